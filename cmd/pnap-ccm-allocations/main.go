@@ -0,0 +1,124 @@
+// pnap-ccm-allocations exports the IP blocks of the Services of a cluster, and imports them into a rebuilt cluster,
+// so that its Services keep their IPs. It uses the credentials and settings of a cloud-provider-phoenixnap config.
+//
+//	pnap-ccm-allocations export --config cloud-sa.json --cluster-id <old kube-system UID> > allocations.json
+//	pnap-ccm-allocations import --config cloud-sa.json --cluster-id <new kube-system UID> < allocations.json
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap"
+)
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "export" && os.Args[1] != "import") {
+		fmt.Fprintf(os.Stderr, "usage: %s export|import [flags]\n", os.Args[0])
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := flags.String("config", "", "path to the cloud-provider-phoenixnap config file; if not set, only the PNAP_* environment variables are used")
+	clusterID := flags.String("cluster-id", "", "ID of the cluster to export from, or to import into: the UID of its kube-system namespace, unless clusterID is configured")
+	file := flags.String("file", "-", "file to write the export to, or to read the import from; - for stdout or stdin")
+	dryRun := flags.Bool("dry-run", false, "import: only report what would be retagged")
+	timeout := flags.Duration("timeout", 5*time.Minute, "timeout for all calls")
+	_ = flags.Parse(os.Args[2:])
+
+	var config io.Reader = strings.NewReader("{}")
+	if *configPath != "" {
+		b, err := os.ReadFile(*configPath)
+		if err != nil {
+			fail(err)
+		}
+		config = bytes.NewReader(b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	switch command {
+	case "export":
+		export(ctx, config, *clusterID, *file)
+	case "import":
+		if !importAllocations(ctx, config, *clusterID, *file, *dryRun) {
+			os.Exit(1)
+		}
+	}
+}
+
+// export writes the allocations of the cluster to file as JSON
+func export(ctx context.Context, config io.Reader, clusterID, file string) {
+	allocations, err := phoenixnap.ExportAllocations(ctx, config, clusterID)
+	if err != nil {
+		fail(err)
+	}
+	b, err := json.MarshalIndent(allocations, "", "  ")
+	if err != nil {
+		fail(err)
+	}
+	b = append(b, '\n')
+	if file == "-" {
+		_, err = os.Stdout.Write(b)
+	} else {
+		err = os.WriteFile(file, b, 0o600)
+	}
+	if err != nil {
+		fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d allocations of cluster %s\n", len(allocations.Allocations), allocations.ClusterID)
+}
+
+// importAllocations reads the allocations from file, retags their blocks for the cluster, and prints a report.
+// It returns false if any failed.
+func importAllocations(ctx context.Context, config io.Reader, clusterID, file string, dryRun bool) bool {
+	var (
+		b   []byte
+		err error
+	)
+	if file == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(file)
+	}
+	if err != nil {
+		fail(err)
+	}
+	var allocations phoenixnap.AllocationExport
+	if err := json.Unmarshal(b, &allocations); err != nil {
+		fail(fmt.Errorf("invalid export: %w", err))
+	}
+	results, err := phoenixnap.ImportAllocations(ctx, config, allocations, clusterID, dryRun)
+	if err != nil {
+		fail(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tBLOCK\tCIDR\tSTATUS\tDETAIL")
+	ok := true
+	for _, result := range results {
+		svc := result.Allocation.Namespace + "/" + result.Allocation.Name
+		if result.Allocation.Secondary {
+			svc += " (secondary)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", svc, result.Allocation.BlockID, result.Allocation.CIDR, result.Status, result.Detail)
+		if result.Status == phoenixnap.ImportFailed {
+			ok = false
+		}
+	}
+	_ = w.Flush()
+	return ok
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(2)
+}
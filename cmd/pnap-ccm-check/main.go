@@ -0,0 +1,56 @@
+// pnap-ccm-check runs safe, read-only checks against the PhoenixNAP API with the credentials
+// and settings of a cloud-provider-phoenixnap config, and prints a compatibility report.
+// Use it before deploying the CCM to a new account.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap"
+)
+
+func main() {
+	configPath := flag.String("config", "", "path to the cloud-provider-phoenixnap config file; if not set, only the PNAP_* environment variables are used")
+	timeout := flag.Duration("timeout", time.Minute, "timeout for all checks")
+	flag.Parse()
+
+	var config io.Reader = strings.NewReader("{}")
+	if *configPath != "" {
+		b, err := os.ReadFile(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		config = bytes.NewReader(b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	results, err := phoenixnap.CheckAccount(ctx, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tCHECK\tSTATUS\tDETAIL")
+	failed := false
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Account, result.Name, result.Status, result.Detail)
+		if result.Status == phoenixnap.CheckFail {
+			failed = true
+		}
+	}
+	_ = w.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
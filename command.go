@@ -0,0 +1,21 @@
+//go:build !cloudprovider_v1_28
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/options"
+	cliflag "k8s.io/component-base/cli/flag"
+)
+
+// The adapters for the cloud-provider module of the version in go.mod and those up to v0.27; build with the tag
+// cloudprovider_v1_28 against v0.28 and later, see command_v1_28.go.
+
+// routeController the name of the route controller, which the CCM does not run
+const routeController = "route"
+
+// newCommand returns the command of the controller manager
+func newCommand(opts *options.CloudControllerManagerOptions, cloudInitializer app.InitCloudFunc, controllerInitializers map[string]app.ControllerInitFuncConstructor, fss cliflag.NamedFlagSets, stop <-chan struct{}) *cobra.Command {
+	return app.NewCloudControllerManagerCommand(opts, cloudInitializer, controllerInitializers, fss, stop)
+}
@@ -0,0 +1,22 @@
+//go:build cloudprovider_v1_28
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/names"
+	"k8s.io/cloud-provider/options"
+	cliflag "k8s.io/component-base/cli/flag"
+)
+
+// The adapters for the cloud-provider module v0.28 and later, whose controllers have new names, with the old ones
+// as aliases; see command.go.
+
+// routeController the name of the route controller, which the CCM does not run
+const routeController = names.NodeRouteController
+
+// newCommand returns the command of the controller manager, which accepts the old controller names in --controllers
+func newCommand(opts *options.CloudControllerManagerOptions, cloudInitializer app.InitCloudFunc, controllerInitializers map[string]app.ControllerInitFuncConstructor, fss cliflag.NamedFlagSets, stop <-chan struct{}) *cobra.Command {
+	return app.NewCloudControllerManagerCommand(opts, cloudInitializer, controllerInitializers, names.CCMControllerAliases(), fss, stop)
+}
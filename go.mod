@@ -9,14 +9,18 @@ require (
 	github.com/phoenixnap/go-sdk-bmc/billingapi v1.3.0
 	github.com/phoenixnap/go-sdk-bmc/bmcapi v1.2.2
 	github.com/phoenixnap/go-sdk-bmc/ipapi v1.1.2
+	github.com/spf13/cobra v1.2.1
 	github.com/spf13/pflag v1.0.5
 	golang.org/x/oauth2 v0.6.0
 	k8s.io/api v0.23.6
 	k8s.io/apimachinery v0.23.6
+	k8s.io/apiserver v0.23.5
 	k8s.io/client-go v0.23.6
 	k8s.io/cloud-provider v0.23.5
 	k8s.io/component-base v0.23.6
 	k8s.io/klog/v2 v2.30.0
+	k8s.io/utils v0.0.0-20211116205334-6203023598ed
+	sigs.k8s.io/yaml v1.2.0
 )
 
 require github.com/phoenixnap/go-sdk-bmc/networkapi v1.1.3
@@ -67,7 +71,6 @@ require (
 	github.com/prometheus/common v0.28.0 // indirect
 	github.com/prometheus/procfs v0.6.0 // indirect
 	github.com/spf13/afero v1.9.3 // indirect
-	github.com/spf13/cobra v1.2.1 // indirect
 	github.com/stretchr/testify v1.8.1 // indirect
 	go.etcd.io/etcd/api/v3 v3.5.5 // indirect
 	go.etcd.io/etcd/client/pkg/v3 v3.5.5 // indirect
@@ -103,13 +106,10 @@ require (
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	k8s.io/apiserver v0.23.5 // indirect
 	k8s.io/component-helpers v0.23.5 // indirect
 	k8s.io/controller-manager v0.23.5 // indirect
 	k8s.io/kube-openapi v0.0.0-20211115234752-e816edb12b65 // indirect
-	k8s.io/utils v0.0.0-20211116205334-6203023598ed // indirect
 	sigs.k8s.io/apiserver-network-proxy/konnectivity-client v0.0.30 // indirect
 	sigs.k8s.io/json v0.0.0-20211020170558-c049b76a60c6 // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.2.1 // indirect
-	sigs.k8s.io/yaml v1.2.0 // indirect
 )
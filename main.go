@@ -19,6 +19,8 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/alerts"
+	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
@@ -33,14 +35,23 @@ func main() {
 	}
 	controllerInitializers := app.DefaultInitFuncConstructors
 	// remove unneeded controllers
-	delete(controllerInitializers, "route")
+	delete(controllerInitializers, routeController)
 	fss := cliflag.NamedFlagSets{
 		NormalizeNameFunc: cliflag.WordSepNormalizeFunc,
 	}
 	pflag.CommandLine.SetNormalizeFunc(cliflag.WordSepNormalizeFunc)
 	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
 
-	command := app.NewCloudControllerManagerCommand(opts, cloudInitializer, controllerInitializers, fss, wait.NeverStop)
+	command := newCommand(opts, cloudInitializer, controllerInitializers, fss, wait.NeverStop)
+	// print the suggested Prometheus rules for the metrics of this version, e.g. for a chart to generate alerts from
+	dumpAlerts := command.Flags().Bool("dump-alerts", false, "Print the suggested Prometheus alerting and recording rules, and exit.")
+	run := command.RunE
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		if *dumpAlerts {
+			return alerts.Dump(os.Stdout)
+		}
+		return run(cmd, args)
+	}
 
 	logs.InitLogs()
 	defer logs.FlushLogs()
@@ -0,0 +1,56 @@
+// Package alerts holds the suggested Prometheus rules for the metrics of the PhoenixNAP cloud controller manager,
+// so that deployment tooling can generate alerts that match the version of the binary, e.g. with its --dump-alerts
+// flag, rather than maintain a copy of them.
+package alerts
+
+import (
+	_ "embed" // for the rule file
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed alerts.yaml
+var ruleFile []byte
+
+// RuleFile a Prometheus rule file
+type RuleFile struct {
+	Groups []Group `json:"groups"`
+}
+
+// Group a group of rules, evaluated together
+type Group struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+// Rule a recording rule, if Record is set, or an alerting rule, if Alert is set
+type Rule struct {
+	Record      string            `json:"record,omitempty"`
+	Alert       string            `json:"alert,omitempty"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Raw returns the rule file as it is embedded, with its comments
+func Raw() []byte {
+	return append([]byte(nil), ruleFile...)
+}
+
+// Rules returns the parsed rule file
+func Rules() (*RuleFile, error) {
+	var rules RuleFile
+	if err := yaml.UnmarshalStrict(ruleFile, &rules); err != nil {
+		return nil, fmt.Errorf("invalid embedded rule file: %w", err)
+	}
+	return &rules, nil
+}
+
+// Dump writes the rule file to w
+func Dump(w io.Writer) error {
+	_, err := w.Write(ruleFile)
+	return err
+}
@@ -0,0 +1,55 @@
+package alerts
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	rules, err := Rules()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules.Groups) == 0 {
+		t.Fatalf("no rule groups")
+	}
+	for _, group := range rules.Groups {
+		for _, rule := range group.Rules {
+			switch {
+			case rule.Expr == "":
+				t.Errorf("rule %s%s has no expression", rule.Record, rule.Alert)
+			case (rule.Record == "") == (rule.Alert == ""):
+				t.Errorf("rule with expression %q must be either a recording or an alerting rule", rule.Expr)
+			case rule.Alert != "" && rule.Labels["severity"] == "":
+				t.Errorf("alert %s has no severity", rule.Alert)
+			case rule.Alert != "" && rule.Annotations["summary"] == "":
+				t.Errorf("alert %s has no summary", rule.Alert)
+			}
+		}
+	}
+}
+
+// TestRulesMetrics checks that the rules only use metrics that exist, so that renaming a metric fails here
+func TestRulesMetrics(t *testing.T) {
+	source, err := os.ReadFile("../metrics.go")
+	if err != nil {
+		t.Fatalf("unable to read metrics: %v", err)
+	}
+	defined := map[string]bool{}
+	for _, match := range regexp.MustCompile(`Name:\s+"([a-z0-9_]+)"`).FindAllStringSubmatch(string(source), -1) {
+		defined["phoenixnap_"+match[1]] = true
+	}
+	for _, used := range regexp.MustCompile(`phoenixnap_[a-z0-9_]+`).FindAllString(string(Raw()), -1) {
+		name := used
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if trimmed := strings.TrimSuffix(used, suffix); defined[trimmed] {
+				name = trimmed
+			}
+		}
+		if !defined[name] {
+			t.Errorf("rules use the metric %s, which is not defined", used)
+		}
+	}
+}
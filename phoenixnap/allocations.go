@@ -0,0 +1,236 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+)
+
+// When a cluster is lost and rebuilt, its IP blocks are still in the account, tagged with the ID of the old cluster,
+// and the rebuilt cluster, with a new ID, would buy new blocks and so new IPs for its Services. The allocations of
+// the old cluster can be exported, while it still runs or from its blocks afterwards, and imported with the ID of the
+// rebuilt cluster, which retags the blocks, so that the Services, once recreated with the same namespaces and names,
+// find their blocks and keep their IPs.
+
+// Allocation the IP block of a Service, as exported for disaster recovery
+type Allocation struct {
+	// Namespace and Name of the Service
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Secondary whether the block is that of the secondary location of the Service
+	Secondary bool `json:"secondary,omitempty"`
+	// BlockID the ID of the IP block
+	BlockID string `json:"blockID"`
+	// CIDR the CIDR of the IP block
+	CIDR string `json:"cidr"`
+	// Location the location of the IP block
+	Location string `json:"location"`
+	// IP the IP of the Service in the block, if it was recorded
+	IP string `json:"ip,omitempty"`
+}
+
+// AllocationExport the allocations of a cluster
+type AllocationExport struct {
+	// ClusterID the ID of the cluster the blocks are tagged with
+	ClusterID   string       `json:"clusterID"`
+	Allocations []Allocation `json:"allocations"`
+}
+
+// ImportStatus the outcome of importing a single allocation
+type ImportStatus string
+
+const (
+	// ImportRetagged the block was retagged for the new cluster, or would be, in a dry run
+	ImportRetagged ImportStatus = "RETAGGED"
+	// ImportUnchanged the block already was tagged for the new cluster, e.g. by an earlier import
+	ImportUnchanged ImportStatus = "UNCHANGED"
+	// ImportFailed the block no longer is that of the Service in the old cluster, or the API failed
+	ImportFailed ImportStatus = "FAILED"
+)
+
+// ImportResult the result of importing a single allocation
+type ImportResult struct {
+	Allocation Allocation
+	Status     ImportStatus
+	// Detail what was done, or why it failed
+	Detail string
+}
+
+// ExportAllocations returns the allocations of the Services of the cluster clusterID, from the IP blocks tagged with
+// its ID, with the credentials and settings of the given provider config. If clusterID is empty, the clusterID of the
+// config is used. It only reads from the API.
+func ExportAllocations(ctx context.Context, providerConfig io.Reader, clusterID string) (*AllocationExport, error) {
+	config, err := getConfig(providerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("provider config error: %w", err)
+	}
+	if clusterID == "" {
+		clusterID = config.ClusterID
+	}
+	if clusterID == "" {
+		return nil, fmt.Errorf("cluster ID is required, the UID of the kube-system namespace unless clusterID is configured")
+	}
+	clients := loadBalancerAPIClients(config)
+	return exportAllocations(ctx, clients.ipClient, config.ownershipTags(), config.TagValuePrefix, clusterID)
+}
+
+// ImportAllocations retags the IP blocks of the allocations in export from the cluster ID of the export to clusterID,
+// the ID of the rebuilt cluster, with the credentials and settings of the given provider config. If clusterID is
+// empty, the clusterID of the config is used. A block is only retagged if it still is that of the Service in the
+// old cluster. With dryRun, nothing is changed. It only returns an error if the config or the IDs are invalid.
+func ImportAllocations(ctx context.Context, providerConfig io.Reader, export AllocationExport, clusterID string, dryRun bool) ([]ImportResult, error) {
+	config, err := getConfig(providerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("provider config error: %w", err)
+	}
+	if clusterID == "" {
+		clusterID = config.ClusterID
+	}
+	switch {
+	case clusterID == "":
+		return nil, fmt.Errorf("cluster ID is required, the UID of the kube-system namespace unless clusterID is configured")
+	case export.ClusterID == "":
+		return nil, fmt.Errorf("export has no cluster ID")
+	}
+	clients := loadBalancerAPIClients(config)
+	return importAllocations(ctx, clients.ipClient, config.ownershipTags(), config.TagValuePrefix, export, clusterID, dryRun), nil
+}
+
+// loadBalancerAPIClients returns the API clients of the account that owns the load balancer location
+func loadBalancerAPIClients(config Config) *apiClients {
+	for _, cred := range config.Credentials {
+		if cred.Location == config.Location {
+			return newAPIClients(cred.ClientID, cred.ClientSecret, config)
+		}
+	}
+	return newAPIClients(config.ClientID, config.ClientSecret, config)
+}
+
+// exportAllocations returns the allocations of the active blocks of the cluster, with the configured ownership tags
+// or the defaults. Blocks that are not those of a Service are skipped.
+func exportAllocations(ctx context.Context, client *ipapi.APIClient, ownership ownershipTags, tagValuePrefix, clusterID string) (*AllocationExport, error) {
+	export := &AllocationExport{ClusterID: clusterID, Allocations: []Allocation{}}
+	seen := map[string]bool{}
+	for _, tags := range []ownershipTags{ownership, defaultOwnershipTags} {
+		blocks, err := listOwnedIPBlocks(ctx, client, tags, clusterID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list IP blocks of cluster %s: %w", clusterID, err)
+		}
+		for _, block := range blocks {
+			if seen[block.Id] || isReleased(block) {
+				continue
+			}
+			seen[block.Id] = true
+			if allocation, ok := blockAllocation(block, tagValuePrefix); ok {
+				export.Allocations = append(export.Allocations, allocation)
+			}
+		}
+	}
+	sort.Slice(export.Allocations, func(i, j int) bool {
+		a, b := export.Allocations[i], export.Allocations[j]
+		if a.Namespace+"/"+a.Name != b.Namespace+"/"+b.Name {
+			return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+		}
+		return !a.Secondary && b.Secondary
+	})
+	return export, nil
+}
+
+// blockAllocation returns the allocation of the block, and false if it is not the block of a Service
+func blockAllocation(block ipapi.IpBlock, tagValuePrefix string) (Allocation, bool) {
+	allocation := Allocation{BlockID: block.Id, CIDR: block.Cidr, Location: block.Location}
+	allocation.IP, _ = blockTagValue(block, assignedIPTag)
+	if svcName, ok := blockTagValue(block, secondaryServiceTag); ok {
+		parts := strings.SplitN(svcName, "/", 2)
+		if len(parts) != 2 {
+			return allocation, false
+		}
+		allocation.Namespace, allocation.Name, allocation.Secondary = parts[0], parts[1], true
+		return allocation, true
+	}
+	namespace, hasNamespace := blockTagValue(block, serviceNamespaceTag)
+	name, hasName := blockTagValue(block, serviceNameTag)
+	if !hasNamespace || !hasName {
+		return allocation, false
+	}
+	// blocks created before the prefix was set do not have it
+	if tagValuePrefix != "" && strings.HasPrefix(namespace, tagValuePrefix) && strings.HasPrefix(name, tagValuePrefix) {
+		namespace, name = namespace[len(tagValuePrefix):], name[len(tagValuePrefix):]
+	}
+	allocation.Namespace, allocation.Name = namespace, name
+	return allocation, true
+}
+
+// importAllocations retags the block of each allocation for the cluster clusterID
+func importAllocations(ctx context.Context, client *ipapi.APIClient, ownership ownershipTags, tagValuePrefix string, export AllocationExport, clusterID string, dryRun bool) []ImportResult {
+	results := make([]ImportResult, 0, len(export.Allocations))
+	for _, allocation := range export.Allocations {
+		status, detail := importAllocation(ctx, client, ownership, tagValuePrefix, allocation, export.ClusterID, clusterID, dryRun)
+		results = append(results, ImportResult{Allocation: allocation, Status: status, Detail: detail})
+	}
+	return results
+}
+
+// importAllocation retags the block of the allocation from the cluster oldID to newID, if it still is that of the
+// Service in the old cluster
+func importAllocation(ctx context.Context, client *ipapi.APIClient, ownership ownershipTags, tagValuePrefix string, allocation Allocation, oldID, newID string, dryRun bool) (ImportStatus, string) {
+	block, resp, err := client.IPBlocksApi.IpBlocksIpBlockIdGet(ctx, allocation.BlockID).Execute()
+	if err != nil {
+		return ImportFailed, fmt.Sprintf("unable to get IP block: %v", providerError(resp, err))
+	}
+	current, ok := blockAllocation(*block, tagValuePrefix)
+	switch {
+	case isReleased(*block):
+		return ImportFailed, "IP block was released, and may be deleted"
+	case block.Cidr != allocation.CIDR:
+		return ImportFailed, fmt.Sprintf("IP block has CIDR %s, not %s", block.Cidr, allocation.CIDR)
+	case !ok || current.Namespace != allocation.Namespace || current.Name != allocation.Name || current.Secondary != allocation.Secondary:
+		return ImportFailed, "IP block no longer is that of the service"
+	}
+
+	// the block may have been created with the configured ownership tags, or with the defaults
+	tags := tagAssignmentsIntoRequests(block.Tags)
+	var retagged, imported bool
+	for _, owner := range []ownershipTags{ownership, defaultOwnershipTags} {
+		if usage, _ := blockTagValue(*block, owner.usage); usage != owner.usageValue {
+			continue
+		}
+		for i := range tags {
+			if tags[i].Name != owner.cluster || tags[i].Value == nil {
+				continue
+			}
+			switch *tags[i].Value {
+			case newID:
+				imported = true
+			case oldID:
+				value := newID
+				tags[i].Value = &value
+				retagged = true
+			}
+		}
+	}
+	switch {
+	case retagged:
+	case imported:
+		return ImportUnchanged, fmt.Sprintf("IP block already is tagged for cluster %s", newID)
+	default:
+		return ImportFailed, fmt.Sprintf("IP block is not tagged for cluster %s", oldID)
+	}
+	// keep the IP of a block tagged before the CCM recorded it
+	if _, ok := blockTagValue(*block, assignedIPTag); !ok && allocation.IP != "" {
+		ip := allocation.IP
+		tags = append(tags, ipapi.TagAssignmentRequest{Name: assignedIPTag, Value: &ip})
+	}
+	detail := fmt.Sprintf("IP block retagged from cluster %s to %s", oldID, newID)
+	if dryRun {
+		return ImportRetagged, "dry run: " + detail
+	}
+	if _, resp, err := client.IPBlocksApi.IpBlocksIpBlockIdTagsPut(ctx, block.Id).TagAssignmentRequest(tags).Execute(); err != nil {
+		return ImportFailed, fmt.Sprintf("unable to retag IP block: %v", providerError(resp, err))
+	}
+	return ImportRetagged, detail
+}
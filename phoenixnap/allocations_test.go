@@ -0,0 +1,129 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExportImportAllocations(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("other", "svc2")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc1, svc2)
+	status1, err := l.EnsureLoadBalancer(context.TODO(), "", svc1, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc2, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a released block is not exported
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	export, err := exportAllocations(context.TODO(), l.ipClient, l.ownership, "", testClusterID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if export.ClusterID != testClusterID || len(export.Allocations) != 1 {
+		t.Fatalf("mismatched export, actual %+v expected 1 allocation of cluster %s", export, testClusterID)
+	}
+	allocation := export.Allocations[0]
+	if allocation.Namespace != "default" || allocation.Name != "svc1" || allocation.IP != status1.Ingress[0].IP {
+		t.Errorf("mismatched allocation, actual %+v expected default/svc1 with IP %s", allocation, status1.Ingress[0].IP)
+	}
+
+	// a dry run changes nothing
+	results := importAllocations(context.TODO(), l.ipClient, l.ownership, "", *export, "rebuilt", true)
+	if len(results) != 1 || results[0].Status != ImportRetagged {
+		t.Fatalf("mismatched dry run results, actual %+v expected %s", results, ImportRetagged)
+	}
+	if blocks, _ := listOwnedIPBlocks(context.TODO(), l.ipClient, l.ownership, "rebuilt"); len(blocks) != 0 {
+		t.Errorf("dry run retagged %d blocks", len(blocks))
+	}
+
+	results = importAllocations(context.TODO(), l.ipClient, l.ownership, "", *export, "rebuilt", false)
+	if len(results) != 1 || results[0].Status != ImportRetagged {
+		t.Fatalf("mismatched import results, actual %+v expected %s", results, ImportRetagged)
+	}
+	// importing again is harmless
+	results = importAllocations(context.TODO(), l.ipClient, l.ownership, "", *export, "rebuilt", false)
+	if len(results) != 1 || results[0].Status != ImportUnchanged {
+		t.Fatalf("mismatched repeated import results, actual %+v expected %s", results, ImportUnchanged)
+	}
+
+	// the rebuilt cluster finds the block of the service, with its IP
+	l.cluster = newClusterIDSource(k8sfake.NewSimpleClientset(), "rebuilt")
+	l.blockCache.invalidate()
+	status, exists, err := l.GetLoadBalancer(context.TODO(), "", svc1)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case !exists:
+		t.Fatalf("expected load balancer to exist in the rebuilt cluster")
+	case status.Ingress[0].IP != status1.Ingress[0].IP:
+		t.Errorf("mismatched IP in the rebuilt cluster, actual %s expected %s", status.Ingress[0].IP, status1.Ingress[0].IP)
+	}
+	if count := testActiveBlocks(backend); count != 1 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 1)
+	}
+}
+
+func TestImportAllocationsChangedBlock(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	export, err := exportAllocations(context.TODO(), l.ipClient, l.ownership, "", testClusterID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*AllocationExport)
+	}{
+		{"other service", func(e *AllocationExport) { e.Allocations[0].Name = "svc2" }},
+		{"other CIDR", func(e *AllocationExport) { e.Allocations[0].CIDR = "192.0.2.0/29" }},
+		{"other cluster", func(e *AllocationExport) { e.ClusterID = "other" }},
+		{"unknown block", func(e *AllocationExport) { e.Allocations[0].BlockID = "unknown" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := AllocationExport{ClusterID: export.ClusterID, Allocations: append([]Allocation(nil), export.Allocations...)}
+			tt.change(&changed)
+			results := importAllocations(context.TODO(), l.ipClient, l.ownership, "", changed, "rebuilt", false)
+			if len(results) != 1 || results[0].Status != ImportFailed {
+				t.Errorf("mismatched results, actual %+v expected %s", results, ImportFailed)
+			}
+		})
+	}
+}
+
+func TestBlockAllocation(t *testing.T) {
+	secondary := "default/svc1"
+	withSecondary := ipapi.IpBlock{Id: "d", Tags: []ipapi.TagAssignment{{Name: secondaryServiceTag, Value: &secondary}}}
+	tests := []struct {
+		name      string
+		block     ipapi.IpBlock
+		prefix    string
+		expected  Allocation
+		isService bool
+	}{
+		{"service", testBlockForService("a", "default", "svc1"), "", Allocation{BlockID: "a", Namespace: "default", Name: "svc1"}, true},
+		{"prefixed", testBlockForService("b", "prod-default", "prod-svc1"), "prod-", Allocation{BlockID: "b", Namespace: "default", Name: "svc1"}, true},
+		{"created before the prefix", testBlockForService("c", "default", "svc1"), "prod-", Allocation{BlockID: "c", Namespace: "default", Name: "svc1"}, true},
+		{"secondary", withSecondary, "", Allocation{BlockID: "d", Namespace: "default", Name: "svc1", Secondary: true}, true},
+		{"not a service", ipapi.IpBlock{Id: "e"}, "", Allocation{BlockID: "e"}, false},
+	}
+	for _, tt := range tests {
+		allocation, ok := blockAllocation(tt.block, tt.prefix)
+		if ok != tt.isService || allocation != tt.expected {
+			t.Errorf("%s: mismatched allocation, actual %+v %t expected %+v %t", tt.name, allocation, ok, tt.expected, tt.isService)
+		}
+	}
+}
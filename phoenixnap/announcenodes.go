@@ -0,0 +1,66 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// announceNodesFromService returns the names of the nodes set by the announce-nodes annotation
+// on the service, or nil if it has none
+func announceNodesFromService(svc *v1.Service) ([]string, error) {
+	value, ok := svc.Annotations[annotationAnnounceNodes]
+	if !ok {
+		return nil, nil
+	}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("annotation %s must be a comma-separated list of node names, %q is not: %s", annotationAnnounceNodes, name, strings.Join(errs, "; "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// announceNodes returns the nodes that may announce the IP of the service: those named in its
+// announce-nodes annotation, or all of nodes if it has none. Named nodes that are not among nodes
+// are reported in a Warning Event; if none of them is, it is an error, as nothing would announce the IP.
+func (l *loadBalancers) announceNodes(svc *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	names, err := announceNodesFromService(svc)
+	if err != nil {
+		if l.recorder != nil {
+			l.recorder.Event(svc, v1.EventTypeWarning, eventReasonInvalidAnnounceNodes, err.Error())
+		}
+		return nil, err
+	}
+	if names == nil {
+		return nodes, nil
+	}
+	byName := map[string]*v1.Node{}
+	for _, node := range nodes {
+		byName[node.Name] = node
+	}
+	var (
+		pinned  []*v1.Node
+		missing []string
+	)
+	for _, name := range names {
+		if node, ok := byName[name]; ok {
+			pinned = append(pinned, node)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 && l.recorder != nil {
+		l.recorder.Event(svc, v1.EventTypeWarning, eventReasonAnnounceNodesNotFound,
+			fmt.Sprintf("nodes %s in annotation %s do not exist, or are not eligible to announce the IP", strings.Join(missing, ", "), annotationAnnounceNodes))
+	}
+	if len(pinned) == 0 {
+		return nil, fmt.Errorf("none of the nodes %s in annotation %s is eligible to announce the IP of service %s", strings.Join(names, ", "), annotationAnnounceNodes, serviceRep(svc))
+	}
+	return pinned, nil
+}
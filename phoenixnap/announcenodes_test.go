@@ -0,0 +1,67 @@
+package phoenixnap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAnnounceNodesFromService(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		names       []string
+		valid       bool
+	}{
+		{nil, nil, true},
+		{map[string]string{annotationAnnounceNodes: "node1"}, []string{"node1"}, true},
+		{map[string]string{annotationAnnounceNodes: "node1, gw.example.com"}, []string{"node1", "gw.example.com"}, true},
+		{map[string]string{annotationAnnounceNodes: ""}, nil, false},
+		{map[string]string{annotationAnnounceNodes: "node1,,node2"}, nil, false},
+		{map[string]string{annotationAnnounceNodes: "Node_1"}, nil, false},
+	}
+	for i, tt := range tests {
+		svc := testService("default", "svc1")
+		svc.Annotations = tt.annotations
+		names, err := announceNodesFromService(svc)
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("%d: unexpected error: %v", i, err)
+		case !tt.valid && err == nil:
+			t.Errorf("%d: expected error", i)
+		case strings.Join(names, ",") != strings.Join(tt.names, ","):
+			t.Errorf("%d: mismatched names, actual %v expected %v", i, names, tt.names)
+		}
+	}
+}
+
+func TestEnsureLoadBalancerAnnounceNodes(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationAnnounceNodes: "node2,gone"}
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+	nodes := []*v1.Node{testNode("phoenixnap://node1", "node1"), testNode("phoenixnap://node2", "node2")}
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := lb.nodes["default/svc1"]; strings.Join(actual, ",") != "node2" {
+		t.Errorf("mismatched nodes, actual %v expected %v", actual, []string{"node2"})
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonAnnounceNodesNotFound) || !strings.Contains(event, "gone") {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+
+	// none of the pinned nodes is eligible
+	svc.Annotations[annotationAnnounceNodes] = "gone"
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nodes); err == nil {
+		t.Errorf("expected error when no pinned node is eligible")
+	}
+}
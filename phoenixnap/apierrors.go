@@ -0,0 +1,86 @@
+package phoenixnap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// apiErrorDetails whether the message in PhoenixNAP API error bodies is added to errors, logs and Events.
+// Set from the config on Initialize.
+var apiErrorDetails = true
+
+// apiErrorBody is implemented by the GenericOpenAPIError of each of the PhoenixNAP SDKs
+type apiErrorBody interface {
+	Body() []byte
+}
+
+// apiErrorPayload the fields of a PhoenixNAP API error body that are safe to report.
+// Anything else in the body is dropped, so it never ends up in logs or Events.
+type apiErrorPayload struct {
+	Message          string   `json:"message"`
+	ValidationErrors []string `json:"validationErrors,omitempty"`
+}
+
+// apiError an SDK error together with the message the PhoenixNAP API returned with it
+type apiError struct {
+	err     error
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%v: %s", e.err, e.message)
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// apiErrorMessage returns the message from the body of a PhoenixNAP API error,
+// or "" if err is not one or the body has no message
+func apiErrorMessage(err error) string {
+	var body apiErrorBody
+	if !errors.As(err, &body) {
+		return ""
+	}
+	var payload apiErrorPayload
+	if err := json.Unmarshal(body.Body(), &payload); err != nil {
+		return ""
+	}
+	message := payload.Message
+	if len(payload.ValidationErrors) > 0 {
+		message = fmt.Sprintf("%s (%s)", message, strings.Join(payload.ValidationErrors, "; "))
+	}
+	return strings.TrimSpace(message)
+}
+
+// withAPIErrorDetails returns err with the message from the PhoenixNAP API error body added,
+// if there is one and apiErrorDetails is enabled, else err unchanged.
+func withAPIErrorDetails(err error) error {
+	if err == nil || !apiErrorDetails {
+		return err
+	}
+	var existing *apiError
+	if errors.As(err, &existing) {
+		return err
+	}
+	message := apiErrorMessage(err)
+	if message == "" {
+		return err
+	}
+	return &apiError{err: err, message: message}
+}
+
+// recordAPIError records a Warning Event on the Service with the message from the PhoenixNAP API error body,
+// so users see why the API rejected the request without reading the CCM logs
+func (l *loadBalancers) recordAPIError(service *v1.Service, err error) {
+	if !apiErrorDetails || l.recorder == nil || service == nil {
+		return
+	}
+	if message := apiErrorMessage(err); message != "" {
+		l.recorder.Event(service, v1.EventTypeWarning, eventReasonProviderAPIError, message)
+	}
+}
@@ -0,0 +1,78 @@
+package phoenixnap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// fipsMode is true in builds with BoringCrypto, which restrict TLS to FIPS-approved settings
+var fipsMode bool
+
+// APITLSConfig TLS settings of the connections to the PhoenixNAP API, e.g. for hardened clusters
+type APITLSConfig struct {
+	// MinVersion the lowest TLS version, "1.2" or "1.3"
+	MinVersion string `json:"minVersion,omitempty"`
+	// CipherSuites the names of the cipher suites for TLS 1.2, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256;
+	// TLS 1.3 suites are not configurable
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+}
+
+// tlsVersions the supported values of MinVersion
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConfig returns the tls.Config for the settings, or an error if a version or cipher suite is unknown.
+// Only secure cipher suites are accepted.
+func (c APITLSConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS minVersion %q, must be 1.2 or 1.3", c.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	if len(c.CipherSuites) == 0 {
+		return config, nil
+	}
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range c.CipherSuites {
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure TLS cipher suite %q", name)
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config, nil
+}
+
+// String the settings, for the startup log
+func (c APITLSConfig) String() string {
+	minVersion := c.MinVersion
+	if minVersion == "" {
+		minVersion = "1.2"
+	}
+	suites := "default"
+	if len(c.CipherSuites) > 0 {
+		suites = strings.Join(c.CipherSuites, ",")
+	}
+	return fmt.Sprintf("min version %s, cipher suites %s, FIPS mode %t", minVersion, suites, fipsMode)
+}
+
+// apiTransport the base transport of the API clients, with the TLS settings applied
+func apiTransport(c APITLSConfig) (http.RoundTripper, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
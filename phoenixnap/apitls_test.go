@@ -0,0 +1,48 @@
+package phoenixnap
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestAPITLSConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     APITLSConfig
+		minVersion uint16
+		suites     []uint16
+		valid      bool
+	}{
+		{"default", APITLSConfig{}, tls.VersionTLS12, nil, true},
+		{"tls 1.3", APITLSConfig{MinVersion: "1.3"}, tls.VersionTLS13, nil, true},
+		{"cipher suites", APITLSConfig{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"}},
+			tls.VersionTLS12, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, true},
+		{"tls 1.1", APITLSConfig{MinVersion: "1.1"}, 0, nil, false},
+		{"unknown suite", APITLSConfig{CipherSuites: []string{"TLS_NO_SUCH_SUITE"}}, 0, nil, false},
+		{"insecure suite", APITLSConfig{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.config.tlsConfig()
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Fatalf("expected error")
+			case !tt.valid:
+				return
+			}
+			if config.MinVersion != tt.minVersion {
+				t.Errorf("mismatched min version, actual %x expected %x", config.MinVersion, tt.minVersion)
+			}
+			if len(config.CipherSuites) != len(tt.suites) {
+				t.Fatalf("mismatched cipher suites, actual %v expected %v", config.CipherSuites, tt.suites)
+			}
+			for i := range tt.suites {
+				if config.CipherSuites[i] != tt.suites[i] {
+					t.Errorf("mismatched cipher suite %d, actual %x expected %x", i, config.CipherSuites[i], tt.suites[i])
+				}
+			}
+		})
+	}
+}
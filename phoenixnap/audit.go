@@ -0,0 +1,59 @@
+package phoenixnap
+
+import (
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Audit Events record on the Namespace of a Service each billable resource that the CCM purchases or releases on
+// its behalf, for chargeback. Unlike the Events on the Service, they outlive it, for as long as Events are kept, and
+// carry the details as annotations, so that a collector need not parse the message.
+
+const (
+	// auditAnnotationService the namespace and name of the Service the resource is for
+	auditAnnotationService = "phoenixnap.com/service"
+	// auditAnnotationGateway the namespace and name of the Gateway the resource is for, instead of a Service
+	auditAnnotationGateway = "phoenixnap.com/gateway"
+	// auditAnnotationResource the type of the resource
+	auditAnnotationResource = "phoenixnap.com/resource-type"
+	// auditAnnotationResourceID the ID of the resource in the PhoenixNAP API
+	auditAnnotationResourceID = "phoenixnap.com/resource-id"
+	// auditAnnotationCIDR the CIDR of an IP block
+	auditAnnotationCIDR = "phoenixnap.com/cidr"
+	// auditAnnotationLocation the location of the resource
+	auditAnnotationLocation = "phoenixnap.com/location"
+)
+
+// auditBlock records an audit Event with reason for block on the Namespace of service, if enabled
+func (l *loadBalancers) auditBlock(service *v1.Service, block ipapi.IpBlock, reason string) {
+	if service == nil {
+		return
+	}
+	l.auditOwnedBlock(service.Namespace, auditAnnotationService, "service", serviceRep(service), block, reason)
+}
+
+// auditOwnedBlock records an audit Event with reason for block on namespace, if enabled, for its owner, the
+// namespace and name of an object of the given kind, which is in the annotation ownerAnnotation
+func (l *loadBalancers) auditOwnedBlock(namespace, ownerAnnotation, kind, owner string, block ipapi.IpBlock, reason string) {
+	if !l.auditEvents || l.recorder == nil {
+		return
+	}
+	ref := &v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: namespace, Namespace: namespace}
+	annotations := map[string]string{
+		ownerAnnotation:           owner,
+		auditAnnotationResource:   "ip-block",
+		auditAnnotationResourceID: block.Id,
+		auditAnnotationCIDR:       block.Cidr,
+		auditAnnotationLocation:   block.Location,
+	}
+	var verb string
+	switch reason {
+	case eventReasonIPBlockPurchased:
+		verb = "purchased"
+	case eventReasonIPBlockReleased:
+		verb = "released"
+	}
+	l.recorder.AnnotatedEventf(ref, annotations, v1.EventTypeNormal, reason, "%s IP block %s (%s) in %s for %s %s",
+		verb, block.Id, block.Cidr, block.Location, kind, owner)
+}
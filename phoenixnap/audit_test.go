@@ -0,0 +1,70 @@
+package phoenixnap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+)
+
+// testDrainEvents returns the events recorded so far
+func testDrainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func testCountEvents(events []string, reason string) int {
+	var count int
+	for _, event := range events {
+		if strings.Contains(event, reason) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestAuditEvents(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+	l.auditEvents = true
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a repeated call purchases nothing
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := testDrainEvents(recorder)
+	if count := testCountEvents(events, eventReasonIPBlockPurchased); count != 1 {
+		t.Errorf("mismatched purchase events, actual %d expected %d: %v", count, 1, events)
+	}
+
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events = testDrainEvents(recorder)
+	if count := testCountEvents(events, eventReasonIPBlockReleased); count != 1 {
+		t.Errorf("mismatched release events, actual %d expected %d: %v", count, 1, events)
+	}
+}
+
+func TestAuditEventsDisabled(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := testCountEvents(testDrainEvents(recorder), eventReasonIPBlockPurchased); count != 0 {
+		t.Errorf("mismatched purchase events, actual %d expected %d", count, 0)
+	}
+}
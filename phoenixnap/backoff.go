@@ -0,0 +1,62 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// newBackoff an exponential backoff starting at initial, doubling up to maxDelay, with 10% jitter,
+// for at most attempts calls
+func newBackoff(initial, maxDelay time.Duration, attempts int) wait.Backoff {
+	return wait.Backoff{
+		Duration: initial,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    attempts,
+		Cap:      maxDelay,
+	}
+}
+
+// retry calls fn until it succeeds, returns an error that is not retriable, backoff.Steps attempts
+// are used up, or ctx is done. Between attempts, it waits for the next step of backoff.
+// It returns the last error of fn, or the error of ctx if it is done while waiting.
+func retry(ctx context.Context, backoff wait.Backoff, op string, fn func() error) error {
+	attempts := backoff.Steps
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !retriable(err) || ctx.Err() != nil || attempt >= attempts {
+			return err
+		}
+		delay := backoff.Step()
+		klog.V(2).Infof("%s failed, attempt %d of %d, retrying in %s: %v", op, attempt, attempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retriable returns true if err may go away by calling again: the IP block is not ready yet,
+// or the PhoenixNAP API failed or is rate limiting. Calls short-circuited by the circuit breaker
+// are not retried, as it will not let them through before its cooldown.
+func retriable(err error) bool {
+	if errors.Is(err, errBlockPending) {
+		return true
+	}
+	if errors.Is(err, ErrProviderAPIUnavailable) || strings.Contains(err.Error(), ErrProviderAPIUnavailable.Error()) {
+		return false
+	}
+	switch ReasonForError(err) {
+	case ErrorReasonUnavailable, ErrorReasonRateLimited:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	backoff := newBackoff(time.Millisecond, 2*time.Millisecond, 3)
+	tests := []struct {
+		err   error
+		calls int
+	}{
+		{nil, 1},
+		{providerErrorf(ErrorReasonUnavailable, "502 Bad Gateway"), 3},
+		{providerErrorf(ErrorReasonRateLimited, "429 Too Many Requests"), 3},
+		{fmt.Errorf("block is creating: %w", errBlockPending), 3},
+		{providerErrorf(ErrorReasonNotFound, "404 Not Found"), 1},
+		{providerErrorf(ErrorReasonConflict, "409 Conflict"), 1},
+		{providerErrorf(ErrorReasonUnavailable, "Get \"https://api\": %s", ErrProviderAPIUnavailable), 1},
+	}
+	for i, tt := range tests {
+		calls := 0
+		err := retry(context.TODO(), backoff, "test", func() error {
+			calls++
+			return tt.err
+		})
+		if calls != tt.calls {
+			t.Errorf("%d: mismatched calls, actual %d expected %d", i, calls, tt.calls)
+		}
+		if err != tt.err {
+			t.Errorf("%d: mismatched error, actual %v expected %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	calls := 0
+	err := retry(context.TODO(), newBackoff(time.Millisecond, time.Millisecond, 5), "test", func() error {
+		calls++
+		if calls < 3 {
+			return providerErrorf(ErrorReasonUnavailable, "503 Service Unavailable")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %d calls and error %v", calls, err)
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	calls := 0
+	err := retry(ctx, newBackoff(time.Hour, time.Hour, 5), "test", func() error {
+		calls++
+		cancel()
+		return providerErrorf(ErrorReasonUnavailable, "503 Service Unavailable")
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("expected a single failed call, got %d calls and error %v", calls, err)
+	}
+	// a call with a done context is not retried, whatever its error
+	calls = 0
+	err = retry(ctx, newBackoff(time.Millisecond, time.Millisecond, 5), "test", func() error {
+		calls++
+		return providerErrorf(ErrorReasonUnavailable, "Get \"https://api\": %v", ctx.Err())
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("expected a single failed call, got %d calls and error %v", calls, err)
+	}
+}
@@ -0,0 +1,58 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	"k8s.io/klog/v2"
+)
+
+// errBlockPending the IP block is still being provisioned, and has no usable CIDR yet
+var errBlockPending = errors.New("IP block is not ready")
+
+// blockPending returns true if the block is still being provisioned, so its CIDR cannot be relied on
+func blockPending(block ipapi.IpBlock) bool {
+	status := blockStatus(block)
+	return block.Cidr == "" || status == blockStatusCreating || status == blockStatusSubdividing
+}
+
+// blockPrefix parses the CIDR of the block. It returns errBlockPending if the block is not ready.
+func blockPrefix(block ipapi.IpBlock) (netip.Prefix, error) {
+	if blockPending(block) {
+		return netip.Prefix{}, fmt.Errorf("block %s has status %q and CIDR %q: %w", block.Id, block.Status, block.Cidr, errBlockPending)
+	}
+	prefix, err := netip.ParsePrefix(block.Cidr)
+	if err != nil {
+		klog.V(2).Infof("invalid CIDR %s: %s", block.Cidr, err)
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR in block %s: %w", block.Cidr, err)
+	}
+	return prefix, nil
+}
+
+// waitForBlock gets the block until it is no longer pending, backing off between attempts.
+// Once the attempts are used up, the returned error wraps errBlockPending, so the Service is retried later.
+func (l *loadBalancers) waitForBlock(ctx context.Context, block *ipapi.IpBlock) (*ipapi.IpBlock, error) {
+	if !blockPending(*block) {
+		return block, nil
+	}
+	id, location := block.Id, block.Location
+	err := retry(ctx, l.blockReadyBackoff, "waiting for block "+id, func() error {
+		latest, err := l.getIPBlock(ctx, location, id)
+		if err != nil {
+			return fmt.Errorf("unable to get block %s: %w", id, err)
+		}
+		l.blockCache.invalidate()
+		block = latest
+		if blockPending(*block) {
+			return fmt.Errorf("block %s has status %q and CIDR %q: %w", id, block.Status, block.Cidr, errBlockPending)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
@@ -0,0 +1,116 @@
+package phoenixnap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+)
+
+func TestEnsureLoadBalancerPendingBlock(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	ready := *blocks[0]
+	pending := ready
+	pending.Cidr = ""
+	pending.Status = blockStatusCreating
+	if err := backend.UpdateIPBlock(&pending); err != nil {
+		t.Fatalf("unable to update IP block: %v", err)
+	}
+	l.blockCache.invalidate()
+
+	// a pending block is not an error, the load balancer just does not exist yet
+	if _, exists, err := l.GetLoadBalancer(context.TODO(), "", svc); err != nil || exists {
+		t.Errorf("expected load balancer not to exist without error, got exists %v error %v", exists, err)
+	}
+
+	// the block never becomes ready
+	_, err = l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if !errors.Is(err, errBlockPending) {
+		t.Fatalf("expected %v, got %v", errBlockPending, err)
+	}
+
+	// the block becomes ready while waiting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := backend.UpdateIPBlock(&ready); err != nil {
+			t.Errorf("unable to update IP block: %v", err)
+		}
+	}()
+	status2, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case status2.Ingress[0].IP != status.Ingress[0].IP:
+		t.Errorf("mismatched IP, actual %s expected %s", status2.Ingress[0].IP, status.Ingress[0].IP)
+	}
+}
+
+func TestEnsureLoadBalancerWaitsForNewBlock(t *testing.T) {
+	svc := testService("default", "svc1")
+	var (
+		backend         *store.Memory
+		assignedPending int32
+	)
+	// new blocks are created pending, and become ready shortly after
+	createPending := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			// before the creation of blocks, whose path it ends with
+			case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/public-networks/"+testNetworkID+"/ip-blocks"):
+				blocks, _ := backend.ListIPBlocks()
+				for _, block := range blocks {
+					if blockPending(*block) {
+						atomic.AddInt32(&assignedPending, 1)
+					}
+				}
+			case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/ip-blocks"):
+				rec := httptest.NewRecorder()
+				next.ServeHTTP(rec, r)
+				var ready ipapi.IpBlock
+				if err := json.Unmarshal(rec.Body.Bytes(), &ready); err != nil {
+					t.Errorf("unable to decode created IP block: %v", err)
+				}
+				pending := ready
+				pending.Cidr = ""
+				pending.Status = blockStatusCreating
+				_ = backend.UpdateIPBlock(&pending)
+				time.AfterFunc(50*time.Millisecond, func() { _ = backend.UpdateIPBlock(&ready) })
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(rec.Code)
+				_ = json.NewEncoder(w).Encode(pending)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	l, backend, _ := testGetLoadBalancersWithHandler(t, 0, createPending, svc)
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case len(status.Ingress) != 1 || status.Ingress[0].IP == "":
+		t.Fatalf("expected a single ingress IP, got %v", status.Ingress)
+	}
+	if assignedPending != 0 {
+		t.Errorf("block assigned to network while pending")
+	}
+}
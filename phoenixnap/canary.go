@@ -0,0 +1,112 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog/v2"
+)
+
+// The canary is an early warning that provisioning load balancers is broken, e.g. because the account ran out of
+// IP blocks or the implementation does not accept the IPs, before a user notices a Service stuck in Pending. It
+// runs the full cycle of a Service of type=LoadBalancer periodically: it creates a Service, ensures its load
+// balancer, which purchases an IP block and announces it, then deletes it and the Service again. The Service has
+// a loadBalancerClass of its own, so that the service controller leaves it to the canary.
+
+// canaryService returns the Service of the canary, in the namespace
+func canaryService(namespace string) *v1.Service {
+	class := canaryLoadBalancerClass
+	allocateNodePorts := false
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      canaryServiceName,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": canaryLoadBalancerClass},
+		},
+		Spec: v1.ServiceSpec{
+			Type:                          v1.ServiceTypeLoadBalancer,
+			LoadBalancerClass:             &class,
+			AllocateLoadBalancerNodePorts: &allocateNodePorts,
+			// selects no pods, nothing is served
+			Selector: map[string]string{"app.kubernetes.io/managed-by": canaryLoadBalancerClass},
+			Ports: []v1.ServicePort{
+				{Name: "canary", Protocol: v1.ProtocolTCP, Port: 80, TargetPort: intstr.FromInt(80)},
+			},
+		},
+	}
+}
+
+// runCanary runs a cycle of the canary, and returns the first error. The load balancer and the Service are
+// deleted even if ensuring the load balancer failed.
+func (l *loadBalancers) runCanary(ctx context.Context) error {
+	services := l.k8sclient.CoreV1().Services(l.namespace)
+	svc, err := services.Create(ctx, canaryService(l.namespace), metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// left over by a canary that did not finish, e.g. because the CCM restarted
+		svc, err = services.Get(ctx, canaryServiceName, metav1.GetOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create canary service: %w", err)
+	}
+	nodes, err := l.balancerNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	_, ensureErr := l.EnsureLoadBalancer(ctx, "", svc, nodes)
+	canaryDuration.WithLabelValues("ensure").Observe(time.Since(start).Seconds())
+	if ensureErr != nil {
+		ensureErr = fmt.Errorf("unable to ensure the load balancer of the canary: %w", ensureErr)
+	}
+
+	start = time.Now()
+	deleteErr := l.EnsureLoadBalancerDeleted(ctx, "", svc)
+	canaryDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
+	if deleteErr != nil {
+		if ensureErr != nil {
+			return ensureErr
+		}
+		// keep the Service, so that the next cycle releases its IP block
+		return fmt.Errorf("unable to delete the load balancer of the canary: %w", deleteErr)
+	}
+	if err := services.Delete(ctx, canaryServiceName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("unable to delete canary service: %v", err)
+	}
+	return ensureErr
+}
+
+// startCanary runs a cycle of the canary every interval, until the loadBalancers are stopped
+func (l *loadBalancers) startCanary(interval time.Duration) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping canary")
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.WithTimeout(l.ctx, canaryTimeoutSeconds*time.Second)
+			err := l.runCanary(ctx)
+			cancel()
+			if err != nil {
+				klog.Errorf("load balancer canary failed: %v", err)
+				canaryRunsTotal.WithLabelValues("failure").Inc()
+				continue
+			}
+			klog.V(2).Info("load balancer canary succeeded")
+			canaryRunsTotal.WithLabelValues("success").Inc()
+			canaryLastSuccess.SetToCurrentTime()
+		}
+	}()
+}
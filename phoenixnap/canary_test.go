@@ -0,0 +1,69 @@
+package phoenixnap
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunCanary(t *testing.T) {
+	l, backend, _ := testGetLoadBalancers(t, 0)
+
+	if err := l.runCanary(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) == 0 {
+		t.Errorf("canary did not purchase an IP block")
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 0)
+	}
+	if _, err := l.k8sclient.CoreV1().Services(metav1.NamespaceSystem).Get(context.TODO(), canaryServiceName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("canary service not deleted: %v", err)
+	}
+}
+
+func TestRunCanaryNamespace(t *testing.T) {
+	// the canary runs in the namespace of the implementation
+	l, _, _ := testGetLoadBalancers(t, 0)
+	l.namespace = "lb-system"
+
+	if err := l.runCanary(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var created []string
+	for _, action := range l.k8sclient.(*k8sfake.Clientset).Actions() {
+		if action.GetVerb() == "create" && action.GetResource().Resource == "services" {
+			created = append(created, action.GetNamespace())
+		}
+	}
+	if len(created) != 1 || created[0] != "lb-system" {
+		t.Errorf("mismatched namespaces of the canary service, actual %v expected %v", created, []string{"lb-system"})
+	}
+}
+
+func TestRunCanaryFailure(t *testing.T) {
+	l, _, _ := testGetLoadBalancersWithHandler(t, 0, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/ip-blocks") {
+				http.Error(w, `{"message":"out of IP blocks"}`, http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	if err := l.runCanary(context.TODO()); err == nil {
+		t.Fatalf("expected error when no IP block can be purchased")
+	}
+	// nothing was left behind, so the service is deleted
+	if _, err := l.k8sclient.CoreV1().Services(metav1.NamespaceSystem).Get(context.TODO(), canaryServiceName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("canary service not deleted: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// featureSourceRanges the capability to restrict clients to spec.loadBalancerSourceRanges
+	featureSourceRanges = "sourceRanges"
+	// featureProxyProtocol the capability to send the PROXY protocol header
+	featureProxyProtocol = "proxyProtocol"
+	// featureHealthCheck the capability to check the health of backends
+	featureHealthCheck = "healthCheck"
+	// featureProxy the capability to proxy connections, with the ingress in proxy mode and probed backends
+	featureProxy = "proxy"
+	// featureSecondaryLocation the capability to announce a second IP of a Service, from another location
+	featureSecondaryLocation = "secondaryLocation"
+)
+
+// ignoredFeature a feature a service uses that the implementation cannot honor
+type ignoredFeature struct {
+	// feature the capability, as in the metrics, e.g. SCTP or proxyProtocol
+	feature string
+	// field the fields of the service that use it
+	field string
+}
+
+// validateCapabilities returns an error if the implementation declares a feature without
+// implementing the interface to configure it
+func validateCapabilities(impl loadbalancers.LB) error {
+	caps := impl.Capabilities()
+	if _, ok := impl.(loadbalancers.ProxyProtocolSetter); caps.ProxyProtocol && !ok {
+		return fmt.Errorf("declares %s, but does not implement SetProxyProtocol", featureProxyProtocol)
+	}
+	if _, ok := impl.(loadbalancers.HealthChecker); caps.HealthCheck && !ok {
+		return fmt.Errorf("declares %s, but does not implement SetHealthCheck", featureHealthCheck)
+	}
+	if _, ok := impl.(loadbalancers.SecondaryAnnouncer); caps.SecondaryLocation && !ok {
+		return fmt.Errorf("declares %s, but does not implement AddSecondaryIP", featureSecondaryLocation)
+	}
+	if len(caps.Protocols) == 0 {
+		return fmt.Errorf("declares no protocols")
+	}
+	return nil
+}
+
+// recordCapabilities sets the capability metric for each known capability of the implementation
+func recordCapabilities(scheme string, caps loadbalancers.Capabilities) {
+	set := func(capability string, supported bool) {
+		value := 0.0
+		if supported {
+			value = 1
+		}
+		implementorCapability.WithLabelValues(scheme, capability).Set(value)
+	}
+	for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP} {
+		set(string(protocol), caps.Supports(protocol))
+	}
+	set(featureSourceRanges, caps.SourceRanges)
+	set(featureProxyProtocol, caps.ProxyProtocol)
+	set(featureHealthCheck, caps.HealthCheck)
+	set(featureProxy, caps.Proxy)
+	set(featureSecondaryLocation, caps.SecondaryLocation)
+}
+
+// ignoredFeatures returns the features of the service that the implementation with the given
+// capabilities cannot honor. Invalid annotations are not listed, they are reported on their own.
+func ignoredFeatures(svc *v1.Service, caps loadbalancers.Capabilities) []ignoredFeature {
+	var ignored []ignoredFeature
+	for i, port := range svc.Spec.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = v1.ProtocolTCP
+		}
+		if !caps.Supports(protocol) {
+			ignored = append(ignored, ignoredFeature{string(protocol), fmt.Sprintf("spec.ports[%d].protocol %s", i, protocol)})
+		}
+	}
+	if len(svc.Spec.LoadBalancerSourceRanges) > 0 && !caps.SourceRanges {
+		ignored = append(ignored, ignoredFeature{featureSourceRanges, "spec.loadBalancerSourceRanges"})
+	}
+	if enabled, err := proxyProtocolFromService(svc); err == nil && enabled && !caps.ProxyProtocol {
+		ignored = append(ignored, ignoredFeature{featureProxyProtocol, "annotation " + annotationProxyProtocol})
+	}
+	if check, err := healthCheckFromService(svc); err == nil && check != nil && !caps.HealthCheck {
+		ignored = append(ignored, ignoredFeature{featureHealthCheck, "annotations " + annotationHealthCheckPort + ", " + annotationHealthCheckPath + ", " + annotationHealthCheckInterval})
+	}
+	if hostname, err := proxyHostnameFromService(svc); err == nil && hostname != "" && !caps.Proxy {
+		ignored = append(ignored, ignoredFeature{featureProxy, "annotation " + annotationLoadBalancerHostname})
+	}
+	if probe, err := probeBackendsFromService(svc); err == nil && probe && !caps.Proxy {
+		ignored = append(ignored, ignoredFeature{featureProxy, "annotation " + annotationProbeBackends})
+	}
+	if secondary, err := secondaryLocationFromService(svc); err == nil && secondary && !caps.SecondaryLocation {
+		ignored = append(ignored, ignoredFeature{featureSecondaryLocation, "annotation " + annotationSecondaryLocation})
+	}
+	return ignored
+}
+
+// warnIgnoredFeatures records a Warning Event listing the fields of the service that the
+// implementation cannot honor, if any, and counts them in the metrics
+func (l *loadBalancers) warnIgnoredFeatures(svc *v1.Service) {
+	ignored := ignoredFeatures(svc, l.implementor.Capabilities())
+	if len(ignored) == 0 {
+		return
+	}
+	fields := make([]string, 0, len(ignored))
+	for _, f := range ignored {
+		fields = append(fields, f.field)
+		serviceFeaturesIgnoredTotal.WithLabelValues(l.implementorScheme, f.feature).Inc()
+	}
+	if l.recorder != nil {
+		l.recorder.Event(svc, v1.EventTypeWarning, eventReasonFeaturesIgnored,
+			fmt.Sprintf("the load balancer implementation %s does not support, and ignores: %s", l.implementorScheme, strings.Join(fields, "; ")))
+	}
+}
@@ -0,0 +1,117 @@
+package phoenixnap
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestIgnoredFeatures(t *testing.T) {
+	tcpUDP := loadbalancers.Capabilities{Protocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP}}
+	all := loadbalancers.Capabilities{Protocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP}, SourceRanges: true, ProxyProtocol: true, HealthCheck: true}
+	tests := []struct {
+		name        string
+		ports       []v1.ServicePort
+		ranges      []string
+		annotations map[string]string
+		caps        loadbalancers.Capabilities
+		ignored     []string
+	}{
+		{"none", []v1.ServicePort{{Port: 80}, {Port: 53, Protocol: v1.ProtocolUDP}}, nil, nil, tcpUDP, nil},
+		{"sctp", []v1.ServicePort{{Port: 80}, {Port: 9000, Protocol: v1.ProtocolSCTP}}, nil, nil, tcpUDP, []string{"spec.ports[1].protocol SCTP"}},
+		{"source ranges", nil, []string{"10.0.0.0/8"}, nil, tcpUDP, []string{"spec.loadBalancerSourceRanges"}},
+		{"proxy protocol", nil, nil, map[string]string{annotationProxyProtocol: "true"}, tcpUDP, []string{"annotation " + annotationProxyProtocol}},
+		{"proxy protocol disabled", nil, nil, map[string]string{annotationProxyProtocol: "false"}, tcpUDP, nil},
+		{"invalid proxy protocol", nil, nil, map[string]string{annotationProxyProtocol: "maybe"}, tcpUDP, nil},
+		{"health check", nil, nil, map[string]string{annotationHealthCheckPort: "30080"}, tcpUDP, []string{"annotations " + annotationHealthCheckPort + ", " + annotationHealthCheckPath + ", " + annotationHealthCheckInterval}},
+		{"all supported", []v1.ServicePort{{Port: 9000, Protocol: v1.ProtocolSCTP}}, []string{"10.0.0.0/8"}, map[string]string{annotationProxyProtocol: "true", annotationHealthCheckPort: "30080"}, all, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := testService("default", "svc1")
+			svc.Spec.Ports = tt.ports
+			svc.Spec.LoadBalancerSourceRanges = tt.ranges
+			svc.Annotations = tt.annotations
+			var fields []string
+			for _, f := range ignoredFeatures(svc, tt.caps) {
+				fields = append(fields, f.field)
+			}
+			if !reflect.DeepEqual(fields, tt.ignored) {
+				t.Errorf("mismatched ignored features, actual %v expected %v", fields, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestEnsureLoadBalancerWarnsIgnoredFeatures(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Spec.Ports = []v1.ServicePort{{Port: 9000, Protocol: v1.ProtocolSCTP}}
+	svc.Spec.LoadBalancerSourceRanges = []string{"10.0.0.0/8"}
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		for _, s := range []string{eventReasonFeaturesIgnored, "spec.ports[0].protocol SCTP", "spec.loadBalancerSourceRanges"} {
+			if !strings.Contains(event, s) {
+				t.Errorf("event %q does not contain %q", event, s)
+			}
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+	if v, _ := testutil.GetCounterMetricValue(serviceFeaturesIgnoredTotal.WithLabelValues(loadBalancerTypeKubeVIP, string(v1.ProtocolSCTP))); v < 1 {
+		t.Errorf("ignored SCTP not counted")
+	}
+	if v, _ := testutil.GetGaugeMetricValue(implementorCapability.WithLabelValues(loadBalancerTypeKubeVIP, string(v1.ProtocolTCP))); v != 1 {
+		t.Errorf("mismatched TCP capability, actual %v expected %v", v, 1)
+	}
+	if v, _ := testutil.GetGaugeMetricValue(implementorCapability.WithLabelValues(loadBalancerTypeKubeVIP, featureProxyProtocol)); v != 0 {
+		t.Errorf("mismatched PROXY protocol capability, actual %v expected %v", v, 0)
+	}
+}
+
+// testDeclaringLB an implementation that declares the given capabilities, without implementing any optional interface
+type testDeclaringLB struct {
+	testRecordingLB
+	caps loadbalancers.Capabilities
+}
+
+func (t *testDeclaringLB) Capabilities() loadbalancers.Capabilities {
+	return t.caps
+}
+
+func TestValidateCapabilities(t *testing.T) {
+	tcp := []v1.Protocol{v1.ProtocolTCP}
+	tests := []struct {
+		name  string
+		impl  loadbalancers.LB
+		valid bool
+	}{
+		{"plain", &testDeclaringLB{caps: loadbalancers.Capabilities{Protocols: tcp, SourceRanges: true}}, true},
+		{"no protocols", &testDeclaringLB{}, false},
+		{"proxy protocol not implemented", &testDeclaringLB{caps: loadbalancers.Capabilities{Protocols: tcp, ProxyProtocol: true}}, false},
+		{"health check not implemented", &testDeclaringLB{caps: loadbalancers.Capabilities{Protocols: tcp, HealthCheck: true}}, false},
+		{"proxy protocol implemented", &testProxyProtocolLB{}, true},
+		{"health check implemented", &testHealthCheckLB{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCapabilities(tt.impl)
+			switch {
+			case tt.valid && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Cluster API (CAPI) creates a Machine for each node. Its infrastructure provider sets the
+// Machine's spec.providerID, which is also the provider ID of the Node. Infrastructure providers
+// often use forms other than phoenixnap://<server-id>, with an empty host, and optionally the
+// location of the server, e.g. phoenixnap:///<server-id> or phoenixnap:///<location>/<server-id>.
+// The helpers here translate all of them to server IDs, so that nodes created by a PhoenixNAP
+// CAPI provider resolve to their servers.
+
+// serverIDFromProviderPath returns the server ID in path, the part of a providerID after
+// phoenixnap://. It accepts <server-id>, /<server-id> and /<location>/<server-id>.
+func serverIDFromProviderPath(path string) (string, error) {
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return parts[0], nil
+	case len(parts) == 2 && parts[0] == "" && parts[1] != "":
+		return parts[1], nil
+	case len(parts) == 3 && parts[0] == "" && parts[1] != "" && parts[2] != "":
+		return parts[2], nil
+	}
+	return "", fmt.Errorf("unexpected providerID path %q, should be 'server-id', '/server-id' or '/location/server-id'", path)
+}
+
+// nodeServerID returns the ID of the server of node, from its provider ID in any of the accepted
+// forms, or else from its server ID annotation. If it has neither, it returns an empty string.
+func nodeServerID(node *v1.Node) (string, error) {
+	if node.Spec.ProviderID != "" {
+		return serverIDFromProviderID(node.Spec.ProviderID)
+	}
+	return node.Annotations[annotationServerID], nil
+}
+
+// nodeHasServer whether node is the node of server: by the server ID of the node, or, if it has
+// none, by the node name matching the hostname of the server.
+func nodeHasServer(node *v1.Node, server *bmcapi.Server) bool {
+	id, err := nodeServerID(node)
+	switch {
+	case err != nil:
+		return false
+	case id != "":
+		return id == server.Id
+	default:
+		return node.Name == server.Hostname
+	}
+}
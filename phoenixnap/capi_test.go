@@ -0,0 +1,107 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServerIDFromCAPIProviderID(t *testing.T) {
+	tests := []struct {
+		providerID string
+		id         string
+		err        bool
+	}{
+		{"phoenixnap://abc", "abc", false},
+		{"phoenixnap:///abc", "abc", false},
+		{"phoenixnap:///SEA/abc", "abc", false},
+		{"abc", "abc", false},
+		{"phoenixnap://", "", true},
+		{"phoenixnap:///", "", true},
+		{"phoenixnap:///SEA/", "", true},
+		{"phoenixnap://SEA/abc", "", true},
+		{"phoenixnap:///a/b/c", "", true},
+		{"aws:///us-east-1a/abc", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.providerID, func(t *testing.T) {
+			id, err := serverIDFromProviderID(tt.providerID)
+			switch {
+			case (err != nil) != tt.err:
+				t.Errorf("mismatched errors, actual %v expected error %v", err, tt.err)
+			case id != tt.id:
+				t.Errorf("mismatched ID, actual %s expected %s", id, tt.id)
+			}
+		})
+	}
+}
+
+func TestNodeHasServer(t *testing.T) {
+	server := &bmcapi.Server{Id: "abc", Hostname: "host1"}
+	annotated := testNode("", "node1")
+	annotated.Annotations = map[string]string{annotationServerID: "abc"}
+	otherAnnotated := testNode("", "host1")
+	otherAnnotated.Annotations = map[string]string{annotationServerID: "def"}
+	tests := []struct {
+		name string
+		node *v1.Node
+		has  bool
+	}{
+		{"provider ID", testNode("phoenixnap://abc", "node1"), true},
+		{"CAPI provider ID", testNode("phoenixnap:///SEA/abc", "node1"), true},
+		{"other provider ID", testNode("phoenixnap:///SEA/def", "host1"), false},
+		{"invalid provider ID", testNode("aws:///abc", "host1"), false},
+		{"annotation", annotated, true},
+		{"other annotation", otherAnnotated, false},
+		{"hostname", testNode("", "host1"), true},
+		{"other hostname", testNode("", "node1"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if has := nodeHasServer(tt.node, server); has != tt.has {
+				t.Errorf("mismatched result, actual %v expected %v", has, tt.has)
+			}
+		})
+	}
+}
+
+func TestInstanceMetadataCAPI(t *testing.T) {
+	vc, backend := testGetValidCloud(t, "")
+	inst, _ := vc.InstancesV2()
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+
+	// a node of a Cluster API machine, named differently than its server
+	annotated := testNode("", "machine-node")
+	annotated.ObjectMeta = metav1.ObjectMeta{
+		Name:        "machine-node",
+		Annotations: map[string]string{annotationCAPIMachine: "machine-1", annotationServerID: server.Id},
+	}
+	tests := []struct {
+		name string
+		node *v1.Node
+	}{
+		{"provider ID with location", testNode("phoenixnap:///"+validLocationName+"/"+server.Id, "machine-node")},
+		{"provider ID without host", testNode("phoenixnap:///"+server.Id, "machine-node")},
+		{"server ID annotation", annotated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := inst.InstanceMetadata(context.TODO(), tt.node)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := providerIDFromServer(server); md.ProviderID != expected {
+				t.Errorf("mismatched provider ID, actual %s expected %s", md.ProviderID, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/billingapi"
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// productCatalog caches the server products of the billing API, to describe the instance type
+// of each server by more than its product code
+type productCatalog struct {
+	client *billingapi.APIClient
+	// ttl how long the products are used before they are listed again
+	ttl   time.Duration
+	clock clock.PassiveClock
+
+	mutex    sync.Mutex
+	products map[string]billingapi.ServerProduct
+	fetched  time.Time
+}
+
+func newProductCatalog(client *billingapi.APIClient) *productCatalog {
+	return &productCatalog{client: client, ttl: productCatalogRefreshSeconds * time.Second, clock: clock.RealClock{}}
+}
+
+// serverProduct returns the server product with the given code, listing the products again
+// once the cached ones are older than the ttl. If listing fails, the cached products are used.
+// It returns nil if there is no such product.
+func (c *productCatalog) serverProduct(ctx context.Context, code string) (*billingapi.ServerProduct, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.products == nil || c.clock.Since(c.fetched) > c.ttl {
+		if err := c.refresh(ctx); err != nil {
+			if c.products == nil {
+				return nil, err
+			}
+			klog.V(2).Infof("unable to refresh product catalog, using products from %s: %v", c.fetched.Format(time.RFC3339), err)
+		}
+	}
+	product, ok := c.products[code]
+	if !ok {
+		return nil, nil
+	}
+	return &product, nil
+}
+
+// refresh lists the server products; must be called with the mutex held
+func (c *productCatalog) refresh(ctx context.Context) error {
+	list, resp, err := c.client.ProductsApi.ProductsGet(ctx).ProductCategory(serverCategory).Execute()
+	if err != nil {
+		return fmt.Errorf("unable to list server products: %w", providerError(resp, err))
+	}
+	products := map[string]billingapi.ServerProduct{}
+	for _, item := range list {
+		if item.ServerProduct != nil {
+			products[item.ServerProduct.ProductCode] = *item.ServerProduct
+		}
+	}
+	c.products = products
+	c.fetched = c.clock.Now()
+	return nil
+}
+
+// instanceTypeLabels the labels of the instance_type_info metric for a server product in a location
+func instanceTypeLabels(product *billingapi.ServerProduct, location string) map[string]string {
+	metadata := product.Metadata
+	hourly := ""
+	for _, plan := range product.Plans {
+		if plan.Location == location && plan.PricingModel == pricingModelHourly {
+			hourly = strconv.FormatFloat(float64(plan.Price), 'f', 2, 32)
+			break
+		}
+	}
+	return map[string]string{
+		"instance_type": product.ProductCode,
+		"location":      location,
+		"cpu":           metadata.Cpu,
+		"cores":         strconv.FormatFloat(float64(metadata.CpuCount*metadata.CoresPerCpu), 'f', -1, 32),
+		"ram_gb":        strconv.FormatFloat(float64(metadata.RamInGb), 'f', -1, 32),
+		"hourly_price":  hourly,
+	}
+}
+
+// recordInstanceType sets the instance_type_info metric for the product of the server, if known
+func (i *instances) recordInstanceType(ctx context.Context, server *bmcapi.Server) {
+	product, err := i.catalog.serverProduct(ctx, server.Type)
+	switch {
+	case err != nil:
+		klog.V(2).Infof("unable to describe instance type %s: %v", server.Type, err)
+	case product == nil:
+		klog.V(2).Infof("instance type %s of server %s not found in product catalog", server.Type, server.Id)
+	default:
+		instanceTypeInfo.With(instanceTypeLabels(product, server.Location)).Set(1)
+	}
+}
+
+// validateProductCatalog lists the server products once, and warns about servers of the given accounts
+// whose type is not among them. It returns false if the products cannot be listed, e.g. because the
+// credentials are not permitted to call the billing API.
+func validateProductCatalog(ctx context.Context, catalog *productCatalog, bmcClients []*bmcapi.APIClient) bool {
+	catalog.mutex.Lock()
+	err := catalog.refresh(ctx)
+	products := catalog.products
+	catalog.mutex.Unlock()
+	if err != nil {
+		klog.Warningf("product catalog disabled, instance types will not be described: %v", err)
+		return false
+	}
+	klog.V(2).Infof("product catalog has %d server products", len(products))
+	for _, client := range bmcClients {
+		servers, resp, err := client.ServersApi.ServersGet(ctx).Execute()
+		if err != nil {
+			klog.V(2).Infof("unable to list servers to validate their products: %v", providerError(resp, err))
+			continue
+		}
+		for _, server := range servers {
+			if _, ok := products[server.Type]; !ok {
+				klog.Warningf("type %s of server %s is not a server product in the billing API", server.Type, server.Id)
+			}
+		}
+	}
+	return true
+}
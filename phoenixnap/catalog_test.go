@@ -0,0 +1,119 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/billingapi"
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+
+	"k8s.io/component-base/metrics/testutil"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestProductCatalog(t *testing.T) {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	ts := httptest.NewServer(fake.CreateHandler())
+	t.Cleanup(ts.Close)
+	bmc, billing, _, _, _, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	plans := []billingapi.PricingPlan{
+		{Sku: "sku-1", Location: location, PricingModel: pricingModelHourly, Price: 0.5, PriceUnit: billingapi.HOUR},
+		{Sku: "sku-2", Location: location, PricingModel: "ONE_MONTH_RESERVATION", Price: 300, PriceUnit: billingapi.MONTH},
+	}
+	if _, err := backend.CreateProduct(validProductName, serverCategory, plans); err != nil {
+		t.Fatalf("unable to create product: %v", err)
+	}
+	if err := backend.SetProductMetadata(validProductName, *billingapi.NewServerProductMetadata(64, "Dual Silver 4210R", 2, 10, 2.4, "2x10Gbps", "2x1TB NVMe")); err != nil {
+		t.Fatalf("unable to set product metadata: %v", err)
+	}
+	server, err := backend.CreateServer(testGetNewServerName(), validProductName, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+
+	inst := newInstances(bmc)
+	inst.catalog = newProductCatalog(billing)
+	clock := testingclock.NewFakeClock(time.Now())
+	inst.catalog.clock = clock
+	if _, err := inst.InstanceMetadata(context.TODO(), testNode(fmt.Sprintf("phoenixnap://%s", server.Id), server.Hostname)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	labels := map[string]string{
+		"instance_type": validProductName,
+		"location":      location,
+		"cpu":           "Dual Silver 4210R",
+		"cores":         "20",
+		"ram_gb":        "64",
+		"hourly_price":  "0.50",
+	}
+	if info, err := testutil.GetGaugeMetricValue(instanceTypeInfo.With(labels)); err != nil || info != 1 {
+		t.Errorf("mismatched instance type info, actual %v expected 1 (%v)", info, err)
+	}
+
+	// cached until the ttl expires
+	_ = backend.SetProductMetadata(validProductName, *billingapi.NewServerProductMetadata(128, "Dual Gold 6258R", 2, 28, 2.7, "2x25Gbps", "4x2TB NVMe"))
+	product, err := inst.catalog.serverProduct(context.TODO(), validProductName)
+	if err != nil || product == nil {
+		t.Fatalf("unexpected product %v, error %v", product, err)
+	}
+	if product.Metadata.RamInGb != 64 {
+		t.Errorf("mismatched cached RAM, actual %v expected 64", product.Metadata.RamInGb)
+	}
+	clock.Step(inst.catalog.ttl + time.Second)
+	product, _ = inst.catalog.serverProduct(context.TODO(), validProductName)
+	if product == nil || product.Metadata.RamInGb != 128 {
+		t.Errorf("expected refreshed product with 128GB RAM, got %v", product)
+	}
+
+	// unknown products are not an error
+	if product, err := inst.catalog.serverProduct(context.TODO(), "nosuchproduct"); err != nil || product != nil {
+		t.Errorf("unexpected product %v, error %v", product, err)
+	}
+}
+
+func TestValidateProductCatalog(t *testing.T) {
+	// enabled when the billing API can be called
+	vc, _ := testGetValidCloud(t, "")
+	if vc.instances.catalog == nil {
+		t.Errorf("expected product catalog to be enabled")
+	}
+
+	// disabled when the credentials may not call the billing API
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	handler := fake.CreateHandler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/billing/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	bmc, billing, _, _, _, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	if validateProductCatalog(context.TODO(), newProductCatalog(billing), []*bmcapi.APIClient{bmc}) {
+		t.Errorf("expected product catalog to be disabled")
+	}
+}
@@ -0,0 +1,201 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CheckStatus the outcome of a single account check
+type CheckStatus string
+
+const (
+	// CheckPass the check succeeded
+	CheckPass CheckStatus = "PASS"
+	// CheckWarn the check succeeded, but found something that may need attention
+	CheckWarn CheckStatus = "WARN"
+	// CheckFail the check failed; the CCM would not work with this account
+	CheckFail CheckStatus = "FAIL"
+)
+
+// CheckResult the result of a single read-only check against the PhoenixNAP API
+type CheckResult struct {
+	// Account the account checked, "default" or the location of per-location credentials
+	Account string
+	// Name what was checked
+	Name   string
+	Status CheckStatus
+	// Detail what was found, or why the check failed
+	Detail string
+}
+
+// CheckAccount runs safe, read-only checks against the PhoenixNAP API with the credentials
+// and settings of the given provider config, for the default account and every set of
+// per-location credentials. It only returns an error if the config itself is invalid.
+func CheckAccount(ctx context.Context, providerConfig io.Reader) ([]CheckResult, error) {
+	config, err := getConfig(providerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("provider config error: %w", err)
+	}
+	// the load balancer location is served by the account that owns it
+	lbAccount := checkAccountDefault
+	for _, cred := range config.Credentials {
+		if cred.Location == config.Location {
+			lbAccount = cred.Location
+		}
+	}
+	results := checkClients(ctx, checkAccountDefault, newAPIClients(config.ClientID, config.ClientSecret, config), config, lbAccount == checkAccountDefault)
+	for _, cred := range config.Credentials {
+		clients := newAPIClients(cred.ClientID, cred.ClientSecret, config)
+		results = append(results, checkClients(ctx, cred.Location, clients, config, lbAccount == cred.Location)...)
+	}
+	return results, nil
+}
+
+// checkClients runs the checks for the account of the given clients. The load balancer
+// and PodCIDR networks are only checked for the account that owns the load balancer location.
+func checkClients(ctx context.Context, account string, clients *apiClients, config Config, lbAccount bool) []CheckResult {
+	results := []CheckResult{checkServers(ctx, account, clients, config)}
+	// the credentials are rejected outright; every other call would fail the same way
+	if results[0].Status == CheckFail && strings.Contains(results[0].Detail, checkTokenError) {
+		return results
+	}
+	results = append(results, checkIPBlocks(ctx, account, clients), checkTags(ctx, account, clients, config.ownershipTags()))
+	if lbAccount {
+		results = append(results, checkPublicNetwork(ctx, account, clients, config))
+		if config.PodCIDRNetwork != "" {
+			results = append(results, checkPrivateNetwork(ctx, account, clients, config.PodCIDRNetwork))
+		}
+	}
+	return results
+}
+
+// checkServers lists the servers of the account, and the locations they are in
+func checkServers(ctx context.Context, account string, clients *apiClients, config Config) CheckResult {
+	result := CheckResult{Account: account, Name: "list servers"}
+	servers, resp, err := clients.bmcClient.ServersApi.ServersGet(ctx).Execute()
+	if err != nil {
+		return failedCheck(result, "bmc.read", providerError(resp, err))
+	}
+	counts := map[string]int{}
+	for _, server := range servers {
+		counts[server.Location]++
+	}
+	locations := make([]string, 0, len(counts))
+	for location, count := range counts {
+		locations = append(locations, fmt.Sprintf("%s: %d", location, count))
+	}
+	sort.Strings(locations)
+	result.Status = CheckPass
+	result.Detail = fmt.Sprintf("%d servers", len(servers))
+	if len(locations) > 0 {
+		result.Detail += " (" + strings.Join(locations, ", ") + ")"
+	}
+	location := config.Location
+	if account != checkAccountDefault {
+		location = account
+	}
+	if location != "" && counts[location] == 0 {
+		result.Status = CheckWarn
+		result.Detail += fmt.Sprintf("; no servers in location %s", location)
+	}
+	return result
+}
+
+// checkIPBlocks lists the IP blocks of the account
+func checkIPBlocks(ctx context.Context, account string, clients *apiClients) CheckResult {
+	result := CheckResult{Account: account, Name: "list IP blocks"}
+	blocks, resp, err := clients.ipClient.IPBlocksApi.IpBlocksGet(ctx).Execute()
+	if err != nil {
+		return failedCheck(result, "bmc.read", providerError(resp, err))
+	}
+	result.Status = CheckPass
+	result.Detail = fmt.Sprintf("%d IP blocks", len(blocks))
+	if len(blocks) > ipBlockListWarnSize {
+		result.Status = CheckWarn
+		result.Detail += fmt.Sprintf("; more than %d, see \"Accounts with Many IP Blocks\"", ipBlockListWarnSize)
+	}
+	return result
+}
+
+// checkTags lists the tags of the account, and reports ownership tags that do not exist yet
+func checkTags(ctx context.Context, account string, clients *apiClients, ownership ownershipTags) CheckResult {
+	result := CheckResult{Account: account, Name: "list tags"}
+	tags, resp, err := clients.tagClient.TagsApi.TagsGet(ctx).Execute()
+	if err != nil {
+		return failedCheck(result, "tags.read", providerError(resp, err))
+	}
+	found := map[string]bool{}
+	for _, tag := range tags {
+		found[tag.Name] = true
+	}
+	var missing []string
+	for _, name := range []string{ownership.usage, ownership.cluster} {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	result.Status = CheckPass
+	result.Detail = fmt.Sprintf("%d tags", len(tags))
+	if len(missing) > 0 {
+		result.Status = CheckWarn
+		result.Detail += fmt.Sprintf("; %s not found, will be created, which needs the tags scope", strings.Join(missing, ", "))
+	}
+	return result
+}
+
+// checkPublicNetwork gets the public network of the loadbalancer setting, and compares its location
+func checkPublicNetwork(ctx context.Context, account string, clients *apiClients, config Config) CheckResult {
+	result := CheckResult{Account: account, Name: "load balancer public network"}
+	if config.LoadBalancerSetting == "" {
+		result.Status = CheckPass
+		result.Detail = "no load balancer configured"
+		return result
+	}
+	u, err := url.Parse(config.LoadBalancerSetting)
+	if err != nil || u.Host == "" {
+		result.Status = CheckFail
+		result.Detail = fmt.Sprintf("invalid loadbalancer setting %q", config.LoadBalancerSetting)
+		return result
+	}
+	network, resp, err := clients.netClient.PublicNetworksApi.PublicNetworksNetworkIdGet(ctx, u.Host).Execute()
+	if err != nil {
+		return failedCheck(result, "bmc.read", providerError(resp, err))
+	}
+	result.Status = CheckPass
+	result.Detail = fmt.Sprintf("%s (%s) in %s", network.Name, network.Id, network.Location)
+	if config.Location != "" && network.Location != config.Location {
+		result.Status = CheckFail
+		result.Detail += fmt.Sprintf("; expected location %s", config.Location)
+	}
+	return result
+}
+
+// checkPrivateNetwork gets the private network from which PodCIDRs are allocated
+func checkPrivateNetwork(ctx context.Context, account string, clients *apiClients, id string) CheckResult {
+	result := CheckResult{Account: account, Name: "PodCIDR private network"}
+	network, resp, err := clients.netClient.PrivateNetworksApi.PrivateNetworksNetworkIdGet(ctx, id).Execute()
+	if err != nil {
+		return failedCheck(result, "bmc.read", providerError(resp, err))
+	}
+	result.Status = CheckPass
+	result.Detail = fmt.Sprintf("%s (%s) %s in %s", network.Name, network.Id, network.Cidr, network.Location)
+	return result
+}
+
+// failedCheck marks the result as failed, explaining errors that are caused by the credentials
+func failedCheck(result CheckResult, scope string, err error) CheckResult {
+	result.Status = CheckFail
+	switch {
+	case strings.Contains(err.Error(), checkTokenError):
+		result.Detail = fmt.Sprintf("credentials rejected: %v", err)
+	case ReasonForError(err) == ErrorReasonAuth:
+		result.Detail = fmt.Sprintf("not permitted, is the %s scope granted? %v", scope, err)
+	default:
+		result.Detail = err.Error()
+	}
+	return result
+}
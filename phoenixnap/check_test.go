@@ -0,0 +1,103 @@
+package phoenixnap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+)
+
+func TestCheckClients(t *testing.T) {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	_, _ = backend.CreateLocation(validLocationName)
+	_, _ = backend.CreateLocation("PHX")
+	product, err := testGetOrCreateValidServerProduct("s1.c1.small", validLocationName, backend)
+	if err != nil {
+		t.Fatalf("unable to create server product: %v", err)
+	}
+	if _, err := backend.CreateServer("server1", product.ProductCode, validLocationName); err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	public, err := backend.CreatePublicNetwork("lb", validLocationName)
+	if err != nil {
+		t.Fatalf("unable to create public network: %v", err)
+	}
+	elsewhere, err := backend.CreatePublicNetwork("lb-phx", "PHX")
+	if err != nil {
+		t.Fatalf("unable to create public network: %v", err)
+	}
+	private, err := backend.CreatePrivateNetwork("pods", validLocationName, "10.100.0.0/22")
+	if err != nil {
+		t.Fatalf("unable to create private network: %v", err)
+	}
+	if _, err := backend.CreateTag(pnapTag); err != nil {
+		t.Fatalf("unable to create tag: %v", err)
+	}
+	// while denyTags is set, the tag API rejects the credentials, as if the tags.read scope were missing
+	var denyTags atomic.Bool
+	handler := fake.CreateHandler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/tag-manager/") && denyTags.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	bmcClient, _, ipClient, tagClient, netClient, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	clients := &apiClients{bmcClient: bmcClient, ipClient: ipClient, tagClient: tagClient, netClient: netClient}
+
+	tests := []struct {
+		name     string
+		config   Config
+		deny     bool
+		expected map[string]CheckStatus
+	}{
+		{"all pass", Config{Location: validLocationName, LoadBalancerSetting: "kube-vip://" + public.Id, PodCIDRNetwork: private.Id, ClusterTag: pnapTag},
+			false, map[string]CheckStatus{"list servers": CheckPass, "list IP blocks": CheckPass, "list tags": CheckPass, "load balancer public network": CheckPass, "PodCIDR private network": CheckPass}},
+		{"missing tag", Config{Location: validLocationName, LoadBalancerSetting: "kube-vip://" + public.Id},
+			false, map[string]CheckStatus{"list servers": CheckPass, "list IP blocks": CheckPass, "list tags": CheckWarn, "load balancer public network": CheckPass}},
+		{"no servers in location", Config{Location: "PHX", LoadBalancerSetting: "kube-vip://" + elsewhere.Id, ClusterTag: pnapTag},
+			false, map[string]CheckStatus{"list servers": CheckWarn, "list IP blocks": CheckPass, "list tags": CheckPass, "load balancer public network": CheckPass}},
+		{"network in other location", Config{Location: validLocationName, LoadBalancerSetting: "kube-vip://" + elsewhere.Id, ClusterTag: pnapTag},
+			false, map[string]CheckStatus{"list servers": CheckPass, "list IP blocks": CheckPass, "list tags": CheckPass, "load balancer public network": CheckFail}},
+		{"unknown networks", Config{Location: validLocationName, LoadBalancerSetting: "kube-vip://nosuchnetwork", PodCIDRNetwork: "nosuchnetwork", ClusterTag: pnapTag},
+			false, map[string]CheckStatus{"list servers": CheckPass, "list IP blocks": CheckPass, "list tags": CheckPass, "load balancer public network": CheckFail, "PodCIDR private network": CheckFail}},
+		{"no load balancer", Config{Location: validLocationName, ClusterTag: pnapTag},
+			false, map[string]CheckStatus{"list servers": CheckPass, "list IP blocks": CheckPass, "list tags": CheckPass, "load balancer public network": CheckPass}},
+		{"tags not permitted", Config{Location: validLocationName, ClusterTag: pnapTag},
+			true, map[string]CheckStatus{"list servers": CheckPass, "list IP blocks": CheckPass, "list tags": CheckFail, "load balancer public network": CheckPass}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denyTags.Store(tt.deny)
+			results := checkClients(context.TODO(), checkAccountDefault, clients, tt.config, true)
+			if len(results) != len(tt.expected) {
+				t.Fatalf("mismatched number of results, actual %d expected %d: %v", len(results), len(tt.expected), results)
+			}
+			for _, result := range results {
+				if result.Account != checkAccountDefault {
+					t.Errorf("%s: mismatched account %q", result.Name, result.Account)
+				}
+				if expected := tt.expected[result.Name]; result.Status != expected {
+					t.Errorf("%s: mismatched status, actual %s expected %s: %s", result.Name, result.Status, expected, result.Detail)
+				}
+			}
+			if tt.deny && !strings.Contains(results[2].Detail, "tags.read") {
+				t.Errorf("expected the missing scope in the detail, got %q", results[2].Detail)
+			}
+		})
+	}
+}
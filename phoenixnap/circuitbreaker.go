@@ -0,0 +1,126 @@
+package phoenixnap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// ErrProviderAPIUnavailable returned for PhoenixNAP API calls that are not attempted,
+// because the API has been failing consistently.
+var ErrProviderAPIUnavailable = errors.New("provider API unavailable")
+
+// circuitBreaker is an http.RoundTripper that stops calling the PhoenixNAP API once
+// it fails threshold times in a row, so that reconcile loops do not amplify an outage.
+// After cooldown, a single trial call is let through; if it succeeds, calls resume.
+// Opening and closing are reported with a log and an Event.
+type circuitBreaker struct {
+	next      http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+	clock     clock.PassiveClock
+	// clientID identifies the account in messages
+	clientID string
+
+	mutex    sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+	recorder record.EventRecorder
+	// eventObject the object on which Events are recorded, e.g. the kube-system namespace
+	eventObject *v1.ObjectReference
+}
+
+func newCircuitBreaker(next http.RoundTripper, threshold int, cooldown time.Duration) *circuitBreaker {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &circuitBreaker{next: next, threshold: threshold, cooldown: cooldown, clock: clock.RealClock{}}
+}
+
+// RoundTrip implements http.RoundTripper
+func (b *circuitBreaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := b.next.RoundTrip(req)
+	if err != nil && req.Context().Err() != nil {
+		// the caller gave up, e.g. on its timeout or at shutdown, which says nothing about the API
+		b.abandon()
+		return resp, err
+	}
+	b.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+	return resp, err
+}
+
+// setRecorder sets where Events about opening and closing are recorded
+func (b *circuitBreaker) setRecorder(recorder record.EventRecorder, object *v1.ObjectReference) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.recorder = recorder
+	b.eventObject = object
+}
+
+// allow returns an error if the call should not be attempted
+func (b *circuitBreaker) allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.trial || b.clock.Since(b.openedAt) < b.cooldown {
+		apiCircuitBreakerRejectedTotal.Inc()
+		return fmt.Errorf("%w: %d consecutive failures, retrying after %s", ErrProviderAPIUnavailable, b.failures, b.openedAt.Add(b.cooldown).Format(time.RFC3339))
+	}
+	// let a single trial call through
+	b.trial = true
+	return nil
+}
+
+// abandon a call without a result, so that a trial call is let through again
+func (b *circuitBreaker) abandon() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trial = false
+}
+
+// record the result of a call
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	b.trial = false
+	recorder, object := b.recorder, b.eventObject
+	var eventType, reason, msg string
+	switch {
+	case success && b.failures >= b.threshold:
+		eventType, reason = v1.EventTypeNormal, eventReasonProviderAPIAvailable
+		msg = fmt.Sprintf("PhoenixNAP API of client ID %s available again, closing circuit breaker", b.clientID)
+		klog.Info(msg)
+		apiCircuitBreakerOpen.Dec()
+		b.failures = 0
+	case success:
+		b.failures = 0
+	default:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openedAt = b.clock.Now()
+		}
+		if b.failures == b.threshold {
+			eventType, reason = v1.EventTypeWarning, eventReasonProviderAPIUnavailable
+			msg = fmt.Sprintf("PhoenixNAP API of client ID %s failed %d times in a row, opening circuit breaker for %s", b.clientID, b.failures, b.cooldown)
+			klog.Error(msg)
+			apiCircuitBreakerOpen.Inc()
+		}
+	}
+	b.mutex.Unlock()
+
+	if reason != "" && recorder != nil && object != nil {
+		recorder.Event(object, eventType, reason, msg)
+	}
+}
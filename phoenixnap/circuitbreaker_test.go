@@ -0,0 +1,118 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+// roundTripFunc allows a function to be used as an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		calls  int
+		status = http.StatusInternalServerError
+	)
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(status)
+		return rec.Result(), nil
+	})
+	clock := testingclock.NewFakeClock(time.Now())
+	b := newCircuitBreaker(next, 3, time.Hour)
+	b.clock = clock
+	recorder := record.NewFakeRecorder(10)
+	b.setRecorder(recorder, &v1.ObjectReference{Kind: "Namespace", Name: "kube-system"})
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+
+	// failures up to the threshold are passed through
+	for i := 0; i < 3; i++ {
+		if _, err := b.RoundTrip(req); err != nil {
+			t.Fatalf("%d: unexpected error before threshold: %v", i, err)
+		}
+	}
+	// now it is open
+	if _, err := b.RoundTrip(req); !errors.Is(err, ErrProviderAPIUnavailable) {
+		t.Fatalf("expected %v once open, got %v", ErrProviderAPIUnavailable, err)
+	}
+	if calls != 3 {
+		t.Errorf("mismatched calls, actual %d expected %d", calls, 3)
+	}
+	expectEvent(t, recorder, "Warning "+eventReasonProviderAPIUnavailable)
+
+	// still open just before the cooldown is over
+	clock.Step(time.Hour - time.Second)
+	if _, err := b.RoundTrip(req); !errors.Is(err, ErrProviderAPIUnavailable) {
+		t.Fatalf("expected %v during cooldown, got %v", ErrProviderAPIUnavailable, err)
+	}
+
+	// after cooldown, a successful trial closes it
+	clock.Step(time.Second)
+	status = http.StatusOK
+	if _, err := b.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error on trial call: %v", err)
+	}
+	if _, err := b.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error after closing: %v", err)
+	}
+	if calls != 5 {
+		t.Errorf("mismatched calls, actual %d expected %d", calls, 5)
+	}
+	expectEvent(t, recorder, "Normal "+eventReasonProviderAPIAvailable)
+}
+
+func TestCircuitBreakerCanceled(t *testing.T) {
+	var calls int
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, req.Context().Err()
+	})
+	b := newCircuitBreaker(next, 1, time.Hour)
+	recorder := record.NewFakeRecorder(10)
+	b.setRecorder(recorder, &v1.ObjectReference{Kind: "Namespace", Name: "kube-system"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "http://localhost/", nil).WithContext(ctx)
+
+	// calls given up by the caller do not count as failures
+	for i := 0; i < 3; i++ {
+		if _, err := b.RoundTrip(req); !errors.Is(err, context.Canceled) {
+			t.Fatalf("%d: expected %v, got %v", i, context.Canceled, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("mismatched calls, actual %d expected %d", calls, 3)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("unexpected event %q", event)
+	default:
+	}
+}
+
+// expectEvent checks that the next recorded event starts with prefix
+func expectEvent(t *testing.T, recorder *record.FakeRecorder, prefix string) {
+	t.Helper()
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, prefix) {
+			t.Errorf("mismatched event, actual %q expected prefix %q", event, prefix)
+		}
+	default:
+		t.Errorf("missing event %q", prefix)
+	}
+}
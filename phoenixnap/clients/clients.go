@@ -0,0 +1,90 @@
+// Package clients creates the PhoenixNAP API clients of an account, the same way for the provider,
+// its tools and its tests
+package clients
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/phoenixnap/go-sdk-bmc/billingapi"
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
+	"github.com/phoenixnap/go-sdk-bmc/tagapi"
+	"k8s.io/component-base/version"
+)
+
+// Options how the clients are created
+type Options struct {
+	// BaseURL overrides the scheme and host of all APIs, e.g. with the URL of a test double;
+	// if empty, the PhoenixNAP API
+	BaseURL string
+	// Transport the http.RoundTripper of all clients, e.g. one that authenticates the calls;
+	// if nil, http.DefaultTransport, which does not authenticate them
+	Transport http.RoundTripper
+	// UserAgent the User-Agent of all calls; if empty, cloud-provider-phoenixnap and the version
+	UserAgent string
+}
+
+// Set the API clients of a single account, which share one http.Client
+type Set struct {
+	BMC     *bmcapi.APIClient
+	IP      *ipapi.APIClient
+	Tag     *tagapi.APIClient
+	Network *netapi.APIClient
+	Billing *billingapi.APIClient
+}
+
+// New creates the API clients with the given options
+func New(options Options) (*Set, error) {
+	var scheme, host string
+	if options.BaseURL != "" {
+		u, err := url.Parse(options.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL %q: %w", options.BaseURL, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid base URL %q: must have a scheme and host", options.BaseURL)
+		}
+		scheme, host = u.Scheme, u.Host
+	}
+	userAgent := options.UserAgent
+	if userAgent == "" {
+		userAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
+	}
+	httpClient := &http.Client{Transport: options.Transport}
+
+	bmcConfiguration := bmcapi.NewConfiguration()
+	bmcConfiguration.HTTPClient = httpClient
+	bmcConfiguration.UserAgent = userAgent
+	bmcConfiguration.Scheme, bmcConfiguration.Host = scheme, host
+
+	ipConfiguration := ipapi.NewConfiguration()
+	ipConfiguration.HTTPClient = httpClient
+	ipConfiguration.UserAgent = userAgent
+	ipConfiguration.Scheme, ipConfiguration.Host = scheme, host
+
+	tagConfiguration := tagapi.NewConfiguration()
+	tagConfiguration.HTTPClient = httpClient
+	tagConfiguration.UserAgent = userAgent
+	tagConfiguration.Scheme, tagConfiguration.Host = scheme, host
+
+	netConfiguration := netapi.NewConfiguration()
+	netConfiguration.HTTPClient = httpClient
+	netConfiguration.UserAgent = userAgent
+	netConfiguration.Scheme, netConfiguration.Host = scheme, host
+
+	billingConfiguration := billingapi.NewConfiguration()
+	billingConfiguration.HTTPClient = httpClient
+	billingConfiguration.UserAgent = userAgent
+	billingConfiguration.Scheme, billingConfiguration.Host = scheme, host
+
+	return &Set{
+		BMC:     bmcapi.NewAPIClient(bmcConfiguration),
+		IP:      ipapi.NewAPIClient(ipConfiguration),
+		Tag:     tagapi.NewAPIClient(tagConfiguration),
+		Network: netapi.NewAPIClient(netConfiguration),
+		Billing: billingapi.NewAPIClient(billingConfiguration),
+	}, nil
+}
@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testRecordingTransport records the requests it forwards
+type testRecordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *testRecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNew(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	t.Cleanup(ts.Close)
+	transport := &testRecordingTransport{}
+
+	set, err := New(Options{BaseURL: ts.URL, Transport: transport, UserAgent: "test-agent"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := set.BMC.ServersApi.ServersGet(context.TODO()).Execute(); err != nil {
+		t.Fatalf("unexpected error listing servers: %v", err)
+	}
+	if _, _, err := set.IP.IPBlocksApi.IpBlocksGet(context.TODO()).Execute(); err != nil {
+		t.Fatalf("unexpected error listing IP blocks: %v", err)
+	}
+	if len(transport.requests) != 2 {
+		t.Fatalf("mismatched requests through the transport, actual %d expected %d", len(transport.requests), 2)
+	}
+	for _, req := range transport.requests {
+		if req.URL.Host != ts.Listener.Addr().String() {
+			t.Errorf("request to %s, expected the base URL %s", req.URL, ts.URL)
+		}
+		// the SDK adds its own user agent first
+		if agents := req.Header.Values("User-Agent"); !containsString(agents, "test-agent") {
+			t.Errorf("mismatched user agents, actual %v expected to contain %q", agents, "test-agent")
+		}
+	}
+}
+
+func TestNewInvalidBaseURL(t *testing.T) {
+	for _, baseURL := range []string{"localhost:8080", "://", "/path"} {
+		if _, err := New(Options{BaseURL: baseURL}); err == nil {
+			t.Errorf("expected error for base URL %q", baseURL)
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
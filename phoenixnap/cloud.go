@@ -1,17 +1,32 @@
 package phoenixnap
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/phoenixnap/go-sdk-bmc/billingapi"
 	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
 	"github.com/phoenixnap/go-sdk-bmc/ipapi"
 	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
 	"github.com/phoenixnap/go-sdk-bmc/tagapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/clients"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/metadataproxy"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
-	"k8s.io/component-base/version"
 	"k8s.io/klog/v2"
 )
 
@@ -25,29 +40,95 @@ const (
 	tokenURL = "https://auth.phoenixnap.com/auth/realms/BMC/protocol/openid-connect/token"
 )
 
+// defaultAPIScopes the scopes of the API token, unless configured otherwise
+var defaultAPIScopes = []string{"bmc", "bmc.read", "tags", "tags.read"}
+
 // cloud implements cloudprovider.Interface
 type cloud struct {
-	bmcClient    *bmcapi.APIClient
-	ipClient     *ipapi.APIClient
-	tagClient    *tagapi.APIClient
-	netClient    *netapi.APIClient
-	config       Config
-	instances    *instances
-	loadBalancer *loadBalancers
+	bmcClient *bmcapi.APIClient
+	ipClient  *ipapi.APIClient
+	tagClient *tagapi.APIClient
+	netClient *netapi.APIClient
+	// billingClient client of the billing API, for the product catalog
+	billingClient *billingapi.APIClient
+	config        Config
+	instances     *instances
+	loadBalancer  *loadBalancers
+	// locationClients API clients for accounts that own specific locations
+	locationClients map[string]*apiClients
+	// clients the API clients of the default account, if created by newAPIClients
+	clients *apiClients
+	// stop is closed by Close, to stop all background goroutines
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// apiClients the set of PhoenixNAP API clients for a single account
+type apiClients struct {
+	bmcClient     *bmcapi.APIClient
+	ipClient      *ipapi.APIClient
+	tagClient     *tagapi.APIClient
+	netClient     *netapi.APIClient
+	billingClient *billingapi.APIClient
+	// credentials watches for the credentials of the account being rejected
+	credentials *credentialMonitor
+	// breaker short-circuits the calls of the account while the API fails
+	breaker *circuitBreaker
+	// tokens caches and refreshes the API token of the account
+	tokens *tokenMonitor
 }
 
 var _ cloudprovider.Interface = (*cloud)(nil)
 
-func newCloud(pnapConfig Config, bmcClient *bmcapi.APIClient, ipClient *ipapi.APIClient, tagClient *tagapi.APIClient, netClient *netapi.APIClient) (cloudprovider.Interface, error) {
+func newCloud(pnapConfig Config, bmcClient *bmcapi.APIClient, ipClient *ipapi.APIClient, tagClient *tagapi.APIClient, netClient *netapi.APIClient, billingClient *billingapi.APIClient, locationClients map[string]*apiClients) (cloudprovider.Interface, error) {
 	return &cloud{
-		bmcClient: bmcClient,
-		ipClient:  ipClient,
-		tagClient: tagClient,
-		netClient: netClient,
-		config:    pnapConfig,
+		bmcClient:       bmcClient,
+		ipClient:        ipClient,
+		tagClient:       tagClient,
+		netClient:       netClient,
+		billingClient:   billingClient,
+		config:          pnapConfig,
+		locationClients: locationClients,
+		stop:            make(chan struct{}),
 	}, nil
 }
 
+// Clients the PhoenixNAP API clients of one account, for NewCloudProvider to use instead of creating
+// them from the credentials in the Config, e.g. to call another API endpoint, or a test double
+type Clients struct {
+	// Location the location owned by the account, which must have credentials in the Config;
+	// empty for the default account
+	Location string
+	BMC      *bmcapi.APIClient
+	IP       *ipapi.APIClient
+	Tag      *tagapi.APIClient
+	Network  *netapi.APIClient
+	// Billing client of the billing API; if nil, the product catalog is disabled
+	Billing *billingapi.APIClient
+}
+
+// NewCloudProvider creates the provider from the given config, so that it can be embedded in a controller
+// manager or tests without the io.Reader config of the registered provider. The config is processed as if
+// read from a config file, so environment variables override it, and defaults are applied. Accounts for
+// which no Clients are given get clients created from their credentials. As with the registered provider,
+// it is not fully initialized until Initialize is called.
+func NewCloudProvider(config Config, clients ...Clients) (cloudprovider.Interface, error) {
+	// only one of the two forms may be set; both are after processing
+	if config.LoadBalancerConfig != nil && config.LoadBalancerSetting == config.LoadBalancerConfig.URL() {
+		config.LoadBalancerSetting = ""
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("provider config error: %w", err)
+	}
+	pnapConfig, err := getConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("provider config error: %w", err)
+	}
+	return newCloudProvider(pnapConfig, clients)
+}
+
 func init() {
 	cloudprovider.RegisterCloudProvider(ProviderName, func(config io.Reader) (cloudprovider.Interface, error) {
 		// by the time we get here, there is no error, as it would have been handled earlier
@@ -56,67 +137,379 @@ func init() {
 		if err != nil {
 			return nil, fmt.Errorf("provider config error: %w", err)
 		}
+		return newCloudProvider(pnapConfig, nil)
+	})
+}
 
-		// report the config
-		printConfig(pnapConfig)
+// newCloudProvider creates the provider from a processed config, with the given clients, and clients
+// created from the credentials of all other accounts
+func newCloudProvider(pnapConfig Config, given []Clients) (cloudprovider.Interface, error) {
+	locations := map[string]bool{}
+	for _, cred := range pnapConfig.Credentials {
+		locations[cred.Location] = true
+	}
+	givenClients := map[string]*apiClients{}
+	for _, c := range given {
+		if c.Location != "" && !locations[c.Location] {
+			return nil, fmt.Errorf("clients given for location %s, which has no credentials", c.Location)
+		}
+		if _, ok := givenClients[c.Location]; ok {
+			return nil, fmt.Errorf("duplicate clients for location %q", c.Location)
+		}
+		if c.BMC == nil || c.IP == nil || c.Tag == nil || c.Network == nil {
+			return nil, fmt.Errorf("clients for location %q must have the bmc, ip, tag and network clients", c.Location)
+		}
+		givenClients[c.Location] = &apiClients{bmcClient: c.BMC, ipClient: c.IP, tagClient: c.Tag, netClient: c.Network, billingClient: c.Billing}
+	}
 
-		// set up our client and create the cloud interface
+	// report the config
+	printConfig(pnapConfig)
 
-		ccConfig := clientcredentials.Config{
-			ClientID:     pnapConfig.ClientID,
-			ClientSecret: pnapConfig.ClientSecret,
-			TokenURL:     tokenURL,
-			Scopes:       []string{"bmc", "bmc.read", "tags", "tags.read"},
+	// set up our clients and create the cloud interface
+	clients, created := givenClients[""], false
+	if clients == nil {
+		clients, created = newAPIClients(pnapConfig.ClientID, pnapConfig.ClientSecret, pnapConfig), true
+	}
+	locationClients := map[string]*apiClients{}
+	for _, cred := range pnapConfig.Credentials {
+		if c, ok := givenClients[cred.Location]; ok {
+			locationClients[cred.Location] = c
+			continue
 		}
+		locationClients[cred.Location] = newAPIClients(cred.ClientID, cred.ClientSecret, pnapConfig)
+	}
 
-		bmcConfiguration := bmcapi.NewConfiguration()
-		bmcConfiguration.HTTPClient = ccConfig.Client(context.Background())
-		bmcConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-		bmcClient := bmcapi.NewAPIClient(bmcConfiguration)
+	pnapCloud, err := newCloud(pnapConfig, clients.bmcClient, clients.ipClient, clients.tagClient, clients.netClient, clients.billingClient, locationClients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new cloud handler: %w", err)
+	}
+	// only clients created from credentials are verified and have their tokens refreshed
+	if created {
+		pnapCloud.(*cloud).clients = clients
+	}
+	// note that this is not fully initialized until it calls cloud.Initialize()
 
-		ipConfiguration := ipapi.NewConfiguration()
-		ipConfiguration.HTTPClient = ccConfig.Client(context.Background())
-		ipConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-		ipClient := ipapi.NewAPIClient(ipConfiguration)
+	return pnapCloud, nil
+}
 
-		tagConfiguration := tagapi.NewConfiguration()
-		tagConfiguration.HTTPClient = ccConfig.Client(context.Background())
-		tagConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-		tagClient := tagapi.NewAPIClient(tagConfiguration)
+// newAPIClients creates the API clients for a single account, each subsystem limited to its share of calls
+// of APIRateLimits. The token is requested with the APIScopes of the config, or the default scopes if none,
+// and all connections use its APITLS settings and BaseURL, which getConfig has validated.
+func newAPIClients(clientID, clientSecret string, config Config) *apiClients {
+	scopes := config.APIScopes
+	if len(scopes) == 0 {
+		scopes = defaultAPIScopes
+	}
+	base, err := apiTransport(config.APITLS)
+	if err != nil {
+		klog.Fatalf("invalid API TLS settings: %v", err)
+	}
 
-		netConfiguration := netapi.NewConfiguration()
-		netConfiguration.HTTPClient = ccConfig.Client(context.Background())
-		netConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-		netClient := netapi.NewAPIClient(netConfiguration)
+	// all clients of an account share one transport, so an outage trips a single circuit breaker
+	credentials, tokens := newAuthTransport(tokenURL, clientID, clientSecret, scopes, base)
+	httpClient := &http.Client{Transport: credentials}
+	breaker := newCircuitBreaker(httpClient.Transport, circuitBreakerThreshold, circuitBreakerCooldownSeconds*time.Second)
+	breaker.clientID = clientID
+	httpClient.Transport = breaker
+	// calls held back by the rate limit do not reach the circuit breaker
+	httpClient.Transport = newRateLimiter(httpClient.Transport, config.APIRateLimits)
 
-		cloud, err := newCloud(pnapConfig, bmcClient, ipClient, tagClient, netClient)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create new cloud handler: %w", err)
-		}
-		// note that this is not fully initialized until it calls cloud.Initialize()
+	var baseURL string
+	if config.BaseURL != nil {
+		baseURL = *config.BaseURL
+	}
+	set, err := clients.New(clients.Options{BaseURL: baseURL, Transport: httpClient.Transport})
+	if err != nil {
+		klog.Fatalf("invalid API base URL: %v", err)
+	}
+
+	return &apiClients{
+		bmcClient:     set.BMC,
+		ipClient:      set.IP,
+		tagClient:     set.Tag,
+		netClient:     set.Network,
+		billingClient: set.Billing,
+		credentials:   credentials,
+		breaker:       breaker,
+		tokens:        tokens,
+	}
+}
 
-		return cloud, nil
+// newAuthTransport returns the transport that authenticates calls over base with a token of the account, fetched from
+// the token endpoint with the given scopes, which tells rejected credentials apart, and the monitor of the token.
+// The token endpoint is called with the same TLS settings as the API.
+func newAuthTransport(endpoint, clientID, clientSecret string, scopes []string, base http.RoundTripper) (*credentialMonitor, *tokenMonitor) {
+	ccConfig := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     endpoint,
+		Scopes:       scopes,
+	}
+	tokenClient := &http.Client{Transport: base}
+	tokens := newTokenMonitor(clientID, func(ctx context.Context) (*oauth2.Token, error) {
+		return ccConfig.Token(context.WithValue(ctx, oauth2.HTTPClient, tokenClient))
 	})
+	// tell rejected credentials apart before anything else handles the failure
+	credentials := newCredentialMonitor(&oauth2.Transport{Source: tokens, Base: base}, clientID, tokens.tokenContext)
+	return credentials, tokens
+}
+
+// clientsForLocation returns the API clients of the account that owns the given location,
+// or the default account if no specific credentials were given for it.
+func (c *cloud) clientsForLocation(location string) *apiClients {
+	if clients, ok := c.locationClients[location]; ok {
+		return clients
+	}
+	return &apiClients{
+		bmcClient:     c.bmcClient,
+		ipClient:      c.ipClient,
+		tagClient:     c.tagClient,
+		netClient:     c.netClient,
+		billingClient: c.billingClient,
+	}
+}
+
+// accountClients returns the API clients created by newAPIClients of all known accounts, default account first
+func (c *cloud) accountClients() []*apiClients {
+	var clients []*apiClients
+	if c.clients != nil {
+		clients = append(clients, c.clients)
+	}
+	locations := make([]string, 0, len(c.locationClients))
+	for location := range c.locationClients {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	for _, location := range locations {
+		if c.locationClients[location].credentials != nil {
+			clients = append(clients, c.locationClients[location])
+		}
+	}
+	return clients
+}
+
+// bmcClients returns the bmc API clients of all known accounts, default account first
+func (c *cloud) bmcClients() []*bmcapi.APIClient {
+	clients := []*bmcapi.APIClient{c.bmcClient}
+	locations := make([]string, 0, len(c.locationClients))
+	for location := range c.locationClients {
+		locations = append(locations, location)
+	}
+	// keep the order stable, so lookups are predictable
+	sort.Strings(locations)
+	for _, location := range locations {
+		clients = append(clients, c.locationClients[location].bmcClient)
+	}
+	return clients
 }
 
 // Initialize provides the cloud with a kubernetes client builder and may spawn goroutines
 // to perform housekeeping activities within the cloud provider.
 func (c *cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
 	klog.V(5).Info("called Initialize")
-	clientset := clientBuilder.ClientOrDie("cloud-provider-phoenixnap-shared-informers")
+	clientset, err := c.kubeClient(clientBuilder)
+	if err != nil {
+		klog.Fatalf("could not create kubernetes client: %v", err)
+	}
+	apiErrorDetails = !c.config.DisableAPIErrorDetails
 
 	// initialize the individual services
-	lb, err := newLoadBalancers(c.ipClient, c.tagClient, c.netClient, clientset, c.config.Location, c.config.LoadBalancerSetting, c.config.AnnotationIPLocation, c.config.ServiceNodeSelector)
+	// IP blocks and public networks live in the account that owns their location, which is the default one for the
+	// locations without credentials of their own
+	lb, err := newLoadBalancers(c.bmcClients(), c.ipClient, c.tagClient, c.netClient, clientset, c.config.Location, c.config.LoadBalancerSetting, c.config.AnnotationIPLocation, c.config.ServiceNodeSelector, c.config.MaxIPBlocks, c.config.ownershipTags(), c.config.ReconcileErrorAnnotation)
 	if err != nil {
 		klog.Fatalf("could not initialize LoadBalancers: %v", err)
 	}
 
 	c.loadBalancer = lb
-	c.instances = newInstances(c.bmcClient)
+	if lb != nil {
+		lb.locationClients = c.locationClients
+		lb.nodeSelectorFallback = c.config.ServiceNodeSelectorFallback
+		lb.tagValuePrefix = c.config.TagValuePrefix
+		lb.startup = newStartupSync(time.Now(), time.Duration(c.config.StartupSpreadSeconds)*time.Second, c.config.StartupConcurrency)
+		lb.auditEvents = c.config.AuditEvents
+		lb.vipFirewall = c.config.VIPFirewall
+		lb.allocateOnEndpoints = c.config.AllocateOnEndpoints
+		lb.allocateDelay = time.Duration(c.config.AllocateDelaySeconds) * time.Second
+		lb.orphanCleanup = c.config.OrphanCleanup
+		if c.config.SecondaryLocation != "" {
+			lb.secondary = &secondaryLocation{location: c.config.SecondaryLocation, network: c.config.SecondaryNetwork}
+		}
+		// validated by getConfig
+		lb.reaperScope, _ = parseReaperScope(c.config.ReaperScopeTag)
+		lb.reaperConcurrency = c.config.ReaperConcurrency
+		if c.config.IPAMLeaseLock {
+			lb.ipamLock = newLeaseLock(clientset, lb.namespace)
+			lb.ipamLock.clock = lb.clock
+			lb.ipamLock.labels = lb.serviceOwnerLabels
+		}
+	}
+	if lb != nil && c.config.NodeReadyDelaySeconds > 0 {
+		lb.nodeReadyDelay = time.Duration(c.config.NodeReadyDelaySeconds) * time.Second
+	}
+	// backends that failed their probe are held back, and rechecked, as are nodes not Ready for long enough
+	if lb != nil && (lb.nodeReadyDelay > 0 || (lb.implementor != nil && lb.implementor.Capabilities().Proxy)) {
+		lb.startNodeReadyRecheck()
+	}
+	if lb != nil {
+		lb.startImplementorReadiness()
+		lb.startImplementorSync()
+		lb.startOwnerSweeper()
+	}
+	if lb != nil && c.config.OrphanCheckIntervalSeconds > 0 {
+		lb.startOrphanCheck(time.Duration(c.config.OrphanCheckIntervalSeconds) * time.Second)
+	}
+	if lb != nil && c.config.CanaryIntervalSeconds > 0 {
+		lb.startCanary(time.Duration(c.config.CanaryIntervalSeconds) * time.Second)
+	}
+	if c.config.ControlPlaneIP != "" {
+		if lb == nil || lb.implementor == nil {
+			klog.Errorf("control plane IP %s is set, but no load balancer implementation is enabled to announce it", c.config.ControlPlaneIP)
+		} else {
+			lb.startControlPlaneAnnouncer(c.config.ControlPlaneIP)
+		}
+	}
+	if c.config.GatewayController {
+		if lb == nil {
+			klog.Errorf("gateway controller is enabled, but load balancers are not, so Gateways get no IP blocks")
+		} else {
+			client, err := c.dynamicClient(clientBuilder)
+			if err != nil {
+				klog.Fatalf("could not create client of the Gateway API: %v", err)
+			}
+			lb.startGatewayController(client)
+		}
+	}
+	c.instances = newInstances(c.bmcClients()...)
+	c.instances.k8sclient = clientset
+	c.instances.hostnameLabel = c.config.NodeHostnameLabel
+	c.instances.regionFormat = c.config.RegionFormat
+	c.instances.deletionProtection = c.config.NodeDeletionProtection
+	c.instances.ignoreForeignNodes = c.config.IgnoreForeignNodes
+	c.instances.duplicateHostnames = c.config.DuplicateHostnames
+	c.instances.clusterTag = c.config.ownershipTags().cluster
+	if lb != nil {
+		c.instances.cluster = lb.cluster
+	} else {
+		c.instances.cluster = newClusterIDSource(clientset, c.config.ClusterID)
+	}
+	if c.config.InstanceNodeSelector != "" {
+		// validated with the config
+		c.instances.nodeSelector, _ = labels.Parse(c.config.InstanceNodeSelector)
+	}
+	if lb != nil {
+		lb.servers = c.instances.serverByNode
+	}
+	if c.config.StatusResource {
+		client, err := c.dynamicClient(clientBuilder)
+		if err != nil {
+			klog.Fatalf("could not create client of the status resource: %v", err)
+		}
+		status := newSyncStatus()
+		c.instances.status = status
+		if lb != nil {
+			lb.status = status
+		}
+		startStatusPublisher(&c.wg, c.stop, client, status)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	c.instances.recorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventSourceComponent})
+	if c.config.UninitializedNodeDiagnostics {
+		startUninitializedNodeDiagnostics(&c.wg, c.stop, c.instances)
+	}
+	// rejected credentials, and the circuit breaker opening and closing, are reported on the namespace of the CCM;
+	// rejected credentials stop it right away at startup
+	var tokens []*tokenMonitor
+	for _, clients := range c.accountClients() {
+		object := &v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: metav1.NamespaceSystem}
+		clients.credentials.setRecorder(c.instances.recorder, object)
+		clients.breaker.setRecorder(c.instances.recorder, object)
+		ctx, cancel := context.WithTimeout(context.Background(), credentialVerifySeconds*time.Second)
+		clients.credentials.verify(ctx)
+		cancel()
+		tokens = append(tokens, clients.tokens)
+	}
+	startTokenPrefetch(&c.wg, c.stop, tokens)
+	if c.billingClient != nil {
+		catalog := newProductCatalog(c.billingClient)
+		ctx, cancel := context.WithTimeout(context.Background(), productCatalogValidateSeconds*time.Second)
+		if validateProductCatalog(withSubsystem(ctx, subsystemInstances), catalog, c.bmcClients()) {
+			c.instances.catalog = catalog
+		}
+		cancel()
+	}
+
+	// allocate PodCIDRs, if enabled; the private network lives in the account of the location
+	if c.config.PodCIDRNetwork != "" {
+		allocator := &podCIDRAllocator{
+			k8sclient: clientset,
+			netClient: c.clientsForLocation(c.config.Location).netClient,
+			network:   c.config.PodCIDRNetwork,
+			maskSize:  c.config.PodCIDRMaskSize,
+		}
+		allocator.start(&c.wg, c.stop)
+	}
+
+	// start the metadata proxy, if enabled
+	if c.config.MetadataProxyAddress != "" {
+		proxy := &metadataproxy.Proxy{
+			BMCClient: c.bmcClient,
+			K8sClient: clientset,
+			CertFile:  c.config.MetadataProxyCertFile,
+			KeyFile:   c.config.MetadataProxyKeyFile,
+		}
+		if lb != nil {
+			proxy.PendingDeletions = lb.pendingDeletions.list
+			proxy.IPBlocks = lb.listAllClusterIPBlocks
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			if err := proxy.Run(c.config.MetadataProxyAddress, c.stop); err != nil {
+				klog.Errorf("metadata proxy failed: %v", err)
+			}
+		}()
+	}
+
+	// serve /readyz, and pprof next to it, if enabled
+	if c.config.ReadinessAddress != "" {
+		startReadyz(&c.wg, c.stop, c.config.ReadinessAddress, lb, c.config.Pprof)
+	}
+
+	// shut everything down when the controller manager stops
+	go func() {
+		select {
+		case <-stop:
+			_ = c.Close()
+		case <-c.stop:
+		}
+	}()
 
 	klog.Info("Initialize of cloud provider complete")
 }
 
+// Close stops all background activity of the cloud provider: the load balancer reaper,
+// the metadata proxy, and any in-flight load balancer API calls. It waits for them to exit.
+// It is called when the stop channel passed to Initialize is closed, and may be called
+// directly by anything embedding the provider. It is safe to call more than once.
+func (c *cloud) Close() error {
+	c.stopOnce.Do(func() {
+		klog.V(2).Info("stopping cloud provider")
+		close(c.stop)
+		if c.loadBalancer != nil {
+			c.loadBalancer.close()
+		}
+		c.wg.Wait()
+	})
+	return nil
+}
+
+// Stop is the same as Close, for callers that do not care about the error
+func (c *cloud) Stop() {
+	_ = c.Close()
+}
+
 // LoadBalancer returns a balancer interface. Also returns true if the interface is supported, false otherwise.
 func (c *cloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
 	klog.V(5).Info("called LoadBalancer")
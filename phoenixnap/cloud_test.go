@@ -1,8 +1,6 @@
 package phoenixnap
 
 import (
-	"context"
-	"fmt"
 	"net/http/httptest"
 	"net/url"
 	"testing"
@@ -12,6 +10,7 @@ import (
 	"github.com/phoenixnap/go-sdk-bmc/ipapi"
 	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
 	"github.com/phoenixnap/go-sdk-bmc/tagapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/clients"
 	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
 	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
 
@@ -19,7 +18,6 @@ import (
 	k8sfake "k8s.io/client-go/kubernetes/fake"
 	restclient "k8s.io/client-go/rest"
 	cloudprovider "k8s.io/cloud-provider"
-	"k8s.io/component-base/version"
 )
 
 const (
@@ -48,7 +46,7 @@ func (m mockControllerClientBuilder) ClientOrDie(name string) clientset.Interfac
 }
 
 type apiServerError struct {
-	t *testing.T
+	t testing.TB
 }
 
 func (a *apiServerError) Error(err error) {
@@ -72,7 +70,7 @@ func testGetValidCloud(t *testing.T, LoadBalancerSetting string) (*cloud, *store
 	url, _ := url.Parse(ts.URL)
 	urlString := url.String()
 
-	bmc, _, ip, tag, netClient, err := constructClients(token, urlString)
+	bmc, billing, ip, tag, netClient, err := constructClients(token, urlString)
 	if err != nil {
 		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
 	}
@@ -81,9 +79,10 @@ func testGetValidCloud(t *testing.T, LoadBalancerSetting string) (*cloud, *store
 	config := Config{
 		LoadBalancerSetting: LoadBalancerSetting,
 	}
-	c, _ := newCloud(config, bmc, ip, tag, netClient)
+	c, _ := newCloud(config, bmc, ip, tag, netClient, billing, nil)
 	ccb := &mockControllerClientBuilder{}
 	c.Initialize(ccb, nil)
+	t.Cleanup(c.(*cloud).Stop)
 
 	return c.(*cloud), backend
 }
@@ -181,62 +180,97 @@ func TestHasClusterID(t *testing.T) {
 
 }
 
-// builds a phoenixnap client
-func constructClients(authToken, baseURL string) (bmc *bmcapi.APIClient, billing *billingapi.APIClient, ip *ipapi.APIClient, tag *tagapi.APIClient, netClient *netapi.APIClient, err error) {
-	// set up our client and create the cloud interface
+func TestClientsForLocation(t *testing.T) {
+	vc, _ := testGetValidCloud(t, "")
+	other := &apiClients{}
+	vc.locationClients = map[string]*apiClients{"PHX": other}
 
-	var u *url.URL
-	u, err = url.Parse(baseURL)
-	if err != nil {
-		return
+	if clients := vc.clientsForLocation("PHX"); clients != other {
+		t.Errorf("location PHX did not return its own clients")
 	}
+	if clients := vc.clientsForLocation(validLocationName); clients.ipClient != vc.ipClient {
+		t.Errorf("location %s did not return the default clients", validLocationName)
+	}
+	if clients := vc.bmcClients(); len(clients) != 2 || clients[0] != vc.bmcClient {
+		t.Errorf("bmcClients returned %v, expected default client first followed by 1 more", clients)
+	}
+}
 
-	// these are for overriding oauth
-	//nolint: revive // because the consuming client specifically checks for the string "accessToken"
-	ctx := context.WithValue(context.Background(), "accessToken", "RANDOMSTRING")
-	//nolint: revive // because the consuming client specifically checks for the string "serverIndex"
-	ctx = context.WithValue(ctx, "serverIndex", nil)
-
-	bmcConfiguration := bmcapi.NewConfiguration()
-	bmcConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-
-	// these are for changing the server target
-	bmcConfiguration.Host = u.Host
-	bmcConfiguration.Scheme = u.Scheme
-	bmc = bmcapi.NewAPIClient(bmcConfiguration)
-
-	billingConfiguration := billingapi.NewConfiguration()
-	billingConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-
-	// these are for changing the server target
-	billingConfiguration.Host = u.Host
-	billingConfiguration.Scheme = u.Scheme
-	billing = billingapi.NewAPIClient(billingConfiguration)
-
-	ipConfiguration := ipapi.NewConfiguration()
-	ipConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-
-	// these are for changing the server target
-	ipConfiguration.Host = u.Host
-	ipConfiguration.Scheme = u.Scheme
-	ip = ipapi.NewAPIClient(ipConfiguration)
-
-	tagConfiguration := tagapi.NewConfiguration()
-	tagConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
-
-	// these are for changing the server target
-	tagConfiguration.Host = u.Host
-	tagConfiguration.Scheme = u.Scheme
-	tag = tagapi.NewAPIClient(tagConfiguration)
+func TestNewCloudProvider(t *testing.T) {
+	bmc, billing, ip, tag, netClient, err := constructClients(token, "http://localhost")
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	given := Clients{BMC: bmc, IP: ip, Tag: tag, Network: netClient, Billing: billing}
+	config := Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Location:     validLocationName,
+		Credentials:  []LocationCredentials{{Location: "PHX", ClientID: "phx-id", ClientSecret: "phx-secret"}},
+	}
 
-	netConfiguration := netapi.NewConfiguration()
-	netConfiguration.UserAgent = fmt.Sprintf("cloud-provider-phoenixnap/%s", version.Get())
+	provider, err := NewCloudProvider(config, given)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := provider.(*cloud)
+	t.Cleanup(c.Stop)
+	if c.bmcClient != bmc || c.billingClient != billing {
+		t.Errorf("given clients not used for the default account")
+	}
+	// defaults are applied as for a config file
+	if c.config.UsageTag != pnapTag || c.config.PodCIDRMaskSize != defaultPodCIDRMaskSize {
+		t.Errorf("defaults not applied, usage tag %q, PodCIDR mask size %d", c.config.UsageTag, c.config.PodCIDRMaskSize)
+	}
+	// the location without given clients gets them from its credentials
+	if phx := c.locationClients["PHX"]; phx == nil || phx.credentials == nil {
+		t.Errorf("clients not created for location PHX")
+	}
+	if accounts := c.accountClients(); len(accounts) != 1 {
+		t.Errorf("mismatched accounts with credentials, actual %d expected %d", len(accounts), 1)
+	}
 
-	// these are for changing the server target
-	netConfiguration.Host = u.Host
-	netConfiguration.Scheme = u.Scheme
-	netClient = netapi.NewAPIClient(netConfiguration)
+	tests := []struct {
+		name    string
+		config  Config
+		clients []Clients
+	}{
+		{"invalid config", Config{}, []Clients{given}},
+		{"unknown location", config, []Clients{given, {Location: "SEA", BMC: bmc, IP: ip, Tag: tag, Network: netClient}}},
+		{"duplicate", config, []Clients{given, given}},
+		{"incomplete", config, []Clients{{BMC: bmc}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCloudProvider(tt.config, tt.clients...); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
 
-	return
+func TestClose(t *testing.T) {
+	vc, _ := testGetValidCloud(t, "")
+	if err := vc.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %v", err)
+	}
+	select {
+	case <-vc.stop:
+	default:
+		t.Errorf("stop channel not closed")
+	}
+	// closing again is a no-op
+	if err := vc.Close(); err != nil {
+		t.Fatalf("unexpected error on second close: %v", err)
+	}
+}
 
+// builds a phoenixnap client
+func constructClients(authToken, baseURL string) (bmc *bmcapi.APIClient, billing *billingapi.APIClient, ip *ipapi.APIClient, tag *tagapi.APIClient, netClient *netapi.APIClient, err error) {
+	// the test server does not check the token, so the calls are not authenticated
+	set, err := clients.New(clients.Options{BaseURL: baseURL})
+	if err != nil {
+		return
+	}
+	return set.BMC, set.Billing, set.IP, set.Tag, set.Network, nil
 }
@@ -0,0 +1,85 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// clusterIDSource the ID of the cluster, which scopes its IP blocks and servers: the configured one, or else the UID
+// of its kube-system namespace, got once and shared. As the API server may not be available yet when the CCM starts,
+// the UID is got with retries at startup, and, if they all fail, on first use instead.
+type clusterIDSource struct {
+	k8sclient kubernetes.Interface
+	// configured the configured cluster ID; if empty, the UID of the kube-system namespace
+	configured string
+
+	mutex sync.Mutex
+	uid   string
+}
+
+func newClusterIDSource(k8sclient kubernetes.Interface, configured string) *clusterIDSource {
+	return &clusterIDSource{k8sclient: k8sclient, configured: configured}
+}
+
+// known returns the cluster ID, or empty if the UID of the kube-system namespace has not been got yet
+func (s *clusterIDSource) known() string {
+	if s.configured != "" {
+		return s.configured
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.uid
+}
+
+// get returns the cluster ID, getting the UID of the kube-system namespace if it is not known yet
+func (s *clusterIDSource) get(ctx context.Context) (string, error) {
+	if id := s.known(); id != "" {
+		return id, nil
+	}
+	ns, err := s.k8sclient.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to get the %s namespace for the cluster ID: %w", metav1.NamespaceSystem, err)
+	}
+	if ns.UID == "" {
+		return "", fmt.Errorf("the %s namespace has no UID for the cluster ID", metav1.NamespaceSystem)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.uid = string(ns.UID)
+	return s.uid, nil
+}
+
+// getWithRetries returns the cluster ID, getting the UID of the kube-system namespace until it succeeds,
+// backoff.Steps attempts are used up, or ctx is done, waiting for the next step of backoff in between, as retry
+// does for the PhoenixNAP API. It returns the last error.
+func (s *clusterIDSource) getWithRetries(ctx context.Context, backoff wait.Backoff) (string, error) {
+	attempts := backoff.Steps
+	for attempt := 1; ; attempt++ {
+		id, err := s.get(ctx)
+		if err == nil || ctx.Err() != nil || attempt >= attempts {
+			return id, err
+		}
+		delay := backoff.Step()
+		klog.V(2).Infof("getting the cluster ID failed, attempt %d of %d, retrying in %s: %v", attempt, attempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// clusterID returns the ID of the cluster, or empty if it is not known yet; the calls that reach the API
+// get it first, see listIPBlocksByOwnership
+func (l *loadBalancers) clusterID() string {
+	return l.cluster.known()
+}
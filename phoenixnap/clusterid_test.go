@@ -0,0 +1,119 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testFailingNamespaceClient returns a fake client with the kube-system namespace, whose first failures gets of
+// namespaces fail, and the count of gets
+func testFailingNamespaceClient(failures int32) (*k8sfake.Clientset, *int32) {
+	client := k8sfake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: types.UID(testClusterID)},
+	})
+	var gets int32
+	client.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if atomic.AddInt32(&gets, 1) <= failures {
+			return true, nil, errors.New("apiserver unavailable")
+		}
+		return false, nil, nil
+	})
+	return client, &gets
+}
+
+func TestClusterIDSourceCaches(t *testing.T) {
+	client, gets := testFailingNamespaceClient(0)
+	source := newClusterIDSource(client, "")
+	if id := source.known(); id != "" {
+		t.Errorf("mismatched cluster ID before the first get, actual %s expected none", id)
+	}
+	for i := 0; i < 3; i++ {
+		id, err := source.get(context.TODO())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id != testClusterID {
+			t.Errorf("mismatched cluster ID, actual %s expected %s", id, testClusterID)
+		}
+	}
+	if *gets != 1 {
+		t.Errorf("mismatched gets of the namespace, actual %d expected %d", *gets, 1)
+	}
+	if id := source.known(); id != testClusterID {
+		t.Errorf("mismatched known cluster ID, actual %s expected %s", id, testClusterID)
+	}
+}
+
+func TestClusterIDSourceConfigured(t *testing.T) {
+	client, gets := testFailingNamespaceClient(1)
+	source := newClusterIDSource(client, "workload-b")
+	id, err := source.get(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "workload-b" || source.known() != "workload-b" {
+		t.Errorf("mismatched cluster ID, actual %s expected %s", id, "workload-b")
+	}
+	if *gets != 0 {
+		t.Errorf("mismatched gets of the namespace, actual %d expected none", *gets)
+	}
+}
+
+func TestClusterIDSourceRetries(t *testing.T) {
+	// the API server becomes available within the attempts
+	client, gets := testFailingNamespaceClient(2)
+	source := newClusterIDSource(client, "")
+	id, err := source.getWithRetries(context.TODO(), newBackoff(time.Millisecond, time.Millisecond, 5))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != testClusterID || *gets != 3 {
+		t.Errorf("mismatched cluster ID %s after %d gets, expected %s after %d", id, *gets, testClusterID, 3)
+	}
+
+	// it does not, and the last error is returned
+	client, _ = testFailingNamespaceClient(10)
+	source = newClusterIDSource(client, "")
+	if _, err := source.getWithRetries(context.TODO(), newBackoff(time.Millisecond, time.Millisecond, 3)); err == nil {
+		t.Fatalf("expected error when the namespace cannot be got")
+	}
+}
+
+func TestEnsureLoadBalancerClusterIDOnFirstUse(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	// as if the API server was not available at startup, and is not for the first call
+	client, _ := testFailingNamespaceClient(1)
+	l.cluster = newClusterIDSource(client, "")
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err == nil {
+		t.Fatalf("expected error when the cluster ID cannot be got")
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks without a cluster ID, actual %d expected %d", count, 0)
+	}
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.clusterID() != testClusterID {
+		t.Errorf("mismatched cluster ID, actual %s expected %s", l.clusterID(), testClusterID)
+	}
+	blocks, err := l.listIPBlocksByOwnership(context.TODO(), l.ownership)
+	if err != nil {
+		t.Fatalf("unable to list blocks: %v", err)
+	}
+	if len(blocks) != 1 {
+		t.Errorf("mismatched blocks of the cluster, actual %d expected %d", len(blocks), 1)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !cloudprovider_v1_30
+
+package phoenixnap
+
+import (
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// The adapters for the cloud-provider module of the version in go.mod and those up to v0.29, which differ from
+// later ones; build with the tag cloudprovider_v1_30 against v0.30 and later, see compat_v1_30.go.
+
+// setAdditionalLabels does nothing, as InstanceMetadata has no AdditionalLabels before cloud-provider v0.30, and
+// returns false; the CCM labels the node itself once it is initialized
+func setAdditionalLabels(metadata *cloudprovider.InstanceMetadata, labels map[string]string) bool {
+	return false
+}
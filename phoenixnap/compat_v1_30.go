@@ -0,0 +1,16 @@
+//go:build cloudprovider_v1_30
+
+package phoenixnap
+
+import (
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// The adapters for the cloud-provider module v0.30 and later; see compat.go.
+
+// setAdditionalLabels sets the labels in metadata, which the node controller sets on the node when it initializes
+// it, and returns true
+func setAdditionalLabels(metadata *cloudprovider.InstanceMetadata, labels map[string]string) bool {
+	metadata.AdditionalLabels = labels
+	return true
+}
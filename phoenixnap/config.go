@@ -4,31 +4,197 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 )
 
 const (
-	clientIDName               = "PNAP_CLIENT_ID"
-	clientSecretName           = "PNAP_CLIENT_SECRET"
-	locationName               = "PNAP_LOCATION"
-	loadBalancerSettingName    = "PNAP_LOAD_BALANCER"
-	envVarAnnotationIPLocation = "PNAP_ANNOTATION_IP_LOCATION"
-	envVarAPIServerPort        = "PNAP_API_SERVER_PORT"
+	clientIDName                   = "PNAP_CLIENT_ID"
+	clientSecretName               = "PNAP_CLIENT_SECRET"
+	locationName                   = "PNAP_LOCATION"
+	loadBalancerSettingName        = "PNAP_LOAD_BALANCER"
+	envVarAnnotationIPLocation     = "PNAP_ANNOTATION_IP_LOCATION"
+	envVarAPIServerPort            = "PNAP_API_SERVER_PORT"
+	envVarMetadataProxyAddress     = "PNAP_METADATA_PROXY_ADDRESS"
+	envVarMetadataProxyCertFile    = "PNAP_METADATA_PROXY_CERT_FILE"
+	envVarMetadataProxyKeyFile     = "PNAP_METADATA_PROXY_KEY_FILE"
+	envVarReadinessAddress         = "PNAP_READINESS_ADDRESS"
+	envVarPprof                    = "PNAP_PPROF"
+	envVarMaxIPBlocks              = "PNAP_MAX_IP_BLOCKS"
+	envVarDisableAPIErrorDetails   = "PNAP_DISABLE_API_ERROR_DETAILS"
+	envVarUsageTag                 = "PNAP_USAGE_TAG"
+	envVarUsageTagValue            = "PNAP_USAGE_TAG_VALUE"
+	envVarClusterTag               = "PNAP_CLUSTER_TAG"
+	envVarClusterID                = "PNAP_CLUSTER_ID"
+	envVarControlPlaneIP           = "PNAP_CONTROL_PLANE_IP"
+	envVarGatewayController        = "PNAP_GATEWAY_CONTROLLER"
+	envVarReconcileErrorAnnotation = "PNAP_RECONCILE_ERROR_ANNOTATION"
+	envVarPodCIDRNetwork           = "PNAP_POD_CIDR_NETWORK"
+	envVarPodCIDRMaskSize          = "PNAP_POD_CIDR_MASK_SIZE"
+	envVarNodeReadyDelaySeconds    = "PNAP_NODE_READY_DELAY_SECONDS"
+	envVarStartupSpreadSeconds     = "PNAP_STARTUP_SPREAD_SECONDS"
+	envVarStartupConcurrency       = "PNAP_STARTUP_CONCURRENCY"
+	envVarServiceNodeSelector      = "PNAP_SERVICE_NODE_SELECTOR"
+	envVarInstanceNodeSelector     = "PNAP_INSTANCE_NODE_SELECTOR"
+	envVarIgnoreForeignNodes       = "PNAP_IGNORE_FOREIGN_NODES"
+	envVarDuplicateHostnames       = "PNAP_DUPLICATE_HOSTNAMES"
+	envVarNodeSelectorFallback     = "PNAP_SERVICE_NODE_SELECTOR_FALLBACK"
+	envVarTagValuePrefix           = "PNAP_TAG_VALUE_PREFIX"
+	envVarNodeHostnameLabel        = "PNAP_NODE_HOSTNAME_LABEL"
+	envVarRegionFormat             = "PNAP_REGION_FORMAT"
+	envVarNodeDeletionProtection   = "PNAP_NODE_DELETION_PROTECTION"
+	envVarUninitializedNodeDiag    = "PNAP_UNINITIALIZED_NODE_DIAGNOSTICS"
+	envVarStatusResource           = "PNAP_STATUS_RESOURCE"
+	envVarIPAMLeaseLock            = "PNAP_IPAM_LEASE_LOCK"
+	envVarCanaryIntervalSeconds    = "PNAP_CANARY_INTERVAL_SECONDS"
+	envVarAuditEvents              = "PNAP_AUDIT_EVENTS"
+	envVarReaperScopeTag           = "PNAP_REAPER_SCOPE_TAG"
+	envVarReaperConcurrency        = "PNAP_REAPER_CONCURRENCY"
+	envVarVIPFirewall              = "PNAP_VIP_FIREWALL"
+	envVarAllocateOnEndpoints      = "PNAP_ALLOCATE_ON_ENDPOINTS"
+	envVarAllocateDelaySeconds     = "PNAP_ALLOCATE_DELAY_SECONDS"
+	envVarOrphanCheckInterval      = "PNAP_ORPHAN_CHECK_INTERVAL_SECONDS"
+	envVarOrphanCleanup            = "PNAP_ORPHAN_CLEANUP"
+	envVarSecondaryLocation        = "PNAP_SECONDARY_LOCATION"
+	envVarSecondaryNetwork         = "PNAP_SECONDARY_NETWORK"
+	envVarKubeconfig               = "PNAP_KUBECONFIG"
+	envVarKubeconfigContext        = "PNAP_KUBECONFIG_CONTEXT"
+	envVarAPIScopes                = "PNAP_API_SCOPES"
+	envVarAPITLSMinVersion         = "PNAP_API_TLS_MIN_VERSION"
+	envVarAPITLSCipherSuites       = "PNAP_API_TLS_CIPHER_SUITES"
+	envVarBaseURL                  = "PNAP_BASE_URL"
+	envVarCredentials              = "PNAP_CREDENTIALS"
+	envVarAPIRateLimits            = "PNAP_API_RATE_LIMITS"
 )
 
+// LocationCredentials API credentials of the account that owns resources in a single location
+type LocationCredentials struct {
+	Location     string `json:"location"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+}
+
 // Config configuration for a provider, includes authentication token, and optional override URL to talk to a different PhoenixNAP API endpoint
 type Config struct {
-	ClientID             string  `json:"clientID"`
-	ClientSecret         string  `json:"clientSecret"`
-	BaseURL              *string `json:"base-url,omitempty"`
-	LoadBalancerSetting  string  `json:"loadbalancer"`
-	Location             string  `json:"location,omitempty"`
-	AnnotationIPLocation string  `json:"annotationIPLocation,omitempty"`
-	APIServerPort        int32   `json:"apiServerPort,omitempty"`
-	ServiceNodeSelector  string  `json:"serviceNodeSelector,omitempty"`
+	ClientID            string  `json:"clientID"`
+	ClientSecret        string  `json:"clientSecret"`
+	BaseURL             *string `json:"base-url,omitempty"`
+	LoadBalancerSetting string  `json:"loadbalancer"`
+	// LoadBalancerConfig structured alternative to LoadBalancerSetting
+	LoadBalancerConfig   *LoadBalancerConfig `json:"loadbalancerConfig,omitempty"`
+	Location             string              `json:"location,omitempty"`
+	AnnotationIPLocation string              `json:"annotationIPLocation,omitempty"`
+	APIServerPort        int32               `json:"apiServerPort,omitempty"`
+	ServiceNodeSelector  string              `json:"serviceNodeSelector,omitempty"`
+	MetadataProxyAddress string              `json:"metadataProxyAddress,omitempty"`
+	// MetadataProxyCertFile and MetadataProxyKeyFile the PEM certificate and key with which the metadata proxy serves
+	// TLS, as callers send their bearer tokens; required with MetadataProxyAddress
+	MetadataProxyCertFile string `json:"metadataProxyCertFile,omitempty"`
+	MetadataProxyKeyFile  string `json:"metadataProxyKeyFile,omitempty"`
+	// ReadinessAddress listen address of /readyz, which fails while the CCM is degraded, e.g. the load balancer
+	// implementation is not ready; if empty, it is not served
+	ReadinessAddress string `json:"readinessAddress,omitempty"`
+	// Pprof serve the pprof endpoints under /debug/pprof/ next to /readyz, to clients on localhost only, e.g. through
+	// kubectl port-forward; requires ReadinessAddress
+	Pprof bool `json:"pprof,omitempty"`
+	// InstanceNodeSelector label selector of the nodes whose servers the CCM manages; the others, e.g. of another
+	// provider in a hybrid cluster, exist and are never looked up. If empty, all nodes
+	InstanceNodeSelector string `json:"instanceNodeSelector,omitempty"`
+	// IgnoreForeignNodes treat nodes whose provider ID is of another provider, e.g. aws://, as not managed, rather
+	// than fail on them
+	IgnoreForeignNodes bool `json:"ignoreForeignNodes,omitempty"`
+	// DuplicateHostnames how a node whose name is the hostname of more than one server is resolved: not at all,
+	// "first" or "clusterTag"
+	DuplicateHostnames string `json:"duplicateHostnames,omitempty"`
+	// Credentials per-location accounts; anything not in a listed location uses ClientID and ClientSecret
+	Credentials []LocationCredentials `json:"credentials,omitempty"`
+	// MaxIPBlocks the most IP blocks the CCM may purchase for load balancers, 0 for unlimited
+	MaxIPBlocks int `json:"maxIPBlocks,omitempty"`
+	// DisableAPIErrorDetails do not add the messages from PhoenixNAP API error bodies to errors, logs and Events
+	DisableAPIErrorDetails bool `json:"disableAPIErrorDetails,omitempty"`
+	// UsageTag name of the tag that marks IP blocks created by the CCM
+	UsageTag string `json:"usageTag,omitempty"`
+	// UsageTagValue value of UsageTag
+	UsageTagValue string `json:"usageTagValue,omitempty"`
+	// ClusterTag name of the tag whose value is the ID of the cluster that owns an IP block
+	ClusterTag string `json:"clusterTag,omitempty"`
+	// ClusterID value of ClusterTag, e.g. the name of a workload cluster; if empty, the UID of its kube-system namespace
+	ClusterID string `json:"clusterID,omitempty"`
+	// TagValuePrefix prefixed to the values of the service namespace and name tags of IP blocks, e.g. the cluster name
+	TagValuePrefix string `json:"tagValuePrefix,omitempty"`
+	// ControlPlaneIP an IP for the kube-apiserver, announced from the control plane nodes by the load balancer implementation
+	ControlPlaneIP string `json:"controlPlaneIP,omitempty"`
+	// GatewayController give the Gateways of the GatewayClasses of the phoenixnap.com/gateway-class controller an IP
+	// block each, and their IPs in their status; experimental
+	GatewayController bool `json:"gatewayController,omitempty"`
+	// ReconcileErrorAnnotation record the last error reconciling a Service in an annotation on it
+	ReconcileErrorAnnotation bool `json:"reconcileErrorAnnotation,omitempty"`
+	// PodCIDRNetwork ID of a private network whose CIDR the CCM divides into the PodCIDRs of the nodes
+	PodCIDRNetwork string `json:"podCIDRNetwork,omitempty"`
+	// PodCIDRMaskSize prefix length of the PodCIDR of each node
+	PodCIDRMaskSize int `json:"podCIDRMaskSize,omitempty"`
+	// APIRateLimits PhoenixNAP API call budget per subsystem: instances, loadbalancer or reaper
+	APIRateLimits map[string]APIRateLimit `json:"apiRateLimits,omitempty"`
+	// ServiceNodeSelectorFallback announce from all Ready worker nodes if ServiceNodeSelector matches none
+	ServiceNodeSelectorFallback bool `json:"serviceNodeSelectorFallback,omitempty"`
+	// NodeReadyDelaySeconds how long a node must have been Ready before it announces Service IPs, 0 to not wait
+	NodeReadyDelaySeconds int `json:"nodeReadyDelaySeconds,omitempty"`
+	// StartupSpreadSeconds the initial syncs of Services after startup are spread at random over this many seconds, 0 to not spread them
+	StartupSpreadSeconds int `json:"startupSpreadSeconds,omitempty"`
+	// StartupConcurrency the most initial syncs of Services that run at once, 0 for unlimited
+	StartupConcurrency int `json:"startupConcurrency,omitempty"`
+	// NodeHostnameLabel label each node with the current hostname of its server
+	NodeHostnameLabel bool `json:"nodeHostnameLabel,omitempty"`
+	// RegionFormat how the location of the server of a node is formatted as its region: as is, "upper" or "lower" case
+	RegionFormat string `json:"regionFormat,omitempty"`
+	// NodeDeletionProtection report the servers of nodes as existing while the API fails to say otherwise
+	NodeDeletionProtection bool `json:"nodeDeletionProtection,omitempty"`
+	// UninitializedNodeDiagnostics periodically explain with Events why nodes still have the uninitialized taint
+	UninitializedNodeDiagnostics bool `json:"uninitializedNodeDiagnostics,omitempty"`
+	// StatusResource publish the sync status of the subsystems to the PNAPCloudProviderStatus resource of the cluster
+	StatusResource bool `json:"statusResource,omitempty"`
+	// IPAMLeaseLock lock the purchase and release of the IP blocks of each Service with a Lease, for CCM replicas that may overlap
+	IPAMLeaseLock bool `json:"ipamLeaseLock,omitempty"`
+	// CanaryIntervalSeconds how often the canary provisions and deletes a load balancer, 0 to disable it
+	CanaryIntervalSeconds int `json:"canaryIntervalSeconds,omitempty"`
+	// AuditEvents record the IP blocks purchased and released for each Service as Events on its Namespace
+	AuditEvents bool `json:"auditEvents,omitempty"`
+	// ReaperScopeTag "<name>" or "<name>=<value>" of a tag that released IP blocks must carry to be deleted; if empty, all are
+	ReaperScopeTag string `json:"reaperScopeTag,omitempty"`
+	// ReaperConcurrency the most released IP blocks the reaper unassigns or deletes at once, 0 for the default
+	ReaperConcurrency int `json:"reaperConcurrency,omitempty"`
+	// VIPFirewall publish the ports of the Service of each VIP in a ConfigMap, for a node-local firewall to allow only them
+	VIPFirewall bool `json:"vipFirewall,omitempty"`
+	// AllocateOnEndpoints purchase the IP block of a Service only once it has a ready endpoint
+	AllocateOnEndpoints bool `json:"allocateOnEndpoints,omitempty"`
+	// AllocateDelaySeconds with AllocateOnEndpoints, how old a Service must be to get its IP block without a ready
+	// endpoint, 0 to wait for one
+	AllocateDelaySeconds int `json:"allocateDelaySeconds,omitempty"`
+	// OrphanCheckIntervalSeconds how often the state of the load balancer implementation is checked for IPs of IP
+	// blocks that no longer exist, 0 to disable it
+	OrphanCheckIntervalSeconds int `json:"orphanCheckIntervalSeconds,omitempty"`
+	// OrphanCleanup remove the IPs the orphan check finds from the load balancer implementation
+	OrphanCleanup bool `json:"orphanCleanup,omitempty"`
+	// SecondaryLocation the location in which Services with the secondary location annotation get a second IP block,
+	// in the account of its credentials, if it has its own
+	SecondaryLocation string `json:"secondaryLocation,omitempty"`
+	// SecondaryNetwork the ID of the public network in SecondaryLocation to which the second IP blocks are assigned
+	SecondaryNetwork string `json:"secondaryNetwork,omitempty"`
+	// Kubeconfig path of a kubeconfig for the cluster whose Services and Nodes the provider manages, when the CCM
+	// runs outside of it; if empty, the client of the controller manager
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// KubeconfigContext the context of Kubeconfig; if empty, its current context
+	KubeconfigContext string `json:"kubeconfigContext,omitempty"`
+	// APIScopes the scopes of the API token, if the default ones do not fit the account
+	APIScopes []string `json:"apiScopes,omitempty"`
+	// APITLS TLS settings of the connections to the PhoenixNAP API
+	APITLS APITLSConfig `json:"apiTLS,omitempty"`
 }
 
 // String converts the Config structure to a string, while masking hidden fields.
@@ -46,15 +212,295 @@ func (c Config) Strings() []string {
 	} else {
 		ret = append(ret, fmt.Sprintf("load balancer config: ''%s", c.LoadBalancerSetting))
 	}
+	if c.BaseURL != nil {
+		ret = append(ret, fmt.Sprintf("API base URL: %s", *c.BaseURL))
+	}
 	ret = append(ret, fmt.Sprintf("location: '%s'", c.Location))
 	ret = append(ret, fmt.Sprintf("API Server Port: '%d'", c.APIServerPort))
 	ret = append(ret, fmt.Sprintf("IP Location annotation: %s", c.AnnotationIPLocation))
 	ret = append(ret, fmt.Sprintf("api server port: %d", c.APIServerPort))
 	ret = append(ret, fmt.Sprintf("service node selector: %s", c.ServiceNodeSelector))
+	ret = append(ret, fmt.Sprintf("service node selector fallback: %t", c.ServiceNodeSelectorFallback))
+	ret = append(ret, fmt.Sprintf("instance node selector: %s", c.InstanceNodeSelector))
+	ret = append(ret, fmt.Sprintf("ignore foreign nodes: %t", c.IgnoreForeignNodes))
+	ret = append(ret, fmt.Sprintf("duplicate hostnames: '%s'", c.DuplicateHostnames))
+	ret = append(ret, fmt.Sprintf("node hostname label: %t", c.NodeHostnameLabel))
+	ret = append(ret, fmt.Sprintf("region format: '%s'", c.RegionFormat))
+	ret = append(ret, fmt.Sprintf("node deletion protection: %t", c.NodeDeletionProtection))
+	ret = append(ret, fmt.Sprintf("uninitialized node diagnostics: %t", c.UninitializedNodeDiagnostics))
+	ret = append(ret, fmt.Sprintf("status resource: %t", c.StatusResource))
+	if c.Kubeconfig != "" {
+		ret = append(ret, fmt.Sprintf("kubeconfig: %s, context: '%s'", c.Kubeconfig, c.KubeconfigContext))
+	}
+	if len(c.APIScopes) == 0 {
+		ret = append(ret, fmt.Sprintf("API scopes: %s (default)", strings.Join(defaultAPIScopes, ",")))
+	} else {
+		ret = append(ret, fmt.Sprintf("API scopes: %s", strings.Join(c.APIScopes, ",")))
+	}
+	ret = append(ret, fmt.Sprintf("API TLS: %s", c.APITLS))
+	for _, cred := range c.Credentials {
+		ret = append(ret, fmt.Sprintf("credentials for location '%s': ClientID: '%s', ClientSecret: '<masked>'", cred.Location, cred.ClientID))
+	}
+	if c.MaxIPBlocks == 0 {
+		ret = append(ret, "max IP blocks: unlimited")
+	} else {
+		ret = append(ret, fmt.Sprintf("max IP blocks: %d", c.MaxIPBlocks))
+	}
+	ret = append(ret, fmt.Sprintf("API error details: %t", !c.DisableAPIErrorDetails))
+	ret = append(ret, fmt.Sprintf("reconcile error annotation: %t", c.ReconcileErrorAnnotation))
+	clusterID := "<kube-system UID>"
+	if c.ClusterID != "" {
+		clusterID = c.ClusterID
+	}
+	ret = append(ret, fmt.Sprintf("IP block ownership tags: %s=%s, %s=%s", c.UsageTag, c.UsageTagValue, c.ClusterTag, clusterID))
+	ret = append(ret, fmt.Sprintf("IP block service tag value prefix: '%s'", c.TagValuePrefix))
+	if c.ControlPlaneIP == "" {
+		ret = append(ret, "control plane IP: disabled")
+	} else {
+		ret = append(ret, fmt.Sprintf("control plane IP: %s", c.ControlPlaneIP))
+	}
+	ret = append(ret, fmt.Sprintf("gateway controller (experimental): %t", c.GatewayController))
+	for _, subsystem := range apiSubsystems {
+		if limit, ok := c.APIRateLimits[string(subsystem)]; ok {
+			ret = append(ret, fmt.Sprintf("API rate limit of %s: %v qps, burst %d", subsystem, limit.QPS, limit.Burst))
+		}
+	}
+	if c.PodCIDRNetwork == "" {
+		ret = append(ret, "PodCIDR allocation: disabled")
+	} else {
+		ret = append(ret, fmt.Sprintf("PodCIDR allocation: /%d from private network %s", c.PodCIDRMaskSize, c.PodCIDRNetwork))
+	}
+	ret = append(ret, fmt.Sprintf("node ready delay: %ds", c.NodeReadyDelaySeconds))
+	ret = append(ret, fmt.Sprintf("startup spread: %ds, concurrency: %d", c.StartupSpreadSeconds, c.StartupConcurrency))
+	ret = append(ret, fmt.Sprintf("IPAM lease lock: %t", c.IPAMLeaseLock))
+	ret = append(ret, fmt.Sprintf("audit events: %t", c.AuditEvents))
+	if c.ReaperScopeTag != "" {
+		ret = append(ret, fmt.Sprintf("reaper scope tag: %s", c.ReaperScopeTag))
+	}
+	if c.ReaperConcurrency > 0 {
+		ret = append(ret, fmt.Sprintf("reaper concurrency: %d", c.ReaperConcurrency))
+	}
+	ret = append(ret, fmt.Sprintf("VIP firewall rules: %t", c.VIPFirewall))
+	if c.AllocateOnEndpoints {
+		ret = append(ret, fmt.Sprintf("IP block allocation: on ready endpoints, delay: %ds", c.AllocateDelaySeconds))
+	} else {
+		ret = append(ret, "IP block allocation: immediate")
+	}
+	if c.OrphanCheckIntervalSeconds == 0 {
+		ret = append(ret, "orphan check: disabled")
+	} else {
+		ret = append(ret, fmt.Sprintf("orphan check interval: %ds, cleanup: %t", c.OrphanCheckIntervalSeconds, c.OrphanCleanup))
+	}
+	if c.SecondaryLocation == "" {
+		ret = append(ret, "secondary location: disabled")
+	} else {
+		ret = append(ret, fmt.Sprintf("secondary location: %s, public network %s", c.SecondaryLocation, c.SecondaryNetwork))
+	}
+	if c.CanaryIntervalSeconds == 0 {
+		ret = append(ret, "load balancer canary: disabled")
+	} else {
+		ret = append(ret, fmt.Sprintf("load balancer canary interval: %ds", c.CanaryIntervalSeconds))
+	}
+	if c.MetadataProxyAddress == "" {
+		ret = append(ret, "metadata proxy: disabled")
+	} else {
+		ret = append(ret, fmt.Sprintf("metadata proxy address: %s, certificate %s", c.MetadataProxyAddress, c.MetadataProxyCertFile))
+	}
+	if c.ReadinessAddress == "" {
+		ret = append(ret, "readiness endpoint: disabled")
+	} else {
+		ret = append(ret, fmt.Sprintf("readiness endpoint address: %s, pprof: %t", c.ReadinessAddress, c.Pprof))
+	}
 
 	return ret
 }
 
+// configBinding binds a field of Config to its env var; the env var, if set, overrides the field in the config file
+type configBinding struct {
+	// field the JSON name of the field in the config file, of nested fields joined with '.'
+	field string
+	// env the env var of the field, or "" if it can only be set in the config file
+	env string
+	// apply sets the field of config from value, the env var, if it is not empty, else from file
+	apply func(config, file *Config, value string) error
+}
+
+// stringBinding binds a string field
+func stringBinding(field, env string, target func(*Config) *string) configBinding {
+	return configBinding{field: field, env: env, apply: func(config, file *Config, value string) error {
+		*target(config) = *target(file)
+		if value != "" {
+			*target(config) = value
+		}
+		return nil
+	}}
+}
+
+// boolBinding binds a bool field
+func boolBinding(field, env string, target func(*Config) *bool) configBinding {
+	return configBinding{field: field, env: env, apply: func(config, file *Config, value string) error {
+		*target(config) = *target(file)
+		if value == "" {
+			return nil
+		}
+		enable, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("env var %s must be a boolean, was %s: %w", env, value, err)
+		}
+		*target(config) = enable
+		return nil
+	}}
+}
+
+// intBinding binds an int field
+func intBinding(field, env string, target func(*Config) *int) configBinding {
+	return configBinding{field: field, env: env, apply: func(config, file *Config, value string) error {
+		*target(config) = *target(file)
+		if value == "" {
+			return nil
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("env var %s must be a number, was %s: %w", env, value, err)
+		}
+		*target(config) = number
+		return nil
+	}}
+}
+
+// listBinding binds a []string field, whose env var is a comma-separated list
+func listBinding(field, env string, target func(*Config) *[]string) configBinding {
+	return configBinding{field: field, env: env, apply: func(config, file *Config, value string) error {
+		*target(config) = *target(file)
+		if value != "" {
+			*target(config) = strings.Split(value, ",")
+		}
+		return nil
+	}}
+}
+
+// configBindings how each field of Config is set, in the order they are applied
+var configBindings = []configBinding{
+	stringBinding("clientID", clientIDName, func(c *Config) *string { return &c.ClientID }),
+	stringBinding("clientSecret", clientSecretName, func(c *Config) *string { return &c.ClientSecret }),
+	{field: "base-url", env: envVarBaseURL, apply: func(config, file *Config, value string) error {
+		config.BaseURL = file.BaseURL
+		if value != "" {
+			config.BaseURL = &value
+		}
+		return nil
+	}},
+	// the structured form has no env var, PNAP_LOAD_BALANCER takes its URL form
+	{field: "loadbalancerConfig", apply: func(config, file *Config, value string) error {
+		config.LoadBalancerConfig = file.LoadBalancerConfig
+		if config.LoadBalancerConfig == nil {
+			return nil
+		}
+		if file.LoadBalancerSetting != "" {
+			return fmt.Errorf("only one of loadbalancer and loadbalancerConfig may be set")
+		}
+		if err := config.LoadBalancerConfig.validate(); err != nil {
+			return fmt.Errorf("invalid loadbalancerConfig: %w", err)
+		}
+		return nil
+	}},
+	{field: "loadbalancer", env: loadBalancerSettingName, apply: func(config, file *Config, value string) error {
+		config.LoadBalancerSetting = file.LoadBalancerSetting
+		if config.LoadBalancerConfig != nil {
+			// everything else uses the URL form
+			config.LoadBalancerSetting = config.LoadBalancerConfig.URL()
+		}
+		if value != "" {
+			config.LoadBalancerSetting = value
+		}
+		return nil
+	}},
+	stringBinding("location", locationName, func(c *Config) *string { return &c.Location }),
+	stringBinding("annotationIPLocation", envVarAnnotationIPLocation, func(c *Config) *string { return &c.AnnotationIPLocation }),
+	{field: "apiServerPort", env: envVarAPIServerPort, apply: func(config, file *Config, value string) error {
+		// 0 uses whatever the kube-apiserver port is
+		config.APIServerPort = file.APIServerPort
+		if value == "" {
+			return nil
+		}
+		port, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("env var %s must be a number, was %s: %w", envVarAPIServerPort, value, err)
+		}
+		config.APIServerPort = int32(port)
+		return nil
+	}},
+	stringBinding("serviceNodeSelector", envVarServiceNodeSelector, func(c *Config) *string { return &c.ServiceNodeSelector }),
+	stringBinding("instanceNodeSelector", envVarInstanceNodeSelector, func(c *Config) *string { return &c.InstanceNodeSelector }),
+	boolBinding("ignoreForeignNodes", envVarIgnoreForeignNodes, func(c *Config) *bool { return &c.IgnoreForeignNodes }),
+	stringBinding("duplicateHostnames", envVarDuplicateHostnames, func(c *Config) *string { return &c.DuplicateHostnames }),
+	stringBinding("metadataProxyAddress", envVarMetadataProxyAddress, func(c *Config) *string { return &c.MetadataProxyAddress }),
+	stringBinding("metadataProxyCertFile", envVarMetadataProxyCertFile, func(c *Config) *string { return &c.MetadataProxyCertFile }),
+	stringBinding("metadataProxyKeyFile", envVarMetadataProxyKeyFile, func(c *Config) *string { return &c.MetadataProxyKeyFile }),
+	stringBinding("readinessAddress", envVarReadinessAddress, func(c *Config) *string { return &c.ReadinessAddress }),
+	boolBinding("pprof", envVarPprof, func(c *Config) *bool { return &c.Pprof }),
+	{field: "credentials", env: envVarCredentials, apply: func(config, file *Config, value string) error {
+		config.Credentials = file.Credentials
+		if value == "" {
+			return nil
+		}
+		config.Credentials = nil
+		if err := json.Unmarshal([]byte(value), &config.Credentials); err != nil {
+			return fmt.Errorf("env var %s must be a JSON list of credentials: %w", envVarCredentials, err)
+		}
+		return nil
+	}},
+	intBinding("maxIPBlocks", envVarMaxIPBlocks, func(c *Config) *int { return &c.MaxIPBlocks }),
+	boolBinding("disableAPIErrorDetails", envVarDisableAPIErrorDetails, func(c *Config) *bool { return &c.DisableAPIErrorDetails }),
+	stringBinding("usageTag", envVarUsageTag, func(c *Config) *string { return &c.UsageTag }),
+	stringBinding("usageTagValue", envVarUsageTagValue, func(c *Config) *string { return &c.UsageTagValue }),
+	stringBinding("clusterTag", envVarClusterTag, func(c *Config) *string { return &c.ClusterTag }),
+	stringBinding("clusterID", envVarClusterID, func(c *Config) *string { return &c.ClusterID }),
+	stringBinding("tagValuePrefix", envVarTagValuePrefix, func(c *Config) *string { return &c.TagValuePrefix }),
+	stringBinding("controlPlaneIP", envVarControlPlaneIP, func(c *Config) *string { return &c.ControlPlaneIP }),
+	boolBinding("gatewayController", envVarGatewayController, func(c *Config) *bool { return &c.GatewayController }),
+	boolBinding("reconcileErrorAnnotation", envVarReconcileErrorAnnotation, func(c *Config) *bool { return &c.ReconcileErrorAnnotation }),
+	stringBinding("podCIDRNetwork", envVarPodCIDRNetwork, func(c *Config) *string { return &c.PodCIDRNetwork }),
+	intBinding("podCIDRMaskSize", envVarPodCIDRMaskSize, func(c *Config) *int { return &c.PodCIDRMaskSize }),
+	{field: "apiRateLimits", env: envVarAPIRateLimits, apply: func(config, file *Config, value string) error {
+		config.APIRateLimits = file.APIRateLimits
+		if value == "" {
+			return nil
+		}
+		config.APIRateLimits = nil
+		if err := json.Unmarshal([]byte(value), &config.APIRateLimits); err != nil {
+			return fmt.Errorf("env var %s must be a JSON object of rate limits: %w", envVarAPIRateLimits, err)
+		}
+		return nil
+	}},
+	boolBinding("serviceNodeSelectorFallback", envVarNodeSelectorFallback, func(c *Config) *bool { return &c.ServiceNodeSelectorFallback }),
+	intBinding("nodeReadyDelaySeconds", envVarNodeReadyDelaySeconds, func(c *Config) *int { return &c.NodeReadyDelaySeconds }),
+	intBinding("startupSpreadSeconds", envVarStartupSpreadSeconds, func(c *Config) *int { return &c.StartupSpreadSeconds }),
+	intBinding("startupConcurrency", envVarStartupConcurrency, func(c *Config) *int { return &c.StartupConcurrency }),
+	boolBinding("nodeHostnameLabel", envVarNodeHostnameLabel, func(c *Config) *bool { return &c.NodeHostnameLabel }),
+	stringBinding("regionFormat", envVarRegionFormat, func(c *Config) *string { return &c.RegionFormat }),
+	boolBinding("nodeDeletionProtection", envVarNodeDeletionProtection, func(c *Config) *bool { return &c.NodeDeletionProtection }),
+	boolBinding("uninitializedNodeDiagnostics", envVarUninitializedNodeDiag, func(c *Config) *bool { return &c.UninitializedNodeDiagnostics }),
+	boolBinding("statusResource", envVarStatusResource, func(c *Config) *bool { return &c.StatusResource }),
+	boolBinding("ipamLeaseLock", envVarIPAMLeaseLock, func(c *Config) *bool { return &c.IPAMLeaseLock }),
+	intBinding("canaryIntervalSeconds", envVarCanaryIntervalSeconds, func(c *Config) *int { return &c.CanaryIntervalSeconds }),
+	boolBinding("auditEvents", envVarAuditEvents, func(c *Config) *bool { return &c.AuditEvents }),
+	stringBinding("reaperScopeTag", envVarReaperScopeTag, func(c *Config) *string { return &c.ReaperScopeTag }),
+	intBinding("reaperConcurrency", envVarReaperConcurrency, func(c *Config) *int { return &c.ReaperConcurrency }),
+	boolBinding("vipFirewall", envVarVIPFirewall, func(c *Config) *bool { return &c.VIPFirewall }),
+	boolBinding("allocateOnEndpoints", envVarAllocateOnEndpoints, func(c *Config) *bool { return &c.AllocateOnEndpoints }),
+	intBinding("allocateDelaySeconds", envVarAllocateDelaySeconds, func(c *Config) *int { return &c.AllocateDelaySeconds }),
+	intBinding("orphanCheckIntervalSeconds", envVarOrphanCheckInterval, func(c *Config) *int { return &c.OrphanCheckIntervalSeconds }),
+	boolBinding("orphanCleanup", envVarOrphanCleanup, func(c *Config) *bool { return &c.OrphanCleanup }),
+	stringBinding("secondaryLocation", envVarSecondaryLocation, func(c *Config) *string { return &c.SecondaryLocation }),
+	stringBinding("secondaryNetwork", envVarSecondaryNetwork, func(c *Config) *string { return &c.SecondaryNetwork }),
+	stringBinding("kubeconfig", envVarKubeconfig, func(c *Config) *string { return &c.Kubeconfig }),
+	stringBinding("kubeconfigContext", envVarKubeconfigContext, func(c *Config) *string { return &c.KubeconfigContext }),
+	listBinding("apiScopes", envVarAPIScopes, func(c *Config) *[]string { return &c.APIScopes }),
+	stringBinding("apiTLS.minVersion", envVarAPITLSMinVersion, func(c *Config) *string { return &c.APITLS.MinVersion }),
+	listBinding("apiTLS.cipherSuites", envVarAPITLSCipherSuites, func(c *Config) *[]string { return &c.APITLS.CipherSuites }),
+}
+
 func getConfig(providerConfig io.Reader) (Config, error) {
 	// get our config, most importantly our client secret and client ID
 	var config, rawConfig Config
@@ -67,65 +513,179 @@ func getConfig(providerConfig io.Reader) (Config, error) {
 		return config, fmt.Errorf("failed to process json of configuration file at path %s: %w", providerConfig, err)
 	}
 
-	// read env vars; if not set, use rawConfig
-	ClientID := os.Getenv(clientIDName)
-	if ClientID == "" {
-		ClientID = rawConfig.ClientID
+	// rule for processing: any setting in env var overrides setting from file, which overrides the default
+	for _, binding := range configBindings {
+		var value string
+		if binding.env != "" {
+			value = os.Getenv(binding.env)
+		}
+		if err := binding.apply(&config, &rawConfig, value); err != nil {
+			return config, err
+		}
 	}
-	config.ClientID = ClientID
 
-	ClientSecret := os.Getenv(clientSecretName)
-	if ClientSecret == "" {
-		ClientSecret = rawConfig.ClientSecret
+	if config.ClientID == "" {
+		return config, fmt.Errorf("environment variable %q is required", clientIDName)
+	}
+	if config.ClientSecret == "" {
+		return config, fmt.Errorf("environment variable %q is required", clientSecretName)
 	}
-	config.ClientSecret = ClientSecret
 
-	loadBalancerSetting := os.Getenv(loadBalancerSettingName)
-	config.LoadBalancerSetting = rawConfig.LoadBalancerSetting
-	// rule for processing: any setting in env var overrides setting from file
-	if loadBalancerSetting != "" {
-		config.LoadBalancerSetting = loadBalancerSetting
+	if config.BaseURL != nil {
+		if u, err := url.Parse(*config.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return config, fmt.Errorf("base-url must be a URL with a scheme and host, was %q", *config.BaseURL)
+		}
 	}
 
-	location := os.Getenv(locationName)
-	if location == "" {
-		location = rawConfig.Location
+	if config.AnnotationIPLocation == "" {
+		config.AnnotationIPLocation = DefaultAnnotationIPLocation
 	}
 
-	if ClientID == "" {
-		return config, fmt.Errorf("environment variable %q is required", clientIDName)
+	seen := map[string]bool{}
+	for i, cred := range config.Credentials {
+		if cred.Location == "" || cred.ClientID == "" || cred.ClientSecret == "" {
+			return config, fmt.Errorf("credentials entry %d must have location, clientID and clientSecret", i)
+		}
+		if seen[cred.Location] {
+			return config, fmt.Errorf("duplicate credentials for location %s", cred.Location)
+		}
+		seen[cred.Location] = true
 	}
-	if ClientSecret == "" {
-		return config, fmt.Errorf("environment variable %q is required", clientSecretName)
+
+	// ownership tags; the defaults apply to any not set
+	if config.UsageTag == "" {
+		config.UsageTag = pnapTag
+	}
+	if config.UsageTagValue == "" {
+		config.UsageTagValue = pnapValue
+	}
+	if config.ClusterTag == "" {
+		config.ClusterTag = clusterTagName
+	}
+	if err := validateTagName(config.UsageTag); err != nil {
+		return config, fmt.Errorf("invalid usageTag: %w", err)
+	}
+	if err := validateTagName(config.ClusterTag); err != nil {
+		return config, fmt.Errorf("invalid clusterTag: %w", err)
+	}
+	if config.UsageTag == config.ClusterTag {
+		return config, fmt.Errorf("usageTag and clusterTag must be different, both were %q", config.UsageTag)
+	}
+	for name, value := range map[string]string{
+		"usageTagValue":  config.UsageTagValue,
+		"clusterID":      config.ClusterID,
+		"tagValuePrefix": config.TagValuePrefix,
+	} {
+		if strings.Contains(value, ",") {
+			return config, fmt.Errorf("%s %q must not contain ','", name, value)
+		}
 	}
 
-	config.Location = location
+	if config.Pprof && config.ReadinessAddress == "" {
+		return config, fmt.Errorf("pprof is served next to /readyz, and requires readinessAddress")
+	}
+	if config.MetadataProxyAddress != "" && (config.MetadataProxyCertFile == "" || config.MetadataProxyKeyFile == "") {
+		return config, fmt.Errorf("the metadata proxy serves only TLS, and metadataProxyAddress requires metadataProxyCertFile and metadataProxyKeyFile")
+	}
 
-	// set the annotations
-	config.AnnotationIPLocation = DefaultAnnotationIPLocation
-	annotationIPLocation := os.Getenv(envVarAnnotationIPLocation)
-	if annotationIPLocation != "" {
-		config.AnnotationIPLocation = annotationIPLocation
+	if config.ControlPlaneIP != "" && net.ParseIP(config.ControlPlaneIP) == nil {
+		return config, fmt.Errorf("controlPlaneIP must be an IP address, was %s", config.ControlPlaneIP)
+	}
+	// the control plane IP is handed to the implementation as a pseudo-service, which kube-vip cannot annotate
+	if config.ControlPlaneIP != "" && kubeVIPAnnotations(config.LoadBalancerSetting) {
+		return config, fmt.Errorf("controlPlaneIP is not supported with kube-vip in daemonset mode or with annotations, which announce only existing services")
 	}
 
-	apiServer := os.Getenv(envVarAPIServerPort)
-	switch {
-	case apiServer != "":
-		apiServerNo, err := strconv.Atoi(apiServer)
-		if err != nil {
-			return config, fmt.Errorf("env var %s must be a number, was %s: %w", envVarAPIServerPort, apiServer, err)
+	if err := validateAPIRateLimits(config.APIRateLimits); err != nil {
+		return config, fmt.Errorf("invalid apiRateLimits: %w", err)
+	}
+
+	if config.PodCIDRMaskSize == 0 {
+		config.PodCIDRMaskSize = defaultPodCIDRMaskSize
+	}
+	if config.PodCIDRMaskSize < 1 || config.PodCIDRMaskSize > 128 {
+		return config, fmt.Errorf("podCIDRMaskSize must be between 1 and 128, was %d", config.PodCIDRMaskSize)
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"maxIPBlocks", config.MaxIPBlocks},
+		{"nodeReadyDelaySeconds", config.NodeReadyDelaySeconds},
+		{"startupSpreadSeconds", config.StartupSpreadSeconds},
+		{"startupConcurrency", config.StartupConcurrency},
+		{"canaryIntervalSeconds", config.CanaryIntervalSeconds},
+		{"reaperConcurrency", config.ReaperConcurrency},
+		{"allocateDelaySeconds", config.AllocateDelaySeconds},
+		{"orphanCheckIntervalSeconds", config.OrphanCheckIntervalSeconds},
+	} {
+		if setting.value < 0 {
+			return config, fmt.Errorf("%s must not be negative, was %d", setting.name, setting.value)
+		}
+	}
+
+	if _, err := labels.Parse(config.ServiceNodeSelector); err != nil {
+		return config, fmt.Errorf("invalid serviceNodeSelector %q: %w", config.ServiceNodeSelector, err)
+	}
+	if _, err := labels.Parse(config.InstanceNodeSelector); err != nil {
+		return config, fmt.Errorf("invalid instanceNodeSelector %q: %w", config.InstanceNodeSelector, err)
+	}
+
+	if err := validateRegionFormat(config.RegionFormat); err != nil {
+		return config, err
+	}
+	if err := validateDuplicateHostnames(config.DuplicateHostnames); err != nil {
+		return config, err
+	}
+
+	if _, err := parseReaperScope(config.ReaperScopeTag); err != nil {
+		return config, err
+	}
+
+	if (config.SecondaryLocation == "") != (config.SecondaryNetwork == "") {
+		return config, fmt.Errorf("secondaryLocation and secondaryNetwork must be set together")
+	}
+	if config.SecondaryLocation != "" {
+		if config.SecondaryLocation == config.Location {
+			return config, fmt.Errorf("secondaryLocation must differ from location %s", config.Location)
 		}
-		config.APIServerPort = int32(apiServerNo)
-	case rawConfig.APIServerPort != 0:
-		config.APIServerPort = rawConfig.APIServerPort
-	default:
-		// if nothing else set it, we set it to 0, to indicate that it should use whatever the kube-apiserver port is
-		config.APIServerPort = 0
+	}
+
+	for _, scope := range config.APIScopes {
+		if scope == "" || strings.ContainsAny(scope, " \t") {
+			return config, fmt.Errorf("invalid API scope %q", scope)
+		}
+	}
+
+	if _, err := config.APITLS.tlsConfig(); err != nil {
+		return config, fmt.Errorf("invalid apiTLS: %w", err)
+	}
+
+	if config.KubeconfigContext != "" && config.Kubeconfig == "" {
+		return config, fmt.Errorf("kubeconfigContext %q is set, but kubeconfig is not", config.KubeconfigContext)
 	}
 
 	return config, nil
 }
 
+// ownershipTags the tags that mark IP blocks as belonging to the cluster
+// Any that are not set use the defaults.
+func (c Config) ownershipTags() ownershipTags {
+	tags := defaultOwnershipTags
+	if c.UsageTag != "" {
+		tags.usage = c.UsageTag
+	}
+	if c.UsageTagValue != "" {
+		tags.usageValue = c.UsageTagValue
+	}
+	if c.ClusterTag != "" {
+		tags.cluster = c.ClusterTag
+	}
+	tags.clusterID = c.ClusterID
+	return tags
+}
+
 // printConfig report the config to startup logs
 func printConfig(config Config) {
 	lines := config.Strings()
@@ -0,0 +1,342 @@
+package phoenixnap
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testConfigJSONFields returns the JSON names of the fields of typ, of nested structs joined with '.'
+func testConfigJSONFields(typ reflect.Type, prefix string) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		// nested settings, e.g. apiTLS, are bound field by field; pointers, e.g. loadbalancerConfig, as a whole
+		if field.Type.Kind() == reflect.Struct {
+			fields = append(fields, testConfigJSONFields(field.Type, prefix+name+".")...)
+			continue
+		}
+		fields = append(fields, prefix+name)
+	}
+	return fields
+}
+
+// testConfigField returns the value of the field of config with the given JSON name, as JSON
+func testConfigField(t *testing.T, config Config, name string) string {
+	value := reflect.ValueOf(config)
+	for _, part := range strings.Split(name, ".") {
+		found := false
+		for i := 0; i < value.NumField(); i++ {
+			if strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0] == part {
+				value, found = value.Field(i), true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("no field %s in Config", name)
+		}
+	}
+	b, err := json.Marshal(value.Interface())
+	if err != nil {
+		t.Fatalf("unable to marshal field %s: %v", name, err)
+	}
+	return string(b)
+}
+
+// testConfigFile returns a config file with the required fields, the given extra fields and the field with the
+// given JSON name, nested ones as objects
+func testConfigFile(t *testing.T, extra map[string]any, field, value string) string {
+	file := map[string]any{"clientID": "id", "clientSecret": "secret"}
+	for k, v := range extra {
+		file[k] = v
+	}
+	if field != "" {
+		parts := strings.Split(field, ".")
+		target := file
+		for _, part := range parts[:len(parts)-1] {
+			nested, ok := target[part].(map[string]any)
+			if !ok {
+				nested = map[string]any{}
+				target[part] = nested
+			}
+			target = nested
+		}
+		target[parts[len(parts)-1]] = json.RawMessage(value)
+	}
+	b, err := json.Marshal(file)
+	if err != nil {
+		t.Fatalf("unable to marshal config file: %v", err)
+	}
+	return string(b)
+}
+
+func TestConfigBindingsCoverAllFields(t *testing.T) {
+	bound := map[string]bool{}
+	envs := map[string]string{}
+	for _, binding := range configBindings {
+		if bound[binding.field] {
+			t.Errorf("field %s bound more than once", binding.field)
+		}
+		bound[binding.field] = true
+		if binding.env == "" {
+			continue
+		}
+		if !strings.HasPrefix(binding.env, "PNAP_") {
+			t.Errorf("env var %s of field %s must start with PNAP_", binding.env, binding.field)
+		}
+		if other, ok := envs[binding.env]; ok {
+			t.Errorf("env var %s bound to both %s and %s", binding.env, other, binding.field)
+		}
+		envs[binding.env] = binding.field
+	}
+	fields := testConfigJSONFields(reflect.TypeOf(Config{}), "")
+	for _, field := range fields {
+		if !bound[field] {
+			t.Errorf("field %s has no binding", field)
+		}
+		delete(bound, field)
+	}
+	for field := range bound {
+		t.Errorf("binding of unknown field %s", field)
+	}
+}
+
+// testConfigSample values of a field to check its precedence: the JSON in the file, the env var, and its value as
+// JSON; any extra fields the field needs to be valid
+type testConfigSample struct {
+	file  string
+	env   string
+	value string
+	extra map[string]any
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	samples := map[string]testConfigSample{
+		"clientID":                     {`"file-id"`, "env-id", `"env-id"`, nil},
+		"clientSecret":                 {`"file-secret"`, "env-secret", `"env-secret"`, nil},
+		"base-url":                     {`"https://file.example.com"`, "https://env.example.com", `"https://env.example.com"`, nil},
+		"loadbalancer":                 {`"kube-vip://file"`, "kube-vip://env", `"kube-vip://env"`, nil},
+		"apiServerPort":                {`6443`, "8443", `8443`, nil},
+		"controlPlaneIP":               {`"192.0.2.1"`, "192.0.2.2", `"192.0.2.2"`, nil},
+		"gatewayController":            {`true`, "false", `false`, nil},
+		"credentials":                  {`[{"location":"PHX","clientID":"a","clientSecret":"b"}]`, `[{"location":"ASH","clientID":"c","clientSecret":"d"}]`, `[{"location":"ASH","clientID":"c","clientSecret":"d"}]`, nil},
+		"apiRateLimits":                {`{"reaper":{"qps":1}}`, `{"instances":{"qps":2,"burst":3}}`, `{"instances":{"qps":2,"burst":3}}`, nil},
+		"serviceNodeSelector":          {`"file=true"`, "env=true", `"env=true"`, nil},
+		"instanceNodeSelector":         {`"file=true"`, "env=true", `"env=true"`, nil},
+		"podCIDRMaskSize":              {`26`, "25", `25`, nil},
+		"regionFormat":                 {`"upper"`, "lower", `"lower"`, nil},
+		"duplicateHostnames":           {`"first"`, "clusterTag", `"clusterTag"`, nil},
+		"reaperScopeTag":               {`"file"`, "env=yes", `"env=yes"`, nil},
+		"usageTag":                     {`"file-usage"`, "env-usage", `"env-usage"`, nil},
+		"clusterTag":                   {`"file-cluster"`, "env-cluster", `"env-cluster"`, nil},
+		"secondaryLocation":            {`"PHX"`, "ASH", `"ASH"`, map[string]any{"location": "NLD", "secondaryNetwork": "net"}},
+		"secondaryNetwork":             {`"file-net"`, "env-net", `"env-net"`, map[string]any{"location": "NLD", "secondaryLocation": "PHX"}},
+		"kubeconfigContext":            {`"file"`, "env", `"env"`, map[string]any{"kubeconfig": "/kubeconfig"}},
+		"apiScopes":                    {`["file"]`, "env1,env2", `["env1","env2"]`, nil},
+		"apiTLS.minVersion":            {`"1.2"`, "1.3", `"1.3"`, nil},
+		"apiTLS.cipherSuites":          {`["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]`, "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", `["TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"]`, nil},
+		"annotationIPLocation":         {`"file.example.com/location"`, "env.example.com/location", `"env.example.com/location"`, nil},
+		"metadataProxyAddress":         {`"127.0.0.1:1"`, "127.0.0.1:2", `"127.0.0.1:2"`, map[string]any{"metadataProxyCertFile": "/tls.crt", "metadataProxyKeyFile": "/tls.key"}},
+		"metadataProxyCertFile":        {`"/file.crt"`, "/env.crt", `"/env.crt"`, map[string]any{"metadataProxyAddress": "127.0.0.1:1", "metadataProxyKeyFile": "/tls.key"}},
+		"metadataProxyKeyFile":         {`"/file.key"`, "/env.key", `"/env.key"`, map[string]any{"metadataProxyAddress": "127.0.0.1:1", "metadataProxyCertFile": "/tls.crt"}},
+		"readinessAddress":             {`"127.0.0.1:1"`, "127.0.0.1:2", `"127.0.0.1:2"`, nil},
+		"pprof":                        {`true`, "false", `false`, map[string]any{"readinessAddress": "127.0.0.1:1"}},
+		"tagValuePrefix":               {`"file"`, "env", `"env"`, nil},
+		"clusterID":                    {`"file"`, "env", `"env"`, nil},
+		"usageTagValue":                {`"file"`, "env", `"env"`, nil},
+		"podCIDRNetwork":               {`"file"`, "env", `"env"`, nil},
+		"location":                     {`"PHX"`, "ASH", `"ASH"`, nil},
+		"kubeconfig":                   {`"/file"`, "/env", `"/env"`, nil},
+		"maxIPBlocks":                  {`3`, "4", `4`, nil},
+		"nodeReadyDelaySeconds":        {`3`, "4", `4`, nil},
+		"startupSpreadSeconds":         {`3`, "4", `4`, nil},
+		"startupConcurrency":           {`3`, "4", `4`, nil},
+		"canaryIntervalSeconds":        {`3`, "4", `4`, nil},
+		"reaperConcurrency":            {`3`, "4", `4`, nil},
+		"allocateDelaySeconds":         {`3`, "4", `4`, nil},
+		"orphanCheckIntervalSeconds":   {`3`, "4", `4`, nil},
+		"disableAPIErrorDetails":       {`true`, "false", `false`, nil},
+		"reconcileErrorAnnotation":     {`true`, "false", `false`, nil},
+		"serviceNodeSelectorFallback":  {`true`, "false", `false`, nil},
+		"nodeHostnameLabel":            {`true`, "false", `false`, nil},
+		"nodeDeletionProtection":       {`true`, "false", `false`, nil},
+		"uninitializedNodeDiagnostics": {`true`, "false", `false`, nil},
+		"statusResource":               {`true`, "false", `false`, nil},
+		"ipamLeaseLock":                {`true`, "false", `false`, nil},
+		"auditEvents":                  {`true`, "false", `false`, nil},
+		"vipFirewall":                  {`true`, "false", `false`, nil},
+		"allocateOnEndpoints":          {`true`, "false", `false`, nil},
+		"orphanCleanup":                {`true`, "false", `false`, nil},
+		"ignoreForeignNodes":           {`true`, "false", `false`, nil},
+	}
+	for _, binding := range configBindings {
+		binding := binding
+		if binding.env == "" {
+			continue
+		}
+		sample, ok := samples[binding.field]
+		if !ok {
+			t.Errorf("no sample for field %s", binding.field)
+			continue
+		}
+		t.Run(binding.field, func(t *testing.T) {
+			file := testConfigFile(t, sample.extra, binding.field, sample.file)
+
+			config, err := getConfig(strings.NewReader(file))
+			if err != nil {
+				t.Fatalf("unexpected error from the file: %v", err)
+			}
+			if actual := testConfigField(t, config, binding.field); actual != sample.file {
+				t.Errorf("mismatched value from the file, actual %s expected %s", actual, sample.file)
+			}
+
+			t.Setenv(binding.env, sample.env)
+			config, err = getConfig(strings.NewReader(file))
+			if err != nil {
+				t.Fatalf("unexpected error with env var %s: %v", binding.env, err)
+			}
+			if actual := testConfigField(t, config, binding.field); actual != sample.value {
+				t.Errorf("mismatched value with env var %s, actual %s expected %s", binding.env, actual, sample.value)
+			}
+		})
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	config, err := getConfig(strings.NewReader(testConfigFile(t, nil, "", "")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name     string
+		actual   any
+		expected any
+	}{
+		{"annotationIPLocation", config.AnnotationIPLocation, DefaultAnnotationIPLocation},
+		{"usageTag", config.UsageTag, pnapTag},
+		{"usageTagValue", config.UsageTagValue, pnapValue},
+		{"clusterTag", config.ClusterTag, clusterTagName},
+		{"podCIDRMaskSize", config.PodCIDRMaskSize, defaultPodCIDRMaskSize},
+		{"apiServerPort", config.APIServerPort, int32(0)},
+		{"maxIPBlocks", config.MaxIPBlocks, 0},
+	}
+	for _, tt := range tests {
+		if tt.actual != tt.expected {
+			t.Errorf("mismatched default of %s, actual %v expected %v", tt.name, tt.actual, tt.expected)
+		}
+	}
+}
+
+func TestConfigInvalidEnv(t *testing.T) {
+	for _, binding := range configBindings {
+		binding := binding
+		var value string
+		switch {
+		case binding.env == "":
+			continue
+		case strings.HasSuffix(binding.env, "_SECONDS") || binding.env == envVarAPIServerPort || binding.env == envVarMaxIPBlocks ||
+			binding.env == envVarPodCIDRMaskSize || binding.env == envVarStartupConcurrency || binding.env == envVarReaperConcurrency:
+			value = "many"
+		case binding.env == envVarCredentials || binding.env == envVarAPIRateLimits:
+			value = "{not json"
+		default:
+			var file Config
+			if err := binding.apply(&Config{}, &file, "maybe"); err == nil {
+				continue
+			}
+			value = "maybe"
+		}
+		t.Run(binding.env, func(t *testing.T) {
+			t.Setenv(binding.env, value)
+			_, err := getConfig(strings.NewReader(testConfigFile(t, nil, "", "")))
+			if err == nil || !strings.Contains(err.Error(), binding.env) {
+				t.Errorf("expected error naming %s, actual %v", binding.env, err)
+			}
+		})
+	}
+}
+
+func TestConfigNegativeNumbers(t *testing.T) {
+	for _, field := range []string{"maxIPBlocks", "nodeReadyDelaySeconds", "startupSpreadSeconds", "startupConcurrency",
+		"canaryIntervalSeconds", "reaperConcurrency", "allocateDelaySeconds", "orphanCheckIntervalSeconds"} {
+		_, err := getConfig(strings.NewReader(testConfigFile(t, nil, field, "-1")))
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("expected error naming %s, actual %v", field, err)
+		}
+	}
+}
+
+func TestConfigPprofRequiresReadinessAddress(t *testing.T) {
+	_, err := getConfig(strings.NewReader(testConfigFile(t, nil, "pprof", "true")))
+	if err == nil || !strings.Contains(err.Error(), "readinessAddress") {
+		t.Errorf("expected error naming readinessAddress, actual %v", err)
+	}
+}
+
+func TestConfigMetadataProxyRequiresTLS(t *testing.T) {
+	_, err := getConfig(strings.NewReader(testConfigFile(t, map[string]any{"metadataProxyCertFile": "/tls.crt"}, "metadataProxyAddress", `":8090"`)))
+	if err == nil || !strings.Contains(err.Error(), "metadataProxyKeyFile") {
+		t.Errorf("expected error naming metadataProxyKeyFile, actual %v", err)
+	}
+}
+
+func TestConfigControlPlaneIPKubeVIPAnnotations(t *testing.T) {
+	tests := []struct {
+		setting string
+		valid   bool
+	}{
+		{"kube-vip://net1", true},
+		{"kube-vip://net1?annotations=true", false},
+		{"kube-vip://net1?mode=daemonset", false},
+	}
+	for i, tt := range tests {
+		extra := map[string]any{"loadbalancer": tt.setting}
+		_, err := getConfig(strings.NewReader(testConfigFile(t, extra, "controlPlaneIP", `"10.0.0.1"`)))
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%d: %s mismatched valid, actual %t expected %t, error %v", i, tt.setting, valid, tt.valid, err)
+		}
+	}
+}
+
+func TestConfigLoadBalancerPrecedence(t *testing.T) {
+	structured := `{"clientID": "id", "clientSecret": "secret", "loadbalancerConfig": {"type": "kube-vip", "network": "net1"}}`
+	config, err := getConfig(strings.NewReader(structured))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.LoadBalancerSetting != config.LoadBalancerConfig.URL() {
+		t.Errorf("mismatched setting from loadbalancerConfig, actual %s expected %s", config.LoadBalancerSetting, config.LoadBalancerConfig.URL())
+	}
+
+	t.Setenv(loadBalancerSettingName, "kube-vip://env")
+	if config, err = getConfig(strings.NewReader(structured)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.LoadBalancerSetting != "kube-vip://env" {
+		t.Errorf("env var %s does not override loadbalancerConfig, actual %s", loadBalancerSettingName, config.LoadBalancerSetting)
+	}
+
+	both := `{"clientID": "id", "clientSecret": "secret", "loadbalancer": "kube-vip://", "loadbalancerConfig": {"type": "kube-vip", "network": "net1"}}`
+	if _, err := getConfig(strings.NewReader(both)); err == nil {
+		t.Errorf("expected error with both loadbalancer and loadbalancerConfig")
+	}
+}
+
+func TestConfigRequiredCredentials(t *testing.T) {
+	if _, err := getConfig(strings.NewReader(`{"clientSecret": "secret"}`)); err == nil || !strings.Contains(err.Error(), clientIDName) {
+		t.Errorf("expected error naming %s, actual %v", clientIDName, err)
+	}
+	if _, err := getConfig(strings.NewReader(`{"clientID": "id"}`)); err == nil || !strings.Contains(err.Error(), clientSecretName) {
+		t.Errorf("expected error naming %s, actual %v", clientSecretName, err)
+	}
+	t.Setenv(clientIDName, "env-id")
+	t.Setenv(clientSecretName, "env-secret")
+	if _, err := getConfig(strings.NewReader(`{}`)); err != nil {
+		t.Errorf("unexpected error with credentials from env vars: %v", err)
+	}
+}
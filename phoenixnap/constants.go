@@ -4,17 +4,175 @@ const (
 	pnapIdentifier              = "cloud-provider-phoenixnap-auto"
 	pnapTag                     = "usage"
 	pnapValue                   = pnapIdentifier
-	deleteTag                   = "delete"
+	deleteTag                   = "pnap-ccm-delete"
+	releasedServiceTag          = "pnap-ccm-released-service"
+	secondaryServiceTag         = "pnap-ccm-secondary-service"
+	gatewayTag                  = "pnap-ccm-gateway"
 	activeValue                 = "true"
 	serviceNamespaceTag         = "serviceNamespace"
 	serviceNameTag              = "serviceName"
+	assignedIPTag               = "assignedIP"
 	ccmIPDescription            = "PhoenixNAP Kubernetes CCM auto-generated for Load Balancer"
 	DefaultAnnotationIPLocation = "phoenixnap.com/ip-location"
-	serviceBlockCidr            = 29
-	gcIterationSeconds          = 30
-	serverCategory              = "SERVER"
-	publicNetworkCaps           = "PUBLIC_NETWORK"
-	publicNetwork               = "public network"
+	annotationExternalIPs       = "phoenixnap.com/external-ips"
+	annotationReconcileError    = "phoenixnap.com/last-reconcile-error"
+	annotationLoadBalancerName  = "phoenixnap.com/load-balancer-name"
+	// annotationAnnouncedExternalIPs the external IPs last announced for a Service in externalIPs mode, so that
+	// those removed from its spec.externalIPs are withdrawn
+	annotationAnnouncedExternalIPs = "phoenixnap.com/announced-external-ips"
+	serviceBlockCidr               = 29
+	gcIterationSeconds             = 30
+	serverCategory                 = "SERVER"
+)
+
+const (
+	// legacyDeleteTag the deletion marker used by earlier versions; still honoured on blocks the CCM released,
+	// i.e. without service tags, so that blocks released before an upgrade still are deleted
+	legacyDeleteTag = "delete"
+	// clusterTagName the default name of the tag with the cluster ID on IP blocks
+	clusterTagName = "cluster"
+)
+
+const (
+	// eventSourceComponent the component name on Events recorded by the CCM
+	eventSourceComponent = "cloud-provider-phoenixnap"
+	// eventReasonIPBlockLimitReached a Service needs an IP block, but the cluster is at maxIPBlocks
+	eventReasonIPBlockLimitReached = "IPBlockLimitReached"
+	// eventReasonIPBlockAssignedToServer a Service's IP block is assigned to a server that is not one of its nodes
+	eventReasonIPBlockAssignedToServer = "IPBlockAssignedToServer"
+	// eventReasonProviderAPIError the PhoenixNAP API rejected a request for a Service
+	eventReasonProviderAPIError = "ProviderAPIError"
+	// eventReasonInvalidHealthCheck the health check annotations on a Service are invalid
+	eventReasonInvalidHealthCheck = "InvalidHealthCheck"
+	// eventReasonInvalidProxyProtocol the proxy protocol annotation on a Service is invalid
+	eventReasonInvalidProxyProtocol = "InvalidProxyProtocol"
+	// eventReasonInvalidAnnounceNodes the announce-nodes annotation on a Service is invalid
+	eventReasonInvalidAnnounceNodes = "InvalidAnnounceNodes"
+	// eventReasonAnnounceNodesNotFound some nodes in the announce-nodes annotation on a Service are not eligible nodes
+	eventReasonAnnounceNodesNotFound = "AnnounceNodesNotFound"
+	// eventReasonFeaturesIgnored a Service uses features that the implementation does not support
+	eventReasonFeaturesIgnored = "FeaturesIgnored"
+	// eventReasonNodeSelectorEmpty the service node selector matches none of the nodes
+	eventReasonNodeSelectorEmpty = "NodeSelectorEmpty"
+	// eventReasonServerHostnameMismatch the hostname of the server of a node no longer is the node name
+	eventReasonServerHostnameMismatch = "ServerHostnameMismatch"
+	// eventReasonCredentialsRejected the PhoenixNAP API token endpoint rejected the client ID and secret
+	eventReasonCredentialsRejected = "CredentialsRejected"
+	// eventReasonProviderAPIUnavailable the PhoenixNAP API failed consistently, and the circuit breaker opened
+	eventReasonProviderAPIUnavailable = "ProviderAPIUnavailable"
+	// eventReasonProviderAPIAvailable the PhoenixNAP API succeeded again, and the circuit breaker closed
+	eventReasonProviderAPIAvailable = "ProviderAPIAvailable"
+	// eventReasonServerNotFound no server was found for the provider ID of a node, which the node controller may delete
+	eventReasonServerNotFound = "ServerNotFound"
+	// eventReasonInstanceCheckFailed checking the server of a node failed, e.g. for InstanceExists
+	eventReasonInstanceCheckFailed = "InstanceCheckFailed"
+	// eventReasonServerAssumedToExist the server of a node is reported as existing, as the API failed with a transient error
+	eventReasonServerAssumedToExist = "ServerAssumedToExist"
+	// eventReasonNodeUninitialized a node still has the uninitialized taint, with the reason why
+	eventReasonNodeUninitialized = "NodeUninitialized"
+	// eventReasonIPBlockPurchased an IP block was purchased for a Service, recorded on its Namespace for audit
+	eventReasonIPBlockPurchased = "IPBlockPurchased"
+	// eventReasonIPBlockReleased the IP block of a Service was released, recorded on its Namespace for audit
+	eventReasonIPBlockReleased = "IPBlockReleased"
+	// eventReasonInvalidBackendProbe the backend probe annotations on a Service are invalid
+	eventReasonInvalidBackendProbe = "InvalidBackendProbe"
+	// eventReasonBackendProbeFailed some backends of a Service failed their probe, and are not added
+	eventReasonBackendProbeFailed = "BackendProbeFailed"
+	// eventReasonAwaitingEndpoints a Service waits for a ready endpoint before its IP block is purchased
+	eventReasonAwaitingEndpoints = "AwaitingEndpoints"
+	// eventReasonOrphanedAnnouncement the implementation announces an IP for a Service that none of its IP blocks contains
+	eventReasonOrphanedAnnouncement = "OrphanedAnnouncement"
+	// eventReasonInvalidSecondaryLocation the secondary location annotation on a Service is invalid, or cannot be honored
+	eventReasonInvalidSecondaryLocation = "InvalidSecondaryLocation"
+	// eventReasonDuplicateServerHostname the name of a node is the hostname of more than one server
+	eventReasonDuplicateServerHostname = "DuplicateServerHostname"
+	// eventReasonImplementationNotReady a prerequisite of the load balancer implementation is missing from the cluster
+	eventReasonImplementationNotReady = "LoadBalancerImplementationNotReady"
+	// eventReasonImplementationReady the prerequisites of the load balancer implementation appeared, and reconciling starts
+	eventReasonImplementationReady = "LoadBalancerImplementationReady"
+	// eventReasonVIPConflict the IP of a Service is the address of a node, or the IP of another Service
+	eventReasonVIPConflict = "VIPConflict"
+	// eventReasonGatewayAddressFailed a Gateway of the phoenixnap.com/gateway-class controller did not get its address
+	eventReasonGatewayAddressFailed = "GatewayAddressFailed"
+)
+
+const (
+	// implementorOpAddService metrics label for calls to AddService of the load balancer implementation
+	implementorOpAddService = "AddService"
+	// implementorOpUpdateService metrics label for calls to UpdateService of the load balancer implementation
+	implementorOpUpdateService = "UpdateService"
+	// implementorOpRemoveService metrics label for calls to RemoveService of the load balancer implementation
+	implementorOpRemoveService = "RemoveService"
+	// implementorOpSetHealthCheck metrics label for calls to SetHealthCheck of the load balancer implementation
+	implementorOpSetHealthCheck = "SetHealthCheck"
+	// implementorOpSetProxyProtocol metrics label for calls to SetProxyProtocol of the load balancer implementation
+	implementorOpSetProxyProtocol = "SetProxyProtocol"
+	// implementorOpSync metrics label for the periodic calls to Sync of the load balancer implementation
+	implementorOpSync = "Sync"
+	// implementorOpListAnnouncements metrics label for the calls to ListAnnouncements of the load balancer implementation
+	implementorOpListAnnouncements = "ListAnnouncements"
+	// implementorOpAddSecondaryIP metrics label for the calls to AddSecondaryIP of the load balancer implementation
+	implementorOpAddSecondaryIP = "AddSecondaryIP"
+	// implementorOpRemoveSecondaryIP metrics label for the calls to RemoveSecondaryIP of the load balancer implementation
+	implementorOpRemoveSecondaryIP = "RemoveSecondaryIP"
+	// implementorOpSetPorts metrics label for the calls to SetPorts of the load balancer implementation
+	implementorOpSetPorts = "SetPorts"
+	// implementorOpSetServiceIPs metrics label for the calls to SetServiceIPs of the load balancer implementation
+	implementorOpSetServiceIPs = "SetServiceIPs"
+)
+
+const (
+	// controlPlaneServiceNamespace namespace of the pseudo-service for the control plane IP
+	controlPlaneServiceNamespace = "kube-system"
+	// controlPlaneServiceName name of the pseudo-service for the control plane IP
+	controlPlaneServiceName = "kube-apiserver"
+	// controlPlaneSyncSeconds how often the control plane nodes are refreshed
+	controlPlaneSyncSeconds = 30
+	// labelControlPlane the label on control plane nodes
+	labelControlPlane = "node-role.kubernetes.io/control-plane"
+	// labelMaster the legacy label on control plane nodes
+	labelMaster = "node-role.kubernetes.io/master"
+)
+
+const (
+	// gatewayControllerName the controllerName of the GatewayClasses whose Gateways the CCM gives an IP block
+	gatewayControllerName = "phoenixnap.com/gateway-class"
+	// gatewayGroup the API group of the Gateway API
+	gatewayGroup = "gateway.networking.k8s.io"
+	// gatewayVersion the version of the Gateway API that is read and written
+	gatewayVersion = "v1beta1"
+	// gatewayAddressType the type of the addresses in the status of a Gateway
+	gatewayAddressType = "IPAddress"
+	// gatewaySyncSeconds how often the Gateways are synced
+	gatewaySyncSeconds = 30
+)
+
+const (
+	// annotationHealthCheckPort the node port on which to check the health of a Service's backends
+	annotationHealthCheckPort = "phoenixnap.com/health-check-port"
+	// annotationHealthCheckPath the HTTP path to check; if not set, a TCP connect is used
+	annotationHealthCheckPath = "phoenixnap.com/health-check-path"
+	// annotationHealthCheckInterval the interval between checks, as a duration, e.g. 10s
+	annotationHealthCheckInterval = "phoenixnap.com/health-check-interval"
+	// annotationProxyProtocol whether the implementation sends the PROXY protocol header to backends, true or false
+	annotationProxyProtocol = "phoenixnap.com/proxy-protocol"
+	// annotationAnnounceNodes comma-separated names of the only nodes that may announce the IP of a Service
+	annotationAnnounceNodes = "phoenixnap.com/announce-nodes"
+	// annotationLoadBalancerHostname the hostname of the ingress of a Service, instead of its IP, if the implementation proxies
+	annotationLoadBalancerHostname = "phoenixnap.com/load-balancer-hostname"
+	// annotationProbeBackends whether backends are probed on the health check before they are added, true or false
+	annotationProbeBackends = "phoenixnap.com/probe-backends"
+	// annotationSecondaryLocation whether a Service gets a second IP, in the secondary location, true or false
+	annotationSecondaryLocation = "phoenixnap.com/secondary-location"
+)
+
+const (
+	// ipBlockCacheSeconds how long a list of the IP blocks of the cluster is reused
+	ipBlockCacheSeconds = 5
+	// circuitBreakerThreshold consecutive PhoenixNAP API failures after which calls are short-circuited
+	circuitBreakerThreshold = 5
+	// circuitBreakerCooldownSeconds how long to short-circuit calls before trying the API again
+	circuitBreakerCooldownSeconds = 30
 )
 
 var (
@@ -40,3 +198,247 @@ const (
 	InstanceStatusError      instanceStatus = "error"
 	InstanceStatusDeleting   instanceStatus = "deleting"
 )
+
+const (
+	// blockStatusCreating the status of an IP block that is still being provisioned
+	blockStatusCreating = "creating"
+	// blockStatusSubdividing the status of an IP block that is being split, whose CIDR may change
+	blockStatusSubdividing = "subdividing"
+	// blockStatusUnassigning the status of an IP block that is being unassigned from its resource
+	blockStatusUnassigning = "unassigning"
+	// blockStatusUnassigned the status of an IP block that is not assigned to any resource
+	blockStatusUnassigned = "unassigned"
+	// blockReadyInitialSeconds how long to wait before getting a pending IP block again, doubling each time
+	blockReadyInitialSeconds = 1
+	// blockReadyMaxSeconds the longest wait between getting a pending IP block
+	blockReadyMaxSeconds = 8
+	// blockReadyAttempts how often to get a pending IP block, about 30 seconds in all, before retrying the Service later
+	blockReadyAttempts = 7
+)
+
+const (
+	// apiRetryInitialMilliseconds how long to wait before retrying a failed PhoenixNAP API call, doubling each time
+	apiRetryInitialMilliseconds = 500
+	// apiRetryMaxSeconds the longest wait between retries of a failed PhoenixNAP API call
+	apiRetryMaxSeconds = 4
+	// apiRetryAttempts how often to call the PhoenixNAP API, including the first call, when it fails or rate limits
+	apiRetryAttempts = 3
+)
+
+const (
+	// clusterIDInitialSeconds how long to wait before getting the kube-system namespace again at startup, doubling each time
+	clusterIDInitialSeconds = 1
+	// clusterIDMaxSeconds the longest wait between getting the kube-system namespace at startup
+	clusterIDMaxSeconds = 8
+	// clusterIDAttempts how often to get the kube-system namespace at startup, about 30 seconds in all, before
+	// getting it on first use instead
+	clusterIDAttempts = 7
+)
+
+const (
+	// podCIDRSyncSeconds how often to allocate PodCIDRs to nodes that do not have one yet
+	podCIDRSyncSeconds = 30
+	// defaultPodCIDRMaskSize prefix length of the PodCIDR of each node, unless configured
+	defaultPodCIDRMaskSize = 24
+)
+
+const (
+	// implementorNamespaceParam the query parameter of the loadbalancer URL with the namespace of the implementation's resources
+	implementorNamespaceParam = "namespace"
+	// implementorModeParam the query parameter of the loadbalancer URL with the kube-vip deployment mode
+	implementorModeParam = "mode"
+	// implementorAnnotationsParam the query parameter of the loadbalancer URL that has kube-vip read its settings from service annotations
+	implementorAnnotationsParam = "annotations"
+	// implementorServiceInterfaceParam the query parameter of the loadbalancer URL with the interface on which kube-vip announces IPs
+	implementorServiceInterfaceParam = "serviceInterface"
+	// implementorBGPPasswordSecretParam the query parameter of the loadbalancer URL with the Secret of the kube-vip BGP passwords
+	implementorBGPPasswordSecretParam = "bgpPasswordSecret"
+	// implementorBGPAnnotationPrefixParam the query parameter of the loadbalancer URL with the prefix of the kube-vip BGP node annotations
+	implementorBGPAnnotationPrefixParam = "bgpAnnotationPrefix"
+	// implementorBGPSharedPasswordParam the query parameter of the loadbalancer URL that has the nodes without a kube-vip
+	// BGP password of their own share one
+	implementorBGPSharedPasswordParam = "bgpSharedPassword"
+	// defaultImplementorNamespace the namespace of the implementation's resources, if not configured
+	defaultImplementorNamespace = "kube-system"
+)
+
+const (
+	// nodeReadyRecheckSeconds how often to check whether nodes held back by the node ready delay have become eligible
+	nodeReadyRecheckSeconds = 10
+)
+
+const (
+	// ipBlockListWarnSize the number of IP blocks of the cluster above which listing them logs a warning
+	ipBlockListWarnSize = 250
+)
+
+const (
+	// loadBalancerNamePrefix the start of the name of each load balancer
+	loadBalancerNamePrefix = "pnap"
+	// maxLoadBalancerNameLength the longest load balancer name, that of a DNS label
+	maxLoadBalancerNameLength = 63
+	// loadBalancerNameHashLength the number of hex digits of the hash at the end of a load balancer name
+	loadBalancerNameHashLength = 8
+)
+
+const (
+	// checkAccountDefault the account name in check results for the default credentials
+	checkAccountDefault = "default"
+	// checkTokenError the start of the error of a call whose credentials were rejected by the token endpoint
+	checkTokenError = "oauth2: cannot fetch token"
+)
+
+const (
+	// labelServerHostname the node label with the current hostname of its server, if enabled
+	labelServerHostname = "phoenixnap.com/server-hostname"
+)
+
+const (
+	// productCatalogRefreshSeconds how long the server products of the billing API are cached
+	productCatalogRefreshSeconds = 3600
+	// productCatalogValidateSeconds how long validating the product catalog at startup may take
+	productCatalogValidateSeconds = 30
+	// pricingModelHourly the pricing model of hourly billed plans, whose price is the instance type price tier
+	pricingModelHourly = "HOURLY"
+)
+
+const (
+	// credentialRejectionThreshold the number of calls in a row whose credentials are rejected, after which the CCM exits
+	credentialRejectionThreshold = 5
+	// credentialFailureRejected metrics label for calls whose token could not be fetched, as the credentials were rejected
+	credentialFailureRejected = "rejected"
+	// credentialFailureUnauthorized metrics label for calls whose token was not accepted by the API
+	credentialFailureUnauthorized = "unauthorized"
+	// credentialVerifySeconds how long verifying the credentials at startup may take
+	credentialVerifySeconds = 30
+)
+
+// oauthRejectedErrorCodes OAuth error codes of the token endpoint for client credentials that are invalid or disabled
+var oauthRejectedErrorCodes = []string{"invalid_client", "unauthorized_client"}
+
+const (
+	// tokenRefreshAheadSeconds how long before its expiry the API token is refreshed
+	tokenRefreshAheadSeconds = 60
+	// tokenPrefetchSeconds how often the API tokens are checked, and refreshed if they expire soon
+	tokenPrefetchSeconds = 30
+	// tokenRefreshWarnThreshold the number of failed token refreshes in a row from which each is logged as a warning
+	tokenRefreshWarnThreshold = 3
+	// tokenRefreshSuccess metrics label for successful token refreshes
+	tokenRefreshSuccess = "success"
+	// tokenRefreshFailure metrics label for failed token refreshes
+	tokenRefreshFailure = "failure"
+)
+
+const (
+	// kubeClientName the name, and user agent, of the kubernetes client of the provider
+	kubeClientName = "cloud-provider-phoenixnap-shared-informers"
+)
+
+const (
+	// annotationServerID the ID of the server of a Node without a provider ID, e.g. set by a Cluster API provider
+	annotationServerID = "phoenixnap.com/server-id"
+	// annotationCAPIMachine the name of the Cluster API Machine of a Node, set by Cluster API
+	annotationCAPIMachine = "cluster.x-k8s.io/machine"
+)
+
+const (
+	// statusGroup the API group of the status resource
+	statusGroup = "phoenixnap.com"
+	// statusVersion the API version of the status resource
+	statusVersion = "v1alpha1"
+	// statusKind the kind of the status resource
+	statusKind = "PNAPCloudProviderStatus"
+	// statusObjectName the name of the single status object of the cluster
+	statusObjectName = "cloud-provider"
+	// statusPublishSeconds how often the sync status is written to the status object
+	statusPublishSeconds = 30
+)
+
+const (
+	// uninitializedNodeCheckSeconds how often nodes with the uninitialized taint are diagnosed, if enabled
+	uninitializedNodeCheckSeconds = 60
+	// uninitializedNodeGraceSeconds how long a new node may have the uninitialized taint before it is diagnosed
+	uninitializedNodeGraceSeconds = 120
+)
+
+const (
+	// serverListWindowSeconds how long a list of the servers of an account is shared by the lookups of nodes
+	serverListWindowSeconds = 2
+)
+
+const (
+	// ipamLeasePrefix the prefix of the names of the Leases that lock the IP blocks of Services
+	ipamLeasePrefix = "pnap-ipam-"
+	// ipamLeaseDurationSeconds how long a Lease that is not renewed locks the IP blocks of a Service
+	ipamLeaseDurationSeconds = 60
+	// ipamLeaseRetryMilliseconds how often a Lease held by another is tried again
+	ipamLeaseRetryMilliseconds = 500
+)
+
+const (
+	// canaryServiceName the name of the Service of the load balancer canary, in kube-system
+	canaryServiceName = "pnap-ccm-canary"
+	// canaryLoadBalancerClass the loadBalancerClass of the canary Service, so that the service controller ignores it
+	canaryLoadBalancerClass = "phoenixnap.com/canary"
+	// canaryTimeoutSeconds how long a cycle of the canary may take
+	canaryTimeoutSeconds = 300
+)
+
+const (
+	// defaultReaperConcurrency the most released blocks the reaper unassigns or deletes at once, by default
+	defaultReaperConcurrency = 4
+)
+
+const (
+	// backendProbeTimeoutSeconds how long a probe of a backend may take
+	backendProbeTimeoutSeconds = 2
+	// backendProbeRecheckSeconds how long after backends failed their probe they are probed again
+	backendProbeRecheckSeconds = 30
+)
+
+const (
+	// implementorSyncSeconds how often the periodic work of the load balancer implementation is done, if it has any
+	implementorSyncSeconds = 60
+	// implementorReadinessSeconds how often the prerequisites of the load balancer implementation are checked
+	// until they exist
+	implementorReadinessSeconds = 15
+)
+
+const (
+	// eventBurst the most Events of an object with a reason that are recorded at once
+	eventBurst = 5
+	// eventRefillSeconds once eventBurst Events of an object with a reason are recorded, one more is every this often
+	eventRefillSeconds = 300
+)
+
+const (
+	// reapLogRepeatCycles a repeated error of the reaper is logged again with its count every this many cycles,
+	// i.e. about every 10 minutes
+	reapLogRepeatCycles = 20
+	// reapLogListKey the key of the reapLog messages about listing the blocks, rather than about a block
+	reapLogListKey = ""
+)
+
+const (
+	// vipFirewallConfigMapPrefix the prefix of the name of the ConfigMap in the implementor namespace with the firewall
+	// rules of a VIP, before the load balancer name
+	vipFirewallConfigMapPrefix = "vip-firewall-"
+	// vipFirewallLabel the label of the ConfigMaps with the firewall rules of the VIPs, for agents to select them
+	vipFirewallLabel = "phoenixnap.com/vip-firewall"
+	// vipFirewallKeyIP the key of the VIP in a VIP firewall ConfigMap
+	vipFirewallKeyIP = "ip"
+	// vipFirewallKeyRules the key of the allowed "<protocol> <port>" of the VIP, one per line, in a VIP firewall ConfigMap
+	vipFirewallKeyRules = "rules"
+	// vipFirewallKeySourceRanges the key of the CIDRs allowed to reach the VIP, one per line, in a VIP firewall
+	// ConfigMap; absent if all are
+	vipFirewallKeySourceRanges = "sourceRanges"
+)
+
+const (
+	// labelClusterID the label of the Kubernetes resources the CCM keeps for a Service, with the ID of its cluster
+	labelClusterID = "phoenixnap.com/cluster-id"
+	// labelServiceUID the label of the Kubernetes resources the CCM keeps for a Service, with the UID of the Service
+	labelServiceUID = "phoenixnap.com/service-uid"
+	// ownerSweepSeconds how often the resources labeled with the UID of a Service that no longer exists are deleted
+	ownerSweepSeconds = 300
+)
@@ -0,0 +1,75 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// isControlPlaneNode returns true if the node has either the current or the legacy control plane role label
+func isControlPlaneNode(node *v1.Node) bool {
+	_, controlPlane := node.Labels[labelControlPlane]
+	_, master := node.Labels[labelMaster]
+	return controlPlane || master
+}
+
+// startControlPlaneAnnouncer hands ip to the implementation as if it were the IP of a Service,
+// announced by the control plane nodes, so that the kube-apiserver is reachable on it.
+// The nodes are refreshed periodically until the load balancers are closed.
+func (l *loadBalancers) startControlPlaneAnnouncer(ip string) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(controlPlaneSyncSeconds * time.Second)
+		defer ticker.Stop()
+
+		added := false
+		for {
+			var err error
+			if added, err = l.syncControlPlane(l.ctx, ip, added); err != nil {
+				klog.Errorf("unable to announce control plane IP %s: %v", ip, err)
+			}
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping control plane announcer")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// syncControlPlane passes the current control plane nodes for ip to the implementation. If added is false,
+// the pseudo-service first is added. It returns whether the pseudo-service has been added.
+func (l *loadBalancers) syncControlPlane(ctx context.Context, ip string, added bool) (bool, error) {
+	list, err := l.k8sclient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return added, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	var controlPlane []*v1.Node
+	for i := range list.Items {
+		if isControlPlaneNode(&list.Items[i]) {
+			controlPlane = append(controlPlane, &list.Items[i])
+		}
+	}
+	nodes := l.implementorNodes(ctx, controlPlane)
+	if len(nodes) == 0 {
+		klog.V(2).Infof("no control plane nodes found to announce %s", ip)
+	}
+	if added {
+		return true, l.callImplementor(implementorOpUpdateService, func() error {
+			return l.implementor.UpdateService(ctx, controlPlaneServiceNamespace, controlPlaneServiceName, nodes)
+		})
+	}
+	if err := l.callImplementor(implementorOpAddService, func() error {
+		return l.implementor.AddService(ctx, controlPlaneServiceNamespace, controlPlaneServiceName, fmt.Sprintf("%s/32", ip), nodes)
+	}); err != nil {
+		return false, err
+	}
+	klog.Infof("announcing control plane IP %s from %d nodes", ip, len(nodes))
+	return true, nil
+}
@@ -0,0 +1,81 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testRecordingLB an implementation that records the IP and nodes of each service
+type testRecordingLB struct {
+	ips   map[string]string
+	nodes map[string][]string
+}
+
+func (t *testRecordingLB) AddService(ctx context.Context, svcNamespace, svcName, ip string, nodes []loadbalancers.Node) error {
+	t.ips[svcNamespace+"/"+svcName] = ip
+	return t.UpdateService(ctx, svcNamespace, svcName, nodes)
+}
+
+func (t *testRecordingLB) RemoveService(ctx context.Context, svcNamespace, svcName string, allocations []loadbalancers.Allocation) error {
+	delete(t.ips, svcNamespace+"/"+svcName)
+	delete(t.nodes, svcNamespace+"/"+svcName)
+	return nil
+}
+
+func (t *testRecordingLB) UpdateService(ctx context.Context, svcNamespace, svcName string, nodes []loadbalancers.Node) error {
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Node.Name)
+	}
+	t.nodes[svcNamespace+"/"+svcName] = names
+	return nil
+}
+
+func (t *testRecordingLB) Capabilities() loadbalancers.Capabilities {
+	return loadbalancers.Capabilities{Protocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP}}
+}
+
+func TestSyncControlPlane(t *testing.T) {
+	l, _, _ := testGetLoadBalancers(t, 0)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+
+	for _, node := range []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "cp1", Labels: map[string]string{labelControlPlane: ""}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker1"}},
+	} {
+		if _, err := l.k8sclient.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unable to create node: %v", err)
+		}
+	}
+	key := controlPlaneServiceNamespace + "/" + controlPlaneServiceName
+
+	added, err := l.syncControlPlane(context.TODO(), "192.0.2.10", false)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case !added:
+		t.Fatalf("expected control plane pseudo-service to be added")
+	case lb.ips[key] != "192.0.2.10/32":
+		t.Errorf("mismatched IP, actual %s expected %s", lb.ips[key], "192.0.2.10/32")
+	case len(lb.nodes[key]) != 1 || lb.nodes[key][0] != "cp1":
+		t.Errorf("mismatched nodes, actual %v expected %v", lb.nodes[key], []string{"cp1"})
+	}
+
+	// a legacy-labelled control plane node joins
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "cp2", Labels: map[string]string{labelMaster: ""}}}
+	if _, err := l.k8sclient.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unable to create node: %v", err)
+	}
+	if _, err := l.syncControlPlane(context.TODO(), "192.0.2.10", added); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lb.nodes[key]) != 2 {
+		t.Errorf("mismatched nodes, actual %v expected %d nodes", lb.nodes[key], 2)
+	}
+}
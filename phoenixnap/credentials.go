@@ -0,0 +1,124 @@
+package phoenixnap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// ErrCredentialsRejected returned for PhoenixNAP API calls whose token could not be fetched,
+// because the token endpoint rejected the client ID and secret, e.g. after they were revoked.
+var ErrCredentialsRejected = errors.New("provider API credentials rejected")
+
+// credentialMonitor is an http.RoundTripper, wrapping the one that fetches the OAuth token, that tells
+// rejected credentials apart from other failures. It reports them with a metric, a log and an Event,
+// and exits once they have been rejected threshold times in a row, as nothing works until they are rotated.
+type credentialMonitor struct {
+	next http.RoundTripper
+	// clientID identifies the account in messages; unlike the secret, it may be logged
+	clientID  string
+	threshold int
+	// token fetches a token with the credentials, to verify them
+	token func(ctx context.Context) (*oauth2.Token, error)
+	// fatalf exits the CCM; klog.Fatalf, except in tests
+	fatalf func(format string, args ...any)
+
+	mutex      sync.Mutex
+	rejections int
+	recorder   record.EventRecorder
+	// eventObject the object on which Events are recorded, e.g. the kube-system namespace
+	eventObject *v1.ObjectReference
+}
+
+func newCredentialMonitor(next http.RoundTripper, clientID string, token func(ctx context.Context) (*oauth2.Token, error)) *credentialMonitor {
+	return &credentialMonitor{next: next, clientID: clientID, threshold: credentialRejectionThreshold, token: token, fatalf: klog.Fatalf}
+}
+
+// RoundTrip implements http.RoundTripper
+func (m *credentialMonitor) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := m.next.RoundTrip(req)
+	switch {
+	case err != nil && credentialsRejected(err):
+		return nil, m.rejected(err)
+	case err == nil && resp.StatusCode == http.StatusUnauthorized:
+		// the token was accepted when fetched, but no longer is, e.g. the credentials were revoked since
+		apiCredentialFailuresTotal.WithLabelValues(credentialFailureUnauthorized).Inc()
+	case err == nil:
+		m.mutex.Lock()
+		m.rejections = 0
+		m.mutex.Unlock()
+	}
+	return resp, err
+}
+
+// rejected reports a call whose credentials were rejected, and exits after threshold in a row
+func (m *credentialMonitor) rejected(err error) error {
+	apiCredentialFailuresTotal.WithLabelValues(credentialFailureRejected).Inc()
+	msg := fmt.Sprintf("PhoenixNAP API credentials with client ID %s were rejected; rotate the client ID and secret in the cloud config", m.clientID)
+	m.mutex.Lock()
+	m.rejections++
+	rejections := m.rejections
+	first := rejections == 1
+	recorder, object := m.recorder, m.eventObject
+	m.mutex.Unlock()
+
+	if first {
+		klog.Errorf("%s: %v", msg, err)
+		if recorder != nil && object != nil {
+			recorder.Event(object, v1.EventTypeWarning, eventReasonCredentialsRejected, msg)
+		}
+	}
+	if m.threshold > 0 && rejections >= m.threshold {
+		m.fatalf("%s: rejected %d times in a row: %v", msg, rejections, err)
+	}
+	return fmt.Errorf("%w: %v", ErrCredentialsRejected, err)
+}
+
+// setRecorder sets where Events about rejected credentials are recorded
+func (m *credentialMonitor) setRecorder(recorder record.EventRecorder, object *v1.ObjectReference) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recorder = recorder
+	m.eventObject = object
+}
+
+// verify fetches a token, and exits at once if the credentials are rejected, rather than
+// on the first calls of the controllers. Other errors, e.g. of the network, are only logged.
+func (m *credentialMonitor) verify(ctx context.Context) {
+	_, err := m.token(ctx)
+	switch {
+	case err == nil:
+		klog.V(2).Infof("PhoenixNAP API credentials with client ID %s verified", m.clientID)
+	case credentialsRejected(err):
+		apiCredentialFailuresTotal.WithLabelValues(credentialFailureRejected).Inc()
+		m.fatalf("PhoenixNAP API credentials with client ID %s were rejected; check the client ID and secret in the cloud config: %v", m.clientID, err)
+	default:
+		klog.Warningf("unable to verify PhoenixNAP API credentials with client ID %s: %v", m.clientID, err)
+	}
+}
+
+// credentialsRejected returns true if err is the token endpoint rejecting the client ID and secret
+func credentialsRejected(err error) bool {
+	var re *oauth2.RetrieveError
+	if !errors.As(err, &re) || re.Response == nil {
+		return false
+	}
+	if re.Response.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	for _, code := range oauthRejectedErrorCodes {
+		if bytes.Contains(re.Body, []byte(code)) {
+			return true
+		}
+	}
+	return false
+}
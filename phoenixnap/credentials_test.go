@@ -0,0 +1,210 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/clients"
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+	"golang.org/x/oauth2"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+// testRoundTripper returns the same response and error for every call
+type testRoundTripper struct {
+	resp *http.Response
+	err  error
+}
+
+func (t testRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	return t.resp, t.err
+}
+
+func testRetrieveError(status int, body string) error {
+	return &oauth2.RetrieveError{Response: &http.Response{StatusCode: status, Status: http.StatusText(status)}, Body: []byte(body)}
+}
+
+func TestCredentialsRejected(t *testing.T) {
+	tests := []struct {
+		err      error
+		rejected bool
+	}{
+		{testRetrieveError(http.StatusUnauthorized, `{"error":"invalid_client"}`), true},
+		{testRetrieveError(http.StatusBadRequest, `{"error":"unauthorized_client"}`), true},
+		{fmt.Errorf("wrapped: %w", testRetrieveError(http.StatusUnauthorized, "")), true},
+		{testRetrieveError(http.StatusServiceUnavailable, "down"), false},
+		{testRetrieveError(http.StatusBadRequest, `{"error":"invalid_scope"}`), false},
+		{errors.New("connection refused"), false},
+	}
+	for i, tt := range tests {
+		if rejected := credentialsRejected(tt.err); rejected != tt.rejected {
+			t.Errorf("%d: mismatched rejected, actual %v expected %v", i, rejected, tt.rejected)
+		}
+	}
+}
+
+func TestCredentialMonitor(t *testing.T) {
+	var fatal string
+	recorder := record.NewFakeRecorder(10)
+	rejected := testRetrieveError(http.StatusUnauthorized, `{"error":"invalid_client"}`)
+	m := newCredentialMonitor(testRoundTripper{err: rejected}, "client-1", nil)
+	m.threshold = 3
+	m.fatalf = func(format string, args ...any) { fatal = fmt.Sprintf(format, args...) }
+	m.setRecorder(recorder, &v1.ObjectReference{Kind: "Namespace", Name: "kube-system"})
+	before, _ := testutil.GetCounterMetricValue(apiCredentialFailuresTotal.WithLabelValues(credentialFailureRejected))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.phoenixnap.com/bmc/v1/servers", nil)
+	for i := 0; i < 2; i++ {
+		_, err := m.RoundTrip(req)
+		if !errors.Is(err, ErrCredentialsRejected) {
+			t.Fatalf("%d: expected ErrCredentialsRejected, got %v", i, err)
+		}
+		if reason := ReasonForError(providerError(nil, err)); reason != ErrorReasonAuth {
+			t.Errorf("%d: mismatched reason, actual %s expected %s", i, reason, ErrorReasonAuth)
+		}
+	}
+	if fatal != "" {
+		t.Errorf("unexpected exit before the threshold: %s", fatal)
+	}
+	// one Event, not one per call
+	if len(recorder.Events) != 1 {
+		t.Errorf("mismatched events, actual %d expected 1", len(recorder.Events))
+	}
+	_, _ = m.RoundTrip(req)
+	if fatal == "" {
+		t.Errorf("expected exit once the threshold is reached")
+	}
+	after, _ := testutil.GetCounterMetricValue(apiCredentialFailuresTotal.WithLabelValues(credentialFailureRejected))
+	if after-before != 3 {
+		t.Errorf("mismatched rejected credential failures, actual %v expected 3", after-before)
+	}
+
+	// a successful call starts counting again
+	m.next = testRoundTripper{resp: &http.Response{StatusCode: http.StatusOK}}
+	if _, err := m.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.rejections != 0 {
+		t.Errorf("mismatched rejections after success, actual %d expected 0", m.rejections)
+	}
+
+	// a token the API does not accept is counted, but is not fatal
+	m.next = testRoundTripper{resp: &http.Response{StatusCode: http.StatusUnauthorized}}
+	before, _ = testutil.GetCounterMetricValue(apiCredentialFailuresTotal.WithLabelValues(credentialFailureUnauthorized))
+	if _, err := m.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, _ = testutil.GetCounterMetricValue(apiCredentialFailuresTotal.WithLabelValues(credentialFailureUnauthorized))
+	if after-before != 1 {
+		t.Errorf("mismatched unauthorized credential failures, actual %v expected 1", after-before)
+	}
+}
+
+func TestCredentialMonitorVerify(t *testing.T) {
+	tests := []struct {
+		err   error
+		fatal bool
+	}{
+		{nil, false},
+		{testRetrieveError(http.StatusUnauthorized, `{"error":"invalid_client"}`), true},
+		{errors.New("dial tcp: connection refused"), false},
+	}
+	for i, tt := range tests {
+		var fatal bool
+		m := newCredentialMonitor(nil, "client-1", func(context.Context) (*oauth2.Token, error) {
+			return &oauth2.Token{AccessToken: "token"}, tt.err
+		})
+		m.fatalf = func(string, ...any) { fatal = true }
+		m.verify(context.TODO())
+		if fatal != tt.fatal {
+			t.Errorf("%d: mismatched exit, actual %v expected %v", i, fatal, tt.fatal)
+		}
+	}
+}
+
+// testAuthClients returns the clients of the account with the credentials and scopes, authenticated
+// by the transport of the CCM against a test server that validates its tokens
+func testAuthClients(t *testing.T, auth *pnapServer.Auth, clientSecret string, scopes ...string) (*clients.Set, *credentialMonitor, *tokenMonitor) {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{Store: backend, ErrorHandler: &apiServerError{t: t}, Auth: auth}
+	ts := httptest.NewServer(fake.CreateHandler())
+	t.Cleanup(ts.Close)
+	credentials, tokens := newAuthTransport(ts.URL+pnapServer.TokenPath, auth.ClientID, clientSecret, scopes, http.DefaultTransport)
+	credentials.fatalf = func(format string, args ...any) { t.Logf("exit: "+format, args...) }
+	set, err := clients.New(clients.Options{BaseURL: ts.URL, Transport: credentials})
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	return set, credentials, tokens
+}
+
+func TestAuthTransport(t *testing.T) {
+	auth := &pnapServer.Auth{ClientID: "client-1", ClientSecret: "secret-1", Scopes: defaultAPIScopes}
+	set, _, tokens := testAuthClients(t, auth, "secret-1", "bmc.read", "tags.read")
+
+	// the token is fetched once, and reused
+	for i := 0; i < 2; i++ {
+		if _, resp, err := set.BMC.ServersApi.ServersGet(context.TODO()).Execute(); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, providerError(resp, err))
+		}
+	}
+	if issued := auth.Issued(); issued != 1 {
+		t.Errorf("mismatched tokens issued, actual %d expected %d", issued, 1)
+	}
+
+	// the read scope does not permit changes
+	_, resp, err := set.IP.IPBlocksApi.IpBlocksPost(context.TODO()).IpBlockCreate(*ipapi.NewIpBlockCreate("ASH", "/29")).Execute()
+	if reason := ReasonForError(providerError(resp, err)); reason != ErrorReasonAuth || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected %s error for a change with a read scope, got %s %v", ErrorReasonAuth, reason, err)
+	}
+
+	// a token no longer accepted fails the call, and is counted, but is not a rejection of the credentials
+	before, _ := testutil.GetCounterMetricValue(apiCredentialFailuresTotal.WithLabelValues(credentialFailureUnauthorized))
+	auth.Revoke()
+	_, resp, err = set.BMC.ServersApi.ServersGet(context.TODO()).Execute()
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized || errors.Is(err, ErrCredentialsRejected) {
+		t.Errorf("expected 401 with a revoked token, got %v", err)
+	}
+	after, _ := testutil.GetCounterMetricValue(apiCredentialFailuresTotal.WithLabelValues(credentialFailureUnauthorized))
+	if after-before != 1 {
+		t.Errorf("mismatched unauthorized credential failures, actual %v expected 1", after-before)
+	}
+
+	// a token about to expire is refreshed before the call
+	tokens.refreshAhead = 2 * time.Hour
+	if _, resp, err := set.BMC.ServersApi.ServersGet(context.TODO()).Execute(); err != nil {
+		t.Fatalf("unexpected error after refresh: %v", providerError(resp, err))
+	}
+	if issued := auth.Issued(); issued != 2 {
+		t.Errorf("mismatched tokens issued after refresh, actual %d expected %d", issued, 2)
+	}
+}
+
+func TestAuthTransportRejected(t *testing.T) {
+	// wrong credentials are rejected
+	auth := &pnapServer.Auth{ClientID: "client-1", ClientSecret: "secret-1", Scopes: defaultAPIScopes}
+	set, _, _ := testAuthClients(t, auth, "wrong", defaultAPIScopes...)
+	if _, _, err := set.BMC.ServersApi.ServersGet(context.TODO()).Execute(); !errors.Is(err, ErrCredentialsRejected) {
+		t.Errorf("expected %v, got %v", ErrCredentialsRejected, err)
+	}
+
+	// a scope that is not granted fails to get a token, but does not reject the credentials
+	set, _, _ = testAuthClients(t, auth, "secret-1", "bmc", "billing")
+	_, _, err := set.BMC.ServersApi.ServersGet(context.TODO()).Execute()
+	if err == nil || errors.Is(err, ErrCredentialsRejected) {
+		t.Errorf("expected an error other than %v, got %v", ErrCredentialsRejected, err)
+	}
+	if auth.Issued() != 0 {
+		t.Errorf("mismatched tokens issued, actual %d expected %d", auth.Issued(), 0)
+	}
+}
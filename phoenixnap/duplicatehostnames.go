@@ -0,0 +1,97 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DuplicateHostnamesError a node whose name is the hostname of more than one server is not resolved; the default
+	DuplicateHostnamesError = ""
+	// DuplicateHostnamesFirst a node whose name is the hostname of more than one server is resolved to the first one
+	// listed, as before duplicates were detected
+	DuplicateHostnamesFirst = "first"
+	// DuplicateHostnamesClusterTag a node whose name is the hostname of more than one server is resolved to the one
+	// whose cluster tag has the ID of the cluster, if exactly one has
+	DuplicateHostnamesClusterTag = "clusterTag"
+)
+
+// validateDuplicateHostnames returns an error if policy is not one of the duplicate hostname policies
+func validateDuplicateHostnames(policy string) error {
+	switch policy {
+	case DuplicateHostnamesError, DuplicateHostnamesFirst, DuplicateHostnamesClusterTag:
+		return nil
+	}
+	return fmt.Errorf("invalid duplicate hostnames policy %q, must be empty, %q or %q", policy, DuplicateHostnamesFirst, DuplicateHostnamesClusterTag)
+}
+
+// duplicateHostnameError a lookup by name found more than one server with the hostname
+type duplicateHostnameError struct {
+	hostname string
+	servers  []bmcapi.Server
+}
+
+func (e *duplicateHostnameError) Error() string {
+	ids := make([]string, 0, len(e.servers))
+	for _, server := range e.servers {
+		ids = append(ids, server.Id)
+	}
+	return fmt.Sprintf("hostname %s is that of %d servers: %s", e.hostname, len(e.servers), strings.Join(ids, ", "))
+}
+
+// resolveDuplicateHostname returns the server of the node among the servers with its name as hostname, by the
+// duplicate hostnames policy, and reports the collision so that it is fixed
+func (i *instances) resolveDuplicateHostname(ctx context.Context, node *v1.Node, dup *duplicateHostnameError) (*bmcapi.Server, error) {
+	serverHostnameDuplicatesTotal.Inc()
+	server, err := i.chooseDuplicate(ctx, dup)
+	msg := fmt.Sprintf("%v; rename all but one server, or give the node the annotation %s", dup, annotationServerID)
+	if err == nil {
+		msg = fmt.Sprintf("%s; chose server %s by the policy %q", msg, server.Id, i.duplicateHostnames)
+	}
+	klog.Warningf("node %s: %s", node.Name, msg)
+	if i.recorder != nil {
+		i.recorder.Event(node, v1.EventTypeWarning, eventReasonDuplicateServerHostname, msg)
+	}
+	return server, err
+}
+
+// chooseDuplicate returns one of the servers with the same hostname by the duplicate hostnames policy, or the error
+// if the policy chooses none
+func (i *instances) chooseDuplicate(ctx context.Context, dup *duplicateHostnameError) (*bmcapi.Server, error) {
+	switch i.duplicateHostnames {
+	case DuplicateHostnamesFirst:
+		return &dup.servers[0], nil
+	case DuplicateHostnamesClusterTag:
+		clusterID, err := i.ownClusterID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var owned []bmcapi.Server
+		for _, server := range dup.servers {
+			for _, tag := range server.Tags {
+				if tag.Name == i.clusterTag && tag.Value != nil && *tag.Value == clusterID {
+					owned = append(owned, server)
+					break
+				}
+			}
+		}
+		if len(owned) == 1 {
+			return &owned[0], nil
+		}
+		return nil, fmt.Errorf("%w, and %d have the tag %s=%s", dup, len(owned), i.clusterTag, clusterID)
+	default:
+		return nil, dup
+	}
+}
+
+// ownClusterID returns the ID of the cluster in the cluster tag: the configured one, or the UID of its kube-system
+// namespace, as for IP blocks
+func (i *instances) ownClusterID(ctx context.Context) (string, error) {
+	return i.cluster.get(ctx)
+}
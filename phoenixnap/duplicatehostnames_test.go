@@ -0,0 +1,95 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDuplicateHostnames(t *testing.T) {
+	vc, backend := testGetValidCloud(t, "")
+	inst := vc.instances
+	recorder := record.NewFakeRecorder(10)
+	inst.recorder = recorder
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	first, err := backend.CreateServer(nodeName, product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	second, err := backend.CreateServer(nodeName, product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	node := testNode("", nodeName)
+
+	_, err = inst.InstanceMetadata(context.TODO(), node)
+	var dup *duplicateHostnameError
+	if !errors.As(err, &dup) || len(dup.servers) != 2 {
+		t.Fatalf("expected duplicate hostname error for 2 servers, actual %v", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, eventReasonDuplicateServerHostname) {
+		t.Errorf("expected %s event, actual %s", eventReasonDuplicateServerHostname, event)
+	}
+
+	inst.duplicateHostnames = DuplicateHostnamesFirst
+	md, err := inst.InstanceMetadata(context.TODO(), node)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case md.ProviderID != providerIDFromServer(first) && md.ProviderID != providerIDFromServer(second):
+		t.Errorf("mismatched provider ID, actual %s expected that of either server", md.ProviderID)
+	}
+	// the collision is still reported
+	if event := <-recorder.Events; !strings.Contains(event, eventReasonDuplicateServerHostname) {
+		t.Errorf("expected %s event, actual %s", eventReasonDuplicateServerHostname, event)
+	}
+}
+
+func TestChooseDuplicateClusterTag(t *testing.T) {
+	inst := &instances{duplicateHostnames: DuplicateHostnamesClusterTag, clusterTag: clusterTagName, cluster: newClusterIDSource(nil, testClusterID)}
+	tagged := func(id, cluster string) bmcapi.Server {
+		server := bmcapi.Server{Id: id, Hostname: nodeName}
+		if cluster != "" {
+			server.Tags = []bmcapi.TagAssignment{{Name: clusterTagName, Value: &cluster}}
+		}
+		return server
+	}
+	tests := []struct {
+		name    string
+		servers []bmcapi.Server
+		id      string
+	}{
+		{"one owned", []bmcapi.Server{tagged("a", "other"), tagged("b", testClusterID), tagged("c", "")}, "b"},
+		{"none owned", []bmcapi.Server{tagged("a", "other"), tagged("b", "")}, ""},
+		{"two owned", []bmcapi.Server{tagged("a", testClusterID), tagged("b", testClusterID)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := inst.chooseDuplicate(context.TODO(), &duplicateHostnameError{hostname: nodeName, servers: tt.servers})
+			switch {
+			case tt.id == "" && err == nil:
+				t.Errorf("expected error, chose %s", server.Id)
+			case tt.id != "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.id != "" && server.Id != tt.id:
+				t.Errorf("mismatched server, actual %s expected %s", server.Id, tt.id)
+			}
+		})
+	}
+}
+
+func TestValidateDuplicateHostnames(t *testing.T) {
+	for _, policy := range []string{DuplicateHostnamesError, DuplicateHostnamesFirst, DuplicateHostnamesClusterTag} {
+		if err := validateDuplicateHostnames(policy); err != nil {
+			t.Errorf("unexpected error for %q: %v", policy, err)
+		}
+	}
+	if err := validateDuplicateHostnames("random"); err == nil {
+		t.Errorf("expected error for an unknown policy")
+	}
+}
@@ -0,0 +1,144 @@
+package phoenixnap
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	"k8s.io/klog/v2"
+)
+
+// The PhoenixNAP API returns enumerations as plain strings, whose values and casing change over time, e.g. the
+// assigned resource type of IP blocks is "public network" or "PUBLIC_NETWORK". Values are compared once
+// normalized, and values that are not known are logged once and counted, rather than failing.
+
+const (
+	// enumServerStatus the status of a server
+	enumServerStatus = "server status"
+	// enumBlockStatus the status of an IP block
+	enumBlockStatus = "IP block status"
+	// enumAssignedResourceType the type of the resource to which an IP block is assigned
+	enumAssignedResourceType = "IP block assigned resource type"
+)
+
+// knownEnums the known values of each enumeration
+var knownEnums = map[string][]string{
+	enumServerStatus:         instanceStatusValues(),
+	enumBlockStatus:          {blockStatusCreating, "assigning", "assigned", blockStatusUnassigning, blockStatusUnassigned, blockStatusSubdividing, "error"},
+	enumAssignedResourceType: assignedResourceTypeValues(),
+}
+
+// assignedResourceType the type of the resource to which an IP block is assigned
+type assignedResourceType string
+
+const (
+	assignedResourceServer         assignedResourceType = "server"
+	assignedResourcePrivateNetwork assignedResourceType = "private network"
+	assignedResourcePublicNetwork  assignedResourceType = "public network"
+)
+
+// assignedResourceTypes the documented types of resources to which IP blocks are assigned
+var assignedResourceTypes = []assignedResourceType{
+	assignedResourceServer,
+	assignedResourcePrivateNetwork,
+	assignedResourcePublicNetwork,
+}
+
+// unknownEnums the unknown values already seen, by enumeration and normalized value
+var unknownEnums sync.Map
+
+func instanceStatusValues() []string {
+	values := make([]string, 0, len(instanceStatuses))
+	for _, status := range instanceStatuses {
+		values = append(values, string(status))
+	}
+	return values
+}
+
+func assignedResourceTypeValues() []string {
+	values := make([]string, 0, len(assignedResourceTypes))
+	for _, resourceType := range assignedResourceTypes {
+		values = append(values, string(resourceType))
+	}
+	return values
+}
+
+// normalizeEnum returns value in lower case, without spaces, '_' and '-', so that "PUBLIC_NETWORK",
+// "public network" and "publicNetwork" are the same
+func normalizeEnum(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-':
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+}
+
+// knownEnum returns whether value is a known value of enum. The first time an unknown value is seen,
+// it is logged as a warning, and counted.
+func knownEnum(enum, value string) bool {
+	normalized := normalizeEnum(value)
+	for _, known := range knownEnums[enum] {
+		if normalizeEnum(known) == normalized {
+			return true
+		}
+	}
+	if _, seen := unknownEnums.LoadOrStore(enum+"/"+normalized, true); !seen {
+		klog.Warningf("the PhoenixNAP API returned the unknown %s %q, which is treated as none of the known ones", enum, value)
+		apiUnknownEnumValuesTotal.WithLabelValues(enum).Inc()
+	}
+	return false
+}
+
+// enumEquals returns whether value of enum is expected, once both are normalized
+func enumEquals(enum, value, expected string) bool {
+	knownEnum(enum, value)
+	return normalizeEnum(value) == normalizeEnum(expected)
+}
+
+// blockStatus returns the normalized status of block, to compare with the normalized block status constants
+func blockStatus(block ipapi.IpBlock) string {
+	knownEnum(enumBlockStatus, block.Status)
+	return normalizeEnum(block.Status)
+}
+
+// parseAssignedResourceType returns the assigned resource type that value spells, in any casing, and false
+// if it is not one of the documented ones
+func parseAssignedResourceType(value string) (assignedResourceType, bool) {
+	normalized := normalizeEnum(value)
+	for _, resourceType := range assignedResourceTypes {
+		if normalizeEnum(string(resourceType)) == normalized {
+			return resourceType, true
+		}
+	}
+	// warn about it
+	knownEnum(enumAssignedResourceType, value)
+	return "", false
+}
+
+// blockAssignedResourceType returns the type of the resource to which block is assigned, and false if it is
+// not assigned, or the type is not known
+func blockAssignedResourceType(block ipapi.IpBlock) (assignedResourceType, bool) {
+	if block.AssignedResourceType == nil {
+		return "", false
+	}
+	return parseAssignedResourceType(*block.AssignedResourceType)
+}
+
+// blockAssignedTo returns whether block is assigned to a resource of resourceType
+func blockAssignedTo(block ipapi.IpBlock, resourceType assignedResourceType) bool {
+	actual, ok := blockAssignedResourceType(block)
+	return ok && actual == resourceType
+}
+
+// blockAssignedToNetwork returns whether block is assigned to the public network: by its type and ID, or,
+// if its type is not known, by its ID alone, so that a new spelling of the type does not fail it
+func blockAssignedToNetwork(block ipapi.IpBlock, network string) bool {
+	if block.AssignedResourceId == nil || *block.AssignedResourceId != network {
+		return false
+	}
+	resourceType, known := blockAssignedResourceType(block)
+	return resourceType == assignedResourcePublicNetwork || (block.AssignedResourceType != nil && !known)
+}
@@ -0,0 +1,113 @@
+package phoenixnap
+
+import (
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestNormalizeEnum(t *testing.T) {
+	for _, value := range []string{"public network", "PUBLIC_NETWORK", "publicNetwork", "Public-Network"} {
+		if normalized := normalizeEnum(value); normalized != "publicnetwork" {
+			t.Errorf("mismatched normalized %q, actual %q expected %q", value, normalized, "publicnetwork")
+		}
+	}
+}
+
+func TestParseAssignedResourceType(t *testing.T) {
+	tests := []struct {
+		value        string
+		resourceType assignedResourceType
+		known        bool
+	}{
+		{"server", assignedResourceServer, true},
+		{"SERVER", assignedResourceServer, true},
+		{"Server", assignedResourceServer, true},
+		{"private network", assignedResourcePrivateNetwork, true},
+		{"PRIVATE_NETWORK", assignedResourcePrivateNetwork, true},
+		{"privateNetwork", assignedResourcePrivateNetwork, true},
+		{"private-network", assignedResourcePrivateNetwork, true},
+		{"public network", assignedResourcePublicNetwork, true},
+		{"PUBLIC_NETWORK", assignedResourcePublicNetwork, true},
+		{"publicNetwork", assignedResourcePublicNetwork, true},
+		{"Public Network", assignedResourcePublicNetwork, true},
+		{"", "", false},
+		{"load balancer", "", false},
+		{"PUBLIC_NETWORK_V2", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			resourceType, known := parseAssignedResourceType(tt.value)
+			if resourceType != tt.resourceType || known != tt.known {
+				t.Errorf("mismatched type, actual %q %v expected %q %v", resourceType, known, tt.resourceType, tt.known)
+			}
+		})
+	}
+}
+
+func TestBlockAssignedTo(t *testing.T) {
+	network := "network1"
+	other := "network2"
+	tests := []struct {
+		name          string
+		resourceType  string
+		resourceID    *string
+		server        bool
+		publicNetwork bool
+	}{
+		{"public network", "public network", &network, false, true},
+		{"public network caps", "PUBLIC_NETWORK", &network, false, true},
+		{"public network camel case", "publicNetwork", &network, false, true},
+		{"other public network", "PUBLIC_NETWORK", &other, false, false},
+		{"server", "server", &network, true, false},
+		{"server caps", "SERVER", &network, true, false},
+		{"private network", "PRIVATE_NETWORK", &network, false, false},
+		{"unknown type on the network", "PUBLIC_NETWORK_V2", &network, false, true},
+		{"unknown type on another network", "PUBLIC_NETWORK_V2", &other, false, false},
+		{"no ID", "public network", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resourceType := tt.resourceType
+			block := ipapi.IpBlock{AssignedResourceType: &resourceType, AssignedResourceId: tt.resourceID}
+			if server := isServerAssigned(block); server != tt.server {
+				t.Errorf("mismatched server assigned, actual %v expected %v", server, tt.server)
+			}
+			if assigned := blockAssignedToNetwork(block, network); assigned != tt.publicNetwork {
+				t.Errorf("mismatched network assigned, actual %v expected %v", assigned, tt.publicNetwork)
+			}
+		})
+	}
+	if blockAssignedTo(ipapi.IpBlock{}, assignedResourcePublicNetwork) {
+		t.Errorf("unassigned block is assigned to a public network")
+	}
+}
+
+func TestUnknownEnumValues(t *testing.T) {
+	before, _ := testutil.GetCounterMetricValue(apiUnknownEnumValuesTotal.WithLabelValues(enumServerStatus))
+	if !knownEnum(enumServerStatus, "POWERED_ON") {
+		t.Errorf("expected POWERED_ON to be a known server status")
+	}
+	for i := 0; i < 3; i++ {
+		if knownEnum(enumServerStatus, "hibernating") || knownEnum(enumServerStatus, "HIBERNATING") {
+			t.Errorf("expected hibernating to be an unknown server status")
+		}
+	}
+	after, _ := testutil.GetCounterMetricValue(apiUnknownEnumValuesTotal.WithLabelValues(enumServerStatus))
+	if after-before != 1 {
+		t.Errorf("mismatched unknown values counted, actual %v expected %v", after-before, 1)
+	}
+
+	// unknown statuses are none of the known ones
+	if status := blockStatus(ipapi.IpBlock{Status: "Unassigned"}); status != blockStatusUnassigned {
+		t.Errorf("mismatched block status, actual %s expected %s", status, blockStatusUnassigned)
+	}
+	if blockPending(ipapi.IpBlock{Cidr: "10.0.0.0/29", Status: "merging"}) {
+		t.Errorf("block with unknown status is pending")
+	}
+	if !blockPending(ipapi.IpBlock{Cidr: "10.0.0.0/29", Status: "CREATING"}) {
+		t.Errorf("creating block is not pending")
+	}
+}
@@ -0,0 +1,123 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// A Service stuck in an error loop is retried by the service controller with a backoff of at most 5 minutes, and
+// by the CCM's own loops more often, and each failure may record an Event. The Event broadcaster of client-go
+// aggregates similar Events, but still writes an update to etcd for each. The rate limited recorder drops the Events
+// of an object with a reason beyond a burst, and then lets one through every eventRefillSeconds, as long as they recur.
+
+// eventsNotLimited the reasons of the Events that each record a distinct change, rather than a recurring failure, e.g.
+// the audit Events, of which creating many Services in a Namespace at once records many on it
+var eventsNotLimited = map[string]bool{
+	eventReasonIPBlockPurchased: true,
+	eventReasonIPBlockReleased:  true,
+}
+
+// rateLimitedRecorder a record.EventRecorder that limits the Events of each object and reason
+type rateLimitedRecorder struct {
+	record.EventRecorder
+	clock clock.Clock
+
+	mutex sync.Mutex
+	// limiters the limiter of each object and reason, with when it last was used
+	limiters map[eventKey]*eventLimiter
+}
+
+// eventKey the object and reason of an Event
+type eventKey struct {
+	object string
+	reason string
+}
+
+// eventLimiter the limiter of an object and reason
+type eventLimiter struct {
+	limiter  flowcontrol.RateLimiter
+	lastUsed time.Time
+}
+
+// newRateLimitedRecorder returns a recorder that records through recorder, with at most eventBurst Events of an object
+// with a reason at once, and one more every eventRefillSeconds
+func newRateLimitedRecorder(recorder record.EventRecorder, c clock.Clock) *rateLimitedRecorder {
+	return &rateLimitedRecorder{EventRecorder: recorder, clock: c, limiters: map[eventKey]*eventLimiter{}}
+}
+
+func (r *rateLimitedRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.allow(object, reason) {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *rateLimitedRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.allow(object, reason) {
+		r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func (r *rateLimitedRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.allow(object, reason) {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// allow returns whether an Event of the object with the reason may be recorded now, and counts it if not
+func (r *rateLimitedRecorder) allow(object runtime.Object, reason string) bool {
+	if eventsNotLimited[reason] {
+		return true
+	}
+	key := eventKey{object: eventObjectKey(object), reason: reason}
+	now := r.clock.Now()
+
+	r.mutex.Lock()
+	r.forgetIdle(now)
+	limiter, ok := r.limiters[key]
+	if !ok {
+		limiter = &eventLimiter{limiter: flowcontrol.NewTokenBucketRateLimiterWithClock(1/float32(eventRefillSeconds), eventBurst, r.clock)}
+		r.limiters[key] = limiter
+	}
+	limiter.lastUsed = now
+	allowed := limiter.limiter.TryAccept()
+	r.mutex.Unlock()
+
+	if !allowed {
+		eventsSuppressedTotal.WithLabelValues(reason).Inc()
+		klog.V(2).Infof("not recording event %s of %s, as it recurs too often", reason, key.object)
+	}
+	return allowed
+}
+
+// forgetIdle drops the limiters not used for long enough to be full again, which new ones are as well
+func (r *rateLimitedRecorder) forgetIdle(now time.Time) {
+	idle := time.Duration(eventBurst*eventRefillSeconds) * time.Second
+	for key, limiter := range r.limiters {
+		if now.Sub(limiter.lastUsed) >= idle {
+			delete(r.limiters, key)
+		}
+	}
+}
+
+// eventObjectKey returns the kind, namespace and name of object, for the Events recorded on it
+func eventObjectKey(object runtime.Object) string {
+	ref, err := reference.GetReference(scheme.Scheme, object)
+	if err != nil {
+		return fmt.Sprintf("%T", object)
+	}
+	if ref.Namespace == "" {
+		return ref.Kind + "/" + ref.Name
+	}
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
+
+var _ record.EventRecorder = &rateLimitedRecorder{}
@@ -0,0 +1,77 @@
+package phoenixnap
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestRateLimitedRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(100)
+	clock := testingclock.NewFakeClock(time.Now())
+	recorder := newRateLimitedRecorder(fake, clock)
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+
+	// the burst of a service and reason is recorded, and then nothing more
+	for i := 0; i < eventBurst+3; i++ {
+		recorder.Event(svc1, v1.EventTypeWarning, eventReasonProviderAPIError, "failed")
+	}
+	if count := testCountEvents(testDrainEvents(fake), eventReasonProviderAPIError); count != eventBurst {
+		t.Errorf("mismatched events in a burst, actual %d expected %d", count, eventBurst)
+	}
+
+	// other reasons and services have their own limits
+	recorder.Eventf(svc1, v1.EventTypeWarning, eventReasonInvalidHealthCheck, "invalid %s", "port")
+	recorder.Event(svc2, v1.EventTypeWarning, eventReasonProviderAPIError, "failed")
+	events := testDrainEvents(fake)
+	if count := testCountEvents(events, eventReasonInvalidHealthCheck); count != 1 {
+		t.Errorf("mismatched events with another reason, actual %d expected %d", count, 1)
+	}
+	if count := testCountEvents(events, eventReasonProviderAPIError); count != 1 {
+		t.Errorf("mismatched events of another service, actual %d expected %d", count, 1)
+	}
+
+	// the audit Events are not limited
+	namespace := &v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: "kube-system"}
+	for i := 0; i < eventBurst+3; i++ {
+		recorder.AnnotatedEventf(namespace, nil, v1.EventTypeNormal, eventReasonIPBlockPurchased, "purchased %d", i)
+	}
+	if count := testCountEvents(testDrainEvents(fake), eventReasonIPBlockPurchased); count != eventBurst+3 {
+		t.Errorf("mismatched audit events, actual %d expected %d", count, eventBurst+3)
+	}
+
+	// one more is recorded every eventRefillSeconds
+	clock.Step(eventRefillSeconds * time.Second)
+	for i := 0; i < 3; i++ {
+		recorder.Event(svc1, v1.EventTypeWarning, eventReasonProviderAPIError, "failed")
+	}
+	if count := testCountEvents(testDrainEvents(fake), eventReasonProviderAPIError); count != 1 {
+		t.Errorf("mismatched events after a refill, actual %d expected %d", count, 1)
+	}
+
+	// once quiet for long enough, the limits are forgotten, and a full burst is recorded again
+	clock.Step(eventBurst * eventRefillSeconds * time.Second)
+	recorder.Event(svc2, v1.EventTypeWarning, eventReasonProviderAPIError, "failed")
+	if len(recorder.limiters) != 1 {
+		t.Errorf("mismatched limiters after idling, actual %d expected %d", len(recorder.limiters), 1)
+	}
+	for i := 0; i < eventBurst; i++ {
+		recorder.Event(svc1, v1.EventTypeWarning, eventReasonProviderAPIError, "failed")
+	}
+	if count := testCountEvents(testDrainEvents(fake), eventReasonProviderAPIError); count != eventBurst+1 {
+		t.Errorf("mismatched events after idling, actual %d expected %d", count, eventBurst+1)
+	}
+}
+
+func TestEventObjectKey(t *testing.T) {
+	if key := eventObjectKey(testService("default", "svc1")); key != "Service/default/svc1" {
+		t.Errorf("mismatched key of a service, actual %s expected %s", key, "Service/default/svc1")
+	}
+	namespace := &v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: "kube-system"}
+	if key := eventObjectKey(namespace); key != "Namespace/kube-system" {
+		t.Errorf("mismatched key of a reference, actual %s expected %s", key, "Namespace/kube-system")
+	}
+}
@@ -0,0 +1,173 @@
+package phoenixnap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// externalIPsMode returns true if the Service asks to be announced on its spec.externalIPs,
+// which must be public IPs of cluster servers, rather than on a purchased IP block.
+func externalIPsMode(svc *v1.Service) bool {
+	return svc.Annotations[annotationExternalIPs] == "true"
+}
+
+// externalIPsStatus returns the load balancer status for a Service in externalIPs mode
+func externalIPsStatus(svc *v1.Service) *v1.LoadBalancerStatus {
+	return loadBalancerStatus(svc, svc.Spec.ExternalIPs...)
+}
+
+// announcedExternalIPs returns the external IPs last announced for a Service in externalIPs mode,
+// as recorded in its annotation
+func announcedExternalIPs(svc *v1.Service) []string {
+	var ips []string
+	for _, ip := range strings.Split(svc.Annotations[annotationAnnouncedExternalIPs], ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// withdrawnExternalIPs returns the external IPs announced for the Service that no longer are in its spec.externalIPs
+func withdrawnExternalIPs(svc *v1.Service) []string {
+	current := map[string]bool{}
+	for _, ip := range svc.Spec.ExternalIPs {
+		current[ip] = true
+	}
+	var withdrawn []string
+	for _, ip := range announcedExternalIPs(svc) {
+		if !current[ip] {
+			withdrawn = append(withdrawn, ip)
+		}
+	}
+	return withdrawn
+}
+
+// externalIPAllocations returns the allocations of the external IPs, each a single address
+func externalIPAllocations(ips []string) []loadbalancers.Allocation {
+	allocations := make([]loadbalancers.Allocation, 0, len(ips))
+	for _, ip := range ips {
+		allocations = append(allocations, loadbalancers.Allocation{IP: fmt.Sprintf("%s/32", ip)})
+	}
+	return allocations
+}
+
+// recordAnnouncedExternalIPs sets the annotation with the announced external IPs on the Service, if they changed
+func (l *loadBalancers) recordAnnouncedExternalIPs(ctx context.Context, svc *v1.Service) error {
+	ips := strings.Join(svc.Spec.ExternalIPs, ",")
+	if svc.Annotations[annotationAnnouncedExternalIPs] == ips {
+		return nil
+	}
+	patch, _ := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{annotationAnnouncedExternalIPs: ips},
+		},
+	})
+	if _, err := l.k8sclient.CoreV1().Services(svc.Namespace).Patch(ctx, svc.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("unable to set annotation %s on service %s: %w", annotationAnnouncedExternalIPs, serviceRep(svc), err)
+	}
+	return nil
+}
+
+// externalIPOwners returns, for each of the Service's spec.externalIPs, the node whose server has
+// that public IP. The servers are looked up with the server cache of the instances. It returns an
+// error if any IP does not belong to the server of one of nodes.
+func (l *loadBalancers) externalIPOwners(ctx context.Context, svc *v1.Service, nodes []*v1.Node) (map[string]*v1.Node, error) {
+	if len(svc.Spec.ExternalIPs) == 0 {
+		return nil, fmt.Errorf("service %s has annotation %s but no spec.externalIPs", serviceRep(svc), annotationExternalIPs)
+	}
+	if l.servers == nil {
+		return nil, fmt.Errorf("unable to find the servers of the external IPs of service %s: no server lookup", serviceRep(svc))
+	}
+	byIP := map[string]*v1.Node{}
+	for _, node := range nodes {
+		server, err := l.servers(ctx, node)
+		if err != nil || server == nil {
+			klog.V(2).Infof("unable to find the server of node %s for the external IPs of service %s: %v", node.Name, serviceRep(svc), err)
+			continue
+		}
+		for _, ip := range server.PublicIpAddresses {
+			byIP[ip] = node
+		}
+	}
+
+	owners := map[string]*v1.Node{}
+	for _, ip := range svc.Spec.ExternalIPs {
+		node, ok := byIP[ip]
+		if !ok {
+			return nil, fmt.Errorf("external IP %s of service %s is not a public IP of the server of any eligible node", ip, serviceRep(svc))
+		}
+		owners[ip] = node
+	}
+	return owners, nil
+}
+
+// ensureExternalIPs configures the implementor for a Service in externalIPs mode, announcing
+// each IP only from the node that owns it, and withdrawing those announced earlier that no longer
+// are external IPs of the Service. No IP blocks are ordered. An implementor that is not a
+// MultiIPAnnouncer supports only a single external IP, as AddService replaces the IP of the Service.
+func (l *loadBalancers) ensureExternalIPs(ctx context.Context, svc *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	owners, err := l.externalIPOwners(ctx, svc, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if announcer, ok := l.implementor.(loadbalancers.MultiIPAnnouncer); ok {
+		ips := make([]loadbalancers.ServiceIP, 0, len(svc.Spec.ExternalIPs))
+		for _, ip := range svc.Spec.ExternalIPs {
+			klog.V(2).Infof("EnsureLoadBalancer(): service %s on external IP %s of node %s", serviceRep(svc), ip, owners[ip].Name)
+			ips = append(ips, loadbalancers.ServiceIP{IP: fmt.Sprintf("%s/32", ip), Nodes: []loadbalancers.Node{l.implementorNode(ctx, owners[ip])}})
+		}
+		if err := l.callImplementor(implementorOpSetServiceIPs, func() error {
+			return announcer.SetServiceIPs(ctx, svc.Namespace, svc.Name, ips)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to set external IPs %s of service %s: %w", strings.Join(svc.Spec.ExternalIPs, ","), serviceRep(svc), err)
+		}
+	} else {
+		if len(svc.Spec.ExternalIPs) > 1 {
+			return nil, fmt.Errorf("service %s has %d external IPs, but the load balancer implementation announces only one IP per service", serviceRep(svc), len(svc.Spec.ExternalIPs))
+		}
+		if withdrawn := withdrawnExternalIPs(svc); len(withdrawn) > 0 {
+			klog.V(2).Infof("EnsureLoadBalancer(): service %s withdrawing external IPs %s", serviceRep(svc), strings.Join(withdrawn, ","))
+			if err := l.callImplementor(implementorOpRemoveService, func() error {
+				return l.implementor.RemoveService(ctx, svc.Namespace, svc.Name, externalIPAllocations(withdrawn))
+			}); err != nil {
+				return nil, fmt.Errorf("failed to withdraw external IPs %s of service %s: %w", strings.Join(withdrawn, ","), serviceRep(svc), err)
+			}
+		}
+		ip := svc.Spec.ExternalIPs[0]
+		klog.V(2).Infof("EnsureLoadBalancer(): service %s on external IP %s of node %s", serviceRep(svc), ip, owners[ip].Name)
+		if err := l.callImplementor(implementorOpAddService, func() error {
+			return l.implementor.AddService(ctx, svc.Namespace, svc.Name, fmt.Sprintf("%s/32", ip), []loadbalancers.Node{l.implementorNode(ctx, owners[ip])})
+		}); err != nil {
+			return nil, fmt.Errorf("failed to add service %s on external IP %s: %w", serviceRep(svc), ip, err)
+		}
+	}
+	if err := l.recordAnnouncedExternalIPs(ctx, svc); err != nil {
+		return nil, err
+	}
+	return externalIPsStatus(svc), nil
+}
+
+// removeExternalIPs removes a Service in externalIPs mode from the implementor, on the external IPs
+// it has and on those announced earlier
+func (l *loadBalancers) removeExternalIPs(ctx context.Context, svc *v1.Service) error {
+	ips := append(append([]string{}, svc.Spec.ExternalIPs...), withdrawnExternalIPs(svc)...)
+	if len(ips) == 0 {
+		return nil
+	}
+	if err := l.callImplementor(implementorOpRemoveService, func() error {
+		return l.implementor.RemoveService(ctx, svc.Namespace, svc.Name, externalIPAllocations(ips))
+	}); err != nil {
+		return fmt.Errorf("failed to remove service %s on external IPs %s: %w", serviceRep(svc), strings.Join(ips, ","), err)
+	}
+	return nil
+}
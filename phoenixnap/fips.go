@@ -0,0 +1,12 @@
+//go:build boringcrypto
+
+package phoenixnap
+
+import (
+	// restrict TLS, including that of the PhoenixNAP API clients, to FIPS-approved settings
+	_ "crypto/tls/fipsonly"
+)
+
+func init() {
+	fipsMode = true
+}
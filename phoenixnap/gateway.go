@@ -0,0 +1,197 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+// The experimental gateway controller gives each Gateway of a GatewayClass whose controllerName is
+// gatewayControllerName an IP block, as a Service of type LoadBalancer gets, and its IP as the address in the status
+// of the Gateway. The block is tagged with gatewayTag rather than the service tags, so that a Service with the same
+// namespace and name does not find it, and is released once the Gateway is deleted, or no longer of such a class.
+// Announcing the IP is up to the data plane of the Gateway, as the load balancer implementations announce Services.
+// Gateways are read through the dynamic client, so that the CCM does not depend on the Gateway API types.
+
+var (
+	gatewayClassResource = schema.GroupVersionResource{Group: gatewayGroup, Version: gatewayVersion, Resource: "gatewayclasses"}
+	gatewayResource      = schema.GroupVersionResource{Group: gatewayGroup, Version: gatewayVersion, Resource: "gateways"}
+)
+
+// gatewayRep returns the namespace and name of the gateway
+func gatewayRep(gw *unstructured.Unstructured) string {
+	return gw.GetNamespace() + "/" + gw.GetName()
+}
+
+// startGatewayController syncs the Gateways every gatewaySyncSeconds, until the load balancers are closed
+func (l *loadBalancers) startGatewayController(client dynamic.Interface) {
+	klog.Infof("syncing the Gateways of controller %s every %ds (experimental)", gatewayControllerName, gatewaySyncSeconds)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(gatewaySyncSeconds * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := l.syncGateways(l.ctx, client); err != nil {
+				klog.Errorf("unable to sync Gateways: %v", err)
+			}
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping gateway controller")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// syncGateways gives each Gateway of the controller its IP block and address, and releases the blocks of the
+// Gateways that no longer are. Nothing is released unless all Gateways could be listed.
+func (l *loadBalancers) syncGateways(ctx context.Context, client dynamic.Interface) error {
+	classes, err := client.Resource(gatewayClassResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list GatewayClasses, is the Gateway API installed? %w", err)
+	}
+	ours := map[string]bool{}
+	for _, class := range classes.Items {
+		if controller, _, _ := unstructured.NestedString(class.Object, "spec", "controllerName"); controller == gatewayControllerName {
+			ours[class.GetName()] = true
+		}
+	}
+	gateways, err := client.Resource(gatewayResource).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list Gateways: %w", err)
+	}
+
+	wanted := map[string]bool{}
+	var errs []error
+	for i := range gateways.Items {
+		gw := &gateways.Items[i]
+		class, _, _ := unstructured.NestedString(gw.Object, "spec", "gatewayClassName")
+		if !ours[class] || gw.GetDeletionTimestamp() != nil {
+			continue
+		}
+		wanted[gatewayRep(gw)] = true
+		if err := l.syncGateway(ctx, client, gw); err != nil {
+			gatewaySyncErrorsTotal.Inc()
+			if l.recorder != nil {
+				l.recorder.Event(gw, v1.EventTypeWarning, eventReasonGatewayAddressFailed, err.Error())
+			}
+			errs = append(errs, fmt.Errorf("gateway %s: %w", gatewayRep(gw), err))
+		}
+	}
+	if err := l.releaseGatewayBlocks(ctx, wanted); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// syncGateway gives the gateway its IP block, and the IP in it as the address in its status
+func (l *loadBalancers) syncGateway(ctx context.Context, client dynamic.Interface, gw *unstructured.Unstructured) error {
+	ip, err := l.ensureGatewayBlock(ctx, gw)
+	if err != nil {
+		return err
+	}
+	addresses := []interface{}{map[string]interface{}{"type": gatewayAddressType, "value": ip}}
+	if current, _, _ := unstructured.NestedSlice(gw.Object, "status", "addresses"); reflect.DeepEqual(current, addresses) {
+		return nil
+	}
+	if err := unstructured.SetNestedSlice(gw.Object, addresses, "status", "addresses"); err != nil {
+		return fmt.Errorf("unable to set addresses: %w", err)
+	}
+	if _, err := client.Resource(gatewayResource).Namespace(gw.GetNamespace()).UpdateStatus(ctx, gw, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update status: %w", err)
+	}
+	klog.Infof("gateway %s has address %s", gatewayRep(gw), ip)
+	return nil
+}
+
+// gatewayBlocks returns the active IP blocks of the gateway, by its namespace and name
+func (l *loadBalancers) gatewayBlocks(ctx context.Context, gateway string) ([]ipapi.IpBlock, error) {
+	all, err := l.getIPBlocks(ctx, "", "", true, false)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []ipapi.IpBlock
+	for _, block := range all {
+		if value, ok := blockTagValue(block, gatewayTag); ok && value == gateway {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+// ensureGatewayBlock returns the IP of the gateway, from its IP block in the load balancer location, which is
+// created and assigned to the public network if needed
+func (l *loadBalancers) ensureGatewayBlock(ctx context.Context, gw *unstructured.Unstructured) (string, error) {
+	gateway := gatewayRep(gw)
+	blocks, err := l.gatewayBlocks(ctx, gateway)
+	if err != nil {
+		return "", err
+	}
+	var block *ipapi.IpBlock
+	switch len(blocks) {
+	case 0:
+		ipBlockCreate := ipapi.NewIpBlockCreate(l.location, fmt.Sprintf("/%d", serviceBlockCidr))
+		usageValue, clusterID := l.ownership.usageValue, l.clusterID()
+		ipBlockCreate.Tags = []ipapi.TagAssignmentRequest{
+			{Name: l.ownership.usage, Value: &usageValue},
+			{Name: l.ownership.cluster, Value: &clusterID},
+			{Name: gatewayTag, Value: &gateway},
+		}
+		if err := l.tags.ensure(ctx, l.clientsFor(l.location).tagClient, gatewayTag); err != nil {
+			return "", fmt.Errorf("unable to ensure tags exist: %w", err)
+		}
+		if block, err = l.createBlock(ctx, nil, ipBlockCreate); err != nil {
+			return "", err
+		}
+		klog.V(2).Infof("created block %s for gateway %s", block.Id, gateway)
+		l.auditOwnedBlock(gw.GetNamespace(), auditAnnotationGateway, "gateway", gateway, *block, eventReasonIPBlockPurchased)
+	case 1:
+		block = &blocks[0]
+	default:
+		return "", fmt.Errorf("more than one block found for gateway %s", gateway)
+	}
+	if block, err = l.waitForBlock(ctx, block); err != nil {
+		return "", err
+	}
+	if err := l.assignToNetwork(ctx, nil, block, l.network); err != nil {
+		return "", err
+	}
+	return l.recordBlockIP(ctx, *block)
+}
+
+// releaseGatewayBlocks releases the blocks of the gateways that are not wanted, e.g. were deleted
+func (l *loadBalancers) releaseGatewayBlocks(ctx context.Context, wanted map[string]bool) error {
+	all, err := l.getIPBlocks(ctx, "", "", true, false)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, block := range all {
+		gateway, ok := blockTagValue(block, gatewayTag)
+		if !ok || wanted[gateway] {
+			continue
+		}
+		if err := l.releaseBlock(ctx, block); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		klog.V(2).Infof("released block %s of gateway %s", block.Cidr, gateway)
+		namespace, _, _ := strings.Cut(gateway, "/")
+		l.auditOwnedBlock(namespace, auditAnnotationGateway, "gateway", gateway, block, eventReasonIPBlockReleased)
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,143 @@
+package phoenixnap
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func testGatewayClass(name, controller string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"controllerName": controller},
+	}}
+	obj.SetAPIVersion(gatewayGroup + "/" + gatewayVersion)
+	obj.SetKind("GatewayClass")
+	obj.SetName(name)
+	return obj
+}
+
+func testGateway(namespace, name, class string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"gatewayClassName": class},
+	}}
+	obj.SetAPIVersion(gatewayGroup + "/" + gatewayVersion)
+	obj.SetKind("Gateway")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// testGatewayClient returns a fake dynamic client with the objects, created through it, as the fake would guess
+// the resource of a Gateway to be "gatewaies"
+func testGatewayClient(t *testing.T, objects ...*unstructured.Unstructured) *dynamicfake.FakeDynamicClient {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gatewayClassResource: "GatewayClassList",
+		gatewayResource:      "GatewayList",
+	})
+	for _, obj := range objects {
+		resource := client.Resource(gatewayClassResource).Namespace(obj.GetNamespace())
+		if obj.GetKind() == "Gateway" {
+			resource = client.Resource(gatewayResource).Namespace(obj.GetNamespace())
+		}
+		if _, err := resource.Create(context.TODO(), obj, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unable to create %s %s: %v", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return client
+}
+
+func testGatewayAddresses(t *testing.T, client *dynamicfake.FakeDynamicClient, namespace, name string) []interface{} {
+	obj, err := client.Resource(gatewayResource).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get gateway %s/%s: %v", namespace, name, err)
+	}
+	addresses, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses")
+	return addresses
+}
+
+func TestSyncGateways(t *testing.T) {
+	l, _, _ := testGetLoadBalancers(t, 0)
+	client := testGatewayClient(t,
+		testGatewayClass("pnap", gatewayControllerName),
+		testGatewayClass("other", "example.com/gateway"),
+		testGateway("default", "gw1", "pnap"),
+		testGateway("default", "gw2", "other"),
+	)
+	ctx := context.TODO()
+
+	if err := l.syncGateways(ctx, client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, err := l.gatewayBlocks(ctx, "default/gw1")
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case len(blocks) != 1:
+		t.Fatalf("expected 1 block of the gateway, actual %d", len(blocks))
+	case !blockAssignedToNetwork(blocks[0], testNetworkID):
+		t.Errorf("block of the gateway not assigned to network %s", testNetworkID)
+	}
+	ip := blockServiceIP(netip.MustParsePrefix(blocks[0].Cidr)).String()
+	addresses := testGatewayAddresses(t, client, "default", "gw1")
+	expected := []interface{}{map[string]interface{}{"type": gatewayAddressType, "value": ip}}
+	if len(addresses) != 1 || addresses[0].(map[string]interface{})["value"] != ip {
+		t.Errorf("mismatched addresses, actual %v expected %v", addresses, expected)
+	}
+	if addresses := testGatewayAddresses(t, client, "default", "gw2"); len(addresses) != 0 {
+		t.Errorf("gateway of another controller got addresses %v", addresses)
+	}
+	// a Service with the same namespace and name does not find the block
+	if blocks, err := l.getIPBlocks(ctx, "default", "gw1", true, false); err != nil || len(blocks) != 0 {
+		t.Errorf("expected no blocks of service default/gw1, actual %d, error %v", len(blocks), err)
+	}
+
+	// syncing again is idempotent
+	if err := l.syncGateways(ctx, client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocks, _ := l.gatewayBlocks(ctx, "default/gw1"); len(blocks) != 1 {
+		t.Errorf("expected 1 block of the gateway after second sync, actual %d", len(blocks))
+	}
+
+	// deleting the gateway releases its block
+	if err := client.Resource(gatewayResource).Namespace("default").Delete(ctx, "gw1", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unable to delete gateway: %v", err)
+	}
+	if err := l.syncGateways(ctx, client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocks, _ := l.gatewayBlocks(ctx, "default/gw1"); len(blocks) != 0 {
+		t.Errorf("block of deleted gateway not released, actual %d", len(blocks))
+	}
+}
+
+func TestSyncGatewaysFailure(t *testing.T) {
+	// no room for a block records an Event on the gateway, and keeps the others synced
+	l, _, recorder := testGetLoadBalancers(t, 1)
+	client := testGatewayClient(t,
+		testGatewayClass("pnap", gatewayControllerName),
+		testGateway("default", "gw1", "pnap"),
+		testGateway("default", "gw2", "pnap"),
+	)
+	if err := l.syncGateways(context.TODO(), client); err == nil {
+		t.Fatalf("expected an error, as only 1 block may be purchased")
+	}
+	if count := testCountEvents(testDrainEvents(recorder), eventReasonGatewayAddressFailed); count != 1 {
+		t.Errorf("mismatched %s events, actual %d expected %d", eventReasonGatewayAddressFailed, count, 1)
+	}
+	var synced int
+	for _, name := range []string{"gw1", "gw2"} {
+		if len(testGatewayAddresses(t, client, "default", name)) == 1 {
+			synced++
+		}
+	}
+	if synced != 1 {
+		t.Errorf("mismatched gateways with an address, actual %d expected %d", synced, 1)
+	}
+}
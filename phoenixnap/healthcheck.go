@@ -0,0 +1,57 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// healthCheckFromService returns the health check set by annotations on the service,
+// or nil if it has none
+func healthCheckFromService(svc *v1.Service) (*loadbalancers.HealthCheck, error) {
+	port, hasPort := svc.Annotations[annotationHealthCheckPort]
+	path, hasPath := svc.Annotations[annotationHealthCheckPath]
+	interval, hasInterval := svc.Annotations[annotationHealthCheckInterval]
+	if !hasPort && !hasPath && !hasInterval {
+		return nil, nil
+	}
+	if !hasPort {
+		return nil, fmt.Errorf("annotation %s is required with %s or %s", annotationHealthCheckPort, annotationHealthCheckPath, annotationHealthCheckInterval)
+	}
+	portNo, err := strconv.ParseInt(port, 10, 32)
+	if err != nil || portNo < 1 || portNo > 65535 {
+		return nil, fmt.Errorf("annotation %s must be a port number, was %q", annotationHealthCheckPort, port)
+	}
+	check := &loadbalancers.HealthCheck{Port: int32(portNo), Path: path}
+	if hasInterval {
+		check.Interval, err = time.ParseDuration(interval)
+		if err != nil || check.Interval <= 0 {
+			return nil, fmt.Errorf("annotation %s must be a positive duration, e.g. 10s, was %q", annotationHealthCheckInterval, interval)
+		}
+	}
+	return check, nil
+}
+
+// setHealthCheck passes the health check of the service, if any, to the implementation.
+// If the implementation does not support health checks, they are ignored; see warnIgnoredFeatures.
+func (l *loadBalancers) setHealthCheck(ctx context.Context, svc *v1.Service) error {
+	check, err := healthCheckFromService(svc)
+	if err != nil {
+		if l.recorder != nil {
+			l.recorder.Event(svc, v1.EventTypeWarning, eventReasonInvalidHealthCheck, err.Error())
+		}
+		return err
+	}
+	checker, ok := l.implementor.(loadbalancers.HealthChecker)
+	if !ok {
+		return nil
+	}
+	return l.callImplementor(implementorOpSetHealthCheck, func() error {
+		return checker.SetHealthCheck(ctx, svc.Namespace, svc.Name, check)
+	})
+}
@@ -0,0 +1,102 @@
+package phoenixnap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// testHealthCheckLB an implementation that records the health checks it is given
+type testHealthCheckLB struct {
+	checks map[string]*loadbalancers.HealthCheck
+}
+
+func (t *testHealthCheckLB) AddService(ctx context.Context, svcNamespace, svcName, ip string, nodes []loadbalancers.Node) error {
+	return nil
+}
+
+func (t *testHealthCheckLB) RemoveService(ctx context.Context, svcNamespace, svcName string, allocations []loadbalancers.Allocation) error {
+	return nil
+}
+
+func (t *testHealthCheckLB) UpdateService(ctx context.Context, svcNamespace, svcName string, nodes []loadbalancers.Node) error {
+	return nil
+}
+
+func (t *testHealthCheckLB) Capabilities() loadbalancers.Capabilities {
+	return loadbalancers.Capabilities{Protocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP}, HealthCheck: true}
+}
+
+func (t *testHealthCheckLB) SetHealthCheck(ctx context.Context, svcNamespace, svcName string, check *loadbalancers.HealthCheck) error {
+	t.checks[svcNamespace+"/"+svcName] = check
+	return nil
+}
+
+func TestHealthCheckFromService(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		check       *loadbalancers.HealthCheck
+		valid       bool
+	}{
+		{nil, nil, true},
+		{map[string]string{annotationHealthCheckPort: "30080"}, &loadbalancers.HealthCheck{Port: 30080}, true},
+		{map[string]string{annotationHealthCheckPort: "30080", annotationHealthCheckPath: "/healthz", annotationHealthCheckInterval: "10s"},
+			&loadbalancers.HealthCheck{Port: 30080, Path: "/healthz", Interval: 10 * time.Second}, true},
+		{map[string]string{annotationHealthCheckPath: "/healthz"}, nil, false},
+		{map[string]string{annotationHealthCheckPort: "http"}, nil, false},
+		{map[string]string{annotationHealthCheckPort: "70000"}, nil, false},
+		{map[string]string{annotationHealthCheckPort: "30080", annotationHealthCheckInterval: "10"}, nil, false},
+		{map[string]string{annotationHealthCheckPort: "30080", annotationHealthCheckInterval: "-1s"}, nil, false},
+	}
+	for i, tt := range tests {
+		svc := testService("default", "svc1")
+		svc.Annotations = tt.annotations
+		check, err := healthCheckFromService(svc)
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("%d: unexpected error: %v", i, err)
+		case !tt.valid && err == nil:
+			t.Errorf("%d: expected error", i)
+		case (check == nil) != (tt.check == nil) || (check != nil && *check != *tt.check):
+			t.Errorf("%d: mismatched health check, actual %v expected %v", i, check, tt.check)
+		}
+	}
+}
+
+func TestSetHealthCheck(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationHealthCheckPort: "30080"}
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+
+	// kube-vip does not support health checks
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonFeaturesIgnored) {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+
+	lb := &testHealthCheckLB{checks: map[string]*loadbalancers.HealthCheck{}}
+	l.implementor = lb
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if check := lb.checks["default/svc1"]; check == nil || check.Port != 30080 {
+		t.Errorf("mismatched health check, actual %v expected port %d", check, 30080)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("unexpected event %s", event)
+	default:
+	}
+}
@@ -0,0 +1,96 @@
+package phoenixnap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// hostnameMismatches the nodes whose server hostname no longer matches the node name,
+// with the hostname last reported, so that a change is reported once
+type hostnameMismatches struct {
+	mutex sync.Mutex
+	nodes map[string]string
+}
+
+// set records the hostname of the server of the node, and returns true if the mismatch is new,
+// or the hostname changed since it was reported
+func (h *hostnameMismatches) set(node, hostname string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.nodes == nil {
+		h.nodes = map[string]string{}
+	}
+	if previous, ok := h.nodes[node]; ok && previous == hostname {
+		return false
+	}
+	h.nodes[node] = hostname
+	serverHostnameMismatches.Set(float64(len(h.nodes)))
+	return true
+}
+
+// clear forgets any mismatch of the node
+func (h *hostnameMismatches) clear(node string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.nodes[node]; !ok {
+		return
+	}
+	delete(h.nodes, node)
+	serverHostnameMismatches.Set(float64(len(h.nodes)))
+}
+
+// checkHostname compares the hostname of the server of a node found by its ProviderID with the node name.
+// The hostname can be changed in the PhoenixNAP portal, after which the node no longer would be found
+// by name. It reports a mismatch with an Event on the node, and, if enabled, labels the node with the hostname.
+func (i *instances) checkHostname(ctx context.Context, node *v1.Node, server *bmcapi.Server) {
+	if server.Hostname == node.Name {
+		i.mismatches.clear(node.Name)
+	} else if i.mismatches.set(node.Name, server.Hostname) {
+		msg := fmt.Sprintf("hostname of server %s is %q, which does not match the node name", server.Id, server.Hostname)
+		klog.Warningf("node %s: %s", node.Name, msg)
+		if i.recorder != nil {
+			i.recorder.Event(node, v1.EventTypeWarning, eventReasonServerHostnameMismatch, msg)
+		}
+	}
+	if i.hostnameLabel && i.k8sclient != nil {
+		if err := i.labelHostname(ctx, node, server.Hostname); err != nil {
+			klog.Errorf("unable to label node %s with the hostname of its server: %v", node.Name, err)
+		}
+	}
+}
+
+// additionalLabels the labels of the node of the server that the node controller sets when it initializes the node,
+// with cloud-provider modules that support it; see setAdditionalLabels. The CCM keeps them up to date itself.
+func (i *instances) additionalLabels(server bmcapi.Server) map[string]string {
+	if !i.hostnameLabel || len(validation.IsValidLabelValue(server.Hostname)) > 0 {
+		return nil
+	}
+	return map[string]string{labelServerHostname: server.Hostname}
+}
+
+// labelHostname sets the server hostname label of the node, unless it already has that value
+func (i *instances) labelHostname(ctx context.Context, node *v1.Node, hostname string) error {
+	if node.Labels[labelServerHostname] == hostname {
+		return nil
+	}
+	if errs := validation.IsValidLabelValue(hostname); len(errs) > 0 {
+		return fmt.Errorf("hostname %q is not a valid label value: %v", hostname, errs)
+	}
+	patch, _ := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"labels": map[string]string{labelServerHostname: hostname},
+		},
+	})
+	_, err := i.k8sclient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,116 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestCheckHostname(t *testing.T) {
+	vc, backend := testGetValidCloud(t, "")
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	serverName := testGetNewServerName()
+	server, err := backend.CreateServer(serverName, product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+
+	// the hostname of the server was changed in the portal after the node joined
+	node := testNode(fmt.Sprintf("phoenixnap://%s", server.Id), "renamed-node")
+	k8sclient := k8sfake.NewSimpleClientset(node)
+	recorder := record.NewFakeRecorder(10)
+	inst := vc.instances
+	inst.k8sclient = k8sclient
+	inst.recorder = recorder
+	inst.hostnameLabel = true
+
+	for i := 0; i < 2; i++ {
+		if _, err := inst.InstanceMetadata(context.TODO(), node); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// reported once, not on every call
+	if len(recorder.Events) != 1 {
+		t.Errorf("mismatched events, actual %d expected 1", len(recorder.Events))
+	}
+	if mismatches, _ := testutil.GetGaugeMetricValue(serverHostnameMismatches); mismatches != 1 {
+		t.Errorf("mismatched hostname mismatches, actual %v expected 1", mismatches)
+	}
+	updated, err := k8sclient.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get node: %v", err)
+	}
+	if label := updated.Labels[labelServerHostname]; label != serverName {
+		t.Errorf("mismatched label, actual %q expected %q", label, serverName)
+	}
+
+	// the node now matches the server hostname
+	matching := testNode(fmt.Sprintf("phoenixnap://%s", server.Id), serverName)
+	inst.mismatches.set(matching.Name, "old-hostname")
+	if _, err := inst.InstanceMetadata(context.TODO(), matching); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mismatches, _ := testutil.GetGaugeMetricValue(serverHostnameMismatches); mismatches != 1 {
+		t.Errorf("mismatched hostname mismatches after match, actual %v expected 1", mismatches)
+	}
+}
+
+func TestCheckHostnameNoLabel(t *testing.T) {
+	vc, backend := testGetValidCloud(t, "")
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	node := testNode(fmt.Sprintf("phoenixnap://%s", server.Id), "other-node")
+	k8sclient := k8sfake.NewSimpleClientset(node)
+	vc.instances.k8sclient = k8sclient
+
+	if _, err := vc.instances.InstanceMetadata(context.TODO(), node); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err := k8sclient.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get node: %v", err)
+	}
+	if _, ok := updated.Labels[labelServerHostname]; ok {
+		t.Errorf("unexpected label %s while disabled", labelServerHostname)
+	}
+}
+
+func TestAdditionalLabels(t *testing.T) {
+	tests := []struct {
+		hostnameLabel bool
+		hostname      string
+		expected      map[string]string
+	}{
+		{true, "server1", map[string]string{labelServerHostname: "server1"}},
+		{false, "server1", nil},
+		{true, "not a label value", nil},
+	}
+	for i, tt := range tests {
+		inst := &instances{hostnameLabel: tt.hostnameLabel}
+		labels := inst.additionalLabels(bmcapi.Server{Hostname: tt.hostname})
+		if !reflect.DeepEqual(labels, tt.expected) {
+			t.Errorf("%d: mismatched labels, actual %v expected %v", i, labels, tt.expected)
+		}
+	}
+
+	// the labels are in the metadata only with cloud-provider modules that have AdditionalLabels
+	metadata := &cloudprovider.InstanceMetadata{}
+	labels := map[string]string{labelServerHostname: "server1"}
+	if supported := setAdditionalLabels(metadata, labels); supported != reflect.ValueOf(metadata).Elem().FieldByName("AdditionalLabels").IsValid() {
+		t.Errorf("mismatched support of AdditionalLabels, adapter reports %t", supported)
+	}
+}
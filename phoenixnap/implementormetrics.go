@@ -0,0 +1,19 @@
+package phoenixnap
+
+import (
+	"time"
+)
+
+// callImplementor calls the load balancer implementation, and records the call, its duration and
+// whether it failed in the metrics, so failures of the implementation can be told apart from those
+// of the PhoenixNAP API
+func (l *loadBalancers) callImplementor(operation string, call func() error) error {
+	start := time.Now()
+	err := call()
+	implementorRequestsTotal.WithLabelValues(l.implementorScheme, operation).Inc()
+	implementorRequestDuration.WithLabelValues(l.implementorScheme, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		implementorRequestFailuresTotal.WithLabelValues(l.implementorScheme, operation).Inc()
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package phoenixnap
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestCallImplementor(t *testing.T) {
+	l, _, _ := testGetLoadBalancers(t, 0)
+	l.implementorScheme = "test-scheme"
+
+	before, _ := testutil.GetCounterMetricValue(implementorRequestsTotal.WithLabelValues("test-scheme", implementorOpAddService))
+	failedBefore, _ := testutil.GetCounterMetricValue(implementorRequestFailuresTotal.WithLabelValues("test-scheme", implementorOpAddService))
+
+	if err := l.callImplementor(implementorOpAddService, func() error { return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	failure := errors.New("implementation failed")
+	if err := l.callImplementor(implementorOpAddService, func() error { return failure }); !errors.Is(err, failure) {
+		t.Fatalf("mismatched error, actual %v expected %v", err, failure)
+	}
+
+	after, _ := testutil.GetCounterMetricValue(implementorRequestsTotal.WithLabelValues("test-scheme", implementorOpAddService))
+	failedAfter, _ := testutil.GetCounterMetricValue(implementorRequestFailuresTotal.WithLabelValues("test-scheme", implementorOpAddService))
+	if after-before != 2 {
+		t.Errorf("mismatched calls, actual %v expected %v", after-before, 2)
+	}
+	if failedAfter-failedBefore != 1 {
+		t.Errorf("mismatched failures, actual %v expected %v", failedAfter-failedBefore, 1)
+	}
+	count, _ := testutil.GetHistogramMetricCount(implementorRequestDuration.WithLabelValues("test-scheme", implementorOpAddService))
+	if count < 2 {
+		t.Errorf("mismatched duration observations, actual %d expected at least %d", count, 2)
+	}
+}
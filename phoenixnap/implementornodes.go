@@ -0,0 +1,47 @@
+package phoenixnap
+
+import (
+	"context"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// implementorNodes returns the nodes as passed to the implementation, each with what is known of its server.
+// A server that cannot be looked up does not fail the reconcile; its node is passed without it.
+func (l *loadBalancers) implementorNodes(ctx context.Context, nodes []*v1.Node) []loadbalancers.Node {
+	var n []loadbalancers.Node
+	for _, node := range nodes {
+		n = append(n, l.implementorNode(ctx, node))
+	}
+	return n
+}
+
+// implementorNode returns the node with the IDs and addresses of its server, if the servers are looked up
+func (l *loadBalancers) implementorNode(ctx context.Context, node *v1.Node) loadbalancers.Node {
+	n := loadbalancers.Node{Node: node}
+	if l.servers == nil {
+		return n
+	}
+	server, err := l.servers(ctx, node)
+	if err != nil {
+		klog.V(2).Infof("unable to look up the server of node %s for the load balancer implementation: %v", node.Name, err)
+		return n
+	}
+	n.ServerID, n.Location = server.Id, server.Location
+	n.PublicIPs, n.PrivateIPs = server.PublicIpAddresses, server.PrivateIpAddresses
+	if gateway := server.NetworkConfiguration.GatewayAddress; gateway != nil {
+		n.BGP.PeerIP = *gateway
+	}
+	if config := server.NetworkConfiguration.PublicNetworkConfiguration; config != nil {
+		network := l.networkForLocation(server.Location)
+		for _, public := range config.PublicNetworks {
+			if public.Id == network {
+				n.BGP.SourceIPs = append(n.BGP.SourceIPs, public.Ips...)
+			}
+		}
+	}
+	return n
+}
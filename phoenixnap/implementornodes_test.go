@@ -0,0 +1,57 @@
+package phoenixnap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestImplementorNodes(t *testing.T) {
+	l, backend, _ := testGetLoadBalancers(t, 0)
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	gateway := "198.51.100.1"
+	server.NetworkConfiguration.GatewayAddress = &gateway
+	server.NetworkConfiguration.PublicNetworkConfiguration = &bmcapi.PublicNetworkConfiguration{PublicNetworks: []bmcapi.ServerPublicNetwork{
+		{Id: testNetworkID, Ips: []string{"198.51.100.20"}},
+		{Id: "other-network", Ips: []string{"198.51.100.30"}},
+	}}
+	if err := backend.UpdateServer(server); err != nil {
+		t.Fatalf("unable to update server: %v", err)
+	}
+	known := testNode("phoenixnap://"+server.Id, server.Hostname)
+	unknown := testNode("phoenixnap://"+randomID, nodeName)
+
+	// without server lookups, only the nodes are passed
+	if nodes := l.implementorNodes(context.TODO(), []*v1.Node{known}); len(nodes) != 1 || nodes[0].ServerID != "" {
+		t.Errorf("mismatched nodes without server lookups: %+v", nodes)
+	}
+
+	l.servers = newInstances(l.bmcClients...).serverByNode
+	nodes := l.implementorNodes(context.TODO(), []*v1.Node{known, unknown})
+	if len(nodes) != 2 {
+		t.Fatalf("mismatched nodes, actual %d expected %d", len(nodes), 2)
+	}
+	n := nodes[0]
+	if n.Node != known || n.ServerID != server.Id || n.Location != location {
+		t.Errorf("mismatched node %s server %s location %s", n.Node.Name, n.ServerID, n.Location)
+	}
+	if !reflect.DeepEqual(n.PublicIPs, server.PublicIpAddresses) || !reflect.DeepEqual(n.PrivateIPs, server.PrivateIpAddresses) {
+		t.Errorf("mismatched public IPs %v private IPs %v", n.PublicIPs, n.PrivateIPs)
+	}
+	if !reflect.DeepEqual(n.BGP.SourceIPs, []string{"198.51.100.20"}) || n.BGP.PeerIP != gateway {
+		t.Errorf("mismatched BGP peer %+v", n.BGP)
+	}
+	// a server that is not found does not fail, the node is passed without it
+	if nodes[1].Node != unknown || nodes[1].ServerID != "" {
+		t.Errorf("mismatched node without server: %+v", nodes[1])
+	}
+}
@@ -0,0 +1,115 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// implementorReadiness whether the prerequisites of the load balancer implementation exist in the cluster, as of
+// the last check. Once ready, it stays so; a prerequisite removed later fails the calls that need it instead.
+type implementorReadiness struct {
+	mutex sync.Mutex
+	ready bool
+	// err why the implementation is not ready, as of the last check
+	err error
+}
+
+// implementorEventObject returns the object on which the readiness of the implementation is reported: the
+// namespace of its resources
+func (l *loadBalancers) implementorEventObject() *v1.ObjectReference {
+	return &v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: l.namespace}
+}
+
+// checkImplementorReady returns nil if the implementation is ready, checking its prerequisites if it was not
+// yet, or an error naming the one that is missing. An implementation that is not a loadbalancers.ReadinessChecker
+// is always ready.
+func (l *loadBalancers) checkImplementorReady(ctx context.Context) error {
+	l.readiness.mutex.Lock()
+	defer l.readiness.mutex.Unlock()
+	if l.readiness.ready {
+		return nil
+	}
+	err := l.implementorReadyErr(ctx)
+	if err != nil {
+		implementorReady.WithLabelValues(l.implementorScheme).Set(0)
+		l.readiness.err = err
+		return err
+	}
+	implementorReady.WithLabelValues(l.implementorScheme).Set(1)
+	// only report becoming ready after having been reported as not ready
+	if l.readiness.err != nil {
+		klog.Infof("load balancer implementation %s is ready, reconciling load balancers", l.implementorScheme)
+		if l.recorder != nil {
+			l.recorder.Event(l.implementorEventObject(), v1.EventTypeNormal, eventReasonImplementationReady,
+				fmt.Sprintf("load balancer implementation %s is ready, reconciling load balancers", l.implementorScheme))
+		}
+	}
+	l.readiness.ready, l.readiness.err = true, nil
+	return nil
+}
+
+// implementorReadyErr calls Ready of the implementation, if it is a loadbalancers.ReadinessChecker
+func (l *loadBalancers) implementorReadyErr(ctx context.Context) error {
+	checker, ok := l.implementor.(loadbalancers.ReadinessChecker)
+	if !ok {
+		return nil
+	}
+	if err := checker.Ready(ctx); err != nil {
+		return fmt.Errorf("load balancer implementation %s is not ready: %w", l.implementorScheme, err)
+	}
+	return nil
+}
+
+// implementorNotReady returns why the implementation is not ready as of the last check, or nil if it is, for /readyz
+func (l *loadBalancers) implementorNotReady() error {
+	l.readiness.mutex.Lock()
+	defer l.readiness.mutex.Unlock()
+	if l.readiness.ready {
+		return nil
+	}
+	return l.readiness.err
+}
+
+// startImplementorReadiness checks the prerequisites of the implementation right away. If one is missing, the CCM
+// starts degraded rather than failing: it reports it with a Warning Event, and checks again every
+// implementorReadinessSeconds until they all exist, while load balancers are not reconciled.
+func (l *loadBalancers) startImplementorReadiness() {
+	if l.implementor == nil {
+		return
+	}
+	err := l.checkImplementorReady(l.ctx)
+	if err == nil {
+		return
+	}
+	klog.Warningf("%v; starting degraded, and not reconciling load balancers until it is", err)
+	if l.recorder != nil {
+		l.recorder.Event(l.implementorEventObject(), v1.EventTypeWarning, eventReasonImplementationNotReady, err.Error())
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := l.clock.NewTicker(implementorReadinessSeconds * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping implementation readiness check")
+				return
+			case <-ticker.C():
+			}
+			err := l.checkImplementorReady(l.ctx)
+			if err == nil {
+				return
+			}
+			klog.V(2).Infof("%v", err)
+		}
+	}()
+}
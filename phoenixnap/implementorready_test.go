@@ -0,0 +1,107 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+// testReadinessLB a testRecordingLB whose prerequisites are missing until missing is cleared
+type testReadinessLB struct {
+	testRecordingLB
+	mutex   sync.Mutex
+	missing error
+}
+
+func (t *testReadinessLB) Ready(ctx context.Context) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.missing
+}
+
+func (t *testReadinessLB) setMissing(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.missing = err
+}
+
+// testReadyzStatus returns the status of /readyz of the load balancers
+func testReadyzStatus(l *loadBalancers) int {
+	rec := httptest.NewRecorder()
+	readyzHandler(l, false).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rec.Code
+}
+
+func TestImplementorReadiness(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, recorder := testGetLoadBalancers(t, 0, svc)
+	lb := &testReadinessLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		missing:         errors.New("CRD not installed"),
+	}
+	l.implementor = lb
+	clock := testingclock.NewFakeClock(time.Now())
+	l.clock = clock
+
+	// the CCM starts degraded, and reports why
+	l.startImplementorReadiness()
+	if event := <-recorder.Events; !strings.Contains(event, eventReasonImplementationNotReady) || !strings.Contains(event, "CRD not installed") {
+		t.Errorf("mismatched event, actual %q expected %s", event, eventReasonImplementationNotReady)
+	}
+	if status := testReadyzStatus(l); status != http.StatusInternalServerError {
+		t.Errorf("mismatched /readyz status while not ready, actual %d expected %d", status, http.StatusInternalServerError)
+	}
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err == nil {
+		t.Fatalf("expected error while the implementation is not ready")
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks while not ready, actual %d expected %d", count, 0)
+	}
+
+	// once the prerequisites appear, the recheck finds them, and reconciling starts
+	lb.setMissing(nil)
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		clock.Step(implementorReadinessSeconds * time.Second)
+		return l.implementorNotReady() == nil, nil
+	}); err != nil {
+		t.Fatalf("implementation not ready after its prerequisites appeared: %v", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, eventReasonImplementationReady) {
+		t.Errorf("mismatched event, actual %q expected %s", event, eventReasonImplementationReady)
+	}
+	if status := testReadyzStatus(l); status != http.StatusOK {
+		t.Errorf("mismatched /readyz status once ready, actual %d expected %d", status, http.StatusOK)
+	}
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.ips["default/svc1"]; !ok {
+		t.Errorf("service not added to the implementation once ready")
+	}
+}
+
+func TestImplementorReadinessWithoutChecker(t *testing.T) {
+	// an implementation without prerequisites is ready right away, and nothing is reported
+	l, _, recorder := testGetLoadBalancers(t, 0)
+	l.implementor = &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.startImplementorReadiness()
+	if err := l.implementorNotReady(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("unexpected event %q", event)
+	default:
+	}
+	if status := testReadyzStatus(l); status != http.StatusOK {
+		t.Errorf("mismatched /readyz status, actual %d expected %d", status, http.StatusOK)
+	}
+}
@@ -0,0 +1,41 @@
+package phoenixnap
+
+import (
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+	"k8s.io/klog/v2"
+)
+
+// startImplementorSync calls Sync of the load balancer implementation right away and then every
+// implementorSyncSeconds, until the loadBalancers are stopped, if it implements loadbalancers.Syncer
+func (l *loadBalancers) startImplementorSync() {
+	syncer, ok := l.implementor.(loadbalancers.Syncer)
+	if !ok {
+		return
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(implementorSyncSeconds * time.Second)
+		defer ticker.Stop()
+
+		for {
+			ctx := withSubsystem(l.ctx, subsystemLoadBalancer)
+			// nothing to sync until the prerequisites of the implementation exist
+			if l.implementorNotReady() != nil {
+				klog.V(2).Infof("not syncing load balancer implementation %s, it is not ready", l.implementorScheme)
+			} else if err := l.callImplementor(implementorOpSync, func() error {
+				return syncer.Sync(ctx)
+			}); err != nil {
+				klog.Errorf("unable to sync load balancer implementation %s: %v", l.implementorScheme, err)
+			}
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping implementation sync")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
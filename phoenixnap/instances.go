@@ -5,43 +5,119 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 )
 
 type instances struct {
-	bmcClient *bmcapi.APIClient
+	// bmcClients clients for every account that may own servers, searched in order
+	bmcClients []*bmcapi.APIClient
+	k8sclient  kubernetes.Interface
+	recorder   record.EventRecorder
+	// regionFormat how the location of the server of a node is formatted as its region
+	regionFormat string
+	// hostnameLabel label nodes with the hostname of their server
+	hostnameLabel bool
+	mismatches    hostnameMismatches
+	// deletionProtection report servers as existing while the API fails with a transient error
+	deletionProtection bool
+	// catalog describes instance types, if the billing API is available
+	catalog *productCatalog
+	// status records the results of instance calls, if the status resource is enabled
+	status *syncStatus
+	// resolver coalesces server lookups; if nil, each lookup calls the API
+	resolver *serverResolver
+	// nodeSelector the nodes whose servers are managed; if nil, all nodes
+	nodeSelector labels.Selector
+	// ignoreForeignNodes do not manage nodes whose provider ID is of another provider, rather than fail on them
+	ignoreForeignNodes bool
+	// duplicateHostnames the policy for node names that are the hostname of more than one server
+	duplicateHostnames string
+	// clusterTag the name of the tag with the ID of the cluster, for DuplicateHostnamesClusterTag
+	clusterTag string
+	// cluster the ID of the cluster, shared with the load balancers
+	cluster *clusterIDSource
+	// clock the time of the grace period of uninitialized nodes; a fake one in tests
+	clock clock.WithTicker
 }
 
 var (
 	_ cloudprovider.InstancesV2 = (*instances)(nil)
 )
 
-func newInstances(client *bmcapi.APIClient) *instances {
-	return &instances{bmcClient: client}
+func newInstances(clients ...*bmcapi.APIClient) *instances {
+	return &instances{bmcClients: clients, resolver: newServerResolver(serverListWindowSeconds * time.Second), clock: clock.RealClock{}}
+}
+
+// manages returns whether the node is selected by the instance node selector and, with ignoreForeignNodes, has no
+// provider ID of another provider; the servers of the others, e.g. the nodes of another provider in a hybrid cluster,
+// are not looked up
+func (i *instances) manages(node *v1.Node) bool {
+	if i.nodeSelector != nil && !i.nodeSelector.Matches(labels.Set(node.Labels)) {
+		klog.V(2).Infof("node %s is not selected by the instance node selector %s, so is not managed", node.Name, i.nodeSelector)
+		return false
+	}
+	if i.ignoreForeignNodes && foreignProviderID(node.Spec.ProviderID) {
+		klog.V(2).Infof("node %s has the provider ID %s of another provider, so is not managed", node.Name, node.Spec.ProviderID)
+		return false
+	}
+	return true
+}
+
+// foreignProviderID returns whether providerID is of a provider other than PhoenixNAP, e.g. aws://...
+func foreignProviderID(providerID string) bool {
+	split := strings.SplitN(providerID, "://", 2)
+	return len(split) == 2 && split[0] != ProviderName
 }
 
 // InstanceShutdown returns true if the node is shutdown in cloudprovider
 func (i *instances) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
 	klog.V(2).Infof("called InstanceShutdown for node %s with providerID %s", node.GetName(), node.Spec.ProviderID)
-	server, err := i.serverFromProviderID(node.Spec.ProviderID)
+	if !i.manages(node) {
+		return false, nil
+	}
+	server, err := i.serverFromProviderID(withSubsystem(ctx, subsystemInstances), node.Spec.ProviderID)
+	i.status.recordInstances(err)
 	if err != nil {
+		i.recordInstanceCheck(node, "InstanceShutdown", err)
 		return false, err
 	}
 
-	return server.Status == string(InstanceStatusPoweredOff), nil
+	return enumEquals(enumServerStatus, server.Status, string(InstanceStatusPoweredOff)), nil
 }
 
 // InstanceExists returns true if the node exists in cloudprovider
 func (i *instances) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
 	klog.V(2).Infof("called InstanceExists for node %s with providerID %s", node.GetName(), node.Spec.ProviderID)
-	_, err := i.serverFromProviderID(node.Spec.ProviderID)
-
+	if !i.manages(node) {
+		// the node controller must not delete nodes that are not ours
+		return true, nil
+	}
+	_, err := i.serverFromProviderID(withSubsystem(ctx, subsystemInstances), node.Spec.ProviderID)
+	i.status.recordInstances(err)
+
+	if err != nil && i.deletionProtection && transientError(err) {
+		// the node controller must not delete the node because the API cannot tell whether the server exists
+		instanceExistsAssumedTotal.Inc()
+		klog.Warningf("assuming the server of node %s with providerID %s exists, as the PhoenixNAP API failed: %v", node.GetName(), node.Spec.ProviderID, err)
+		if i.recorder != nil {
+			i.recorder.Eventf(node, v1.EventTypeWarning, eventReasonServerAssumedToExist, "InstanceExists assumes the server with provider ID %s exists, as the PhoenixNAP API failed with an error of class %s: %v", node.Spec.ProviderID, ReasonForError(err), err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		i.recordInstanceCheck(node, "InstanceExists", err)
+	}
 	switch {
 	case errors.Is(err, cloudprovider.InstanceNotFound):
 		return false, nil
@@ -52,12 +128,43 @@ func (i *instances) InstanceExists(ctx context.Context, node *v1.Node) (bool, er
 	return true, nil
 }
 
+// recordInstanceCheck records an Event on the node when a check of its server fails or finds no server,
+// as the node controller may act on it, e.g. delete the node. The Event has the provider ID and the
+// class of the API error, so that the action can be traced to the API response.
+func (i *instances) recordInstanceCheck(node *v1.Node, check string, err error) {
+	if i.recorder == nil {
+		return
+	}
+	if errors.Is(err, cloudprovider.InstanceNotFound) {
+		i.recorder.Eventf(node, v1.EventTypeWarning, eventReasonServerNotFound, "%s found no server with provider ID %s in any account", check, node.Spec.ProviderID)
+		return
+	}
+	i.recorder.Eventf(node, v1.EventTypeWarning, eventReasonInstanceCheckFailed, "%s failed for provider ID %s with a PhoenixNAP API error of class %s: %v", check, node.Spec.ProviderID, ReasonForError(err), err)
+}
+
 // InstanceMetadata returns instancemetadata for the node according to the cloudprovider
 func (i *instances) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
-	server, err := i.serverByNode(node)
+	if !i.manages(node) {
+		// what the node has, so that the cloud node controller changes nothing
+		return &cloudprovider.InstanceMetadata{
+			ProviderID:    node.Spec.ProviderID,
+			InstanceType:  node.Labels[v1.LabelInstanceTypeStable],
+			NodeAddresses: node.Status.Addresses,
+			Region:        node.Labels[v1.LabelTopologyRegion],
+			Zone:          node.Labels[v1.LabelTopologyZone],
+		}, nil
+	}
+	server, err := i.serverByNode(withSubsystem(ctx, subsystemInstances), node)
+	i.status.recordInstances(err)
 	if err != nil {
 		return nil, err
 	}
+	if node.Spec.ProviderID != "" {
+		i.checkHostname(ctx, node, server)
+	}
+	if i.catalog != nil {
+		i.recordInstanceType(ctx, server)
+	}
 	nodeAddresses, err := nodeAddresses(*server)
 	if err != nil {
 		return nil, err
@@ -69,12 +176,14 @@ func (i *instances) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloud
 	//
 	// https://kubernetes.io/docs/reference/labels-annotations-taints/#topologykubernetesiozone
 
-	return &cloudprovider.InstanceMetadata{
+	metadata := &cloudprovider.InstanceMetadata{
 		ProviderID:    providerIDFromServer(server),
 		InstanceType:  server.Type,
 		NodeAddresses: nodeAddresses,
-		Region:        server.Location,
-	}, nil
+		Region:        formatRegion(server.Location, i.regionFormat),
+	}
+	setAdditionalLabels(metadata, i.additionalLabels(*server))
+	return metadata, nil
 }
 
 func nodeAddresses(server bmcapi.Server) ([]v1.NodeAddress, error) {
@@ -102,55 +211,82 @@ func nodeAddresses(server bmcapi.Server) ([]v1.NodeAddress, error) {
 	return addresses, nil
 }
 
-func (i *instances) serverByNode(node *v1.Node) (*bmcapi.Server, error) {
+func (i *instances) serverByNode(ctx context.Context, node *v1.Node) (*bmcapi.Server, error) {
 	if node.Spec.ProviderID != "" {
-		return i.serverFromProviderID(node.Spec.ProviderID)
+		return i.serverFromProviderID(ctx, node.Spec.ProviderID)
+	}
+	if id := node.Annotations[annotationServerID]; id != "" {
+		return i.serverFromProviderID(ctx, id)
+	}
+	if machine := node.Annotations[annotationCAPIMachine]; machine != "" {
+		klog.V(2).Infof("node %s of Cluster API machine %s has neither a provider ID nor annotation %s, looking up its server by name", node.GetName(), machine, annotationServerID)
 	}
 
-	return serverByName(i.bmcClient, types.NodeName(node.GetName()))
+	for _, client := range i.bmcClients {
+		server, err := i.resolver.serverByName(ctx, client, node.GetName())
+		if errors.Is(err, cloudprovider.InstanceNotFound) {
+			continue
+		}
+		var dup *duplicateHostnameError
+		if errors.As(err, &dup) {
+			return i.resolveDuplicateHostname(ctx, node, dup)
+		}
+		return server, err
+	}
+	return nil, cloudprovider.InstanceNotFound
 }
 
-func serverByID(client *bmcapi.APIClient, id string) (*bmcapi.Server, error) {
+func serverByID(ctx context.Context, client *bmcapi.APIClient, id string) (*bmcapi.Server, error) {
 	klog.V(2).Infof("called serverByID with ID %s", id)
-	server, resp, err := client.ServersApi.ServersServerIdGet(context.Background(), id).Execute()
+	server, resp, err := client.ServersApi.ServersServerIdGet(ctx, id).Execute()
 
-	if resp.StatusCode == 404 || resp.StatusCode == 403 {
+	if resp != nil && (resp.StatusCode == 404 || resp.StatusCode == 403) {
 		return nil, cloudprovider.InstanceNotFound
 	}
 	if err != nil {
-		return nil, err
+		return nil, providerError(resp, err)
 	}
-	return server, err
+	return server, nil
 }
 
 // serverByName returns an instance whose hostname matches the kubernetes node.Name
-func serverByName(client *bmcapi.APIClient, nodeName types.NodeName) (*bmcapi.Server, error) {
+func serverByName(ctx context.Context, client *bmcapi.APIClient, nodeName types.NodeName) (*bmcapi.Server, error) {
 	klog.V(2).Infof("called serverByName nodeName %s", nodeName)
 	if string(nodeName) == "" {
 		return nil, errors.New("node name cannot be empty string")
 	}
-	servers, _, err := client.ServersApi.ServersGet(context.Background()).Execute()
+	servers, resp, err := client.ServersApi.ServersGet(ctx).Execute()
 
 	if err != nil {
+		err = providerError(resp, err)
 		klog.V(2).Infof("error listing servers: %v", err)
 		return nil, err
 	}
 
+	var matches []bmcapi.Server
 	for _, server := range servers {
 		if server.Hostname == string(nodeName) {
 			klog.V(2).Infof("Found server %s for nodeName %s", server.Id, nodeName)
-			return &server, nil
+			matches = append(matches, server)
 		}
 	}
 
-	klog.V(2).Infof("No server found for nodeName %s", nodeName)
-	return nil, cloudprovider.InstanceNotFound
+	switch len(matches) {
+	case 0:
+		klog.V(2).Infof("No server found for nodeName %s", nodeName)
+		return nil, cloudprovider.InstanceNotFound
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, &duplicateHostnameError{hostname: string(nodeName), servers: matches}
+	}
 }
 
 // serverIDFromProviderID returns a server's ID from providerID.
 //
 // The providerID spec should be retrievable from the Kubernetes
-// node object. The expected format is: phoenixnap://server-id or just server-id
+// node object. The expected format is: phoenixnap://server-id or just server-id,
+// or one of the Cluster API forms accepted by serverIDFromProviderPath.
 func serverIDFromProviderID(providerID string) (string, error) {
 	klog.V(2).Infof("called serverIDFromProviderID with providerID %s", providerID)
 	if providerID == "" {
@@ -158,31 +294,35 @@ func serverIDFromProviderID(providerID string) (string, error) {
 	}
 
 	split := strings.Split(providerID, "://")
-	var serverID string
 	switch len(split) {
 	case 2:
-		serverID = split[1]
 		if split[0] != ProviderName {
 			return "", fmt.Errorf("provider name from providerID should be %s, was %s", ProviderName, split[0])
 		}
+		return serverIDFromProviderPath(split[1])
 	case 1:
-		serverID = providerID
+		return providerID, nil
 	default:
 		return "", fmt.Errorf("unexpected providerID format: %s, format should be: 'server-id' or 'phoenixnap://server-id'", providerID)
 	}
-
-	return serverID, nil
 }
 
 // serverFromProviderID uses providerID to get the server id and return the server
-func (i *instances) serverFromProviderID(providerID string) (*bmcapi.Server, error) {
+func (i *instances) serverFromProviderID(ctx context.Context, providerID string) (*bmcapi.Server, error) {
 	klog.V(2).Infof("called serverFromProviderID with providerID %s", providerID)
 	id, err := serverIDFromProviderID(providerID)
 	if err != nil {
 		return nil, err
 	}
 
-	return serverByID(i.bmcClient, id)
+	for _, client := range i.bmcClients {
+		server, err := i.resolver.serverByID(ctx, client, id)
+		if errors.Is(err, cloudprovider.InstanceNotFound) {
+			continue
+		}
+		return server, err
+	}
+	return nil, cloudprovider.InstanceNotFound
 }
 
 // providerIDFromServer returns a providerID from a server
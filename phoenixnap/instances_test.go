@@ -3,13 +3,22 @@ package phoenixnap
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"sort"
 	"strings"
 	"testing"
 
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/metrics/testutil"
 )
 
 // testNode provides a simple Node object satisfying the lookup requirements of InstanceMetadata()
@@ -243,6 +252,57 @@ func TestInstanceShutdownByProviderID(t *testing.T) {
 	}
 }
 
+func TestInstanceExistsMultipleAccounts(t *testing.T) {
+	vc, _ := testGetValidCloud(t, "")
+	// second account, which owns its own servers
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	ts := httptest.NewServer(fake.CreateHandler())
+	defer ts.Close()
+	bmc, _, _, _, _, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	vc.instances = newInstances(vc.bmcClient, bmc)
+	inst, _ := vc.InstancesV2()
+
+	serverName := testGetNewServerName()
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(serverName, product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+
+	tests := []struct {
+		node   *v1.Node
+		exists bool
+	}{
+		{testNode(fmt.Sprintf("phoenixnap://%s", server.Id), nodeName), true}, // by ID in second account
+		{testNode(fmt.Sprintf("phoenixnap://%s", randomID), nodeName), false}, // in neither account
+	}
+	for i, tt := range tests {
+		exists, err := inst.InstanceExists(context.TODO(), tt.node)
+		switch {
+		case err != nil:
+			t.Errorf("%d: unexpected error %v", i, err)
+		case exists != tt.exists:
+			t.Errorf("%d: mismatched exists, actual %v expected %v", i, exists, tt.exists)
+		}
+	}
+
+	md, err := inst.InstanceMetadata(context.TODO(), testNode("", serverName))
+	if err != nil {
+		t.Fatalf("unexpected error getting metadata by name: %v", err)
+	}
+	if md.ProviderID != providerIDFromServer(server) {
+		t.Errorf("mismatched provider ID, actual %s expected %s", md.ProviderID, providerIDFromServer(server))
+	}
+}
+
 func compareAddresses(a1, a2 []v1.NodeAddress) bool {
 	switch {
 	case (a1 == nil && a2 != nil) || (a1 != nil && a2 == nil):
@@ -268,3 +328,197 @@ func compareAddresses(a1, a2 []v1.NodeAddress) bool {
 	}
 
 }
+
+func TestInstanceCheckEvents(t *testing.T) {
+	// an API that is down
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	bmc, _, _, _, _, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	vc, _ := testGetValidCloud(t, "")
+	recorder := record.NewFakeRecorder(10)
+	vc.instances.recorder = recorder
+	node := testNode(fmt.Sprintf("phoenixnap://%s", randomID), nodeName)
+
+	// no server in the account
+	if exists, err := vc.instances.InstanceExists(context.TODO(), node); err != nil || exists {
+		t.Fatalf("expected no server, got exists %v error %v", exists, err)
+	}
+	// the check fails
+	vc.instances.bmcClients = []*bmcapi.APIClient{bmc}
+	if _, err := vc.instances.InstanceShutdown(context.TODO(), node); err == nil {
+		t.Fatalf("expected error from the API")
+	}
+
+	expected := []string{
+		fmt.Sprintf("Warning %s InstanceExists found no server with provider ID %s", eventReasonServerNotFound, node.Spec.ProviderID),
+		fmt.Sprintf("Warning %s InstanceShutdown failed for provider ID %s with a PhoenixNAP API error of class %s", eventReasonInstanceCheckFailed, node.Spec.ProviderID, ErrorReasonUnavailable),
+	}
+	if len(recorder.Events) != len(expected) {
+		t.Fatalf("mismatched events, actual %d expected %d", len(recorder.Events), len(expected))
+	}
+	for i, prefix := range expected {
+		if event := <-recorder.Events; !strings.HasPrefix(event, prefix) {
+			t.Errorf("%d: mismatched event, actual %q expected prefix %q", i, event, prefix)
+		}
+	}
+}
+
+func TestInstanceExistsDeletionProtection(t *testing.T) {
+	// an API that is down
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	down, _, _, _, _, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	vc, _ := testGetValidCloud(t, "")
+	up := vc.bmcClient
+	recorder := record.NewFakeRecorder(10)
+	inst := vc.instances
+	inst.recorder = recorder
+	node := testNode(fmt.Sprintf("phoenixnap://%s", randomID), nodeName)
+
+	tests := []struct {
+		name       string
+		client     *bmcapi.APIClient
+		protection bool
+		exists     bool
+		err        bool
+		assumed    float64
+		reason     string
+	}{
+		{"unprotected outage", down, false, false, true, 0, eventReasonInstanceCheckFailed},
+		{"protected outage", down, true, true, false, 1, eventReasonServerAssumedToExist},
+		// a definitive answer is not overridden
+		{"protected not found", up, true, false, false, 0, eventReasonServerNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst.bmcClients = []*bmcapi.APIClient{tt.client}
+			inst.deletionProtection = tt.protection
+			before, _ := testutil.GetCounterMetricValue(instanceExistsAssumedTotal)
+
+			exists, err := inst.InstanceExists(context.TODO(), node)
+			switch {
+			case tt.err && err == nil:
+				t.Fatalf("expected error")
+			case !tt.err && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case exists != tt.exists:
+				t.Errorf("mismatched exists, actual %v expected %v", exists, tt.exists)
+			}
+			after, _ := testutil.GetCounterMetricValue(instanceExistsAssumedTotal)
+			if after-before != tt.assumed {
+				t.Errorf("mismatched assumed, actual %v expected %v", after-before, tt.assumed)
+			}
+			if event := <-recorder.Events; !strings.Contains(event, " "+tt.reason+" ") {
+				t.Errorf("mismatched event, actual %q expected reason %s", event, tt.reason)
+			}
+		})
+	}
+}
+
+func TestInstanceNodeSelector(t *testing.T) {
+	vc, _ := testGetValidCloud(t, "")
+	inst := vc.instances
+	inst.nodeSelector, _ = labels.Parse("provider=phoenixnap")
+	ctx := context.TODO()
+
+	foreign := testNode(fmt.Sprintf("aws://%s", randomID), nodeName)
+	foreign.Labels = map[string]string{"provider": "aws", v1.LabelTopologyRegion: "us-east-1"}
+	foreign.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}
+
+	exists, err := inst.InstanceExists(ctx, foreign)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error from InstanceExists: %v", err)
+	case !exists:
+		t.Errorf("unmanaged node reported as not existing")
+	}
+	shutdown, err := inst.InstanceShutdown(ctx, foreign)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error from InstanceShutdown: %v", err)
+	case shutdown:
+		t.Errorf("unmanaged node reported as shut down")
+	}
+	md, err := inst.InstanceMetadata(ctx, foreign)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error from InstanceMetadata: %v", err)
+	case md.ProviderID != foreign.Spec.ProviderID:
+		t.Errorf("mismatched provider ID, actual %s expected %s", md.ProviderID, foreign.Spec.ProviderID)
+	case md.Region != "us-east-1":
+		t.Errorf("mismatched region, actual %s expected us-east-1", md.Region)
+	case len(md.NodeAddresses) != 1 || md.NodeAddresses[0].Address != "10.0.0.1":
+		t.Errorf("mismatched addresses, actual %v", md.NodeAddresses)
+	}
+
+	// selected nodes are looked up as before
+	managed := testNode(fmt.Sprintf("phoenixnap://%s", randomID), nodeName)
+	managed.Labels = map[string]string{"provider": "phoenixnap"}
+	if exists, err := inst.InstanceExists(ctx, managed); err != nil || exists {
+		t.Errorf("mismatched result for managed node with unknown server, actual %v, %v expected false, nil", exists, err)
+	}
+}
+
+func TestInstanceIgnoreForeignNodes(t *testing.T) {
+	vc, _ := testGetValidCloud(t, "")
+	inst := vc.instances
+	ctx := context.TODO()
+	foreign := testNode(fmt.Sprintf("aws://%s", randomID), nodeName)
+
+	if _, err := inst.InstanceExists(ctx, foreign); err == nil {
+		t.Errorf("expected error for a foreign provider ID without ignoreForeignNodes")
+	}
+
+	inst.ignoreForeignNodes = true
+	exists, err := inst.InstanceExists(ctx, foreign)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error from InstanceExists: %v", err)
+	case !exists:
+		t.Errorf("foreign node reported as not existing")
+	}
+	if shutdown, err := inst.InstanceShutdown(ctx, foreign); err != nil || shutdown {
+		t.Errorf("mismatched InstanceShutdown of foreign node, actual %v, %v expected false, nil", shutdown, err)
+	}
+	md, err := inst.InstanceMetadata(ctx, foreign)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error from InstanceMetadata: %v", err)
+	case md.ProviderID != foreign.Spec.ProviderID:
+		t.Errorf("mismatched provider ID, actual %s expected %s", md.ProviderID, foreign.Spec.ProviderID)
+	}
+
+	// PhoenixNAP provider IDs are still looked up
+	if exists, err := inst.InstanceExists(ctx, testNode(fmt.Sprintf("phoenixnap://%s", randomID), nodeName)); err != nil || exists {
+		t.Errorf("mismatched result for unknown server, actual %v, %v expected false, nil", exists, err)
+	}
+}
+
+func TestForeignProviderID(t *testing.T) {
+	tests := []struct {
+		providerID string
+		foreign    bool
+	}{
+		{"", false},
+		{randomID, false},
+		{"phoenixnap://" + randomID, false},
+		{"phoenixnap:///PHX/" + randomID, false},
+		{"aws:///us-east-1a/i-0123", true},
+		{"gce://project/zone/name", true},
+	}
+	for _, tt := range tests {
+		if foreign := foreignProviderID(tt.providerID); foreign != tt.foreign {
+			t.Errorf("mismatched foreign for %q, actual %v expected %v", tt.providerID, foreign, tt.foreign)
+		}
+	}
+}
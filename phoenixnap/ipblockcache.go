@@ -0,0 +1,80 @@
+package phoenixnap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	"k8s.io/utils/clock"
+)
+
+// ipBlockCache holds a short-lived copy of all of the IP blocks of the cluster, indexed by
+// the Service they belong to. Rather than a tag-filtered list call for every Service on every
+// reconcile, the blocks are listed once and shared until they expire or are invalidated.
+type ipBlockCache struct {
+	ttl   time.Duration
+	list  func(ctx context.Context) ([]ipapi.IpBlock, error)
+	clock clock.PassiveClock
+
+	mutex     sync.Mutex
+	fetched   time.Time
+	blocks    []ipapi.IpBlock
+	byService map[string][]ipapi.IpBlock
+}
+
+func newIPBlockCache(ttl time.Duration, list func(ctx context.Context) ([]ipapi.IpBlock, error)) *ipBlockCache {
+	return &ipBlockCache{ttl: ttl, list: list, clock: clock.RealClock{}}
+}
+
+// get returns the blocks of the cluster; if namespace and name both are set, only those of that Service.
+// The returned slice is a copy, and may be modified by the caller.
+func (c *ipBlockCache) get(ctx context.Context, namespace, name string) ([]ipapi.IpBlock, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.byService == nil || c.clock.Since(c.fetched) > c.ttl {
+		blocks, err := c.list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.blocks = blocks
+		c.byService = map[string][]ipapi.IpBlock{}
+		for _, b := range blocks {
+			ns, _ := blockTagValue(b, serviceNamespaceTag)
+			n, _ := blockTagValue(b, serviceNameTag)
+			key := ns + "/" + n
+			c.byService[key] = append(c.byService[key], b)
+		}
+		c.fetched = c.clock.Now()
+		ipBlockListRequestsTotal.Inc()
+	} else {
+		ipBlockCacheHitsTotal.Inc()
+	}
+
+	var source []ipapi.IpBlock
+	switch {
+	case namespace != "" && name != "":
+		source = c.byService[namespace+"/"+name]
+	case namespace == "" && name == "":
+		source = c.blocks
+	default:
+		for _, b := range c.blocks {
+			ns, _ := blockTagValue(b, serviceNamespaceTag)
+			n, _ := blockTagValue(b, serviceNameTag)
+			if (namespace == "" || ns == namespace) && (name == "" || n == name) {
+				source = append(source, b)
+			}
+		}
+	}
+	return append([]ipapi.IpBlock(nil), source...), nil
+}
+
+// invalidate discards the cached blocks, so the next get lists them again.
+// It must be called after anything that changes a block of the cluster.
+func (c *ipBlockCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.byService = nil
+	c.blocks = nil
+}
@@ -0,0 +1,89 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func testBlockForService(id, namespace, name string) ipapi.IpBlock {
+	return ipapi.IpBlock{
+		Id: id,
+		Tags: []ipapi.TagAssignment{
+			{Name: serviceNamespaceTag, Value: &namespace},
+			{Name: serviceNameTag, Value: &name},
+		},
+	}
+}
+
+func TestIPBlockCache(t *testing.T) {
+	var calls int
+	list := func(ctx context.Context) ([]ipapi.IpBlock, error) {
+		calls++
+		return []ipapi.IpBlock{
+			testBlockForService("a", "ns1", "svc1"),
+			testBlockForService("b", "ns1", "svc2"),
+			testBlockForService("c", "ns2", "svc1"),
+		}, nil
+	}
+	clock := testingclock.NewFakeClock(time.Now())
+	cache := newIPBlockCache(time.Hour, list)
+	cache.clock = clock
+
+	tests := []struct {
+		namespace, name string
+		ids             []string
+	}{
+		{"ns1", "svc1", []string{"a"}},
+		{"ns2", "svc1", []string{"c"}},
+		{"ns2", "svc2", nil},
+		{"ns1", "", []string{"a", "b"}},
+		{"", "", []string{"a", "b", "c"}},
+	}
+	for i, tt := range tests {
+		blocks, err := cache.get(context.TODO(), tt.namespace, tt.name)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if len(blocks) != len(tt.ids) {
+			t.Errorf("%d: mismatched blocks, actual %v expected %v", i, blocks, tt.ids)
+			continue
+		}
+		for j := range blocks {
+			if blocks[j].Id != tt.ids[j] {
+				t.Errorf("%d: mismatched block %d, actual %s expected %s", i, j, blocks[j].Id, tt.ids[j])
+			}
+		}
+	}
+	if calls != 1 {
+		t.Errorf("mismatched list calls, actual %d expected %d", calls, 1)
+	}
+
+	cache.invalidate()
+	if _, err := cache.get(context.TODO(), "ns1", "svc1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("mismatched list calls after invalidate, actual %d expected %d", calls, 2)
+	}
+
+	// until the ttl is over, the blocks are shared
+	clock.Step(time.Hour)
+	if _, err := cache.get(context.TODO(), "", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("mismatched list calls within ttl, actual %d expected %d", calls, 2)
+	}
+	clock.Step(time.Second)
+	if _, err := cache.get(context.TODO(), "", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("mismatched list calls after ttl, actual %d expected %d", calls, 3)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !cloudprovider_v1_29
+
+package phoenixnap
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// The adapter for the Kubernetes API modules of the version in go.mod and those up to v0.28, whose
+// LoadBalancerIngress has no ipMode; build with the tag cloudprovider_v1_29 against v0.29 and later, see
+// ipmode_v1_29.go.
+
+// setIPMode does nothing, as LoadBalancerIngress has no IPMode before k8s.io/api v0.29
+func setIPMode(ingress *v1.LoadBalancerIngress, proxy bool) {}
@@ -0,0 +1,18 @@
+//go:build cloudprovider_v1_29
+
+package phoenixnap
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// The adapter for the Kubernetes API modules v0.29 and later; see ipmode.go.
+
+// setIPMode sets the ipMode of ingress to Proxy if proxy, else to VIP
+func setIPMode(ingress *v1.LoadBalancerIngress, proxy bool) {
+	mode := v1.LoadBalancerIPModeVIP
+	if proxy {
+		mode = v1.LoadBalancerIPModeProxy
+	}
+	ingress.IPMode = &mode
+}
@@ -0,0 +1,43 @@
+package phoenixnap
+
+import (
+	"sync"
+)
+
+// keyedMutex a mutex per key, so that work on one key does not wait for work on another.
+// The mutex of a key is created when first locked, and dropped when no longer in use.
+type keyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the mutex of key, and returns the function to unlock it
+func (k *keyedMutex) lock(key string) func() {
+	k.mutex.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mutex.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mutex.Unlock()
+	}
+}
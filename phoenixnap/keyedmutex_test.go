@@ -0,0 +1,40 @@
+package phoenixnap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var k keyedMutex
+	unlockA := k.lock("a")
+
+	// a different key does not wait
+	unlockB := k.lock("b")
+	unlockB()
+
+	// the same key waits until unlocked
+	locked := make(chan struct{})
+	go func() {
+		unlock := k.lock("a")
+		close(locked)
+		unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("second lock of the same key did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlockA()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second lock of the same key not acquired after unlock")
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if len(k.locks) != 0 {
+		t.Errorf("mismatched locks held, actual %d expected 0", len(k.locks))
+	}
+}
@@ -0,0 +1,56 @@
+package phoenixnap
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// kubeClient returns the kubernetes client with which the provider accesses Services, Nodes and the resources
+// of the implementation: from the Kubeconfig of the config, if set, e.g. when the CCM runs outside the
+// cluster it manages, else from the client builder of the controller manager
+func (c *cloud) kubeClient(clientBuilder cloudprovider.ControllerClientBuilder) (kubernetes.Interface, error) {
+	if c.config.Kubeconfig == "" {
+		return clientBuilder.ClientOrDie(kubeClientName), nil
+	}
+	config, err := kubeRESTConfig(c.config.Kubeconfig, c.config.KubeconfigContext)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("using kubeconfig %s, context %q, for the cluster at %s", c.config.Kubeconfig, c.config.KubeconfigContext, config.Host)
+	return kubernetes.NewForConfig(rest.AddUserAgent(config, kubeClientName))
+}
+
+// dynamicClient returns the dynamic client with which the provider publishes its status resource, and syncs
+// Gateways, to the same cluster as kubeClient
+func (c *cloud) dynamicClient(clientBuilder cloudprovider.ControllerClientBuilder) (dynamic.Interface, error) {
+	if c.config.Kubeconfig == "" {
+		config, err := clientBuilder.Config(kubeClientName)
+		if err != nil {
+			return nil, err
+		}
+		return dynamic.NewForConfig(config)
+	}
+	config, err := kubeRESTConfig(c.config.Kubeconfig, c.config.KubeconfigContext)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(rest.AddUserAgent(config, kubeClientName))
+}
+
+// kubeRESTConfig loads the client config of the given context of a kubeconfig file, or of its current
+// context if empty. Credentials that are files, e.g. a service account token, are read again when they change.
+func kubeRESTConfig(path, context string) (*rest.Config, error) {
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: path}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load kubeconfig %s, context %q: %w", path, context, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,82 @@
+package phoenixnap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKubeconfig a kubeconfig with a context for each cluster, and a service account token file for TOKENFILE
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: management
+  cluster:
+    server: https://management.example.com:6443
+- name: workload
+  cluster:
+    server: https://workload.example.com:6443
+users:
+- name: ccm
+  user:
+    tokenFile: TOKENFILE
+contexts:
+- name: management
+  context:
+    cluster: management
+    user: ccm
+- name: workload
+  context:
+    cluster: workload
+    user: ccm
+current-context: management
+`
+
+func TestKubeRESTConfig(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("service-account-token"), 0o600); err != nil {
+		t.Fatalf("unable to write token: %v", err)
+	}
+	path := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(path, []byte(strings.ReplaceAll(testKubeconfig, "TOKENFILE", tokenFile)), 0o600); err != nil {
+		t.Fatalf("unable to write kubeconfig: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		context string
+		host    string
+		valid   bool
+	}{
+		{path, "", "https://management.example.com:6443", true},
+		{path, "workload", "https://workload.example.com:6443", true},
+		{path, "unknown", "", false},
+		{filepath.Join(dir, "missing"), "missing", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.context, func(t *testing.T) {
+			config, err := kubeRESTConfig(tt.path, tt.context)
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Fatalf("expected error")
+			case !tt.valid:
+				return
+			case config.Host != tt.host:
+				t.Errorf("mismatched host, actual %s expected %s", config.Host, tt.host)
+			case config.BearerTokenFile != tokenFile:
+				t.Errorf("mismatched token file, actual %q", config.BearerTokenFile)
+			}
+		})
+	}
+}
+
+func TestKubeconfigContextWithoutKubeconfig(t *testing.T) {
+	_, err := getConfig(strings.NewReader(`{"clientID": "id", "clientSecret": "secret", "kubeconfigContext": "workload"}`))
+	if err == nil {
+		t.Errorf("expected error for a context without kubeconfig")
+	}
+}
@@ -0,0 +1,61 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Services are often created ahead of their workloads, e.g. by a chart, and each IP block is billed from the
+// moment it is purchased. With lazy allocation, the block of a Service is only purchased once it has a ready
+// endpoint, or, if a delay is set, once it is that old. Until then, EnsureLoadBalancer fails, so that the Service
+// stays Pending, and the service controller retries it with its backoff, at most every few minutes.
+
+// awaitEndpoints returns an error, and records an Event on the service, if lazy allocation is enabled and the
+// service must wait for a ready endpoint before its IP block is purchased
+func (l *loadBalancers) awaitEndpoints(ctx context.Context, service *v1.Service) error {
+	if !l.allocateOnEndpoints {
+		return nil
+	}
+	if l.allocateDelay > 0 && l.clock.Since(service.CreationTimestamp.Time) >= l.allocateDelay {
+		return nil
+	}
+	ready, err := l.hasReadyEndpoints(ctx, service)
+	if err != nil {
+		return err
+	}
+	if ready {
+		return nil
+	}
+	msg := "waiting for a ready endpoint before purchasing an IP block"
+	if l.allocateDelay > 0 {
+		msg = fmt.Sprintf("%s, or until %s", msg, service.CreationTimestamp.Add(l.allocateDelay).UTC().Format(time.RFC3339))
+	}
+	klog.V(2).Infof("service %s: %s", serviceRep(service), msg)
+	if l.recorder != nil {
+		l.recorder.Event(service, v1.EventTypeNormal, eventReasonAwaitingEndpoints, msg)
+	}
+	return fmt.Errorf("service %s: %s", serviceRep(service), msg)
+}
+
+// hasReadyEndpoints returns whether the Endpoints of the service have a ready address
+func (l *loadBalancers) hasReadyEndpoints(ctx context.Context, service *v1.Service) (bool, error) {
+	endpoints, err := l.k8sclient.CoreV1().Endpoints(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("unable to get endpoints of service %s: %w", serviceRep(service), err)
+	}
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
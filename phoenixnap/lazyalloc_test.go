@@ -0,0 +1,66 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAllocateOnEndpoints(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.CreationTimestamp = metav1.Now()
+	l, backend, recorder := testGetLoadBalancers(t, 0, svc)
+	l.allocateOnEndpoints = true
+	ctx := context.TODO()
+
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc, nil); err == nil {
+		t.Fatalf("expected error without endpoints")
+	}
+	if blocks, _ := backend.ListIPBlocks(); len(blocks) != 0 {
+		t.Errorf("mismatched IP blocks without endpoints, actual %d expected %d", len(blocks), 0)
+	}
+	if count := testCountEvents(testDrainEvents(recorder), eventReasonAwaitingEndpoints); count != 1 {
+		t.Errorf("mismatched %s events, actual %d expected %d", eventReasonAwaitingEndpoints, count, 1)
+	}
+
+	// an endpoint that is not ready does not count
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc1"},
+		Subsets:    []v1.EndpointSubset{{NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}}},
+	}
+	if _, err := l.k8sclient.CoreV1().Endpoints("default").Create(ctx, endpoints, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unable to create endpoints: %v", err)
+	}
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc, nil); err == nil {
+		t.Fatalf("expected error without ready endpoints")
+	}
+
+	endpoints.Subsets = []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}}}
+	if _, err := l.k8sclient.CoreV1().Endpoints("default").Update(ctx, endpoints, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unable to update endpoints: %v", err)
+	}
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc, nil); err != nil {
+		t.Fatalf("unexpected error with ready endpoints: %v", err)
+	}
+	if blocks, _ := backend.ListIPBlocks(); len(blocks) != 1 {
+		t.Errorf("mismatched IP blocks with ready endpoints, actual %d expected %d", len(blocks), 1)
+	}
+}
+
+func TestAllocateOnEndpointsDelay(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	l.allocateOnEndpoints = true
+	l.allocateDelay = 10 * time.Minute
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error past the delay: %v", err)
+	}
+	if blocks, _ := backend.ListIPBlocks(); len(blocks) != 1 {
+		t.Errorf("mismatched IP blocks past the delay, actual %d expected %d", len(blocks), 1)
+	}
+}
@@ -0,0 +1,184 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers/kubevip"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// loadBalancerTypeKubeVIP the kube-vip implementation
+	loadBalancerTypeKubeVIP = "kube-vip"
+)
+
+// LoadBalancerConfig structured load balancer configuration, an alternative to the
+// loadbalancer URL, e.g. kube-vip://<network>/<detail>
+type LoadBalancerConfig struct {
+	// Type the implementation, e.g. kube-vip
+	Type string `json:"type"`
+	// Network ID of the public network to which IP blocks are assigned
+	Network string `json:"network"`
+	// KubeVIP settings for the kube-vip implementation
+	KubeVIP *KubeVIPConfig `json:"kubeVIP,omitempty"`
+}
+
+// KubeVIPConfig settings for the kube-vip implementation
+type KubeVIPConfig struct {
+	// Config any additional detail for kube-vip; the path of the loadbalancer URL
+	Config string `json:"config,omitempty"`
+	// Namespace in which kube-vip resources are managed; the namespace query parameter of the loadbalancer URL
+	Namespace string `json:"namespace,omitempty"`
+	// Mode how kube-vip is deployed, static-pod or daemonset; the mode query parameter of the loadbalancer URL
+	Mode string `json:"mode,omitempty"`
+	// Annotations set the IP of each service in kube-vip's annotations, for kube-vip in services mode; always
+	// on in daemonset mode; the annotations query parameter of the loadbalancer URL
+	Annotations bool `json:"annotations,omitempty"`
+	// ServiceInterface the interface on which kube-vip announces the IPs, set in the annotations of each service;
+	// the serviceInterface query parameter of the loadbalancer URL
+	ServiceInterface string `json:"serviceInterface,omitempty"`
+	// BGPPasswordSecret the Secret in the namespace whose BGP passwords are set on the nodes for kube-vip; the
+	// bgpPasswordSecret query parameter of the loadbalancer URL
+	BGPPasswordSecret string `json:"bgpPasswordSecret,omitempty"`
+	// BGPAnnotationPrefix the prefix of the node annotations from which kube-vip reads the BGP settings, as in its
+	// --annotations flag; the bgpAnnotationPrefix query parameter of the loadbalancer URL
+	BGPAnnotationPrefix string `json:"bgpAnnotationPrefix,omitempty"`
+	// BGPSharedPassword set the shared password of the Secret on the nodes without one of their own, rather than
+	// generating one for each; the bgpSharedPassword query parameter of the loadbalancer URL
+	BGPSharedPassword bool `json:"bgpSharedPassword,omitempty"`
+}
+
+// validate returns an error if the config is incomplete, or has settings for
+// an implementation other than its type
+func (c LoadBalancerConfig) validate() error {
+	if c.Network == "" {
+		return fmt.Errorf("network is required")
+	}
+	switch c.Type {
+	case loadBalancerTypeKubeVIP:
+	case "":
+		return fmt.Errorf("type is required")
+	default:
+		return fmt.Errorf("unsupported type %q", c.Type)
+	}
+	if c.KubeVIP != nil && c.Type != loadBalancerTypeKubeVIP {
+		return fmt.Errorf("kubeVIP settings given for type %q", c.Type)
+	}
+	if c.KubeVIP != nil && c.KubeVIP.Namespace != "" {
+		if errs := validation.IsDNS1123Label(c.KubeVIP.Namespace); len(errs) > 0 {
+			return fmt.Errorf("invalid kubeVIP namespace %q: %s", c.KubeVIP.Namespace, strings.Join(errs, ", "))
+		}
+	}
+	if c.KubeVIP != nil {
+		u, err := url.Parse(c.URL())
+		if err != nil {
+			return err
+		}
+		if _, err := kubeVIPOptions(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// URL the equivalent loadbalancer URL
+func (c LoadBalancerConfig) URL() string {
+	u := url.URL{Scheme: c.Type, Host: c.Network}
+	if c.KubeVIP != nil && c.KubeVIP.Config != "" {
+		u.Path = "/" + c.KubeVIP.Config
+	}
+	query := url.Values{}
+	if c.KubeVIP != nil && c.KubeVIP.Namespace != "" {
+		query.Set(implementorNamespaceParam, c.KubeVIP.Namespace)
+	}
+	if c.KubeVIP != nil && c.KubeVIP.Mode != "" {
+		query.Set(implementorModeParam, c.KubeVIP.Mode)
+	}
+	if c.KubeVIP != nil && c.KubeVIP.Annotations {
+		query.Set(implementorAnnotationsParam, "true")
+	}
+	if c.KubeVIP != nil && c.KubeVIP.ServiceInterface != "" {
+		query.Set(implementorServiceInterfaceParam, c.KubeVIP.ServiceInterface)
+	}
+	if c.KubeVIP != nil && c.KubeVIP.BGPPasswordSecret != "" {
+		query.Set(implementorBGPPasswordSecretParam, c.KubeVIP.BGPPasswordSecret)
+	}
+	if c.KubeVIP != nil && c.KubeVIP.BGPAnnotationPrefix != "" {
+		query.Set(implementorBGPAnnotationPrefixParam, c.KubeVIP.BGPAnnotationPrefix)
+	}
+	if c.KubeVIP != nil && c.KubeVIP.BGPSharedPassword {
+		query.Set(implementorBGPSharedPasswordParam, "true")
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// implementorNamespace the namespace for the resources of the implementation, from the namespace
+// query parameter of the loadbalancer URL, else the default
+func implementorNamespace(u *url.URL) (string, error) {
+	namespace := u.Query().Get(implementorNamespaceParam)
+	if namespace == "" {
+		return defaultImplementorNamespace, nil
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return "", fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+	}
+	return namespace, nil
+}
+
+// kubeVIPAnnotations returns true if the loadbalancer setting is kube-vip with the IPs set in the annotations of
+// each service, which then must exist
+func kubeVIPAnnotations(setting string) bool {
+	u, err := url.Parse(setting)
+	if err != nil || u.Scheme != loadBalancerTypeKubeVIP {
+		return false
+	}
+	options, err := kubeVIPOptions(u)
+	return err == nil && (options.Annotations || options.Mode == kubevip.ModeDaemonSet)
+}
+
+// kubeVIPOptions the kube-vip options from the query parameters of the loadbalancer URL
+func kubeVIPOptions(u *url.URL) (kubevip.Options, error) {
+	query := u.Query()
+	mode, err := kubevip.ParseMode(query.Get(implementorModeParam))
+	if err != nil {
+		return kubevip.Options{}, err
+	}
+	options := kubevip.Options{Mode: mode, ServiceInterface: query.Get(implementorServiceInterfaceParam)}
+	if value := query.Get(implementorAnnotationsParam); value != "" {
+		if options.Annotations, err = strconv.ParseBool(value); err != nil {
+			return kubevip.Options{}, fmt.Errorf("invalid %s %q: %w", implementorAnnotationsParam, value, err)
+		}
+	}
+	if options.ServiceInterface != "" && !options.Annotations && mode != kubevip.ModeDaemonSet {
+		return kubevip.Options{}, fmt.Errorf("%s is set in service annotations, which are off in %s mode unless %s is true", implementorServiceInterfaceParam, mode, implementorAnnotationsParam)
+	}
+	options.BGPPasswordSecret = query.Get(implementorBGPPasswordSecretParam)
+	options.BGPAnnotationPrefix = query.Get(implementorBGPAnnotationPrefixParam)
+	if options.BGPPasswordSecret != "" {
+		if errs := validation.IsDNS1123Subdomain(options.BGPPasswordSecret); len(errs) > 0 {
+			return kubevip.Options{}, fmt.Errorf("invalid %s %q: %s", implementorBGPPasswordSecretParam, options.BGPPasswordSecret, strings.Join(errs, ", "))
+		}
+		if options.BGPAnnotationPrefix == "" {
+			return kubevip.Options{}, fmt.Errorf("%s requires %s, the --annotations prefix of kube-vip", implementorBGPPasswordSecretParam, implementorBGPAnnotationPrefixParam)
+		}
+	}
+	if options.BGPAnnotationPrefix != "" {
+		if errs := validation.IsDNS1123Subdomain(options.BGPAnnotationPrefix); len(errs) > 0 {
+			return kubevip.Options{}, fmt.Errorf("invalid %s %q: %s", implementorBGPAnnotationPrefixParam, options.BGPAnnotationPrefix, strings.Join(errs, ", "))
+		}
+	}
+	if value := query.Get(implementorBGPSharedPasswordParam); value != "" {
+		if options.BGPSharedPassword, err = strconv.ParseBool(value); err != nil {
+			return kubevip.Options{}, fmt.Errorf("invalid %s %q: %w", implementorBGPSharedPasswordParam, value, err)
+		}
+		if options.BGPSharedPassword && options.BGPPasswordSecret == "" {
+			return kubevip.Options{}, fmt.Errorf("%s requires %s", implementorBGPSharedPasswordParam, implementorBGPPasswordSecretParam)
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,112 @@
+package phoenixnap
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers/kubevip"
+)
+
+func TestLoadBalancerConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		url    string
+		valid  bool
+	}{
+		{"url form", `"loadbalancer": "kube-vip://net-1"`, "kube-vip://net-1", true},
+		{"structured", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1"}`, "kube-vip://net-1", true},
+		{"structured with detail", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1", "kubeVIP": {"config": "abc"}}`, "kube-vip://net-1/abc", true},
+		{"structured with namespace", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1", "kubeVIP": {"namespace": "lb-system"}}`, "kube-vip://net-1?namespace=lb-system", true},
+		{"structured with mode", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1", "kubeVIP": {"namespace": "lb-system", "mode": "daemonset"}}`, "kube-vip://net-1?mode=daemonset&namespace=lb-system", true},
+		{"invalid mode", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1", "kubeVIP": {"mode": "sidecar"}}`, "", false},
+		{"structured with annotations", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1", "kubeVIP": {"annotations": true, "serviceInterface": "bond0"}}`, "kube-vip://net-1?annotations=true&serviceInterface=bond0", true},
+		{"service interface without annotations", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1", "kubeVIP": {"serviceInterface": "bond0"}}`, "", false},
+		{"invalid namespace", `"loadbalancerConfig": {"type": "kube-vip", "network": "net-1", "kubeVIP": {"namespace": "LB_System"}}`, "", false},
+		{"both", `"loadbalancer": "kube-vip://net-1", "loadbalancerConfig": {"type": "kube-vip", "network": "net-1"}`, "", false},
+		{"no network", `"loadbalancerConfig": {"type": "kube-vip"}`, "", false},
+		{"no type", `"loadbalancerConfig": {"network": "net-1"}`, "", false},
+		{"unknown type", `"loadbalancerConfig": {"type": "other", "network": "net-1"}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := getConfig(strings.NewReader(`{"clientID": "id", "clientSecret": "secret", ` + tt.config + `}`))
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Fatalf("expected error")
+			case config.LoadBalancerSetting != tt.url && tt.valid:
+				t.Errorf("mismatched loadbalancer, actual %s expected %s", config.LoadBalancerSetting, tt.url)
+			}
+		})
+	}
+}
+
+func TestImplementorNamespace(t *testing.T) {
+	tests := []struct {
+		url       string
+		namespace string
+		valid     bool
+	}{
+		{"kube-vip://net-1", defaultImplementorNamespace, true},
+		{"kube-vip://net-1/abc?namespace=lb-system", "lb-system", true},
+		{"kube-vip://net-1?namespace=", defaultImplementorNamespace, true},
+		{"kube-vip://net-1?namespace=LB_System", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("unable to parse url: %v", err)
+			}
+			namespace, err := implementorNamespace(u)
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Fatalf("expected error")
+			case namespace != tt.namespace:
+				t.Errorf("mismatched namespace, actual %s expected %s", namespace, tt.namespace)
+			}
+		})
+	}
+}
+
+func TestKubeVIPOptions(t *testing.T) {
+	tests := []struct {
+		url     string
+		options kubevip.Options
+		valid   bool
+	}{
+		{"kube-vip://net-1", kubevip.Options{Mode: kubevip.ModeStaticPod}, true},
+		{"kube-vip://net-1?mode=daemonset&serviceInterface=bond0", kubevip.Options{Mode: kubevip.ModeDaemonSet, ServiceInterface: "bond0"}, true},
+		{"kube-vip://net-1?annotations=true", kubevip.Options{Mode: kubevip.ModeStaticPod, Annotations: true}, true},
+		{"kube-vip://net-1?annotations=maybe", kubevip.Options{}, false},
+		{"kube-vip://net-1?mode=sidecar", kubevip.Options{}, false},
+		{"kube-vip://net-1?serviceInterface=bond0", kubevip.Options{}, false},
+		{"kube-vip://net-1?bgpPasswordSecret=bgp&bgpAnnotationPrefix=bgp.example.com", kubevip.Options{Mode: kubevip.ModeStaticPod, BGPPasswordSecret: "bgp", BGPAnnotationPrefix: "bgp.example.com"}, true},
+		{"kube-vip://net-1?bgpPasswordSecret=bgp", kubevip.Options{}, false},
+		{"kube-vip://net-1?bgpPasswordSecret=BGP_Secret&bgpAnnotationPrefix=bgp.example.com", kubevip.Options{}, false},
+		{"kube-vip://net-1?bgpPasswordSecret=bgp&bgpAnnotationPrefix=bgp.example.com&bgpSharedPassword=true", kubevip.Options{Mode: kubevip.ModeStaticPod, BGPPasswordSecret: "bgp", BGPAnnotationPrefix: "bgp.example.com", BGPSharedPassword: true}, true},
+		{"kube-vip://net-1?bgpSharedPassword=true", kubevip.Options{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("unable to parse url: %v", err)
+			}
+			options, err := kubeVIPOptions(u)
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Fatalf("expected error")
+			case options != tt.options:
+				t.Errorf("mismatched options, actual %+v expected %+v", options, tt.options)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package phoenixnap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// loadBalancerName the name of the load balancer of the service: the prefix, the namespace and the
+// name, truncated so that with a hash of the cluster ID, namespace and name it is at most
+// maxLoadBalancerNameLength long, e.g. pnap-default-nginx-1a2b3c4d
+func loadBalancerName(clusterID string, service *v1.Service) string {
+	sum := sha256.Sum256([]byte(clusterID + "/" + service.Namespace + "/" + service.Name))
+	hash := hex.EncodeToString(sum[:])[:loadBalancerNameHashLength]
+	base := fmt.Sprintf("%s-%s-%s", loadBalancerNamePrefix, service.Namespace, service.Name)
+	if max := maxLoadBalancerNameLength - len(hash) - 1; len(base) > max {
+		base = base[:max]
+	}
+	return base + "-" + hash
+}
+
+// legacyLoadBalancerName the name of the load balancer of the service in earlier versions, made of its tags
+func (l *loadBalancers) legacyLoadBalancerName(service *v1.Service) string {
+	return fmt.Sprintf("%s=%s:%s=%s:%s=%s", l.ownership.usage, l.ownership.usageValue, "service", serviceRep(service), l.ownership.cluster, l.clusterID())
+}
+
+// recordLoadBalancerName sets the load balancer name annotation on the service, if it is not set yet,
+// so that its name does not change, e.g. when the service gets its IP. It only logs if it fails.
+func (l *loadBalancers) recordLoadBalancerName(ctx context.Context, service *v1.Service) {
+	if _, ok := service.Annotations[annotationLoadBalancerName]; ok {
+		return
+	}
+	patch, _ := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{annotationLoadBalancerName: l.GetLoadBalancerName(ctx, "", service)},
+		},
+	})
+	if _, err := l.k8sclient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.V(2).Infof("unable to set annotation %s on service %s: %v", annotationLoadBalancerName, serviceRep(service), err)
+	}
+}
@@ -0,0 +1,85 @@
+package phoenixnap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestLoadBalancerName(t *testing.T) {
+	short := testService("default", "nginx")
+	long := testService(strings.Repeat("n", 63), strings.Repeat("s", 63))
+
+	name := loadBalancerName(testClusterID, short)
+	if !strings.HasPrefix(name, "pnap-default-nginx-") || len(name) != len("pnap-default-nginx-")+loadBalancerNameHashLength {
+		t.Errorf("unexpected name %s", name)
+	}
+	if again := loadBalancerName(testClusterID, short.DeepCopy()); again != name {
+		t.Errorf("name not deterministic, %s then %s", name, again)
+	}
+	if other := loadBalancerName("other-cluster", short); other == name {
+		t.Errorf("same name %s in different clusters", name)
+	}
+
+	longName := loadBalancerName(testClusterID, long)
+	if len(longName) != maxLoadBalancerNameLength {
+		t.Errorf("mismatched length, actual %d expected %d", len(longName), maxLoadBalancerNameLength)
+	}
+	if errs := validation.IsDNS1123Label(longName); len(errs) > 0 {
+		t.Errorf("name %s is not a DNS label: %v", longName, errs)
+	}
+	// truncated names still differ by the hash
+	long2 := testService(strings.Repeat("n", 63), strings.Repeat("s", 62)+"t")
+	if loadBalancerName(testClusterID, long2) == longName {
+		t.Errorf("same name for services differing after the truncation")
+	}
+}
+
+func TestGetLoadBalancerName(t *testing.T) {
+	svc := testService("default", "nginx")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+
+	if name := l.GetLoadBalancerName(context.TODO(), "", svc); name != loadBalancerName(testClusterID, svc) {
+		t.Errorf("mismatched name of new service, actual %s expected %s", name, loadBalancerName(testClusterID, svc))
+	}
+
+	// existing deployments keep their names
+	existing := svc.DeepCopy()
+	existing.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.3"}}
+	if name := l.GetLoadBalancerName(context.TODO(), "", existing); name != l.legacyLoadBalancerName(svc) {
+		t.Errorf("mismatched name of existing service, actual %s expected %s", name, l.legacyLoadBalancerName(svc))
+	}
+
+	recorded := existing.DeepCopy()
+	recorded.Annotations = map[string]string{annotationLoadBalancerName: "recorded"}
+	if name := l.GetLoadBalancerName(context.TODO(), "", recorded); name != "recorded" {
+		t.Errorf("mismatched recorded name, actual %s expected %s", name, "recorded")
+	}
+}
+
+func TestEnsureLoadBalancerRecordsName(t *testing.T) {
+	svc := testService("default", "nginx")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err := l.k8sclient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get service: %v", err)
+	}
+	expected := loadBalancerName(testClusterID, svc)
+	if name := updated.Annotations[annotationLoadBalancerName]; name != expected {
+		t.Errorf("mismatched annotation, actual %q expected %q", name, expected)
+	}
+
+	// once recorded, the name stays, even with an IP in the status
+	updated.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.3"}}
+	if name := l.GetLoadBalancerName(context.TODO(), "", updated); name != expected {
+		t.Errorf("mismatched name, actual %s expected %s", name, expected)
+	}
+}
@@ -0,0 +1,176 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// leaseLock serializes the IP block operations of a Service across CCM replicas, and other tools using the
+// same Leases, e.g. while leadership moves from one replica to another and both still reconcile. The
+// in-process serviceLocks cannot do that. The lock of a Service is a Lease named after its UID, held while
+// its blocks are looked up, purchased or released, and renewed until then. It is deleted once the blocks
+// of the Service are, as the next Service of that name has another UID.
+type leaseLock struct {
+	client    kubernetes.Interface
+	namespace string
+	// holder the identity of this CCM in the Leases it holds
+	holder string
+	// duration after which a Lease that is not renewed may be taken over, e.g. when its holder crashed
+	duration time.Duration
+	// retry the wait between attempts to acquire a Lease held by another
+	retry time.Duration
+	// clock the time of the Leases and their renewal; the clock of the load balancers
+	clock clock.WithTicker
+	// labels returns the labels of the Lease of a service, e.g. its owner labels for the sweeper; if nil, none
+	labels func(service *v1.Service) map[string]string
+}
+
+func newLeaseLock(client kubernetes.Interface, namespace string) *leaseLock {
+	hostname, _ := os.Hostname()
+	return &leaseLock{
+		client:    client,
+		namespace: namespace,
+		holder:    fmt.Sprintf("%s_%s", hostname, uuid.NewUUID()),
+		duration:  ipamLeaseDurationSeconds * time.Second,
+		retry:     ipamLeaseRetryMilliseconds * time.Millisecond,
+		clock:     clock.RealClock{},
+	}
+}
+
+// leaseName returns the name of the Lease of service: its UID, or, if it has none, its namespace and name
+func leaseName(service *v1.Service) string {
+	if service.UID != "" {
+		return ipamLeasePrefix + string(service.UID)
+	}
+	return fmt.Sprintf("%s%s.%s", ipamLeasePrefix, service.Namespace, service.Name)
+}
+
+// acquire waits until it holds the Lease of service, and returns a function that releases it, or, if remove
+// is true, deletes it. A nil leaseLock locks nothing.
+func (l *leaseLock) acquire(ctx context.Context, service *v1.Service) (func(remove bool), error) {
+	if l == nil {
+		return func(bool) {}, nil
+	}
+	name := leaseName(service)
+	var lease *coordinationv1.Lease
+	err := wait.PollImmediateUntilWithContext(ctx, l.retry, func(ctx context.Context) (bool, error) {
+		var err error
+		lease, err = l.tryAcquire(ctx, name, l.leaseLabels(service))
+		switch {
+		case apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err):
+			// another took or updated it meanwhile
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		return lease != nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire lease %s/%s for the IP blocks of service %s: %w", l.namespace, name, serviceRep(service), err)
+	}
+	klog.V(2).Infof("acquired lease %s/%s for service %s", l.namespace, name, serviceRep(service))
+
+	// renew it while held, as purchasing and waiting for a block may take longer than its duration
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := l.clock.NewTicker(l.duration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C():
+			}
+			lease.Spec.RenewTime = &metav1.MicroTime{Time: l.clock.Now()}
+			updated, err := l.client.CoordinationV1().Leases(l.namespace).Update(context.Background(), lease, metav1.UpdateOptions{})
+			if err != nil {
+				klog.Errorf("unable to renew lease %s/%s: %v", l.namespace, name, err)
+				continue
+			}
+			lease = updated
+		}
+	}()
+	return func(remove bool) {
+		close(stop)
+		<-done
+		if remove {
+			if err := l.client.CoordinationV1().Leases(l.namespace).Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				klog.Errorf("unable to delete lease %s/%s: %v", l.namespace, name, err)
+			}
+			return
+		}
+		// held by none, so that the next holder need not wait for it to expire
+		lease.Spec.HolderIdentity = nil
+		if _, err := l.client.CoordinationV1().Leases(l.namespace).Update(context.Background(), lease, metav1.UpdateOptions{}); err != nil {
+			klog.Errorf("unable to release lease %s/%s: %v", l.namespace, name, err)
+		}
+	}, nil
+}
+
+// leaseLabels returns the labels of the Lease of service
+func (l *leaseLock) leaseLabels(service *v1.Service) map[string]string {
+	if l.labels == nil {
+		return nil
+	}
+	return l.labels(service)
+}
+
+// tryAcquire takes the Lease name if it does not exist, is held by none, or has expired, and returns it, with the
+// labels. If another holds it, it returns nil.
+func (l *leaseLock) tryAcquire(ctx context.Context, name string, labels map[string]string) (*coordinationv1.Lease, error) {
+	now := metav1.MicroTime{Time: l.clock.Now()}
+	seconds := int32(l.duration / time.Second)
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: l.namespace, Labels: labels},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.holder,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if held(lease, now.Time) {
+		klog.V(2).Infof("lease %s/%s is held by %s, waiting", l.namespace, name, *lease.Spec.HolderIdentity)
+		return nil, nil
+	}
+	for k, v := range labels {
+		if lease.Labels == nil {
+			lease.Labels = map[string]string{}
+		}
+		lease.Labels[k] = v
+	}
+	lease.Spec.HolderIdentity = &l.holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	return leases.Update(ctx, lease, metav1.UpdateOptions{})
+}
+
+// held whether lease is held by anyone, and not expired at now
+func held(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	return now.Before(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
@@ -0,0 +1,149 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestLeaseName(t *testing.T) {
+	svc := testService("default", "web")
+	if got := leaseName(svc); got != "pnap-ipam-default.web" {
+		t.Errorf("mismatched name without UID, actual %s", got)
+	}
+	svc.UID = types.UID("1234")
+	if got := leaseName(svc); got != "pnap-ipam-1234" {
+		t.Errorf("mismatched name with UID, actual %s", got)
+	}
+}
+
+func TestLeaseLockAcquire(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	svc := testService("default", "web")
+	svc.UID = types.UID("1234")
+	first := newLeaseLock(client, metav1.NamespaceSystem)
+	first.retry = 10 * time.Millisecond
+	second := newLeaseLock(client, metav1.NamespaceSystem)
+	second.retry = 10 * time.Millisecond
+
+	release, err := first.acquire(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("unexpected error acquiring: %v", err)
+	}
+	lease, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(context.TODO(), leaseName(svc), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("lease not created: %v", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != first.holder {
+		t.Fatalf("lease not held by the first lock")
+	}
+
+	// the second waits while the first holds it
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := second.acquire(ctx, svc); err == nil {
+		t.Fatalf("second acquired a lease that is held")
+	}
+
+	release(false)
+	releaseSecond, err := second.acquire(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("second could not acquire the released lease: %v", err)
+	}
+	releaseSecond(false)
+}
+
+func TestLeaseLockTakeOverExpired(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	svc := testService("default", "web")
+	holder := "crashed"
+	seconds := int32(60)
+	renewed := metav1.MicroTime{Time: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Create(context.TODO(), &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: leaseName(svc), Namespace: metav1.NamespaceSystem},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			RenewTime:            &renewed,
+		},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unable to create lease: %v", err)
+	}
+
+	clock := testingclock.NewFakeClock(renewed.Add(30 * time.Second))
+	lock := newLeaseLock(client, metav1.NamespaceSystem)
+	lock.retry = 10 * time.Millisecond
+	lock.clock = clock
+
+	// not expired yet by the clock of the lock
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := lock.acquire(ctx, svc); err == nil {
+		t.Fatalf("acquired a lease that has not expired")
+	}
+
+	clock.Step(2 * time.Minute)
+	ctx, cancel = context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	release, err := lock.acquire(ctx, svc)
+	if err != nil {
+		t.Fatalf("expired lease not taken over: %v", err)
+	}
+	lease, _ := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(context.TODO(), leaseName(svc), metav1.GetOptions{})
+	if lease.Spec.RenewTime == nil || !lease.Spec.RenewTime.Time.Equal(clock.Now()) {
+		t.Errorf("mismatched renew time, actual %v expected %v", lease.Spec.RenewTime, clock.Now())
+	}
+	release(false)
+}
+
+func TestLeaseLockRemove(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	svc := testService("default", "web")
+	svc.UID = types.UID("1234")
+
+	release, err := newLeaseLock(client, metav1.NamespaceSystem).acquire(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("unexpected error acquiring: %v", err)
+	}
+	release(true)
+	if _, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(context.TODO(), leaseName(svc), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("lease not deleted, error %v", err)
+	}
+}
+
+func TestEnsureLoadBalancerDeletedRemovesLease(t *testing.T) {
+	svc := testService("default", "web")
+	svc.UID = types.UID("1234")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	l.ipamLock = newLeaseLock(l.k8sclient, metav1.NamespaceSystem)
+	leases := l.k8sclient.CoordinationV1().Leases(metav1.NamespaceSystem)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := leases.Get(context.TODO(), leaseName(svc), metav1.GetOptions{}); err != nil {
+		t.Fatalf("lease not kept after ensuring: %v", err)
+	}
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := leases.Get(context.TODO(), leaseName(svc), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("lease of deleted service not deleted, error %v", err)
+	}
+}
+
+func TestLeaseLockNil(t *testing.T) {
+	var l *leaseLock
+	release, err := l.acquire(context.TODO(), testService("default", "web"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release(true)
+}
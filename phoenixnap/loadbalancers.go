@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net/netip"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
 	"github.com/phoenixnap/go-sdk-bmc/ipapi"
 	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
 	"github.com/phoenixnap/go-sdk-bmc/tagapi"
@@ -15,33 +18,136 @@ import (
 	kubevip "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers/kubevip"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	clientretry "k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 )
 
 type loadBalancers struct {
-	ipClient             *ipapi.APIClient
-	tagClient            *tagapi.APIClient
-	netClient            *netapi.APIClient
-	k8sclient            kubernetes.Interface
-	location             string
-	clusterID            string
-	implementor          loadbalancers.LB
-	implementorConfig    string
+	bmcClients []*bmcapi.APIClient
+	ipClient   *ipapi.APIClient
+	tagClient  *tagapi.APIClient
+	netClient  *netapi.APIClient
+	// locationClients the API clients of the accounts of locations with credentials of their own, with which the
+	// IP blocks in those locations are managed; those in any other location with ipClient, tagClient and netClient
+	locationClients map[string]*apiClients
+	k8sclient       kubernetes.Interface
+	location        string
+	// cluster the ID of the cluster, which scopes its IP blocks
+	cluster           *clusterIDSource
+	implementor       loadbalancers.LB
+	implementorConfig string
+	// implementorScheme the type of the implementation, for metrics
+	implementorScheme string
+	// namespace the namespace of the implementation's resources, in which the CCM also keeps its own, e.g. Leases
+	namespace            string
 	ipLocationAnnotation string
 	network              string
 	nodeSelector         labels.Selector
+	// tagValuePrefix prefixed to the values of the service namespace and name tags of new blocks
+	tagValuePrefix string
+	// nodeSelectorFallback announce from all Ready worker nodes if nodeSelector matches none
+	nodeSelectorFallback bool
+	// maxIPBlocks the most IP blocks the CCM may purchase for this cluster, 0 for unlimited
+	maxIPBlocks int
+	// reconcileErrorAnnotation whether to record the last error reconciling a Service in an annotation on it
+	reconcileErrorAnnotation bool
+	// ownership the tags that mark IP blocks as belonging to this cluster
+	ownership  ownershipTags
+	recorder   record.EventRecorder
+	blockCache *ipBlockCache
+	tags       tagCache
+	// apiBackoff retries failed PhoenixNAP API calls
+	apiBackoff wait.Backoff
+	// blockReadyBackoff waits for a pending IP block to be ready
+	blockReadyBackoff wait.Backoff
+	// serviceLocks serializes the calls for each Service, while calls for different Services run in parallel
+	serviceLocks keyedMutex
+	// nodeSets the IP and nodes last passed to the implementation for each Service
+	nodeSets serviceNodeSets
+	// nodeReadyDelay how long a node must have been Ready before it announces IPs; 0 to not wait
+	nodeReadyDelay time.Duration
+	// heldBack the services with nodes not yet Ready for nodeReadyDelay
+	heldBack heldBackServices
+	// status records the results of reconciles and reaps, if the status resource is enabled
+	status *syncStatus
+	// startup spreads and limits the initial syncs of Services after startup, if configured
+	startup *startupSync
+	// ipamLock serializes the lookup, purchase and release of the IP blocks of each Service across CCM replicas, if enabled
+	ipamLock *leaseLock
+	// auditEvents record the IP blocks purchased and released for each Service as Events on its Namespace
+	auditEvents bool
+	// vipFirewall publish the ports of the Service of each VIP in a ConfigMap, for a node-local firewall to allow only them
+	vipFirewall bool
+	// allocateOnEndpoints purchase the IP block of a Service only once it has a ready endpoint
+	allocateOnEndpoints bool
+	// allocateDelay with allocateOnEndpoints, how old a Service must be to get its IP block without a ready endpoint;
+	// if 0, it waits for one
+	allocateDelay time.Duration
+	// orphanCleanup remove the IPs the orphan check finds from the implementation, rather than only flag them
+	orphanCleanup bool
+	// pendingDeletions the released IP blocks as of the last cycle of the reaper
+	pendingDeletions pendingDeletions
+	// secondary the location in which Services with the secondary location annotation get a second IP block; nil if none
+	secondary *secondaryLocation
+	// reaperScope restricts the reaper to the released blocks with a tag, if set
+	reaperScope reaperScope
+	// reaperConcurrency the most blocks the reaper unassigns or deletes at once; if 0, defaultReaperConcurrency
+	reaperConcurrency int
+	// reapLog logs what the reaper finds only when it changes
+	reapLog reapLog
+	// servers looks up the server of a node, to pass what is known of it to the implementation; if nil, nothing is
+	servers func(ctx context.Context, node *v1.Node) (*bmcapi.Server, error)
+	// probe probes a backend at address, with an HTTP GET of path if not empty; if nil, probeBackend
+	probe func(ctx context.Context, address, path string) error
+	// clock the time of the grace periods and the reaper; a fake one in tests
+	clock clock.WithTicker
+	// readiness whether the prerequisites of the implementation exist; until they do, nothing is reconciled
+	readiness implementorReadiness
+	// purchaseMutex serializes checking maxIPBlocks and creating a block, so parallel calls cannot exceed it
+	purchaseMutex sync.Mutex
+	// ctx is cancelled by close, to stop the reaper and any in-flight API calls
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-func newLoadBalancers(ipClient *ipapi.APIClient, tagClient *tagapi.APIClient, netclient *netapi.APIClient, k8sclient kubernetes.Interface, location, config string, ipLocationAnnotation, nodeSelector string) (*loadBalancers, error) {
+func newLoadBalancers(bmcClients []*bmcapi.APIClient, ipClient *ipapi.APIClient, tagClient *tagapi.APIClient, netclient *netapi.APIClient, k8sclient kubernetes.Interface, location, config string, ipLocationAnnotation, nodeSelector string, maxIPBlocks int, ownership ownershipTags, reconcileErrorAnnotation bool) (*loadBalancers, error) {
 	selector := labels.Everything()
 	if nodeSelector != "" {
 		selector, _ = labels.Parse(nodeSelector)
 	}
 
-	l := &loadBalancers{ipClient, tagClient, netclient, k8sclient, location, "", nil, config, ipLocationAnnotation, "", selector}
+	l := &loadBalancers{
+		bmcClients:               bmcClients,
+		ipClient:                 ipClient,
+		tagClient:                tagClient,
+		netClient:                netclient,
+		k8sclient:                k8sclient,
+		location:                 location,
+		implementorConfig:        config,
+		ipLocationAnnotation:     ipLocationAnnotation,
+		nodeSelector:             selector,
+		maxIPBlocks:              maxIPBlocks,
+		ownership:                ownership,
+		reconcileErrorAnnotation: reconcileErrorAnnotation,
+		apiBackoff:               newBackoff(apiRetryInitialMilliseconds*time.Millisecond, apiRetryMaxSeconds*time.Second, apiRetryAttempts),
+		blockReadyBackoff:        newBackoff(blockReadyInitialSeconds*time.Second, blockReadyMaxSeconds*time.Second, blockReadyAttempts),
+		clock:                    clock.RealClock{},
+	}
+	l.tags.backoff = l.apiBackoff
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.blockCache = newIPBlockCache(ipBlockCacheSeconds*time.Second, l.listClusterIPBlocks)
+	l.blockCache.clock = l.clock
 
 	// parse the implementor config and see what kind it is - allow for no config
 	if l.implementorConfig == "" {
@@ -54,15 +160,6 @@ func newLoadBalancers(ipClient *ipapi.APIClient, tagClient *tagapi.APIClient, ne
 		return nil, fmt.Errorf("no location specified, cannot proceed")
 	}
 
-	// get the UID of the kube-system namespace
-	systemNamespace, err := k8sclient.CoreV1().Namespaces().Get(context.Background(), "kube-system", metav1.GetOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get kube-system namespace: %w", err)
-	}
-	if systemNamespace == nil {
-		return nil, fmt.Errorf("kube-system namespace is missing unexplainably")
-	}
-
 	u, err := url.Parse(l.implementorConfig)
 	if err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
@@ -71,58 +168,179 @@ func newLoadBalancers(ipClient *ipapi.APIClient, tagClient *tagapi.APIClient, ne
 		return nil, fmt.Errorf("invalid config: no public network provided")
 	}
 	lbconfig := u.Path
+	namespace, err := implementorNamespace(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 	var impl loadbalancers.LB
 	switch u.Scheme {
-	case "kube-vip":
-		klog.Infof("loadbalancer implementation enabled: kube-vip on public network %s", lbconfig)
-		impl = kubevip.NewLB(k8sclient, lbconfig)
+	case loadBalancerTypeKubeVIP:
+		options, err := kubeVIPOptions(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+		klog.Infof("loadbalancer implementation enabled: kube-vip on public network %s, namespace %s, mode %s, annotations %t", lbconfig, namespace, options.Mode, options.Annotations || options.Mode == kubevip.ModeDaemonSet)
+		impl = kubevip.NewLB(k8sclient, namespace, lbconfig, options)
 	default:
 		klog.Info("loadbalancer implementation disabled")
 		impl = nil
 	}
+	if impl != nil {
+		if err := validateCapabilities(impl); err != nil {
+			return nil, fmt.Errorf("invalid %s implementation: %w", u.Scheme, err)
+		}
+		recordCapabilities(u.Scheme, impl.Capabilities())
+	}
 
-	l.clusterID = string(systemNamespace.UID)
+	// the cluster ID scopes the blocks to the cluster whose Services are reconciled, which may not be
+	// the one the CCM runs in; if the API server is not available yet, it is got on first use instead
+	l.cluster = newClusterIDSource(k8sclient, ownership.clusterID)
+	clusterID, err := l.cluster.getWithRetries(l.ctx, newBackoff(clusterIDInitialSeconds*time.Second, clusterIDMaxSeconds*time.Second, clusterIDAttempts))
+	if err != nil {
+		klog.Warningf("unable to get the cluster ID at startup, getting it on first use: %v", err)
+	} else {
+		klog.Infof("loadbalancer IP blocks are scoped to cluster ID %s", clusterID)
+	}
 	l.implementor = impl
+	l.implementorScheme = u.Scheme
+	l.namespace = namespace
 	l.network = u.Host
 
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sclient.CoreV1().Events("")})
+	// a Service stuck in an error loop must not flood etcd with Events
+	l.recorder = newRateLimitedRecorder(broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventSourceComponent}), l.clock)
+
+	if maxIPBlocks > 0 {
+		ipBlocksMax.Set(float64(maxIPBlocks))
+	}
+
 	// start the reaper for blocks indicated for deletion
+	l.wg.Add(1)
 	go func() {
+		defer l.wg.Done()
 		ticker := time.NewTicker(gcIterationSeconds * time.Second)
+		defer ticker.Stop()
 
-		for range ticker.C {
-			// get deleted only
-			blocks, err := l.getIPBlocks("", "", false, true)
-			if err != nil {
-				klog.Errorf("unable to retrieve IP blocks: %w", err)
-				continue
-			}
-			if len(blocks) == 0 {
-				klog.Error("no inactive blocks found")
-				continue
-			}
-			for _, block := range blocks {
-				switch block.Status {
-				case "unassigned":
-					klog.Infof("deleting unassigned block %s", block.Id)
-					// it is unassigned, delete the block
-					if _, _, err := l.ipClient.IPBlocksApi.IpBlocksIpBlockIdDelete(context.Background(), block.Id).Execute(); err != nil {
-						klog.Errorf("unable to delete IP block: %w", err)
-					}
-				case "unassigning":
-					klog.Infof("block %s still unassigning, waiting", block.Id)
-				default:
-					// unassign it
-					if _, _, err := l.netClient.PublicNetworksApi.PublicNetworksNetworkIdIpBlocksIpBlockIdDelete(context.Background(), l.network, blocks[0].Id).Execute(); err != nil {
-						klog.Errorf("unable to unassign IP block %s from network %s: %w", blocks[0].Id, l.network, err)
-					}
-				}
+		for {
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping reaper")
+				return
+			case <-ticker.C:
 			}
+			l.status.record(subsystemReaper, l.reap(withSubsystem(l.ctx, subsystemReaper)))
 		}
 	}()
 	klog.V(2).Info("loadBalancers.init(): complete")
 	return l, nil
 }
 
+// close stops the reaper and cancels in-flight API calls, and waits for the reaper to exit
+func (l *loadBalancers) close() {
+	l.cancel()
+	l.wg.Wait()
+}
+
+// withStop returns a context that is cancelled when ctx is, or when the load balancers are closed.
+// Its PhoenixNAP API calls count against the budget of the loadbalancer subsystem.
+func (l *loadBalancers) withStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(withSubsystem(ctx, subsystemLoadBalancer))
+	go func() {
+		select {
+		case <-l.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// reap unassigns and deletes blocks that are indicated for deletion, and returns the errors of those that failed
+func (l *loadBalancers) reap(ctx context.Context) error {
+	l.reapLog.begin()
+	defer l.reapLog.end()
+	// get deleted only
+	blocks, err := l.getIPBlocks(ctx, "", "", false, true)
+	if err != nil {
+		l.reapLog.errorf(reapLogListKey, "unable to retrieve IP blocks: %v", err)
+		return err
+	}
+	l.recordPendingDeletions(blocks, l.clock.Now())
+	if len(blocks) == 0 {
+		// healthy, and not worth a line every cycle
+		klog.V(4).Info("no inactive blocks found")
+		return nil
+	}
+	// whatever happens, the blocks are changed
+	defer l.blockCache.invalidate()
+	concurrency := l.reaperConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultReaperConcurrency
+	}
+	// each block is reaped on its own, so that one failing, or slow to respond, does not hold up the others
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+		errs  []error
+	)
+	slots := make(chan struct{}, concurrency)
+	for _, block := range blocks {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(block ipapi.IpBlock) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := l.reapBlock(ctx, block); err != nil {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}(block)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+// reapBlock unassigns block, or deletes it once it is unassigned, if it is ours and in the reaper scope
+func (l *loadBalancers) reapBlock(ctx context.Context, block ipapi.IpBlock) error {
+	// never delete a block that is not marked as ours, whatever its other tags say
+	if !l.ownsBlock(block) {
+		l.reapLog.errorf(block.Id, "block %s is marked for deletion, but does not have the ownership tags of the cluster, skipping", block.Id)
+		return nil
+	}
+	if !l.reaperScope.includes(block) {
+		l.reapLog.infof(block.Id, "block %s is marked for deletion, but is not in the reaper scope, %s; skipping", block.Id, l.reaperScope)
+		return nil
+	}
+	switch blockStatus(block) {
+	case blockStatusUnassigned:
+		l.reapLog.infof(block.Id, "deleting unassigned block %s", block.Id)
+		// it is unassigned, delete the block
+		if err := retry(ctx, l.apiBackoff, "deleting block "+block.Id, func() error {
+			_, resp, err := l.clientsFor(block.Location).ipClient.IPBlocksApi.IpBlocksIpBlockIdDelete(ctx, block.Id).Execute()
+			return providerError(resp, err)
+		}); err != nil {
+			l.reapLog.errorf(block.Id, "unable to delete IP block: %v", err)
+			return err
+		}
+	case blockStatusUnassigning:
+		l.reapLog.infof(block.Id, "block %s still unassigning, waiting", block.Id)
+	default:
+		// unassign it
+		if err := retry(ctx, l.apiBackoff, "unassigning block "+block.Id, func() error {
+			_, resp, err := l.clientsFor(block.Location).netClient.PublicNetworksApi.PublicNetworksNetworkIdIpBlocksIpBlockIdDelete(ctx, l.networkForLocation(block.Location), block.Id).Execute()
+			return providerError(resp, err)
+		}); err != nil {
+			l.reapLog.errorf(block.Id, "unable to unassign IP block %s from network %s: %v", block.Id, l.networkForLocation(block.Location), err)
+			return err
+		}
+	}
+	return nil
+}
+
 // implementation of cloudprovider.LoadBalancer
 
 // GetLoadBalancer returns whether the specified load balancer exists, and
@@ -130,19 +348,18 @@ func newLoadBalancers(ipClient *ipapi.APIClient, tagClient *tagapi.APIClient, ne
 // Implementations must treat the *v1.Service parameter as read-only and not modify it.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (l *loadBalancers) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+	ctx, cancel := l.withStop(ctx)
+	defer cancel()
+
 	svcName := serviceRep(service)
 
-	// if no service IP, then there is no load balancer for it
-	if service.Spec.LoadBalancerIP == "" {
-		return nil, false, nil
-	}
-	svcIP, err := netip.ParseAddr(service.Spec.LoadBalancerIP)
-	if err != nil {
-		return nil, false, fmt.Errorf("invalid service IP %s: %w", service.Spec.LoadBalancerIP, err)
+	if externalIPsMode(service) {
+		return l.withIPMode(externalIPsStatus(service)), len(service.Spec.ExternalIPs) > 0, nil
 	}
 
+	// the tags on the block are the source of truth, not the Service spec, which may have been changed
 	// get active only
-	blocks, err := l.getIPBlocks(service.Namespace, service.Name, true, false)
+	blocks, err := l.getIPBlocks(ctx, service.Namespace, service.Name, true, false)
 	if err != nil {
 		return nil, false, err
 	}
@@ -158,47 +375,69 @@ func (l *loadBalancers) GetLoadBalancer(ctx context.Context, clusterName string,
 
 	// one block, it has our IP
 	block := blocks[0]
-	network, err := netip.ParsePrefix(block.Cidr)
-	if err != nil {
-		klog.V(2).Infof("invalid CIDR %s: %s", block.Cidr, err)
-		return nil, false, fmt.Errorf("invalid CIDR in block %s: %w", block.Cidr, err)
+	if blockPending(block) {
+		// not yet provisioned, so the load balancer is not complete; EnsureLoadBalancer will wait for it
+		klog.V(2).Infof("block %s is not ready, status %q", block.Id, block.Status)
+		return nil, false, nil
 	}
-	if !network.Contains(svcIP) {
-		klog.V(2).Infof("block %s does not contain IP %s", block.Cidr, svcIP)
-		return nil, false, fmt.Errorf("block %s does not contain IP %s", block.Cidr, svcIP)
+	network, err := blockPrefix(block)
+	if err != nil {
+		return nil, false, err
 	}
 
 	// see that it is connected to the correct network
 	if block.AssignedResourceType == nil {
+		// not yet assigned, so the load balancer is not complete; EnsureLoadBalancer will assign it
 		klog.V(2).Infof("block %s has no assigned resource type", block.Cidr)
-		return nil, false, fmt.Errorf("block %s has no assigned resource type", block.Cidr)
+		return nil, false, nil
 	}
-	if *block.AssignedResourceType != publicNetwork && *block.AssignedResourceType != publicNetworkCaps {
+	resourceType, known := blockAssignedResourceType(block)
+	switch {
+	case resourceType == assignedResourceServer:
+		// the IP is routed directly to a server; EnsureLoadBalancer has checked that it is one of our nodes
+		klog.V(2).Infof("block %s is assigned to server %v", block.Cidr, block.AssignedResourceId)
+	case blockAssignedToNetwork(block, l.network):
+		// assigned to the public network of the cluster
+	case known && resourceType != assignedResourcePublicNetwork:
 		klog.V(2).Infof("block %s is not assigned to a public network", block.Cidr)
 		return nil, false, fmt.Errorf("block %s is not assigned to a public network", block.Cidr)
-	}
-	if block.AssignedResourceId == nil {
+	case block.AssignedResourceId == nil:
 		klog.V(2).Infof("block %s has no assigned resource ID", block.Cidr)
 		return nil, false, fmt.Errorf("block %s has no assigned resource ID", block.Cidr)
-	}
-	if *block.AssignedResourceId != l.network {
-		klog.V(2).Infof("block %s is assigned to network %s instead of expected %s", block.Cidr, block.AssignedResourceId, l.network)
+	default:
+		klog.V(2).Infof("block %s is assigned to network %s instead of expected %s", block.Cidr, *block.AssignedResourceId, l.network)
 		return nil, false, fmt.Errorf("block %s is assigned to network %s instead of expected %s", block.Cidr, *block.AssignedResourceId, l.network)
 	}
 
+	svcIP, err := serviceIP(service, block, network)
+	if err != nil {
+		return nil, false, err
+	}
+
 	klog.V(2).Infof("GetLoadBalancer(): %s with existing IP assignment %s", svcName, svcIP)
-	return &v1.LoadBalancerStatus{
-		Ingress: []v1.LoadBalancerIngress{
-			{IP: svcIP.String()},
-		},
-	}, true, nil
+	status, err = l.withSecondaryIngress(ctx, service, l.proxyModeStatus(service, loadBalancerStatus(service, svcIP.String())))
+	if err != nil {
+		return nil, false, err
+	}
+	return l.withIPMode(status), true, nil
 }
 
 // GetLoadBalancerName returns the name of the load balancer. Implementations must treat the
 // *v1.Service parameter as read-only and not modify it.
+// The name recorded in the annotation is kept. Otherwise, services that already have an IP keep the
+// name of earlier versions, and others get a bounded name, see loadBalancerName.
 func (l *loadBalancers) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
-	clsTag, clsValue := clusterTag(l.clusterID)
-	return fmt.Sprintf("%s=%s:%s=%s:%s=%s", pnapTag, pnapValue, "service", serviceRep(service), clsTag, clsValue)
+	if name := service.Annotations[annotationLoadBalancerName]; name != "" {
+		return name
+	}
+	if len(service.Status.LoadBalancer.Ingress) > 0 {
+		return l.legacyLoadBalancerName(service)
+	}
+	clusterID, err := l.cluster.get(ctx)
+	if err != nil {
+		klog.V(2).Infof("unable to get the cluster ID for the load balancer name of service %s: %v", serviceRep(service), err)
+	}
+	return loadBalancerName(clusterID, service)
 }
 
 // EnsureLoadBalancer creates a new load balancer 'name', or updates the existing one. Returns the status of the balancer
@@ -206,23 +445,64 @@ func (l *loadBalancers) GetLoadBalancerName(ctx context.Context, clusterName str
 // parameters as read-only and not modify them.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (l *loadBalancers) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	klog.V(2).Infof("EnsureLoadBalancer(): add: service %s/%s", service.Namespace, service.Name)
-	// first check if one already exists for this service
-	status, exists, err := l.GetLoadBalancer(ctx, clusterName, service)
+	ctx, cancel := l.withStop(ctx)
+	defer cancel()
+	release, err := l.startup.wait(ctx, serviceRep(service))
 	if err != nil {
 		return nil, err
 	}
-	if exists {
-		return status, nil
+	defer release()
+	// the blocks of the service are scoped by the cluster ID, which may not have been got at startup
+	if _, err := l.cluster.get(ctx); err != nil {
+		l.status.record(subsystemLoadBalancer, err)
+		return nil, err
+	}
+	if err := l.checkImplementorReady(ctx); err != nil {
+		l.status.record(subsystemLoadBalancer, err)
+		return nil, err
 	}
 
-	// no error, but no existing load balancer, so create one
-	svcName := serviceRep(service)
+	unlock := l.serviceLocks.lock(serviceRep(service))
+	defer unlock()
+	unlockLease, err := l.ipamLock.acquire(ctx, service)
+	if err != nil {
+		l.status.record(subsystemLoadBalancer, err)
+		return nil, err
+	}
+	defer unlockLease(false)
+	status, err := l.ensureLoadBalancer(ctx, clusterName, service, nodes)
+	if err == nil {
+		status, err = l.ensureSecondary(ctx, service, nodes, status)
+	}
+	if err == nil {
+		err = l.ensureVIPFirewall(ctx, service, status)
+	}
+	if err == nil {
+		status = l.withIPMode(status)
+	}
+	l.recordReconcileResult(ctx, service, err)
+	l.status.record(subsystemLoadBalancer, err)
+	if err == nil {
+		l.recordLoadBalancerName(ctx, service)
+	}
+	return status, err
+}
+
+// ensureLoadBalancer does the work of EnsureLoadBalancer
+func (l *loadBalancers) ensureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	klog.V(2).Infof("EnsureLoadBalancer(): add: service %s/%s", service.Namespace, service.Name)
+	if externalIPsMode(service) {
+		return l.ensureExternalIPs(ctx, service, l.eligibleNodes(service, nodes))
+	}
 	// get active only
-	blocks, err := l.getIPBlocks(service.Namespace, service.Name, true, false)
+	blocks, err := l.getIPBlocks(ctx, service.Namespace, service.Name, true, false)
 	if err != nil {
 		return nil, err
 	}
+	// an existing load balancer goes through the same steps, each of which is a no-op if already done, so that one
+	// interrupted after assigning its block, or not known to the implementation after a restart, is completed,
+	// and changed options or ports of a live service are applied; unchanged ones skip the implementation
+	svcName := serviceRep(service)
 
 	var (
 		foundIP string
@@ -231,72 +511,125 @@ func (l *loadBalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 		klog.V(2).Infof("multiple blocks with reservation found")
 		return nil, fmt.Errorf("more than one block found for service %s", svcName)
 	}
-	var block *ipapi.IpBlock
+	var (
+		block   *ipapi.IpBlock
+		created bool
+	)
 	if len(blocks) == 1 {
 		// we have a block, but it doesn't have an IP assigned
 		block = &blocks[0]
 	} else {
-		clsTag, clsValue := clusterTag(l.clusterID)
 		ipBlockCreate := ipapi.NewIpBlockCreate(l.location, fmt.Sprintf("/%d", serviceBlockCidr))
-		// copy because we cannot take pointer to constant to use here
-		pnapVal := pnapValue
+		// copy because we cannot take pointers to fields of l
+		usageValue, clusterID := l.ownership.usageValue, l.clusterID()
+		namespaceValue, nameValue := l.tagValuePrefix+service.Namespace, l.tagValuePrefix+service.Name
 		tags := []ipapi.TagAssignmentRequest{
-			{Name: pnapTag, Value: &pnapVal},
-			{Name: clsTag, Value: &clsValue},
-			{Name: serviceNamespaceTag, Value: &service.Namespace},
-			{Name: serviceNameTag, Value: &service.Name},
-		}
-		if err := ensureTags(l.tagClient, pnapTag, clsTag, serviceNamespaceTag, serviceNameTag, deleteTag); err != nil {
-			return nil, fmt.Errorf("unable to ensure tags exist: %w", err)
+			{Name: l.ownership.usage, Value: &usageValue},
+			{Name: l.ownership.cluster, Value: &clusterID},
+			{Name: serviceNamespaceTag, Value: &namespaceValue},
+			{Name: serviceNameTag, Value: &nameValue},
 		}
 		ipBlockCreate.Tags = append(ipBlockCreate.Tags, tags...)
-
-		block, _, err = l.ipClient.IPBlocksApi.IpBlocksPost(context.Background()).IpBlockCreate(*ipBlockCreate).Execute()
-		if err != nil {
-			return nil, fmt.Errorf("unable to create new IP block: %w", err)
+		if err := l.awaitEndpoints(ctx, service); err != nil {
+			return nil, err
+		}
+		if block, err = l.createBlock(ctx, service, ipBlockCreate); err != nil {
+			return nil, err
 		}
+		created = true
 	}
-	if block.AssignedResourceType != nil {
-		if *block.AssignedResourceType != publicNetwork && *block.AssignedResourceType != publicNetworkCaps {
-			return nil, fmt.Errorf("block %s is assigned to %s and not to a public network", block.Cidr, *block.AssignedResourceType)
+	// the block is not usable until it is provisioned; neither assign it nor hand out its IPs before
+	if block, err = l.waitForBlock(ctx, block); err != nil {
+		return nil, err
+	}
+	nodes = l.eligibleNodes(service, nodes)
+	switch {
+	case block.AssignedResourceType != nil && isServerAssigned(*block):
+		// the IP is routed directly to a server, so only its node can announce it
+		node, err := l.adoptServerBlock(ctx, service, *block, nodes)
+		if err != nil {
+			return nil, err
 		}
-		if block.AssignedResourceId == nil {
+		klog.V(2).Infof("EnsureLoadBalancer(): service %s adopts block %s assigned to node %s", svcName, block.Cidr, node.Name)
+		nodes = []*v1.Node{node}
+	case block.AssignedResourceType != nil:
+		resourceType, known := blockAssignedResourceType(*block)
+		switch {
+		case blockAssignedToNetwork(*block, l.network):
+		case known && resourceType != assignedResourcePublicNetwork:
+			return nil, fmt.Errorf("block %s is assigned to %s and not to a public network", block.Cidr, *block.AssignedResourceType)
+		case block.AssignedResourceId == nil:
 			return nil, fmt.Errorf("block %s has an assigned resource type %s but not ID", block.Cidr, *block.AssignedResourceType)
-		}
-		if *block.AssignedResourceId != l.network {
+		default:
 			return nil, fmt.Errorf("block %s is assigned to network %s instead of expected %s", block.Cidr, *block.AssignedResourceId, l.network)
 		}
 		// at this point, it is assigned and to our network
-	} else {
+	default:
 		// it all was nil, so assign it
-		if _, _, err := l.netClient.PublicNetworksApi.PublicNetworksNetworkIdIpBlocksPost(context.Background(), l.network).PublicNetworkIpBlock(*netapi.NewPublicNetworkIpBlock(block.Id)).Execute(); err != nil {
-			return nil, fmt.Errorf("unable to assign block %s to network %s: %w", block.Cidr, l.network, err)
+		err := retry(ctx, l.apiBackoff, "assigning block "+block.Id, func() error {
+			_, resp, err := l.clientsFor(block.Location).netClient.PublicNetworksApi.PublicNetworksNetworkIdIpBlocksPost(ctx, l.network).PublicNetworkIpBlock(*netapi.NewPublicNetworkIpBlock(block.Id)).Execute()
+			return providerError(resp, err)
+		})
+		l.blockCache.invalidate()
+		if err != nil {
+			l.recordAPIError(service, err)
+			err = fmt.Errorf("unable to assign block %s to network %s: %w", block.Cidr, l.network, err)
+			if created {
+				// do not strand a block we just paid for; the reaper only deletes blocks tagged for it
+				klog.V(2).Infof("EnsureLoadBalancer(): releasing new block %s after failed assignment", block.Cidr)
+				if rerr := l.releaseBlock(ctx, *block); rerr != nil {
+					return nil, fmt.Errorf("%w; unable to release it: %v", err, rerr)
+				}
+				l.auditBlock(service, *block, eventReasonIPBlockReleased)
+			}
+			return nil, err
+		}
+	}
+	if !isServerAssigned(*block) {
+		// only nodes in the location of the block can announce it
+		nodes = nodesInLocation(nodes, block.Location)
+		if nodes, err = l.announceNodes(service, nodes); err != nil {
+			return nil, err
 		}
 	}
 
-	prefix, err := netip.ParsePrefix(block.Cidr)
+	prefix, err := blockPrefix(*block)
+	if err != nil {
+		return nil, err
+	}
+	svcIP, err := serviceIP(service, *block, prefix)
 	if err != nil {
-		klog.V(2).Infof("invalid CIDR %s: %s", block.Cidr, err)
-		return nil, fmt.Errorf("invalid CIDR in block %s: %w", block.Cidr, err)
+		return nil, err
+	}
+	if err := l.checkVIPConflict(ctx, service, svcIP); err != nil {
+		return nil, err
+	}
+	foundIP = svcIP.String()
+
+	// record the IP on the block, so it can be recovered without relying on the Service
+	if _, ok := blockTagValue(*block, assignedIPTag); !ok {
+		clients := l.clientsFor(block.Location)
+		if err := l.tags.ensure(ctx, clients.tagClient, assignedIPTag); err != nil {
+			return nil, fmt.Errorf("unable to ensure tags exist: %w", err)
+		}
+		tagRequest := append(tagAssignmentsIntoRequests(block.Tags), ipapi.TagAssignmentRequest{Name: assignedIPTag, Value: &foundIP})
+		_, resp, err := clients.ipClient.IPBlocksApi.IpBlocksIpBlockIdTagsPut(ctx, block.Id).TagAssignmentRequest(tagRequest).Execute()
+		l.blockCache.invalidate()
+		if err != nil {
+			return nil, fmt.Errorf("unable to add '%s' tag to IP block %s: %w", assignedIPTag, block.Id, providerError(resp, err))
+		}
 	}
-	network := prefix.Addr()
-	// get the first free address, after network and router
-	foundIP = network.Next().Next().String()
 
 	// assign the second IP in the block to this service
 
-	ipCidr, err := l.addService(ctx, service, foundIP, filterNodes(nodes, l.nodeSelector))
+	ipCidr, err := l.addService(ctx, service, foundIP, nodes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add service %s: %w", service.Name, err)
 	}
 	// get the IP only
 	ip := strings.SplitN(ipCidr, "/", 2)
 
-	return &v1.LoadBalancerStatus{
-		Ingress: []v1.LoadBalancerIngress{
-			{IP: ip[0]},
-		},
-	}, nil
+	return l.proxyModeStatus(service, loadBalancerStatus(service, ip[0])), nil
 }
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
@@ -304,22 +637,119 @@ func (l *loadBalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 // parameters as read-only and not modify them.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (l *loadBalancers) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	ctx, cancel := l.withStop(ctx)
+	defer cancel()
+	release, err := l.startup.wait(ctx, serviceRep(service))
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err := l.cluster.get(ctx); err != nil {
+		l.status.record(subsystemLoadBalancer, err)
+		return err
+	}
+	if err := l.checkImplementorReady(ctx); err != nil {
+		l.status.record(subsystemLoadBalancer, err)
+		return err
+	}
+
+	unlock := l.serviceLocks.lock(serviceRep(service))
+	defer unlock()
+	err = l.updateLoadBalancer(ctx, service, nodes)
+	if err == nil {
+		err = l.updateSecondary(ctx, service, nodes)
+	}
+	l.recordReconcileResult(ctx, service, err)
+	l.status.record(subsystemLoadBalancer, err)
+	return err
+}
+
+// updateLoadBalancer does the work of UpdateLoadBalancer
+func (l *loadBalancers) updateLoadBalancer(ctx context.Context, service *v1.Service, nodes []*v1.Node) error {
 	klog.V(2).Infof("UpdateLoadBalancer(): service %s", service.Name)
 	// get IP address reservations and check if any exists for this svc
 
-	var n []loadbalancers.Node
-	for _, node := range filterNodes(nodes, l.nodeSelector) {
+	nodes = l.eligibleNodes(service, nodes)
+	if externalIPsMode(service) {
+		// only the nodes that own the IPs announce them
+		owners, err := l.externalIPOwners(ctx, service, nodes)
+		if err != nil {
+			return err
+		}
+		nodes = nil
+		for _, node := range owners {
+			nodes = append(nodes, node)
+		}
+	} else {
+		// a block assigned directly to a server only can be announced by that server's node
+		blocks, err := l.getIPBlocks(ctx, service.Namespace, service.Name, true, false)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(blocks) == 1 && isServerAssigned(blocks[0]):
+			node, err := l.adoptServerBlock(ctx, service, blocks[0], nodes)
+			if err != nil {
+				return err
+			}
+			nodes = []*v1.Node{node}
+		default:
+			if len(blocks) == 1 {
+				nodes = nodesInLocation(nodes, blocks[0].Location)
+			}
+			if nodes, err = l.announceNodes(service, nodes); err != nil {
+				return err
+			}
+		}
+	}
+
+	nodes, err := l.probeBackends(ctx, service, nodes)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
 		klog.V(2).Infof("UpdateLoadBalancer(): %s", node.Name)
 		// get the node provider ID
 		id := node.Spec.ProviderID
 		if id == "" {
 			return fmt.Errorf("no provider ID given for node %s, skipping", node.Name)
 		}
-		n = append(n, loadbalancers.Node{
-			Node: node,
-		})
 	}
-	return l.implementor.UpdateService(ctx, service.Namespace, service.Name, n)
+	n := l.implementorNodes(ctx, nodes)
+	ports := servicePorts(service)
+	svcName := serviceRep(service)
+	added, removed, known := l.nodeSets.diff(svcName, n)
+	portsAdded, portsRemoved, _ := l.nodeSets.portsDiff(svcName, ports)
+	switch {
+	case l.nodeSets.unchanged(svcName, l.nodeSets.ip(svcName), ports, n):
+		klog.V(2).Infof("UpdateLoadBalancer(): nodes and ports of service %s unchanged, skipping update", svcName)
+		serviceNodeUpdatesSkippedTotal.Inc()
+		implementorRequestsSkippedTotal.WithLabelValues(l.implementorScheme, implementorOpUpdateService).Inc()
+		return l.setServiceOptions(ctx, service)
+	case known && len(added) == 0 && len(removed) == 0 && (len(portsAdded) > 0 || len(portsRemoved) > 0):
+		klog.V(2).Infof("UpdateLoadBalancer(): service %s has the same nodes, ports added %v, removed %v", svcName, portsAdded, portsRemoved)
+	case known && len(added) == 0 && len(removed) == 0:
+		klog.V(2).Infof("UpdateLoadBalancer(): service %s has the same nodes, with changed addresses", svcName)
+	case known:
+		klog.V(2).Infof("UpdateLoadBalancer(): service %s nodes added %v, removed %v", svcName, added, removed)
+		serviceNodeChangesTotal.WithLabelValues("added").Add(float64(len(added)))
+		serviceNodeChangesTotal.WithLabelValues("removed").Add(float64(len(removed)))
+	default:
+		klog.V(2).Infof("UpdateLoadBalancer(): service %s nodes %v, previous nodes unknown", svcName, added)
+	}
+	if err := l.setPorts(ctx, service, ports); err != nil {
+		l.nodeSets.forget(svcName)
+		return err
+	}
+	if err := l.callImplementor(implementorOpUpdateService, func() error {
+		return l.implementor.UpdateService(ctx, service.Namespace, service.Name, n)
+	}); err != nil {
+		// the implementation may have applied part of it
+		l.nodeSets.forget(svcName)
+		return err
+	}
+	l.nodeSets.setNodes(svcName, ports, n)
+	return l.setServiceOptions(ctx, service)
 }
 
 // EnsureLoadBalancerDeleted deletes the specified load balancer if it
@@ -331,48 +761,144 @@ func (l *loadBalancers) UpdateLoadBalancer(ctx context.Context, clusterName stri
 // Implementations must treat the *v1.Service parameter as read-only and not modify it.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (l *loadBalancers) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	ctx, cancel := l.withStop(ctx)
+	defer cancel()
+	release, err := l.startup.wait(ctx, serviceRep(service))
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err := l.cluster.get(ctx); err != nil {
+		l.status.record(subsystemLoadBalancer, err)
+		return err
+	}
+	unlock := l.serviceLocks.lock(serviceRep(service))
+	defer unlock()
+	unlockLease, err := l.ipamLock.acquire(ctx, service)
+	if err != nil {
+		l.status.record(subsystemLoadBalancer, err)
+		return err
+	}
+	l.nodeSets.forget(serviceRep(service))
+	err = l.ensureLoadBalancerDeleted(ctx, service)
+	if err == nil {
+		err = l.releaseSecondary(ctx, service)
+	}
+	if err == nil {
+		err = l.deleteVIPFirewall(ctx, service)
+	}
+	// the Lease is no longer needed once the blocks are released, else it is kept for the retry
+	unlockLease(err == nil)
+	l.status.record(subsystemLoadBalancer, err)
+	return err
+}
+
+// ensureLoadBalancerDeleted does the work of EnsureLoadBalancerDeleted
+func (l *loadBalancers) ensureLoadBalancerDeleted(ctx context.Context, service *v1.Service) error {
 	// REMOVAL
 	klog.V(2).Infof("EnsureLoadBalancerDeleted(): remove: %s", service.Name)
+	if externalIPsMode(service) {
+		// no blocks were ordered, so there is nothing to release
+		return l.removeExternalIPs(ctx, service)
+	}
 	svcName := serviceRep(service)
 	svcIP := service.Spec.LoadBalancerIP
 
-	// first remove the IP from the loadbalancer, so it gets released
+	// first remove the IP from the service, so it gets released. The blocks are the source of truth,
+	// so failing to do so does not stop them from being released; the error is returned after.
 	klog.V(2).Infof("removing IP %s from %s", svcIP, svcName)
-	intf := l.k8sclient.CoreV1().Services(service.Namespace)
-	existing, err := intf.Get(ctx, service.Name, metav1.GetOptions{})
-	if err != nil || existing == nil {
-		klog.V(2).Infof("failed to get latest for service, moving on to delete IP assignment %s: %v", svcName, err)
-	} else {
-		existing.Spec.LoadBalancerIP = ""
-		_, err = intf.Update(ctx, existing, metav1.UpdateOptions{})
-		if err != nil {
-			klog.V(2).Infof("failed to update service to remove IP %s: %v", svcName, err)
-			return fmt.Errorf("failed to update service %s: %w", svcName, err)
-		}
-		klog.V(2).Infof("successfully removed %s from service %s", svcIP, svcName)
+	var errs []error
+	if err := l.clearServiceIP(ctx, service); err != nil {
+		klog.V(2).Infof("failed to update service to remove IP %s: %v", svcName, err)
+		errs = append(errs, fmt.Errorf("failed to update service %s: %w", svcName, err))
 	}
 
 	// tags for Get() are separated via '.', so '<key>.<value>'
 	// get IP address blocks and check if any exist for this svc
-	// active blocks only
-	blocks, err := l.getIPBlocks(service.Namespace, service.Name, true, false)
+	// active blocks only; released blocks are not returned, so repeated calls do nothing
+	blocks, err := l.getIPBlocks(ctx, service.Namespace, service.Name, true, false)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve IP reservations: %w", err)
+		return utilerrors.NewAggregate(append(errs, fmt.Errorf("unable to retrieve IP reservations: %w", err)))
 	}
 
 	klog.V(2).Infof("EnsureLoadBalancerDeleted(): remove: %s with existing IP assignment %s", svcName, svcIP)
 	if len(blocks) == 0 {
 		klog.V(2).Infof("EnsureLoadBalancerDeleted(): remove: no IP reservation found for %s, nothing to delete", svcName)
-		return nil
+		return utilerrors.NewAggregate(errs)
 	}
 	if len(blocks) > 1 {
-		return fmt.Errorf("multiple IP blocks found for %s, cannot delete", svcName)
+		klog.Warningf("EnsureLoadBalancerDeleted(): remove: %d IP blocks found for %s, releasing all of them", len(blocks), svcName)
+	}
+	// remove the service from the implementation before its blocks are released, with the allocations
+	// recorded on the blocks, as the spec may no longer have the IP. Once released, the blocks no longer
+	// are found, so they are kept if the implementation fails, for the retry to remove the service again.
+	allocations := blockAllocations(blocks)
+	if err := l.callImplementor(implementorOpRemoveService, func() error {
+		return l.implementor.RemoveService(ctx, service.Namespace, service.Name, allocations)
+	}); err != nil {
+		return utilerrors.NewAggregate(append(errs, fmt.Errorf("failed to remove service %s from implementation: %w", svcName, err)))
+	}
+	// add the delete tag to each block; this will cause the other loop to unassign it and delete it
+	for _, block := range blocks {
+		if err := l.releaseBlock(ctx, block); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		l.auditBlock(service, block, eventReasonIPBlockReleased)
 	}
-	// add the delete tag to the block; this will cause the other loop to unassign it and delete it
-	tags := blocks[0].Tags
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	klog.V(2).Infof("EnsureLoadBalancerDeleted(): remove: removed service %s from implementation", svcName)
+	return nil
+}
+
+// blockAllocations returns the allocations of a Service recorded on its blocks, with the IP of the
+// assigned IP tag of each block
+func blockAllocations(blocks []ipapi.IpBlock) []loadbalancers.Allocation {
+	allocations := make([]loadbalancers.Allocation, 0, len(blocks))
+	for _, block := range blocks {
+		allocation := loadbalancers.Allocation{CIDR: block.Cidr, BlockID: block.Id}
+		if ip, ok := blockTagValue(block, assignedIPTag); ok && ip != "" {
+			allocation.IP = fmt.Sprintf("%s/32", ip)
+		}
+		allocations = append(allocations, allocation)
+	}
+	return allocations
+}
+
+// clearServiceIP removes spec.loadBalancerIP from the latest version of the service. It does nothing
+// if the service no longer exists, or has no IP.
+func (l *loadBalancers) clearServiceIP(ctx context.Context, service *v1.Service) error {
+	intf := l.k8sclient.CoreV1().Services(service.Namespace)
+	return clientretry.RetryOnConflict(clientretry.DefaultRetry, func() error {
+		existing, err := intf.Get(ctx, service.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			klog.V(2).Infof("service %s already deleted", serviceRep(service))
+			return nil
+		case err != nil:
+			return err
+		case existing.Spec.LoadBalancerIP == "":
+			return nil
+		}
+		svcIP := existing.Spec.LoadBalancerIP
+		existing.Spec.LoadBalancerIP = ""
+		if _, err := intf.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		klog.V(2).Infof("successfully removed %s from service %s", svcIP, serviceRep(service))
+		return nil
+	})
+}
+
+// releaseBlock strips the service tags from the block and adds the delete tag, so that the reaper
+// unassigns it and deletes it
+func (l *loadBalancers) releaseBlock(ctx context.Context, block ipapi.IpBlock) error {
 	var tagRequest []ipapi.TagAssignmentRequest
-	for _, tag := range tags {
-		if tag.Name == serviceNameTag || tag.Name == serviceNamespaceTag {
+	for _, tag := range block.Tags {
+		if tag.Name == serviceNameTag || tag.Name == serviceNamespaceTag || tag.Name == assignedIPTag || tag.Name == deleteTag || tag.Name == releasedServiceTag || tag.Name == secondaryServiceTag || tag.Name == gatewayTag {
 			continue
 		}
 		tagRequest = append(tagRequest, ipapi.TagAssignmentRequest{
@@ -380,14 +906,31 @@ func (l *loadBalancers) EnsureLoadBalancerDeleted(ctx context.Context, clusterNa
 			Value: tag.Value,
 		})
 	}
-	valtrue := "true"
-	tagRequest = append(tagRequest, ipapi.TagAssignmentRequest{Name: deleteTag, Value: &valtrue})
-
-	if _, _, err := l.ipClient.IPBlocksApi.IpBlocksIpBlockIdTagsPut(context.Background(), blocks[0].Id).TagAssignmentRequest(tagRequest).Execute(); err != nil {
-		return fmt.Errorf("unable to add 'delete' tag from IP block %s: %w", blocks[0].Id, err)
+	// the value of the delete tag is when it was released, for how long it has been pending deletion
+	releasedAt := l.clock.Now().UTC().Format(time.RFC3339)
+	tagRequest = append(tagRequest, ipapi.TagAssignmentRequest{Name: deleteTag, Value: &releasedAt})
+	namespace, _ := blockTagValue(block, serviceNamespaceTag)
+	name, _ := blockTagValue(block, serviceNameTag)
+	releasedService := namespace + "/" + name
+	if secondary, ok := blockTagValue(block, secondaryServiceTag); ok {
+		releasedService = secondary
+	}
+	if gateway, ok := blockTagValue(block, gatewayTag); ok {
+		releasedService = "gateway:" + gateway
+	}
+	clients := l.clientsFor(block.Location)
+	if releasedService != "/" {
+		if err := l.tags.ensure(ctx, clients.tagClient, releasedServiceTag); err != nil {
+			return fmt.Errorf("unable to ensure tags exist: %w", err)
+		}
+		tagRequest = append(tagRequest, ipapi.TagAssignmentRequest{Name: releasedServiceTag, Value: &releasedService})
 	}
 
-	klog.V(2).Infof("EnsureLoadBalancerDeleted(): remove: removed service %s from implementation", svcName)
+	_, resp, err := clients.ipClient.IPBlocksApi.IpBlocksIpBlockIdTagsPut(ctx, block.Id).TagAssignmentRequest(tagRequest).Execute()
+	l.blockCache.invalidate()
+	if err != nil {
+		return fmt.Errorf("unable to add 'delete' tag from IP block %s: %w", block.Id, providerError(resp, err))
+	}
 	return nil
 }
 
@@ -395,22 +938,20 @@ func (l *loadBalancers) EnsureLoadBalancerDeleted(ctx context.Context, clusterNa
 
 // getIPBlocks returns cluster-related IP blocks. If namespace or name is not blank, filters search
 // by IP blocks with those tags. If activeOnly is true, will not return blocks with the delete tag set.
-func (l *loadBalancers) getIPBlocks(namespace, name string, active, deleted bool) (blocks []ipapi.IpBlock, err error) {
-	clsTag, clsValue := clusterTag(l.clusterID)
-
-	// tags for Get() are separated via '.', so '<key>.<value>'
-	tags := []string{fmt.Sprintf("%s.%s", clsTag, clsValue), fmt.Sprintf("%s.%s", pnapTag, pnapValue)}
-	if name != "" {
-		tags = append(tags, fmt.Sprintf("%s.%s", serviceNameTag, name))
-	}
-	if namespace != "" {
-		tags = append(tags, fmt.Sprintf("%s.%s", serviceNamespaceTag, namespace))
-	}
-	// get IP address blocks and check if any has an IP that matches this service
-	blocks, _, err = l.ipClient.IPBlocksApi.IpBlocksGet(context.Background()).Tag(tags).Execute()
+// The blocks come from the cache, which is refreshed with a single list call for the whole cluster.
+// With a tag value prefix, blocks tagged with the prefixed and, from before it was set, the plain names match.
+func (l *loadBalancers) getIPBlocks(ctx context.Context, namespace, name string, active, deleted bool) (blocks []ipapi.IpBlock, err error) {
+	blocks, err = l.blockCache.get(ctx, namespace, name)
 	if err != nil {
 		return
 	}
+	if l.tagValuePrefix != "" && namespace != "" && name != "" {
+		var prefixed []ipapi.IpBlock
+		if prefixed, err = l.blockCache.get(ctx, l.tagValuePrefix+namespace, l.tagValuePrefix+name); err != nil {
+			return
+		}
+		blocks = append(prefixed, blocks...)
+	}
 
 	// if we take all blocks, just return them
 	if active && deleted {
@@ -420,13 +961,7 @@ func (l *loadBalancers) getIPBlocks(namespace, name string, active, deleted bool
 
 	// arrange active and passive
 	for _, b := range blocks {
-		var isDeleted bool
-		for _, tags := range b.Tags {
-			if tags.Name == deleteTag {
-				isDeleted = true
-				break
-			}
-		}
+		isDeleted := isReleased(b)
 		// only keep the block if we asked for deleted and it is deleted,
 		// or if we asked for active and it is not deleted
 		if (isDeleted && deleted) || (!isDeleted && active) {
@@ -437,10 +972,247 @@ func (l *loadBalancers) getIPBlocks(namespace, name string, active, deleted bool
 	return
 }
 
-// getIPBlock returns current status of a single block
-func (l *loadBalancers) getIPBlock(id string) (block *ipapi.IpBlock, err error) {
+// createBlock creates a new IP block for the service, unless the cluster is at maxIPBlocks. The service is nil for
+// a block that is not of a Service, e.g. of a Gateway, and then no Events are recorded.
+func (l *loadBalancers) createBlock(ctx context.Context, service *v1.Service, ipBlockCreate *ipapi.IpBlockCreate) (*ipapi.IpBlock, error) {
+	if l.maxIPBlocks > 0 {
+		// parallel calls for different Services must not each see room for one more block
+		l.purchaseMutex.Lock()
+		defer l.purchaseMutex.Unlock()
+	}
+	if err := l.checkIPBlockBudget(ctx, service); err != nil {
+		return nil, err
+	}
+	clients := l.clientsFor(ipBlockCreate.Location)
+	if err := l.tags.ensure(ctx, clients.tagClient, l.ownership.usage, l.ownership.cluster, serviceNamespaceTag, serviceNameTag, deleteTag); err != nil {
+		return nil, fmt.Errorf("unable to ensure tags exist: %w", err)
+	}
+
+	block, resp, err := clients.ipClient.IPBlocksApi.IpBlocksPost(ctx).IpBlockCreate(*ipBlockCreate).Execute()
+	l.blockCache.invalidate()
+	if err != nil {
+		err = providerError(resp, err)
+		l.recordAPIError(service, err)
+		// a tag may have been deleted since it was ensured
+		l.tags.invalidate()
+		return nil, fmt.Errorf("unable to create new IP block: %w", err)
+	}
+	l.auditBlock(service, *block, eventReasonIPBlockPurchased)
+	return block, nil
+}
+
+// checkIPBlockBudget returns an error, and records an Event on the service, if purchasing
+// another IP block would exceed the configured maximum for the cluster.
+func (l *loadBalancers) checkIPBlockBudget(ctx context.Context, service *v1.Service) error {
+	if l.maxIPBlocks <= 0 {
+		return nil
+	}
+	// blocks pending deletion still are billed, so count them
+	blocks, err := l.getIPBlocks(ctx, "", "", true, true)
+	if err != nil {
+		return fmt.Errorf("unable to count IP blocks: %w", err)
+	}
+	ipBlocksInUse.Set(float64(len(blocks)))
+	if len(blocks) < l.maxIPBlocks {
+		return nil
+	}
+	msg := fmt.Sprintf("cluster already has %d of maximum %d IP blocks, not creating another", len(blocks), l.maxIPBlocks)
+	if service == nil {
+		return providerErrorf(ErrorReasonQuota, "%s", msg)
+	}
+	if l.recorder != nil {
+		l.recorder.Event(service, v1.EventTypeWarning, eventReasonIPBlockLimitReached, msg)
+	}
+	return providerErrorf(ErrorReasonQuota, "service %s: %s", serviceRep(service), msg)
+}
+
+// assignToNetwork assigns block to the public network, unless it already is; it fails if the block is assigned
+// to something else. API errors are recorded on service, if not nil.
+func (l *loadBalancers) assignToNetwork(ctx context.Context, service *v1.Service, block *ipapi.IpBlock, network string) error {
+	switch {
+	case blockAssignedToNetwork(*block, network):
+		return nil
+	case block.AssignedResourceType != nil:
+		return fmt.Errorf("block %s is assigned to %s, not to network %s", block.Cidr, *block.AssignedResourceType, network)
+	}
+	err := retry(ctx, l.apiBackoff, "assigning block "+block.Id, func() error {
+		_, resp, err := l.clientsFor(block.Location).netClient.PublicNetworksApi.PublicNetworksNetworkIdIpBlocksPost(ctx, network).PublicNetworkIpBlock(*netapi.NewPublicNetworkIpBlock(block.Id)).Execute()
+		return providerError(resp, err)
+	})
+	l.blockCache.invalidate()
+	if err != nil {
+		l.recordAPIError(service, err)
+		return fmt.Errorf("unable to assign block %s to network %s: %w", block.Cidr, network, err)
+	}
+	return nil
+}
+
+// recordBlockIP returns the IP in block of its assignedIP tag, first tagging it with the IP for a Service in the
+// block if it has none
+func (l *loadBalancers) recordBlockIP(ctx context.Context, block ipapi.IpBlock) (string, error) {
+	if ip, ok := blockTagValue(block, assignedIPTag); ok {
+		return ip, nil
+	}
+	prefix, err := blockPrefix(block)
+	if err != nil {
+		return "", err
+	}
+	ip := blockServiceIP(prefix).String()
+	clients := l.clientsFor(block.Location)
+	if err := l.tags.ensure(ctx, clients.tagClient, assignedIPTag); err != nil {
+		return "", fmt.Errorf("unable to ensure tags exist: %w", err)
+	}
+	tagRequest := append(tagAssignmentsIntoRequests(block.Tags), ipapi.TagAssignmentRequest{Name: assignedIPTag, Value: &ip})
+	_, resp, err := clients.ipClient.IPBlocksApi.IpBlocksIpBlockIdTagsPut(ctx, block.Id).TagAssignmentRequest(tagRequest).Execute()
+	l.blockCache.invalidate()
+	if err != nil {
+		return "", fmt.Errorf("unable to add '%s' tag to IP block %s: %w", assignedIPTag, block.Id, providerError(resp, err))
+	}
+	return ip, nil
+}
+
+// isReleased returns true if the block was released by the CCM, and should be deleted by the reaper.
+// A legacy "delete" tag only counts on a block without service tags, as the CCM always removed those when
+// releasing, while the tag may have been added by someone else for their own purposes.
+func isReleased(block ipapi.IpBlock) bool {
+	if _, ok := blockTagValue(block, deleteTag); ok {
+		return true
+	}
+	value, ok := blockTagValue(block, legacyDeleteTag)
+	if !ok || value != activeValue {
+		return false
+	}
+	_, hasNamespace := blockTagValue(block, serviceNamespaceTag)
+	_, hasName := blockTagValue(block, serviceNameTag)
+	return !hasNamespace && !hasName
+}
+
+// ownsBlock returns true if the block has the usage and cluster tags of this cluster,
+// either the configured ones or the defaults
+func (l *loadBalancers) ownsBlock(block ipapi.IpBlock) bool {
+	for _, ownership := range []ownershipTags{l.ownership, defaultOwnershipTags} {
+		usage, _ := blockTagValue(block, ownership.usage)
+		cluster, _ := blockTagValue(block, ownership.cluster)
+		if usage == ownership.usageValue && cluster == l.clusterID() {
+			return true
+		}
+	}
+	return false
+}
+
+// listClusterIPBlocks lists all of the IP blocks of the cluster, bypassing the cache, and
+// records how many there are; more than expected is logged, as it suggests leaked blocks.
+func (l *loadBalancers) listClusterIPBlocks(ctx context.Context) ([]ipapi.IpBlock, error) {
+	blocks, err := l.listAllClusterIPBlocks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) > ipBlockListWarnSize {
+		klog.Warningf("cluster has %d IP blocks, more than the expected %d; check for leaked blocks", len(blocks), ipBlockListWarnSize)
+	}
+	ipBlockListSize.Set(float64(len(blocks)))
+	return blocks, nil
+}
+
+// listAllClusterIPBlocks lists the blocks with the ownership tags. If those are not the defaults,
+// blocks created before they were changed, and so still tagged with the defaults, are included as well.
+func (l *loadBalancers) listAllClusterIPBlocks(ctx context.Context) ([]ipapi.IpBlock, error) {
+	blocks, err := l.listIPBlocksByOwnership(ctx, l.ownership)
+	if err != nil || l.ownership == defaultOwnershipTags {
+		return blocks, err
+	}
+	legacy, err := l.listIPBlocksByOwnership(ctx, defaultOwnershipTags)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, block := range blocks {
+		seen[block.Id] = true
+	}
+	for _, block := range legacy {
+		if !seen[block.Id] {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+// listIPBlocksByOwnership lists the IP blocks of the cluster with the given ownership tags, in all of the accounts
+func (l *loadBalancers) listIPBlocksByOwnership(ctx context.Context, ownership ownershipTags) ([]ipapi.IpBlock, error) {
+	// nothing of the cluster is known without its ID
+	clusterID, err := l.cluster.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []ipapi.IpBlock
+	for _, client := range l.ipClients() {
+		owned, err := listOwnedIPBlocks(ctx, client, ownership, clusterID)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, owned...)
+	}
+	return blocks, nil
+}
+
+// clientsFor returns the API clients of the account of the IP blocks in location
+func (l *loadBalancers) clientsFor(location string) *apiClients {
+	if clients, ok := l.locationClients[location]; ok {
+		return clients
+	}
+	return &apiClients{ipClient: l.ipClient, tagClient: l.tagClient, netClient: l.netClient}
+}
+
+// ipClients returns the IP clients of all of the accounts, each once, that of the locations without their own first
+func (l *loadBalancers) ipClients() []*ipapi.APIClient {
+	clients := []*ipapi.APIClient{l.ipClient}
+	seen := map[*ipapi.APIClient]bool{l.ipClient: true}
+	locations := make([]string, 0, len(l.locationClients))
+	for location := range l.locationClients {
+		locations = append(locations, location)
+	}
+	// keep the order stable, so the lists are
+	sort.Strings(locations)
+	for _, location := range locations {
+		if client := l.locationClients[location].ipClient; !seen[client] {
+			clients = append(clients, client)
+			seen[client] = true
+		}
+	}
+	return clients
+}
+
+// listOwnedIPBlocks lists the IP blocks of the cluster clusterID with the given ownership tags.
+// The API filters by tag, and does not page the result; should it return blocks of other
+// clusters anyway, they are dropped here.
+func listOwnedIPBlocks(ctx context.Context, client *ipapi.APIClient, ownership ownershipTags, clusterID string) ([]ipapi.IpBlock, error) {
+	// tags for Get() are separated via '.', so '<key>.<value>'
+	tags := []string{fmt.Sprintf("%s.%s", ownership.cluster, clusterID), fmt.Sprintf("%s.%s", ownership.usage, ownership.usageValue)}
+	start := time.Now()
+	blocks, resp, err := client.IPBlocksApi.IpBlocksGet(ctx).Tag(tags).Execute()
+	ipBlockListDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, providerError(resp, err)
+	}
+	owned := blocks[:0]
+	for _, block := range blocks {
+		cluster, _ := blockTagValue(block, ownership.cluster)
+		usage, _ := blockTagValue(block, ownership.usage)
+		if cluster == clusterID && usage == ownership.usageValue {
+			owned = append(owned, block)
+		}
+	}
+	if dropped := len(blocks) - len(owned); dropped > 0 {
+		klog.Warningf("IP block list returned %d blocks not tagged %s, ignoring them; the API may not support filtering by tag", dropped, strings.Join(tags, ", "))
+	}
+	return owned, nil
+}
+
+// getIPBlock returns current status of a single block, in location
+func (l *loadBalancers) getIPBlock(ctx context.Context, location, id string) (block *ipapi.IpBlock, err error) {
 	// get IP address blocks and check if any has an IP that matches this service
-	block, _, err = l.ipClient.IPBlocksApi.IpBlocksIpBlockIdGet(context.Background(), id).Execute()
+	block, resp, err := l.clientsFor(location).ipClient.IPBlocksApi.IpBlocksIpBlockIdGet(ctx, id).Execute()
+	err = providerError(resp, err)
 	return
 }
 
@@ -479,16 +1251,102 @@ func (l *loadBalancers) addService(ctx context.Context, svc *v1.Service, ip stri
 		}
 		klog.V(2).Infof("successfully assigned %s update service %s", svcIP, svcName)
 	}
+	svcIPCidr = fmt.Sprintf("%s/32", svcIP)
 	// now need to pass it the nodes
+	nodes, err := l.probeBackends(ctx, svc, nodes)
+	if err != nil {
+		return svcIPCidr, err
+	}
+	n := l.implementorNodes(ctx, nodes)
+	ports := servicePorts(svc)
 
-	var n []loadbalancers.Node
-	for _, node := range nodes {
-		n = append(n, loadbalancers.Node{
-			Node: node,
-		})
+	if l.nodeSets.unchanged(svcName, svcIPCidr, ports, n) {
+		// e.g. a periodic resync; the implementation already has exactly this
+		klog.V(2).Infof("IP %s, ports and nodes of service %s unchanged, skipping implementation", svcIPCidr, svcName)
+		implementorRequestsSkippedTotal.WithLabelValues(l.implementorScheme, implementorOpAddService).Inc()
+		return svcIPCidr, l.setServiceOptions(ctx, svc)
+	}
+	if added, removed, known := l.nodeSets.portsDiff(svcName, ports); known && (len(added) > 0 || len(removed) > 0) {
+		klog.V(2).Infof("service %s ports added %v, removed %v", svcName, added, removed)
 	}
+	if err := l.setPorts(ctx, svc, ports); err != nil {
+		l.nodeSets.forget(svcName)
+		return svcIPCidr, err
+	}
+	if err := l.callImplementor(implementorOpAddService, func() error {
+		return l.implementor.AddService(ctx, svc.Namespace, svc.Name, svcIPCidr, n)
+	}); err != nil {
+		l.nodeSets.forget(svcName)
+		return svcIPCidr, err
+	}
+	l.nodeSets.set(svcName, svcIPCidr, ports, n)
+	return svcIPCidr, l.setServiceOptions(ctx, svc)
+}
 
-	return svcIPCidr, l.implementor.AddService(ctx, svc.Namespace, svc.Name, svcIPCidr, n)
+// setServiceOptions passes the settings from the annotations of the service to the implementation,
+// and warns about those it cannot honor
+func (l *loadBalancers) setServiceOptions(ctx context.Context, svc *v1.Service) error {
+	l.warnIgnoredFeatures(svc)
+	if err := l.setHealthCheck(ctx, svc); err != nil {
+		return err
+	}
+	return l.setProxyProtocol(ctx, svc)
+}
+
+// blockServiceIP returns the IP in the block that is used for the Service,
+// i.e. the first free address, after network and router.
+func blockServiceIP(block netip.Prefix) netip.Addr {
+	return block.Masked().Addr().Next().Next()
+}
+
+// serviceIP returns the IP of the Service within the given block. It is the IP recorded in the
+// block's tags, else the IP in the Service spec, else the IP already in its status,
+// else the IP the CCM picks for the block.
+func serviceIP(svc *v1.Service, ipBlock ipapi.IpBlock, block netip.Prefix) (netip.Addr, error) {
+	if assigned, ok := blockTagValue(ipBlock, assignedIPTag); ok {
+		ip, err := netip.ParseAddr(assigned)
+		if err != nil {
+			return ip, fmt.Errorf("invalid %s tag %s on block %s: %w", assignedIPTag, assigned, block, err)
+		}
+		if !block.Contains(ip) {
+			return ip, fmt.Errorf("block %s does not contain its %s %s", block, assignedIPTag, ip)
+		}
+		if svc.Spec.LoadBalancerIP != "" && svc.Spec.LoadBalancerIP != assigned {
+			klog.V(2).Infof("service %s has IP %s, but block %s is assigned %s, using the latter", serviceRep(svc), svc.Spec.LoadBalancerIP, block, assigned)
+		}
+		return ip, nil
+	}
+	if svc.Spec.LoadBalancerIP != "" {
+		ip, err := netip.ParseAddr(svc.Spec.LoadBalancerIP)
+		if err != nil {
+			return ip, fmt.Errorf("invalid service IP %s: %w", svc.Spec.LoadBalancerIP, err)
+		}
+		if !block.Contains(ip) {
+			klog.V(2).Infof("block %s does not contain IP %s", block, ip)
+			return ip, fmt.Errorf("block %s does not contain IP %s", block, ip)
+		}
+		return ip, nil
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ip, err := netip.ParseAddr(ingress.IP); err == nil && block.Contains(ip) {
+			return ip, nil
+		}
+	}
+	return blockServiceIP(block), nil
+}
+
+// blockTagValue returns the value of the named tag on the block, and whether it was found
+func blockTagValue(block ipapi.IpBlock, name string) (string, bool) {
+	for _, tag := range block.Tags {
+		if tag.Name != name {
+			continue
+		}
+		if tag.Value == nil {
+			return "", true
+		}
+		return *tag.Value, true
+	}
+	return "", false
 }
 
 func serviceRep(svc *v1.Service) string {
@@ -498,8 +1356,37 @@ func serviceRep(svc *v1.Service) string {
 	return fmt.Sprintf("%s/%s", svc.Namespace, svc.Name)
 }
 
-func clusterTag(clusterID string) (string, string) {
-	return "cluster", clusterID
+// loadBalancerStatus the status of the load balancer of the service, announced on the given IPs.
+// Each ingress lists the ports of the service, so that clients know what is served on it.
+func loadBalancerStatus(svc *v1.Service, ips ...string) *v1.LoadBalancerStatus {
+	var ports []v1.PortStatus
+	for _, port := range svc.Spec.Ports {
+		ports = append(ports, v1.PortStatus{Port: port.Port, Protocol: port.Protocol})
+	}
+	status := &v1.LoadBalancerStatus{}
+	for _, ip := range ips {
+		status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{IP: ip, Ports: ports})
+	}
+	return status
+}
+
+// nodesInLocation returns the nodes that are in the given location, according to their region label,
+// in any case, as the region may be formatted. Nodes without the label are kept, as their location is unknown. Announcing an IP from a node
+// in another location would blackhole its traffic.
+func nodesInLocation(nodes []*v1.Node, location string) []*v1.Node {
+	if location == "" {
+		return nodes
+	}
+	var inLocation []*v1.Node
+	for _, node := range nodes {
+		region, ok := node.Labels[v1.LabelTopologyRegion]
+		if ok && !strings.EqualFold(region, location) {
+			klog.V(2).Infof("node %s is in region %s, not in location %s, so does not announce its IPs", node.Name, region, location)
+			continue
+		}
+		inLocation = append(inLocation, node)
+	}
+	return inLocation
 }
 
 func filterNodes(nodes []*v1.Node, nodeSelector labels.Selector) []*v1.Node {
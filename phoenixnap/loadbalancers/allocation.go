@@ -0,0 +1,14 @@
+package loadbalancers
+
+// Allocation an address of a Service, as recorded by the CCM when it allocated it, rather than
+// as found in the Service spec, which may already be cleared when the Service is removed
+type Allocation struct {
+	// IP the address announced for the Service, with its prefix length, e.g. 203.0.113.10/32;
+	// empty if the CCM has no record of it
+	IP string
+	// CIDR the IP block the address was allocated from, e.g. 203.0.113.8/29; empty if it was not
+	// allocated from an IP block, e.g. for external IPs
+	CIDR string
+	// BlockID the PhoenixNAP ID of the IP block; empty if it was not allocated from an IP block
+	BlockID string
+}
@@ -0,0 +1,33 @@
+package loadbalancers
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// Capabilities the protocols and optional Service features an LB can honor
+type Capabilities struct {
+	// Protocols the port protocols the LB forwards
+	Protocols []v1.Protocol
+	// SourceRanges whether the LB restricts clients to spec.loadBalancerSourceRanges
+	SourceRanges bool
+	// ProxyProtocol whether the LB can send the PROXY protocol header; requires ProxyProtocolSetter
+	ProxyProtocol bool
+	// HealthCheck whether the LB can check the health of backends; requires HealthChecker
+	HealthCheck bool
+	// Proxy whether the LB proxies connections to the backends, rather than routing the IP to them, so that
+	// traffic to the IP must not be short-circuited by kube-proxy, and backends may be probed before they are added
+	Proxy bool
+	// SecondaryLocation whether the LB can announce a second IP of a Service, from another location; requires
+	// SecondaryAnnouncer
+	SecondaryLocation bool
+}
+
+// Supports whether the LB forwards the given protocol
+func (c Capabilities) Supports(protocol v1.Protocol) bool {
+	for _, p := range c.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package loadbalancers
+
+import (
+	"context"
+	"time"
+)
+
+// HealthCheck settings for checking the health of the backends of a service
+type HealthCheck struct {
+	// Port the node port to check
+	Port int32
+	// Path the HTTP path to request; if empty, a TCP connect is used
+	Path string
+	// Interval between checks; if 0, the implementation default
+	Interval time.Duration
+}
+
+// HealthChecker is implemented by an LB that can configure backend health checks.
+// An LB that does not implement it ignores health checks.
+type HealthChecker interface {
+	// SetHealthCheck set the health check for the service with the given name; nil removes it
+	SetHealthCheck(ctx context.Context, svcNamespace, svcName string, check *HealthCheck) error
+}
@@ -7,8 +7,10 @@ import (
 type LB interface {
 	// AddService add a service with the provided name and IP
 	AddService(ctx context.Context, svcNamespace, svcName, ip string, nodes []Node) error
-	// RemoveService remove service with the given IP
-	RemoveService(ctx context.Context, svcNamespace, svcName, ip string) error
+	// RemoveService remove service with the given allocations, as recorded when they were made
+	RemoveService(ctx context.Context, svcNamespace, svcName string, allocations []Allocation) error
 	// UpdateService ensure that the nodes handled by the service are correct
 	UpdateService(ctx context.Context, svcNamespace, svcName string, nodes []Node) error
+	// Capabilities returns the protocols and optional features the LB supports
+	Capabilities() Capabilities
 }
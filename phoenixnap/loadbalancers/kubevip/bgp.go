@@ -0,0 +1,136 @@
+package kubevip
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// kube-vip in BGP mode, started with --annotations=<prefix>, reads the BGP settings of each node from annotations
+// on the node, among them the MD5 password of its peers. The CCM distributes the passwords from a Secret to these
+// annotations: each node gets only the key of its own name, which is generated if missing, so that a node, or anyone
+// who can read its annotations, learns no password of another. Only with BGPSharedPassword do the nodes without a key
+// of their own get the key password, likewise generated if missing. To rotate the passwords, change the Secret, or
+// delete a key to have a new one generated; the nodes are updated on the next sync.
+
+const (
+	// SecretKeyBGPPassword the key of the Secret with the BGP password shared by the nodes without one of their own,
+	// with BGPSharedPassword
+	SecretKeyBGPPassword = "password"
+	// annotationBGPPassword the suffix of the node annotation from which kube-vip reads the BGP password
+	annotationBGPPassword = "/bgp-pass"
+	// bgpPasswordBytes the random bytes of a generated password; kube-vip and GoBGP accept up to 80 characters
+	bgpPasswordBytes = 24
+)
+
+// Sync distributes the BGP passwords to the nodes, if the password Secret is set
+func (l *LB) Sync(ctx context.Context) error {
+	if l.options.BGPPasswordSecret == "" {
+		return nil
+	}
+	nodes, err := l.k8sclient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list nodes: %w", err)
+	}
+	secret, err := l.bgpPasswordSecret(ctx, nodes.Items)
+	if err != nil {
+		return err
+	}
+	annotation := l.options.BGPAnnotationPrefix + annotationBGPPassword
+	var errs []error
+	for _, node := range nodes.Items {
+		password, ok := secret.Data[node.Name]
+		if !ok && l.options.BGPSharedPassword {
+			password, ok = secret.Data[SecretKeyBGPPassword]
+		}
+		if !ok {
+			continue
+		}
+		if current, ok := node.Annotations[annotation]; ok && current == string(password) {
+			continue
+		}
+		patch, _ := json.Marshal(map[string]any{
+			"metadata": map[string]any{
+				"annotations": map[string]string{annotation: string(password)},
+			},
+		})
+		if _, err := l.k8sclient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("unable to set the BGP password of node %s: %w", node.Name, err))
+			continue
+		}
+		klog.V(2).Infof("set the BGP password of node %s from secret %s/%s", node.Name, l.namespace, secret.Name)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// bgpPasswordSecret returns the Secret with the BGP passwords, created, or with the missing passwords generated:
+// that of each of the nodes, or with BGPSharedPassword the shared one
+func (l *LB) bgpPasswordSecret(ctx context.Context, nodes []v1.Node) (*v1.Secret, error) {
+	secrets := l.k8sclient.CoreV1().Secrets(l.namespace)
+	secret, err := secrets.Get(ctx, l.options.BGPPasswordSecret, metav1.GetOptions{})
+	notFound := apierrors.IsNotFound(err)
+	switch {
+	case notFound:
+		klog.Infof("BGP password secret %s/%s not found, creating it with generated passwords", l.namespace, l.options.BGPPasswordSecret)
+		secret = &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: l.options.BGPPasswordSecret, Namespace: l.namespace}}
+	case err != nil:
+		return nil, fmt.Errorf("unable to get BGP password secret %s/%s: %w", l.namespace, l.options.BGPPasswordSecret, err)
+	}
+
+	keys := []string{SecretKeyBGPPassword}
+	if !l.options.BGPSharedPassword {
+		keys = keys[:0]
+		for _, node := range nodes {
+			keys = append(keys, node.Name)
+		}
+	}
+	var generated []string
+	for _, key := range keys {
+		if len(secret.Data[key]) > 0 {
+			continue
+		}
+		password, err := generateBGPPassword()
+		if err != nil {
+			return nil, err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[key] = password
+		generated = append(generated, key)
+	}
+
+	switch {
+	case notFound:
+		if secret, err = secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return nil, fmt.Errorf("unable to create BGP password secret %s/%s: %w", l.namespace, l.options.BGPPasswordSecret, err)
+		}
+	case len(generated) > 0:
+		klog.Infof("BGP password secret %s/%s has no %s, generating them", l.namespace, secret.Name, strings.Join(generated, ", "))
+		if secret, err = secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("unable to update BGP password secret %s/%s: %w", l.namespace, l.options.BGPPasswordSecret, err)
+		}
+	}
+	return secret, nil
+}
+
+// generateBGPPassword returns a random password of printable characters
+func generateBGPPassword() ([]byte, error) {
+	random := make([]byte, bgpPasswordBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("unable to generate BGP password: %w", err)
+	}
+	password := make([]byte, base64.RawURLEncoding.EncodedLen(len(random)))
+	base64.RawURLEncoding.Encode(password, random)
+	return password, nil
+}
@@ -0,0 +1,120 @@
+package kubevip
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncBGPPasswords(t *testing.T) {
+	const annotation = "bgp.example.com" + annotationBGPPassword
+	node := func(name string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "bgp"},
+		Data:       map[string][]byte{SecretKeyBGPPassword: []byte("shared"), "node2": []byte("own")},
+	}
+	client := k8sfake.NewSimpleClientset(node("node1"), node("node2"), secret)
+	lb := NewLB(client, "kube-system", "", Options{Mode: ModeDaemonSet, BGPPasswordSecret: "bgp", BGPAnnotationPrefix: "bgp.example.com"})
+	ctx := context.TODO()
+	passwords := func() map[string]string {
+		passwords := map[string]string{}
+		for _, name := range []string{"node1", "node2"} {
+			n, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("unable to get node %s: %v", name, err)
+			}
+			passwords[name] = n.Annotations[annotation]
+		}
+		return passwords
+	}
+
+	// each node gets only its own password, generated if missing, and never the shared one
+	if err := lb.Sync(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err := client.CoreV1().Secrets("kube-system").Get(ctx, "bgp", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get secret: %v", err)
+	}
+	generated := string(updated.Data["node1"])
+	if generated == "" || generated == "shared" {
+		t.Fatalf("expected a generated password, was %q", generated)
+	}
+	if actual, expected := passwords(), map[string]string{"node1": generated, "node2": "own"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("mismatched passwords, actual %v expected %v", actual, expected)
+	}
+
+	// rotate by deleting the password of a node; a new one is generated and set on that node only
+	delete(updated.Data, "node1")
+	if _, err := client.CoreV1().Secrets("kube-system").Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unable to update secret: %v", err)
+	}
+	if err := lb.Sync(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := passwords(); actual["node1"] == generated || actual["node1"] == "" || actual["node2"] != "own" {
+		t.Errorf("mismatched rotated passwords, actual %v", actual)
+	}
+}
+
+func TestSyncBGPSharedPassword(t *testing.T) {
+	const annotation = "bgp.example.com" + annotationBGPPassword
+	node := func(name string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "bgp"},
+		Data:       map[string][]byte{"node2": []byte("own")},
+	}
+	client := k8sfake.NewSimpleClientset(node("node1"), node("node2"), secret)
+	lb := NewLB(client, "kube-system", "", Options{Mode: ModeDaemonSet, BGPPasswordSecret: "bgp", BGPAnnotationPrefix: "bgp.example.com", BGPSharedPassword: true})
+	ctx := context.TODO()
+
+	// the shared password is generated, and set on the nodes without one of their own
+	if err := lb.Sync(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err := client.CoreV1().Secrets("kube-system").Get(ctx, "bgp", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get secret: %v", err)
+	}
+	shared := string(updated.Data[SecretKeyBGPPassword])
+	if shared == "" || len(updated.Data["node1"]) > 0 {
+		t.Fatalf("expected only a generated shared password, was %v", updated.Data)
+	}
+	for name, expected := range map[string]string{"node1": shared, "node2": "own"} {
+		n, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unable to get node %s: %v", name, err)
+		}
+		if actual := n.Annotations[annotation]; actual != expected {
+			t.Errorf("mismatched password of node %s, actual %q expected %q", name, actual, expected)
+		}
+	}
+}
+
+func TestSyncBGPPasswordsCreatesSecret(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	lb := NewLB(client, "kube-system", "", Options{Mode: ModeDaemonSet, BGPPasswordSecret: "bgp", BGPAnnotationPrefix: "bgp.example.com"})
+	ctx := context.TODO()
+
+	if err := lb.Sync(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, err := client.CoreV1().Secrets("kube-system").Get(ctx, "bgp", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the secret to be created: %v", err)
+	}
+	if len(secret.Data["node1"]) != 32 {
+		t.Errorf("mismatched length of generated password, actual %d expected 32", len(secret.Data["node1"]))
+	}
+	if _, ok := secret.Data[SecretKeyBGPPassword]; ok {
+		t.Errorf("expected no shared password")
+	}
+}
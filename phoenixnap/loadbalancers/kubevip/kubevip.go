@@ -1,28 +1,281 @@
-// empty loadbalancer that does nothing, but exists to enable bgp functionality
+// loadbalancer for kube-vip, which announces the IPs of services itself; depending on how kube-vip
+// is configured, it does nothing, but exists to enable bgp functionality, or annotates the services
 package kubevip
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
 )
 
+// Mode how kube-vip is deployed in the cluster, which determines how it learns the IPs of services
+type Mode string
+
+const (
+	// ModeStaticPod kube-vip runs as a static pod, configured from its ConfigMap, which the CCM does not
+	// write yet; the default
+	ModeStaticPod Mode = "static-pod"
+	// ModeDaemonSet kube-vip runs as a DaemonSet in services mode, e.g. deployed with its Helm chart,
+	// and learns the IP of each service from an annotation on the service
+	ModeDaemonSet Mode = "daemonset"
+
+	// AnnotationLoadBalancerIPs the annotation from which kube-vip in services mode reads the IP of a service
+	AnnotationLoadBalancerIPs = "kube-vip.io/loadbalancerIPs"
+	// AnnotationServiceInterface the annotation from which kube-vip in services mode reads the interface
+	// on which it announces the IP of a service
+	AnnotationServiceInterface = "kube-vip.io/serviceInterface"
+)
+
+// Options how the CCM configures kube-vip
+type Options struct {
+	Mode Mode
+	// Annotations set the IP, and any other settings, in the annotations of each service, for kube-vip in
+	// services mode; always on in daemonset mode
+	Annotations bool
+	// ServiceInterface the network interface on which the IPs are announced; if empty, kube-vip's default
+	ServiceInterface string
+	// BGPPasswordSecret the Secret in the namespace whose BGP passwords are set on the nodes; if empty, none are
+	BGPPasswordSecret string
+	// BGPAnnotationPrefix the prefix of the node annotations from which kube-vip reads the BGP settings, as in its
+	// --annotations flag
+	BGPAnnotationPrefix string
+	// BGPSharedPassword set the shared password of the Secret on the nodes without one of their own, rather than
+	// generating one for each
+	BGPSharedPassword bool
+}
+
+// ParseMode returns the mode of the given name, or ModeStaticPod if it is empty
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case "":
+		return ModeStaticPod, nil
+	case ModeStaticPod, ModeDaemonSet:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported kube-vip mode %q, must be %s or %s", name, ModeStaticPod, ModeDaemonSet)
+	}
+}
+
 type LB struct {
+	k8sclient kubernetes.Interface
+	// namespace in which any resources for kube-vip are managed
+	namespace string
+	options   Options
 }
 
-func NewLB(k8sclient kubernetes.Interface, config string) *LB {
-	return &LB{}
+func NewLB(k8sclient kubernetes.Interface, namespace, config string, options Options) *LB {
+	if options.Mode == ModeDaemonSet {
+		options.Annotations = true
+	}
+	return &LB{k8sclient: k8sclient, namespace: namespace, options: options}
 }
 
+// AddService with annotations sets the IP, and the other settings, in the annotations of the service,
+// from which kube-vip reads them
 func (l *LB) AddService(ctx context.Context, svcNamespace, svcName, ip string, nodes []loadbalancers.Node) error {
+	if !l.options.Annotations {
+		return nil
+	}
+	ips, err := l.serviceIPs(ctx, svcNamespace, svcName)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to read kube-vip annotations of service %s/%s: %w", svcNamespace, svcName, err)
+	}
+	// the primary IP comes first, any secondary ones set by AddSecondaryIP follow and are kept
+	ip = strings.SplitN(ip, "/", 2)[0]
+	if len(ips) > 1 {
+		ip = strings.Join(append([]string{ip}, ips[1:]...), ",")
+	}
+	return l.setServiceIPs(ctx, svcNamespace, svcName, ip)
+}
+
+// SetServiceIPs with annotations sets all of the IPs, e.g. the external IPs of the service, in its annotation,
+// replacing any others; kube-vip elects the node that announces each itself, so the nodes are not used
+func (l *LB) SetServiceIPs(ctx context.Context, svcNamespace, svcName string, ips []loadbalancers.ServiceIP) error {
+	if !l.options.Annotations {
+		return nil
+	}
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, strings.SplitN(ip.IP, "/", 2)[0])
+	}
+	return l.setServiceIPs(ctx, svcNamespace, svcName, strings.Join(addresses, ","))
+}
+
+// setServiceIPs sets the comma-separated ips, and the other settings, in the annotations of the service
+func (l *LB) setServiceIPs(ctx context.Context, svcNamespace, svcName, ips string) error {
+	if err := l.annotate(ctx, svcNamespace, svcName, l.annotations(&ips)); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("service %s/%s not found; kube-vip in services mode announces only existing services", svcNamespace, svcName)
+		}
+		return fmt.Errorf("unable to set kube-vip annotations on service %s/%s: %w", svcNamespace, svcName, err)
+	}
 	return nil
 }
 
-func (l *LB) RemoveService(ctx context.Context, svcNamespace, svcName, ip string) error {
+// RemoveService with annotations removes the annotations set by AddService from the service, if it still exists
+func (l *LB) RemoveService(ctx context.Context, svcNamespace, svcName string, allocations []loadbalancers.Allocation) error {
+	if !l.options.Annotations {
+		return nil
+	}
+	if err := l.annotate(ctx, svcNamespace, svcName, l.annotations(nil)); err != nil {
+		if apierrors.IsNotFound(err) {
+			klog.V(2).Infof("service %s/%s already deleted", svcNamespace, svcName)
+			return nil
+		}
+		return fmt.Errorf("unable to remove kube-vip annotations from service %s/%s: %w", svcNamespace, svcName, err)
+	}
 	return nil
 }
 
+// Ready returns an error if the namespace in which the resources for kube-vip are managed does not exist
+func (l *LB) Ready(ctx context.Context) error {
+	if _, err := l.k8sclient.CoreV1().Namespaces().Get(ctx, l.namespace, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("namespace %s does not exist", l.namespace)
+		}
+		return fmt.Errorf("unable to get namespace %s: %w", l.namespace, err)
+	}
+	return nil
+}
+
+// UpdateService does nothing, as kube-vip itself elects the node that announces the IP
 func (l *LB) UpdateService(ctx context.Context, svcNamespace, svcName string, nodes []loadbalancers.Node) error {
 	return nil
 }
+
+// AddSecondaryIP with annotations appends the secondary IP to the IPs in the annotation of the service, after
+// the primary one, so that kube-vip announces both; without, kube-vip has its own configuration
+func (l *LB) AddSecondaryIP(ctx context.Context, svcNamespace, svcName, ip string, nodes []loadbalancers.Node) error {
+	if !l.options.Annotations {
+		return nil
+	}
+	ips, err := l.serviceIPs(ctx, svcNamespace, svcName)
+	if err != nil {
+		return fmt.Errorf("unable to read kube-vip annotations of service %s/%s: %w", svcNamespace, svcName, err)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("service %s/%s has no primary IP yet", svcNamespace, svcName)
+	}
+	ip = strings.SplitN(ip, "/", 2)[0]
+	for _, existing := range ips[1:] {
+		if existing == ip {
+			return nil
+		}
+	}
+	joined := strings.Join(append(ips, ip), ",")
+	if err := l.annotate(ctx, svcNamespace, svcName, map[string]*string{AnnotationLoadBalancerIPs: &joined}); err != nil {
+		return fmt.Errorf("unable to set kube-vip annotations on service %s/%s: %w", svcNamespace, svcName, err)
+	}
+	return nil
+}
+
+// RemoveSecondaryIP with annotations removes the secondary IP from the annotation of the service, if it still exists
+func (l *LB) RemoveSecondaryIP(ctx context.Context, svcNamespace, svcName, ip string) error {
+	if !l.options.Annotations {
+		return nil
+	}
+	ips, err := l.serviceIPs(ctx, svcNamespace, svcName)
+	if apierrors.IsNotFound(err) {
+		klog.V(2).Infof("service %s/%s already deleted", svcNamespace, svcName)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read kube-vip annotations of service %s/%s: %w", svcNamespace, svcName, err)
+	}
+	ip = strings.SplitN(ip, "/", 2)[0]
+	var kept []string
+	for i, existing := range ips {
+		// never the primary IP, which RemoveService removes
+		if i == 0 || existing != ip {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == len(ips) {
+		return nil
+	}
+	joined := strings.Join(kept, ",")
+	if err := l.annotate(ctx, svcNamespace, svcName, map[string]*string{AnnotationLoadBalancerIPs: &joined}); err != nil {
+		return fmt.Errorf("unable to remove the secondary IP from the kube-vip annotations of service %s/%s: %w", svcNamespace, svcName, err)
+	}
+	return nil
+}
+
+// Capabilities kube-vip only announces the IPs, so the only optional feature is a secondary IP, which it
+// announces like the primary one
+func (l *LB) Capabilities() loadbalancers.Capabilities {
+	return loadbalancers.Capabilities{Protocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP}, SecondaryLocation: true}
+}
+
+// ListAnnouncements with annotations returns the IPs in the annotations of the services; without, kube-vip has
+// its own configuration, so there is nothing to list
+func (l *LB) ListAnnouncements(ctx context.Context) ([]loadbalancers.Announcement, error) {
+	if !l.options.Annotations {
+		return nil, nil
+	}
+	services, err := l.k8sclient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %w", err)
+	}
+	var announcements []loadbalancers.Announcement
+	for _, svc := range services.Items {
+		ips, ok := svc.Annotations[AnnotationLoadBalancerIPs]
+		if !ok {
+			continue
+		}
+		// kube-vip takes a comma-separated list, e.g. for dual stack
+		for _, ip := range strings.Split(ips, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				announcements = append(announcements, loadbalancers.Announcement{Namespace: svc.Namespace, Name: svc.Name, IP: ip})
+			}
+		}
+	}
+	return announcements, nil
+}
+
+// serviceIPs returns the IPs in the kube-vip annotation of the service, primary first
+func (l *LB) serviceIPs(ctx context.Context, svcNamespace, svcName string) ([]string, error) {
+	svc, err := l.k8sclient.CoreV1().Services(svcNamespace).Get(ctx, svcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, ip := range strings.Split(svc.Annotations[AnnotationLoadBalancerIPs], ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// annotations the kube-vip annotations of a service with the given IP; with a nil IP, to remove them
+func (l *LB) annotations(ip *string) map[string]*string {
+	annotations := map[string]*string{AnnotationLoadBalancerIPs: ip}
+	if l.options.ServiceInterface != "" {
+		var serviceInterface *string
+		if ip != nil {
+			serviceInterface = &l.options.ServiceInterface
+		}
+		annotations[AnnotationServiceInterface] = serviceInterface
+	}
+	return annotations
+}
+
+// annotate merges the annotations into those of the service; nil values remove them
+func (l *LB) annotate(ctx context.Context, svcNamespace, svcName string, annotations map[string]*string) error {
+	patch, _ := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": annotations,
+		},
+	})
+	_, err := l.k8sclient.CoreV1().Services(svcNamespace).Patch(ctx, svcName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,204 @@
+package kubevip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  Mode
+		valid bool
+	}{
+		{"", ModeStaticPod, true},
+		{"static-pod", ModeStaticPod, true},
+		{"daemonset", ModeDaemonSet, true},
+		{"sidecar", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, err := ParseMode(tt.name)
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Fatalf("expected error")
+			case mode != tt.mode:
+				t.Errorf("mismatched mode, actual %s expected %s", mode, tt.mode)
+			}
+		})
+	}
+}
+
+func TestServiceAnnotation(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc1"}}
+	tests := []struct {
+		name        string
+		options     Options
+		annotations map[string]string
+	}{
+		{"static pod", Options{Mode: ModeStaticPod}, nil},
+		{"static pod with annotations", Options{Mode: ModeStaticPod, Annotations: true}, map[string]string{AnnotationLoadBalancerIPs: "203.0.113.10"}},
+		{"daemonset", Options{Mode: ModeDaemonSet}, map[string]string{AnnotationLoadBalancerIPs: "203.0.113.10"}},
+		{"service interface", Options{Mode: ModeDaemonSet, ServiceInterface: "bond0"}, map[string]string{AnnotationLoadBalancerIPs: "203.0.113.10", AnnotationServiceInterface: "bond0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := k8sfake.NewSimpleClientset(svc.DeepCopy())
+			lb := NewLB(client, "kube-system", "", tt.options)
+			ctx := context.TODO()
+
+			if err := lb.AddService(ctx, "default", "svc1", "203.0.113.10/32", nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			added, _ := client.CoreV1().Services("default").Get(ctx, "svc1", metav1.GetOptions{})
+			if len(added.Annotations) != len(tt.annotations) {
+				t.Errorf("mismatched annotations after add, actual %v expected %v", added.Annotations, tt.annotations)
+			}
+			for name, value := range tt.annotations {
+				if actual := added.Annotations[name]; actual != value {
+					t.Errorf("mismatched annotation %s after add, actual %q expected %q", name, actual, value)
+				}
+			}
+
+			if err := lb.RemoveService(ctx, "default", "svc1", []loadbalancers.Allocation{{IP: "203.0.113.10/32"}}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			removed, _ := client.CoreV1().Services("default").Get(ctx, "svc1", metav1.GetOptions{})
+			if len(removed.Annotations) != 0 {
+				t.Errorf("annotations not removed, actual %v", removed.Annotations)
+			}
+		})
+	}
+}
+
+func TestServiceAnnotationServiceGone(t *testing.T) {
+	lb := NewLB(k8sfake.NewSimpleClientset(), "kube-system", "", Options{Mode: ModeDaemonSet})
+
+	// kube-vip announces only services that exist, so the IP cannot be set
+	if err := lb.AddService(context.TODO(), "default", "svc1", "203.0.113.10/32", nil); err == nil {
+		t.Errorf("expected error for a missing service")
+	}
+	// a deleted service no longer needs its annotation removed
+	if err := lb.RemoveService(context.TODO(), "default", "svc1", nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReady(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	lb := NewLB(client, "kube-vip", "", Options{})
+	if err := lb.Ready(context.TODO()); err == nil {
+		t.Errorf("expected error while the namespace does not exist")
+	}
+	if _, err := client.CoreV1().Namespaces().Create(context.TODO(), &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-vip"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unable to create namespace: %v", err)
+	}
+	if err := lb.Ready(context.TODO()); err != nil {
+		t.Errorf("unexpected error once the namespace exists: %v", err)
+	}
+}
+
+func TestListAnnouncements(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc1", Annotations: map[string]string{AnnotationLoadBalancerIPs: "203.0.113.10"}}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc2"}},
+	)
+	ctx := context.TODO()
+
+	announcements, err := NewLB(client, "kube-system", "", Options{Mode: ModeStaticPod}).ListAnnouncements(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(announcements) != 0 {
+		t.Errorf("mismatched announcements without annotations, actual %v expected none", announcements)
+	}
+
+	announcements, err = NewLB(client, "kube-system", "", Options{Mode: ModeDaemonSet}).ListAnnouncements(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := loadbalancers.Announcement{Namespace: "default", Name: "svc1", IP: "203.0.113.10"}
+	if len(announcements) != 1 || announcements[0] != expected {
+		t.Errorf("mismatched announcements, actual %v expected %v", announcements, expected)
+	}
+}
+
+func TestSecondaryIP(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc1"}}
+	client := k8sfake.NewSimpleClientset(svc)
+	lb := NewLB(client, "kube-system", "", Options{Mode: ModeDaemonSet})
+	ctx := context.TODO()
+	annotation := func() string {
+		svc, _ := client.CoreV1().Services("default").Get(ctx, "svc1", metav1.GetOptions{})
+		return svc.Annotations[AnnotationLoadBalancerIPs]
+	}
+
+	if err := lb.AddSecondaryIP(ctx, "default", "svc1", "198.51.100.10/32", nil); err == nil {
+		t.Errorf("expected error without a primary IP")
+	}
+	if err := lb.AddService(ctx, "default", "svc1", "203.0.113.10/32", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := lb.AddSecondaryIP(ctx, "default", "svc1", "198.51.100.10/32", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if actual, expected := annotation(), "203.0.113.10,198.51.100.10"; actual != expected {
+		t.Errorf("mismatched IPs after adding secondary, actual %q expected %q", actual, expected)
+	}
+
+	// a new primary IP keeps the secondary one
+	if err := lb.AddService(ctx, "default", "svc1", "203.0.113.20/32", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual, expected := annotation(), "203.0.113.20,198.51.100.10"; actual != expected {
+		t.Errorf("mismatched IPs after changing primary, actual %q expected %q", actual, expected)
+	}
+
+	if err := lb.RemoveSecondaryIP(ctx, "default", "svc1", "198.51.100.10/32"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual, expected := annotation(), "203.0.113.20"; actual != expected {
+		t.Errorf("mismatched IPs after removing secondary, actual %q expected %q", actual, expected)
+	}
+	if err := lb.RemoveSecondaryIP(ctx, "default", "gone", "198.51.100.10/32"); err != nil {
+		t.Errorf("unexpected error for a deleted service: %v", err)
+	}
+}
+
+func TestSetServiceIPs(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc1"}}
+	client := k8sfake.NewSimpleClientset(svc)
+	lb := NewLB(client, "kube-system", "", Options{Mode: ModeDaemonSet})
+	ctx := context.TODO()
+	annotation := func() string {
+		svc, _ := client.CoreV1().Services("default").Get(ctx, "svc1", metav1.GetOptions{})
+		return svc.Annotations[AnnotationLoadBalancerIPs]
+	}
+
+	// all IPs are set at once, in order
+	ips := []loadbalancers.ServiceIP{{IP: "203.0.113.10/32"}, {IP: "203.0.113.20/32"}}
+	if err := lb.SetServiceIPs(ctx, "default", "svc1", ips); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual, expected := annotation(), "203.0.113.10,203.0.113.20"; actual != expected {
+		t.Errorf("mismatched IPs, actual %q expected %q", actual, expected)
+	}
+
+	// an IP no longer set is withdrawn
+	if err := lb.SetServiceIPs(ctx, "default", "svc1", ips[1:]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual, expected := annotation(), "203.0.113.20"; actual != expected {
+		t.Errorf("mismatched IPs after withdrawing an IP, actual %q expected %q", actual, expected)
+	}
+}
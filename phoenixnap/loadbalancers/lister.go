@@ -0,0 +1,21 @@
+package loadbalancers
+
+import (
+	"context"
+)
+
+// Announcement an IP that the LB announces for a Service, as found in the state of the LB
+type Announcement struct {
+	// Namespace and Name of the Service
+	Namespace string
+	Name      string
+	// IP the address, without prefix length, e.g. 203.0.113.10
+	IP string
+}
+
+// Lister is implemented by an LB that keeps state of its own in the cluster, so that the CCM can check it
+// against the IP blocks, and remove what is left for blocks that no longer exist
+type Lister interface {
+	// ListAnnouncements the IPs the LB announces, by Service
+	ListAnnouncements(ctx context.Context) ([]Announcement, error)
+}
@@ -0,0 +1,20 @@
+package loadbalancers
+
+import (
+	"context"
+)
+
+// ServiceIP an IP of a Service, with its prefix length, and the nodes that announce it
+type ServiceIP struct {
+	IP    string
+	Nodes []Node
+}
+
+// MultiIPAnnouncer is implemented by an LB that can announce several IPs of a Service at once, each from its own
+// nodes, e.g. its external IPs. AddService announces one IP per Service, so a Service with more than one external
+// IP requires it.
+type MultiIPAnnouncer interface {
+	// SetServiceIPs announce exactly the ips for the service, each from its nodes; IPs announced for it by an
+	// earlier call that are not among them are withdrawn
+	SetServiceIPs(ctx context.Context, svcNamespace, svcName string, ips []ServiceIP) error
+}
@@ -2,6 +2,27 @@ package loadbalancers
 
 import v1 "k8s.io/api/core/v1"
 
+// Node a node that announces the IPs of a service, with what the CCM knows of its PhoenixNAP server, so that an LB
+// does not need access to the PhoenixNAP API of its own. The server fields are empty if the server is not known.
 type Node struct {
 	Node *v1.Node
+	// ServerID the PhoenixNAP ID of the server of the node
+	ServerID string
+	// Location the location of the server, e.g. PHX
+	Location string
+	// PublicIPs the public IPs of the server
+	PublicIPs []string
+	// PrivateIPs the private IPs of the server
+	PrivateIPs []string
+	// BGP the addresses with which the node peers to announce IPs by BGP
+	BGP BGPPeer
+}
+
+// BGPPeer the addresses with which a node peers with the PhoenixNAP routers of its location. The AS numbers
+// are not known to the CCM, and are part of the configuration of the LB.
+type BGPPeer struct {
+	// SourceIPs the IPs of the server on the public network to which the IP blocks are assigned, from which it peers
+	SourceIPs []string
+	// PeerIP the gateway of the server, with which it peers; empty if not known
+	PeerIP string
 }
@@ -0,0 +1,27 @@
+package loadbalancers
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Port a port of a Service announced on its IP
+type Port struct {
+	// Name the name of the port in the Service; empty if it has a single port
+	Name string
+	// Protocol the protocol of the port
+	Protocol v1.Protocol
+	// Port the port on the IP
+	Port int32
+	// NodePort the port on the nodes to which it is forwarded; 0 if the Service has no node ports
+	NodePort int32
+}
+
+// PortSetter is implemented by an LB that forwards the ports of a Service one by one, e.g. a proxy, rather than
+// routing the IP. SetPorts is called with all the ports before AddService or UpdateService whenever they changed.
+// An LB that does not implement it is called with AddService or UpdateService when the ports change, with the same nodes.
+type PortSetter interface {
+	// SetPorts set the ports of the service with the given name, replacing those set before
+	SetPorts(ctx context.Context, svcNamespace, svcName string, ports []Port) error
+}
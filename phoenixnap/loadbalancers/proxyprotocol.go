@@ -0,0 +1,13 @@
+package loadbalancers
+
+import (
+	"context"
+)
+
+// ProxyProtocolSetter is implemented by an LB that terminates or forwards connections, and
+// can send the PROXY protocol header to backends, so that they see the client IP.
+// An LB that does not implement it never sends the header.
+type ProxyProtocolSetter interface {
+	// SetProxyProtocol enable or disable the PROXY protocol for the service with the given name
+	SetProxyProtocol(ctx context.Context, svcNamespace, svcName string, enabled bool) error
+}
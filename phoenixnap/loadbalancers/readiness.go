@@ -0,0 +1,12 @@
+package loadbalancers
+
+import (
+	"context"
+)
+
+// ReadinessChecker is implemented by an LB with prerequisites in the cluster, e.g. a namespace or CRDs, that may
+// not exist yet when the CCM starts. Until Ready succeeds, the CCM does not reconcile load balancers with the LB.
+type ReadinessChecker interface {
+	// Ready returns an error naming the missing prerequisite, or nil if the LB can be used
+	Ready(ctx context.Context) error
+}
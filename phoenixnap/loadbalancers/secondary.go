@@ -0,0 +1,15 @@
+package loadbalancers
+
+import (
+	"context"
+)
+
+// SecondaryAnnouncer is implemented by an LB that can announce a second IP of a Service, from an IP block in
+// another location, from the nodes in that location, alongside the IP given to AddService; declared with
+// Capabilities.SecondaryLocation
+type SecondaryAnnouncer interface {
+	// AddSecondaryIP announce ip, with its prefix length, for the service from the nodes, or update the nodes
+	AddSecondaryIP(ctx context.Context, svcNamespace, svcName, ip string, nodes []Node) error
+	// RemoveSecondaryIP stop announcing ip, with its prefix length, for the service
+	RemoveSecondaryIP(ctx context.Context, svcNamespace, svcName, ip string) error
+}
@@ -0,0 +1,12 @@
+package loadbalancers
+
+import (
+	"context"
+)
+
+// Syncer is implemented by an LB with periodic work that is not tied to a service, e.g. distributing settings to
+// all nodes. Sync is called once the LB is set up, and then periodically.
+type Syncer interface {
+	// Sync do the periodic work
+	Sync(ctx context.Context) error
+}
@@ -0,0 +1,1228 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers/kubevip"
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+const (
+	testNetworkID = "public-network-1"
+	testClusterID = "cluster-uid-1"
+)
+
+// testGetLoadBalancers create a loadBalancers with kube-vip enabled, backed by a fake PhoenixNAP API
+// and a fake kubernetes client, which has the given services.
+func testGetLoadBalancers(t testing.TB, maxIPBlocks int, services ...*v1.Service) (*loadBalancers, *store.Memory, *record.FakeRecorder) {
+	return testGetLoadBalancersWithHandler(t, maxIPBlocks, nil, services...)
+}
+
+// testGetLoadBalancersWithHandler same as testGetLoadBalancers, but wraps the fake PhoenixNAP API
+// handler with wrap, if not nil, e.g. to inject failures.
+func testGetLoadBalancersWithHandler(t testing.TB, maxIPBlocks int, wrap func(http.Handler) http.Handler, services ...*v1.Service) (*loadBalancers, *store.Memory, *record.FakeRecorder) {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	_, _ = backend.CreateLocation(validLocationName)
+	if _, err := backend.CreatePublicNetworkWithID(testNetworkID, "lb", validLocationName); err != nil {
+		t.Fatalf("unable to create public network: %v", err)
+	}
+	// the scenario must leave the store as the API would
+	t.Cleanup(func() {
+		if err := backend.Validate(); err != nil {
+			t.Errorf("inconsistent store after the test: %v", err)
+		}
+	})
+	handler := fake.CreateHandler()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	bmc, _, ip, tag, netClient, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	k8sclient := k8sfake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: types.UID(testClusterID)},
+	})
+	for _, svc := range services {
+		if _, err := k8sclient.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unable to create service %s: %v", serviceRep(svc), err)
+		}
+	}
+	l, err := newLoadBalancers([]*bmcapi.APIClient{bmc}, ip, tag, netClient, k8sclient, validLocationName, "kube-vip://"+testNetworkID, DefaultAnnotationIPLocation, "", maxIPBlocks, defaultOwnershipTags, false)
+	if err != nil {
+		t.Fatalf("unable to create load balancers: %v", err)
+	}
+	t.Cleanup(l.close)
+	// do not slow down tests with real backoffs
+	l.apiBackoff = newBackoff(time.Millisecond, 10*time.Millisecond, apiRetryAttempts)
+	l.tags.backoff = l.apiBackoff
+	l.blockReadyBackoff = newBackoff(10*time.Millisecond, 20*time.Millisecond, 20)
+	recorder := record.NewFakeRecorder(10)
+	l.recorder = recorder
+	return l, backend, recorder
+}
+
+// testService a Service of type=LoadBalancer
+func testService(namespace, name string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+}
+
+func TestEnsureLoadBalancerMaxIPBlocks(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+	l, backend, recorder := testGetLoadBalancers(t, 1, svc1, svc2)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc1, nil); err != nil {
+		t.Fatalf("unexpected error for first service: %v", err)
+	}
+	_, err := l.EnsureLoadBalancer(context.TODO(), "", svc2, nil)
+	if err == nil {
+		t.Fatalf("expected error for second service once at maximum IP blocks")
+	}
+	if reason := ReasonForError(err); reason != ErrorReasonQuota {
+		t.Errorf("mismatched reason, actual %s expected %s", reason, ErrorReasonQuota)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Errorf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonIPBlockLimitReached) {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+}
+
+func TestEnsureLoadBalancerParallelMaxIPBlocks(t *testing.T) {
+	var services []*v1.Service
+	for i := 0; i < 5; i++ {
+		services = append(services, testService("default", fmt.Sprintf("svc%d", i)))
+	}
+	l, backend, _ := testGetLoadBalancers(t, 2, services...)
+
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+	for _, svc := range services {
+		wg.Add(1)
+		go func(svc *v1.Service) {
+			defer wg.Done()
+			if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+				if reason := ReasonForError(err); reason != ErrorReasonQuota {
+					t.Errorf("unexpected error for %s: %v", serviceRep(svc), err)
+				}
+				atomic.AddInt32(&failed, 1)
+			}
+		}(svc)
+	}
+	wg.Wait()
+
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 2 {
+		t.Errorf("mismatched IP blocks, actual %d expected %d", len(blocks), 2)
+	}
+	if failed != 3 {
+		t.Errorf("mismatched failed services, actual %d expected %d", failed, 3)
+	}
+}
+
+// BenchmarkEnsureLoadBalancerParallel ensures load balancers for independent Services in parallel
+func BenchmarkEnsureLoadBalancerParallel(b *testing.B) {
+	services := make([]*v1.Service, b.N)
+	for i := range services {
+		services[i] = testService("default", fmt.Sprintf("svc%d", i))
+	}
+	l, _, _ := testGetLoadBalancers(b, 0, services...)
+	// discard events
+	l.recorder = &record.FakeRecorder{}
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			svc := services[atomic.AddInt64(&n, 1)-1]
+			if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+				b.Errorf("unexpected error for %s: %v", serviceRep(svc), err)
+			}
+		}
+	})
+}
+
+func TestLoadBalancersClose(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	l.close()
+	// in-flight and new calls are cancelled
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v after close, got %v", context.Canceled, err)
+	}
+}
+
+func TestGetLoadBalancerWithoutServiceIP(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Ingress) != 1 || status.Ingress[0].IP == "" {
+		t.Fatalf("expected a single ingress IP, got %v", status.Ingress)
+	}
+
+	// the original service object never had spec.loadBalancerIP set
+	status2, exists, err := l.GetLoadBalancer(context.TODO(), "", svc)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case !exists:
+		t.Fatalf("expected load balancer to exist")
+	case status2.Ingress[0].IP != status.Ingress[0].IP:
+		t.Errorf("mismatched IP, actual %s expected %s", status2.Ingress[0].IP, status.Ingress[0].IP)
+	}
+
+	// ensuring again must not allocate another block
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Errorf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+}
+
+func TestEnsureLoadBalancerExistingRestoresImplementation(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+	nodes := []*v1.Node{testNode("phoenixnap://node1", "node1")}
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the CCM restarts, and the implementation lost the service, e.g. it was interrupted before handing it over
+	delete(lb.ips, "default/svc1")
+	delete(lb.nodes, "default/svc1")
+	l.nodeSets = serviceNodeSets{}
+
+	status2, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case status2.Ingress[0].IP != status.Ingress[0].IP:
+		t.Errorf("mismatched IP, actual %s expected %s", status2.Ingress[0].IP, status.Ingress[0].IP)
+	}
+	if ip := lb.ips["default/svc1"]; ip != status.Ingress[0].IP+"/32" {
+		t.Errorf("service not passed to the implementation again, actual IP %q expected %s/32", ip, status.Ingress[0].IP)
+	}
+	if names := lb.nodes["default/svc1"]; len(names) != 1 || names[0] != "node1" {
+		t.Errorf("mismatched nodes, actual %v expected [node1]", names)
+	}
+	if blocks, _ := backend.ListIPBlocks(); len(blocks) != 1 {
+		t.Errorf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+}
+
+func TestEnsureLoadBalancerRecordsAssignedIP(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	assigned, ok := blockTagValue(*blocks[0], assignedIPTag)
+	switch {
+	case !ok:
+		t.Fatalf("block has no %s tag", assignedIPTag)
+	case assigned != status.Ingress[0].IP:
+		t.Errorf("mismatched %s tag, actual %s expected %s", assignedIPTag, assigned, status.Ingress[0].IP)
+	}
+
+	// the tag wins over a stale spec
+	stale := svc.DeepCopy()
+	stale.Spec.LoadBalancerIP = "192.0.2.10"
+	status2, exists, err := l.GetLoadBalancer(context.TODO(), "", stale)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case !exists:
+		t.Fatalf("expected load balancer to exist")
+	case status2.Ingress[0].IP != assigned:
+		t.Errorf("mismatched IP, actual %s expected %s", status2.Ingress[0].IP, assigned)
+	}
+}
+
+// testGetAccount returns the API clients of another account, backed by its own fake PhoenixNAP API, with the
+// location and a public network of ID network in it
+func testGetAccount(t *testing.T, location, network string) (*apiClients, *store.Memory) {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	_, _ = backend.CreateLocation(location)
+	if _, err := backend.CreatePublicNetworkWithID(network, "lb-"+location, location); err != nil {
+		t.Fatalf("unable to create public network: %v", err)
+	}
+	ts := httptest.NewServer(fake.CreateHandler())
+	t.Cleanup(ts.Close)
+	bmc, _, ip, tag, netClient, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	return &apiClients{bmcClient: bmc, ipClient: ip, tagClient: tag, netClient: netClient}, backend
+}
+
+func TestEnsureLoadBalancerLocationCredentials(t *testing.T) {
+	// the blocks in a location with credentials of its own are in the account of that location
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	account, accountBackend := testGetAccount(t, "PHX", testNetworkID)
+	l.location = "PHX"
+	l.locationClients = map[string]*apiClients{"PHX": account}
+	ctx := context.TODO()
+
+	status, err := l.EnsureLoadBalancer(ctx, "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocks, _ := backend.ListIPBlocks(); len(blocks) != 0 {
+		t.Errorf("mismatched IP blocks of the default account, actual %d expected 0", len(blocks))
+	}
+	blocks, _ := accountBackend.ListIPBlocks()
+	if len(blocks) != 1 || blocks[0].Location != "PHX" {
+		t.Fatalf("mismatched IP blocks of the PHX account, actual %v expected 1 in PHX", blocks)
+	}
+
+	// the block is found in its account, rather than another bought
+	l.blockCache.invalidate()
+	status2, err := l.EnsureLoadBalancer(ctx, "", svc, nil)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case status2.Ingress[0].IP != status.Ingress[0].IP:
+		t.Errorf("mismatched IP, actual %s expected %s", status2.Ingress[0].IP, status.Ingress[0].IP)
+	}
+	if blocks, _ := accountBackend.ListIPBlocks(); len(blocks) != 1 {
+		t.Errorf("mismatched IP blocks of the PHX account after second ensure, actual %d expected 1", len(blocks))
+	}
+
+	// and released in it
+	if err := l.EnsureLoadBalancerDeleted(ctx, "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, _ = accountBackend.ListIPBlocks()
+	if _, ok := blockTagValue(*blocks[0], deleteTag); !ok {
+		t.Errorf("expected the block to be released in the PHX account")
+	}
+}
+
+func TestEnsureLoadBalancerExternalIPs(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationExternalIPs: "true"}
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	l.servers = newInstances(l.bmcClients...).serverByNode
+
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	node := testNode(providerIDFromServer(server), server.Hostname)
+
+	tests := []struct {
+		name        string
+		externalIPs []string
+		nodes       []*v1.Node
+		valid       bool
+	}{
+		{"no IPs", nil, []*v1.Node{node}, false},
+		{"unknown IP", []string{"192.0.2.1"}, []*v1.Node{node}, false},
+		{"server not a node", server.PublicIpAddresses, nil, false},
+		{"valid", server.PublicIpAddresses, []*v1.Node{node}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := svc.DeepCopy()
+			s.Spec.ExternalIPs = tt.externalIPs
+			status, err := l.EnsureLoadBalancer(context.TODO(), "", s, tt.nodes)
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tt.valid && err == nil:
+				t.Fatalf("expected error")
+			case tt.valid && (len(status.Ingress) != 1 || status.Ingress[0].IP != tt.externalIPs[0]):
+				t.Errorf("mismatched ingress, actual %v expected %v", status.Ingress, tt.externalIPs)
+			}
+		})
+	}
+
+	// no blocks are ordered in this mode
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 0 {
+		t.Errorf("mismatched IP blocks, actual %d expected %d", len(blocks), 0)
+	}
+}
+
+func TestEnsureLoadBalancerExternalIPsKubeVIPAnnotations(t *testing.T) {
+	// all external IPs are set at once, and kube-vip announces all of them
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationExternalIPs: "true"}
+	l, backend, _ := testGetLoadBalancers(t, 0)
+	l.servers = newInstances(l.bmcClients...).serverByNode
+	l.implementor = kubevip.NewLB(l.k8sclient, "kube-system", "", kubevip.Options{Mode: kubevip.ModeStaticPod, Annotations: true})
+
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	var nodes []*v1.Node
+	for i := 0; i < 2; i++ {
+		server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+		if err != nil {
+			t.Fatalf("unable to create server: %v", err)
+		}
+		svc.Spec.ExternalIPs = append(svc.Spec.ExternalIPs, server.PublicIpAddresses[0])
+		nodes = append(nodes, testNode(providerIDFromServer(server), server.Hostname))
+	}
+	if _, err := l.k8sclient.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unable to create service: %v", err)
+	}
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	annotated, err := l.k8sclient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get service: %v", err)
+	}
+	if actual, expected := annotated.Annotations[kubevip.AnnotationLoadBalancerIPs], strings.Join(svc.Spec.ExternalIPs, ","); actual != expected {
+		t.Errorf("mismatched kube-vip IPs, actual %q expected %q", actual, expected)
+	}
+	if actual, expected := annotated.Annotations[annotationAnnouncedExternalIPs], strings.Join(svc.Spec.ExternalIPs, ","); actual != expected {
+		t.Errorf("mismatched announced IPs, actual %q expected %q", actual, expected)
+	}
+
+	// an IP removed from the spec is withdrawn
+	annotated.Spec.ExternalIPs = annotated.Spec.ExternalIPs[1:]
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", annotated, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	annotated, err = l.k8sclient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get service: %v", err)
+	}
+	for _, annotation := range []string{kubevip.AnnotationLoadBalancerIPs, annotationAnnouncedExternalIPs} {
+		if actual, expected := annotated.Annotations[annotation], svc.Spec.ExternalIPs[1]; actual != expected {
+			t.Errorf("mismatched %s, actual %q expected %q", annotation, actual, expected)
+		}
+	}
+}
+
+func TestEnsureLoadBalancerExternalIPsSingleIP(t *testing.T) {
+	// an implementation that is not a MultiIPAnnouncer announces one external IP, and withdraws the earlier one
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationExternalIPs: "true"}
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	l.servers = newInstances(l.bmcClients...).serverByNode
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	var (
+		ips   []string
+		nodes []*v1.Node
+	)
+	for i := 0; i < 2; i++ {
+		server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+		if err != nil {
+			t.Fatalf("unable to create server: %v", err)
+		}
+		ips = append(ips, server.PublicIpAddresses[0])
+		nodes = append(nodes, testNode(providerIDFromServer(server), server.Hostname))
+	}
+
+	svc.Spec.ExternalIPs = ips
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err == nil {
+		t.Errorf("expected error for more than one external IP")
+	}
+
+	svc.Spec.ExternalIPs = ips[:1]
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc, err := l.k8sclient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get service: %v", err)
+	}
+	svc.Spec.ExternalIPs = ips[1:]
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual, expected := lb.ips["default/svc1"], ips[1]+"/32"; actual != expected {
+		t.Errorf("mismatched IP, actual %q expected %q", actual, expected)
+	}
+	if withdrawn := withdrawnExternalIPs(svc); len(withdrawn) != 1 || withdrawn[0] != ips[0] {
+		t.Errorf("mismatched withdrawn IPs, actual %v expected %v", withdrawn, ips[:1])
+	}
+}
+
+func TestEnsureLoadBalancerServerAssignedBlock(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, recorder := testGetLoadBalancers(t, 0, svc)
+
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	node := testNode(providerIDFromServer(server), server.Hostname)
+	other := testNode("phoenixnap://other-server", "other")
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, []*v1.Node{node, other})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// move the block from the public network directly onto the server
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	block := *blocks[0]
+	block.AssignedResourceType = &[]string{string(assignedResourceServer)}[0]
+	block.AssignedResourceId = &server.Id
+	if err := backend.UpdateIPBlock(&block); err != nil {
+		t.Fatalf("unable to update IP block: %v", err)
+	}
+	l.blockCache.invalidate()
+
+	// the server is a node, so the block is adopted
+	status2, err := l.EnsureLoadBalancer(context.TODO(), "", svc, []*v1.Node{node, other})
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case status2.Ingress[0].IP != status.Ingress[0].IP:
+		t.Errorf("mismatched IP, actual %s expected %s", status2.Ingress[0].IP, status.Ingress[0].IP)
+	}
+	if _, exists, err := l.GetLoadBalancer(context.TODO(), "", svc); err != nil || !exists {
+		t.Errorf("expected load balancer to exist, got exists %v error %v", exists, err)
+	}
+
+	// the server is not a node, so it is refused with an explanation
+	_, err = l.EnsureLoadBalancer(context.TODO(), "", svc, []*v1.Node{other})
+	switch {
+	case err == nil:
+		t.Fatalf("expected error when server is not a node")
+	case !strings.Contains(err.Error(), server.Id) || !strings.Contains(err.Error(), testNetworkID):
+		t.Errorf("error does not name server and network: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonIPBlockAssignedToServer) {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+}
+
+func TestEnsureLoadBalancerRollbackOnAssignFailure(t *testing.T) {
+	svc := testService("default", "svc1")
+	failAssign := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/public-networks/"+testNetworkID+"/ip-blocks") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	l, backend, _ := testGetLoadBalancersWithHandler(t, 0, failAssign, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err == nil {
+		t.Fatalf("expected error when network assignment fails")
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	if _, ok := blockTagValue(*blocks[0], deleteTag); !ok {
+		t.Errorf("new block not tagged with %s after failed assignment", deleteTag)
+	}
+	if _, ok := blockTagValue(*blocks[0], serviceNameTag); ok {
+		t.Errorf("new block still tagged with %s after failed assignment", serviceNameTag)
+	}
+}
+
+func TestEnsureLoadBalancerAPIErrorDetails(t *testing.T) {
+	svc := testService("default", "svc1")
+	quotaExceeded := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/ip-blocks") && !strings.Contains(r.URL.Path, "public-networks") {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"message":"IP block quota exceeded","validationErrors":["size"],"accountId":"secret-account"}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	l, _, recorder := testGetLoadBalancersWithHandler(t, 0, quotaExceeded, svc)
+
+	tests := []struct {
+		name    string
+		details bool
+		message bool
+	}{
+		{"enabled", true, true},
+		{"disabled", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErrorDetails = tt.details
+			defer func() { apiErrorDetails = true }()
+
+			_, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+			switch {
+			case err == nil:
+				t.Fatalf("expected error")
+			case strings.Contains(err.Error(), "IP block quota exceeded (size)") != tt.message:
+				t.Errorf("mismatched API message in error, expected %v: %v", tt.message, err)
+			case strings.Contains(err.Error(), "secret-account"):
+				t.Errorf("error includes unexpected field: %v", err)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !tt.message || !strings.Contains(event, eventReasonProviderAPIError) || strings.Contains(event, "secret-account") {
+					t.Errorf("unexpected event %s", event)
+				}
+			default:
+				if tt.message {
+					t.Errorf("no event recorded")
+				}
+			}
+		})
+	}
+}
+
+func TestEnsureLoadBalancerCustomOwnershipTags(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc1, svc2)
+
+	// svc1 gets its block while the default tags are in use
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc1, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	l.ownership = ownershipTags{usage: "owner", usageValue: "k8s", cluster: "k8s-cluster"}
+	l.blockCache.invalidate()
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc2, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 2 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 2)
+	}
+	for _, block := range blocks {
+		if name, _ := blockTagValue(*block, serviceNameTag); name != svc2.Name {
+			continue
+		}
+		if value, _ := blockTagValue(*block, "owner"); value != "k8s" {
+			t.Errorf("new block not tagged with custom usage tag, got %q", value)
+		}
+		if value, _ := blockTagValue(*block, "k8s-cluster"); value != testClusterID {
+			t.Errorf("new block not tagged with custom cluster tag, got %q", value)
+		}
+	}
+
+	// the block tagged with the defaults still is found
+	status2, exists, err := l.GetLoadBalancer(context.TODO(), "", svc1)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case !exists:
+		t.Fatalf("expected block tagged with default tags to be found")
+	case status2.Ingress[0].IP != status.Ingress[0].IP:
+		t.Errorf("mismatched IP, actual %s expected %s", status2.Ingress[0].IP, status.Ingress[0].IP)
+	}
+}
+
+func TestReapLegacyDeleteTag(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc1, svc2)
+
+	for _, svc := range []*v1.Service{svc1, svc2} {
+		if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	valtrue := "true"
+	blocks, _ := backend.ListIPBlocks()
+	for _, block := range blocks {
+		name, _ := blockTagValue(*block, serviceNameTag)
+		updated := *block
+		switch name {
+		case svc1.Name:
+			// someone else's "delete" tag on an active block
+			updated.Tags = append(append([]ipapi.TagAssignment(nil), block.Tags...), ipapi.TagAssignment{Name: legacyDeleteTag, Value: &valtrue})
+		case svc2.Name:
+			// released by an earlier version: service tags removed, "delete" added
+			updated.Tags = nil
+			for _, tag := range block.Tags {
+				if tag.Name != serviceNameTag && tag.Name != serviceNamespaceTag && tag.Name != assignedIPTag {
+					updated.Tags = append(updated.Tags, tag)
+				}
+			}
+			updated.Tags = append(updated.Tags, ipapi.TagAssignment{Name: legacyDeleteTag, Value: &valtrue})
+		}
+		if err := backend.UpdateIPBlock(&updated); err != nil {
+			t.Fatalf("unable to update IP block: %v", err)
+		}
+	}
+	l.blockCache.invalidate()
+
+	// first unassigns, second deletes
+	l.reap(context.TODO())
+	l.reap(context.TODO())
+
+	blocks, _ = backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	if name, _ := blockTagValue(*blocks[0], serviceNameTag); name != svc1.Name {
+		t.Errorf("mismatched remaining block, actual %s expected %s", name, svc1.Name)
+	}
+	if _, exists, err := l.GetLoadBalancer(context.TODO(), "", svc1); err != nil || !exists {
+		t.Errorf("expected load balancer to exist, got exists %v error %v", exists, err)
+	}
+}
+
+func TestReapConcurrency(t *testing.T) {
+	var (
+		inFlight, maxInFlight int32
+		failID                atomic.Value
+	)
+	failID.Store("")
+	services := make([]*v1.Service, 0, 6)
+	for i := 0; i < 6; i++ {
+		services = append(services, testService("default", fmt.Sprintf("svc%d", i)))
+	}
+	l, backend, _ := testGetLoadBalancersWithHandler(t, 0, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodDelete {
+				next.ServeHTTP(w, r)
+				return
+			}
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				highest := atomic.LoadInt32(&maxInFlight)
+				if current <= highest || atomic.CompareAndSwapInt32(&maxInFlight, highest, current) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			if id := failID.Load().(string); id != "" && strings.HasSuffix(r.URL.Path, "/"+id) {
+				http.Error(w, `{"message":"invalid block"}`, http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, services...)
+	l.reaperConcurrency = 3
+
+	for _, svc := range services {
+		if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	blocks, _ := backend.ListIPBlocks()
+	failID.Store(blocks[0].Id)
+
+	// first unassigns, second deletes; the failing block does not hold up the others
+	if err := l.reap(context.TODO()); err == nil {
+		t.Errorf("expected error for the failing block")
+	}
+	_ = l.reap(context.TODO())
+
+	if highest := atomic.LoadInt32(&maxInFlight); highest < 2 || highest > 3 {
+		t.Errorf("mismatched most blocks reaped at once, actual %d expected 2 to 3", highest)
+	}
+	blocks, _ = backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Errorf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+}
+
+// testActiveBlocks returns the number of blocks in the backend not tagged for deletion.
+func testActiveBlocks(backend *store.Memory) int {
+	blocks, _ := backend.ListIPBlocks()
+	var count int
+	for _, block := range blocks {
+		if _, ok := blockTagValue(*block, deleteTag); !ok {
+			count++
+		}
+	}
+	return count
+}
+
+func TestEnsureLoadBalancerDeletedMultipleBlocks(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a duplicate block for the same service, e.g. left by an interrupted purchase
+	blocks, _ := backend.ListIPBlocks()
+	if _, err := backend.CreateIPBlock(validLocationName, 29, blocks[0].Tags); err != nil {
+		t.Fatalf("unable to create IP block: %v", err)
+	}
+	l.blockCache.invalidate()
+
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 0)
+	}
+}
+
+func TestEnsureLoadBalancerDeletedServiceGone(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.k8sclient.CoreV1().Services(svc.Namespace).Delete(context.TODO(), svc.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unable to delete service: %v", err)
+	}
+
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 0)
+	}
+}
+
+func TestEnsureLoadBalancerDeletedServiceUpdateFails(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc, _ = l.k8sclient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	client := l.k8sclient.(*k8sfake.Clientset)
+	var fail atomic.Bool
+	fail.Store(true)
+	client.PrependReactor("update", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if fail.Load() {
+			return true, nil, errors.New("apiserver unavailable")
+		}
+		return false, nil, nil
+	})
+
+	// the block is released anyway, the failure is reported so the call is retried
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err == nil {
+		t.Fatalf("expected error when the service update fails")
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 0)
+	}
+
+	fail.Store(false)
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	updated, _ := l.k8sclient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if updated.Spec.LoadBalancerIP != "" {
+		t.Errorf("expected service IP to be cleared, got %q", updated.Spec.LoadBalancerIP)
+	}
+}
+
+func TestEnsureLoadBalancerDeletedIdempotent(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+			t.Fatalf("unexpected error on call %d: %v", i, err)
+		}
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	if _, ok := blockTagValue(*blocks[0], deleteTag); !ok {
+		t.Errorf("expected block to be tagged for deletion")
+	}
+	if _, exists, err := l.GetLoadBalancer(context.TODO(), "", svc); err != nil || exists {
+		t.Errorf("expected load balancer to be gone, got exists %v error %v", exists, err)
+	}
+}
+
+// testRemovingLB an implementation that records the allocations each service is removed with,
+// and fails removals while err is set
+type testRemovingLB struct {
+	testRecordingLB
+	removed map[string][]loadbalancers.Allocation
+	err     error
+}
+
+func (t *testRemovingLB) RemoveService(ctx context.Context, svcNamespace, svcName string, allocations []loadbalancers.Allocation) error {
+	if t.err != nil {
+		return t.err
+	}
+	t.removed[svcNamespace+"/"+svcName] = allocations
+	return t.testRecordingLB.RemoveService(ctx, svcNamespace, svcName, allocations)
+}
+
+func TestEnsureLoadBalancerDeletedAllocations(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testRemovingLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		removed:         map[string][]loadbalancers.Allocation{},
+	}
+	l.implementor = lb
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	expected := loadbalancers.Allocation{IP: lb.ips["default/svc1"], CIDR: blocks[0].Cidr, BlockID: blocks[0].Id}
+	// the spec no longer has the IP, e.g. it was cleared by an earlier attempt
+	deleted := svc.DeepCopy()
+	deleted.Spec.LoadBalancerIP = ""
+
+	// a failing implementation keeps the block, so that the retry removes the service again
+	lb.err = errors.New("implementation unavailable")
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", deleted); err == nil {
+		t.Fatalf("expected error when the implementation fails")
+	}
+	if count := testActiveBlocks(backend); count != 1 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 1)
+	}
+
+	lb.err = nil
+	if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", deleted); err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 0)
+	}
+	removed := lb.removed["default/svc1"]
+	if len(removed) != 1 || removed[0] != expected {
+		t.Errorf("mismatched allocations, actual %+v expected %+v", removed, []loadbalancers.Allocation{expected})
+	}
+	if _, ok := lb.ips["default/svc1"]; ok {
+		t.Errorf("service still in implementation after deletion")
+	}
+}
+
+// testCreateOwnedBlocks creates count blocks in the backend tagged as owned by the cluster clusterID
+func testCreateOwnedBlocks(t testing.TB, backend *store.Memory, ownership ownershipTags, clusterID string, count int) {
+	for i := 0; i < count; i++ {
+		usageValue, cluster := ownership.usageValue, clusterID
+		name := fmt.Sprintf("svc%d", i)
+		tags := []ipapi.TagAssignment{
+			{Name: ownership.usage, Value: &usageValue},
+			{Name: ownership.cluster, Value: &cluster},
+			{Name: serviceNameTag, Value: &name},
+		}
+		if _, err := backend.CreateIPBlock(validLocationName, 29, tags); err != nil {
+			t.Fatalf("unable to create IP block: %v", err)
+		}
+	}
+}
+
+func TestListClusterIPBlocksLargeInventory(t *testing.T) {
+	tests := []struct {
+		name string
+		wrap func(http.Handler) http.Handler
+	}{
+		{"filtered by the API", nil},
+		// an API that ignores the tag filter returns the blocks of every cluster in the account
+		{"not filtered by the API", func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				q.Del("tag")
+				r.URL.RawQuery = q.Encode()
+				next.ServeHTTP(w, r)
+			})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, backend, _ := testGetLoadBalancersWithHandler(t, 0, tt.wrap)
+			testCreateOwnedBlocks(t, backend, l.ownership, "other-cluster", 600)
+			testCreateOwnedBlocks(t, backend, l.ownership, testClusterID, ipBlockListWarnSize+50)
+
+			blocks, err := l.listClusterIPBlocks(context.TODO())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(blocks) != ipBlockListWarnSize+50 {
+				t.Errorf("mismatched blocks, actual %d expected %d", len(blocks), ipBlockListWarnSize+50)
+			}
+			for _, block := range blocks {
+				if cluster, _ := blockTagValue(block, l.ownership.cluster); cluster != testClusterID {
+					t.Fatalf("block %s of cluster %q returned", block.Id, cluster)
+				}
+			}
+			if v, _ := testutil.GetGaugeMetricValue(ipBlockListSize); v != float64(ipBlockListWarnSize+50) {
+				t.Errorf("mismatched metric, actual %v expected %v", v, ipBlockListWarnSize+50)
+			}
+		})
+	}
+}
+
+func TestTagValuePrefix(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc1, svc2)
+
+	// svc2 gets its block before the prefix is set
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc2, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.tagValuePrefix = "prod-"
+	l.blockCache.invalidate()
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc1, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blocks, _ := backend.ListIPBlocks()
+	if len(blocks) != 2 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 2)
+	}
+	names := map[string]string{}
+	for _, block := range blocks {
+		namespace, _ := blockTagValue(*block, serviceNamespaceTag)
+		name, _ := blockTagValue(*block, serviceNameTag)
+		names[namespace+"/"+name] = block.Id
+	}
+	for _, expected := range []string{"prod-default/prod-svc1", "default/svc2"} {
+		if _, ok := names[expected]; !ok {
+			t.Errorf("no block tagged %s, found %v", expected, names)
+		}
+	}
+
+	// both are found, with and without the prefix
+	for _, svc := range []*v1.Service{svc1, svc2} {
+		if _, exists, err := l.GetLoadBalancer(context.TODO(), "", svc); err != nil || !exists {
+			t.Errorf("expected load balancer of %s to exist, got exists %v error %v", svc.Name, exists, err)
+		}
+		if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+			t.Errorf("unexpected error deleting %s: %v", svc.Name, err)
+		}
+	}
+	if count := testActiveBlocks(backend); count != 0 {
+		t.Errorf("mismatched active blocks, actual %d expected %d", count, 0)
+	}
+}
+
+func TestLoadBalancerStatusPorts(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Spec.Ports = []v1.ServicePort{
+		{Name: "http", Port: 80, Protocol: v1.ProtocolTCP},
+		{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP},
+	}
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	status2, _, err := l.GetLoadBalancer(context.TODO(), "", svc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []*v1.LoadBalancerStatus{status, status2} {
+		if len(s.Ingress) != 1 || len(s.Ingress[0].Ports) != 2 {
+			t.Fatalf("expected a single ingress with 2 ports, got %v", s.Ingress)
+		}
+		for i, port := range s.Ingress[0].Ports {
+			if port.Port != svc.Spec.Ports[i].Port || port.Protocol != svc.Spec.Ports[i].Protocol {
+				t.Errorf("%d: mismatched port, actual %d/%s expected %d/%s", i, port.Port, port.Protocol, svc.Spec.Ports[i].Port, svc.Spec.Ports[i].Protocol)
+			}
+		}
+	}
+}
+
+func TestEnsureLoadBalancerNodesInLocation(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+
+	local := testNode("phoenixnap://local", "local")
+	local.Labels = map[string]string{v1.LabelTopologyRegion: validLocationName}
+	remote := testNode("phoenixnap://remote", "remote")
+	remote.Labels = map[string]string{v1.LabelTopologyRegion: "elsewhere"}
+	unlabelled := testNode("phoenixnap://unlabelled", "unlabelled")
+	nodes := []*v1.Node{local, remote, unlabelled}
+	expected := []string{"local", "unlabelled"}
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := lb.nodes["default/svc1"]; strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("mismatched nodes after ensure, actual %v expected %v", actual, expected)
+	}
+	// as if after a restart, so the update is not skipped as unchanged
+	lb.nodes = map[string][]string{}
+	l.nodeSets.forget("default/svc1")
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := lb.nodes["default/svc1"]; strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("mismatched nodes after update, actual %v expected %v", actual, expected)
+	}
+}
+
+func TestUpdateLoadBalancerNodeChanges(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+	node1, node2 := testNode("phoenixnap://node1", "node1"), testNode("phoenixnap://node2", "node2")
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, []*v1.Node{node1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// unchanged nodes do not call the implementation
+	lb.nodes = map[string][]string{}
+	skippedBefore, _ := testutil.GetCounterMetricValue(serviceNodeUpdatesSkippedTotal)
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, []*v1.Node{node1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.nodes["default/svc1"]; ok {
+		t.Errorf("implementation called for unchanged nodes")
+	}
+	skippedAfter, _ := testutil.GetCounterMetricValue(serviceNodeUpdatesSkippedTotal)
+	if skippedAfter-skippedBefore != 1 {
+		t.Errorf("mismatched skipped updates, actual %v expected %v", skippedAfter-skippedBefore, 1)
+	}
+
+	// changed nodes do, and are counted
+	addedBefore, _ := testutil.GetCounterMetricValue(serviceNodeChangesTotal.WithLabelValues("added"))
+	removedBefore, _ := testutil.GetCounterMetricValue(serviceNodeChangesTotal.WithLabelValues("removed"))
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, []*v1.Node{node2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := lb.nodes["default/svc1"]; strings.Join(actual, ",") != "node2" {
+		t.Errorf("mismatched nodes after update, actual %v expected %v", actual, []string{"node2"})
+	}
+	addedAfter, _ := testutil.GetCounterMetricValue(serviceNodeChangesTotal.WithLabelValues("added"))
+	removedAfter, _ := testutil.GetCounterMetricValue(serviceNodeChangesTotal.WithLabelValues("removed"))
+	if addedAfter-addedBefore != 1 || removedAfter-removedBefore != 1 {
+		t.Errorf("mismatched node changes, actual added %v removed %v expected 1 each", addedAfter-addedBefore, removedAfter-removedBefore)
+	}
+}
+
+func TestEnsureLoadBalancerClusterID(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	// a second CCM for another workload cluster, in the same account, scoped by its configured cluster ID
+	ownership := defaultOwnershipTags
+	ownership.clusterID = "workload-b"
+	k8sclient := k8sfake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: types.UID(testClusterID)},
+	}, svc.DeepCopy())
+	other, err := newLoadBalancers(l.bmcClients, l.ipClient, l.tagClient, l.netClient, k8sclient, validLocationName, "kube-vip://"+testNetworkID, DefaultAnnotationIPLocation, "", 0, ownership, false)
+	if err != nil {
+		t.Fatalf("unable to create load balancers: %v", err)
+	}
+	t.Cleanup(other.close)
+	other.apiBackoff, other.tags.backoff, other.blockReadyBackoff = l.apiBackoff, l.apiBackoff, l.blockReadyBackoff
+	other.recorder = record.NewFakeRecorder(10)
+	if other.clusterID() != "workload-b" {
+		t.Fatalf("mismatched cluster ID, actual %s expected %s", other.clusterID(), "workload-b")
+	}
+
+	// the same service in both clusters gets a block of its own in each
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	otherStatus, err := other.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error in the other cluster: %v", err)
+	}
+	if status.Ingress[0].IP == otherStatus.Ingress[0].IP {
+		t.Errorf("both clusters got IP %s", status.Ingress[0].IP)
+	}
+	blocks, _ := backend.ListIPBlocks()
+	clusters := map[string]int{}
+	for _, block := range blocks {
+		cluster, _ := blockTagValue(*block, ownership.cluster)
+		clusters[cluster]++
+	}
+	if clusters[testClusterID] != 1 || clusters["workload-b"] != 1 {
+		t.Errorf("mismatched blocks per cluster, actual %v", clusters)
+	}
+
+	// deleting it in one cluster leaves the other's block alone
+	if err := other.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, exists, err := l.GetLoadBalancer(context.TODO(), "", svc); err != nil || !exists {
+		t.Errorf("expected load balancer to exist in the first cluster, got exists %v error %v", exists, err)
+	}
+}
@@ -0,0 +1,265 @@
+// Package metadataproxy serves a restricted, read-only subset of the PhoenixNAP API
+// to in-cluster clients, using the credentials of the CCM. This saves other controllers
+// from each needing their own full API credentials.
+package metadataproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// APIGroup is the RBAC API group against which access to the proxy is checked.
+	// It does not need to be served by the kube-apiserver, it only is used in Roles.
+	APIGroup = "metadata.phoenixnap.com"
+
+	// ResourceServers is the RBAC resource for reading servers
+	ResourceServers = "servers"
+	// ResourceIPBlocks is the RBAC resource for reading IP blocks
+	ResourceIPBlocks = "ipblocks"
+	// ResourcePendingDeletions is the RBAC resource for reading the IP blocks pending deletion
+	ResourcePendingDeletions = "pendingdeletions"
+
+	serviceAccountPrefix = "system:serviceaccount:"
+)
+
+// Proxy a handler creator for the metadata proxy http server
+type Proxy struct {
+	BMCClient *bmcapi.APIClient
+	K8sClient kubernetes.Interface
+	// CertFile and KeyFile the PEM certificate and key with which Run serves TLS
+	CertFile string
+	KeyFile  string
+	// IPBlocks lists the IP blocks of the cluster, i.e. with its ownership tags; only those are served, and if nil,
+	// none are
+	IPBlocks func(ctx context.Context) ([]ipapi.IpBlock, error)
+	// PendingDeletions lists the IP blocks the CCM released, and has yet to delete; if nil, they are not served
+	PendingDeletions func(ctx context.Context) ([]PendingDeletion, error)
+}
+
+// PendingDeletion an IP block the CCM released, which waits to be unassigned and deleted
+type PendingDeletion struct {
+	BlockID  string `json:"blockID"`
+	CIDR     string `json:"cidr"`
+	Location string `json:"location"`
+	Status   string `json:"status"`
+	// Service the <namespace>/<name> of the Service the block was released by, if known
+	Service string `json:"service,omitempty"`
+	// ReleasedAt when the block was released, or, if it was released by an earlier version, first seen released
+	ReleasedAt time.Time `json:"releasedAt"`
+	AgeSeconds int64     `json:"ageSeconds"`
+	// InReaperScope whether the reaper deletes the block; if not, it stays until deleted otherwise
+	InReaperScope bool `json:"inReaperScope"`
+}
+
+// ErrorResponse the body returned with any non-2xx response
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// CreateHandler create an http.Handler
+func (p *Proxy) CreateHandler() http.Handler {
+	r := mux.NewRouter()
+	v1 := r.PathPrefix("/v1").Subrouter()
+	// list all servers
+	v1.HandleFunc("/servers", p.authorize("list", ResourceServers, p.listServersHandler)).Methods("GET")
+	// get a single server
+	v1.HandleFunc("/servers/{serverID}", p.authorize("get", ResourceServers, p.getServerHandler)).Methods("GET")
+	// list the IP blocks pending deletion
+	if p.PendingDeletions != nil {
+		v1.HandleFunc("/pending-deletions", p.authorize("list", ResourcePendingDeletions, p.listPendingDeletionsHandler)).Methods("GET")
+	}
+	if p.IPBlocks != nil {
+		// list the IP blocks of the cluster
+		v1.HandleFunc("/ip-blocks", p.authorize("list", ResourceIPBlocks, p.listIPBlocksHandler)).Methods("GET")
+		// get a single IP block of the cluster
+		v1.HandleFunc("/ip-blocks/{ipBlockID}", p.authorize("get", ResourceIPBlocks, p.getIPBlockHandler)).Methods("GET")
+	}
+	return r
+}
+
+// Run serve the proxy with TLS on the given address until stop is closed
+func (p *Proxy) Run(addr string, stop <-chan struct{}) error {
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   p.CreateHandler(),
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	go func() {
+		<-stop
+		if err := srv.Shutdown(context.Background()); err != nil {
+			klog.Errorf("metadata proxy shutdown: %v", err)
+		}
+	}()
+	klog.Infof("metadata proxy listening on %s", addr)
+	if err := srv.ListenAndServeTLS(p.CertFile, p.KeyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// authorize wrap a handler so that it only is called if the bearer token in the request
+// belongs to a user that is allowed to perform verb on resource. The check is made
+// in the namespace of the caller, if it is a service account, so that access can be
+// granted per namespace using a Role.
+func (p *Proxy) authorize(verb, resource string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == "" || token == auth {
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		review, err := p.K8sClient.AuthenticationV1().TokenReviews().Create(r.Context(), &authnv1.TokenReview{
+			Spec: authnv1.TokenReviewSpec{Token: token},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			klog.V(2).Infof("metadata proxy token review failed: %v", err)
+			writeError(w, http.StatusUnauthorized, "unable to authenticate")
+			return
+		}
+		if !review.Status.Authenticated {
+			writeError(w, http.StatusUnauthorized, "unable to authenticate")
+			return
+		}
+		user := review.Status.User
+		extra := map[string]authzv1.ExtraValue{}
+		for k, v := range user.Extra {
+			extra[k] = authzv1.ExtraValue(v)
+		}
+		sar, err := p.K8sClient.AuthorizationV1().SubjectAccessReviews().Create(r.Context(), &authzv1.SubjectAccessReview{
+			Spec: authzv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				ResourceAttributes: &authzv1.ResourceAttributes{
+					Namespace: namespaceFromUsername(user.Username),
+					Verb:      verb,
+					Group:     APIGroup,
+					Resource:  resource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			klog.V(2).Infof("metadata proxy subject access review failed: %v", err)
+			writeError(w, http.StatusForbidden, "unable to authorize")
+			return
+		}
+		if !sar.Status.Allowed {
+			klog.V(2).Infof("metadata proxy denied %s %s to %s: %s", verb, resource, user.Username, sar.Status.Reason)
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// list all servers
+func (p *Proxy) listServersHandler(w http.ResponseWriter, r *http.Request) {
+	servers, _, err := p.BMCClient.ServersApi.ServersGet(r.Context()).Execute()
+	if err != nil {
+		klog.V(2).Infof("metadata proxy error listing servers: %v", err)
+		writeError(w, http.StatusBadGateway, "error retrieving servers")
+		return
+	}
+	writeJSON(w, servers)
+}
+
+// get information about a specific server
+func (p *Proxy) getServerHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["serverID"]
+	server, resp, err := p.BMCClient.ServersApi.ServersServerIdGet(r.Context(), id).Execute()
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	if err != nil {
+		klog.V(2).Infof("metadata proxy error getting server %s: %v", id, err)
+		writeError(w, http.StatusBadGateway, "error retrieving server")
+		return
+	}
+	writeJSON(w, server)
+}
+
+// list the IP blocks of the cluster
+func (p *Proxy) listIPBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	blocks, err := p.IPBlocks(r.Context())
+	if err != nil {
+		klog.V(2).Infof("metadata proxy error listing IP blocks: %v", err)
+		writeError(w, http.StatusBadGateway, "error retrieving IP blocks")
+		return
+	}
+	writeJSON(w, blocks)
+}
+
+// get information about a specific IP block of the cluster; those of others are not found
+func (p *Proxy) getIPBlockHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["ipBlockID"]
+	blocks, err := p.IPBlocks(r.Context())
+	if err != nil {
+		klog.V(2).Infof("metadata proxy error getting IP block %s: %v", id, err)
+		writeError(w, http.StatusBadGateway, "error retrieving IP block")
+		return
+	}
+	for _, block := range blocks {
+		if block.Id == id {
+			writeJSON(w, block)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "IP block not found")
+}
+
+// list the IP blocks pending deletion
+func (p *Proxy) listPendingDeletionsHandler(w http.ResponseWriter, r *http.Request) {
+	pending, err := p.PendingDeletions(r.Context())
+	if err != nil {
+		klog.V(2).Infof("metadata proxy error listing pending deletions: %v", err)
+		writeError(w, http.StatusInternalServerError, "error retrieving pending deletions")
+		return
+	}
+	writeJSON(w, pending)
+}
+
+// namespaceFromUsername returns the namespace of a service account username,
+// i.e. system:serviceaccount:<namespace>:<name>, or "" for any other user.
+func namespaceFromUsername(username string) string {
+	if !strings.HasPrefix(username, serviceAccountPrefix) {
+		return ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(username, serviceAccountPrefix), ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Code: code, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.V(2).Infof("metadata proxy unable to write json: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package metadataproxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/clients"
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	validToken   = "valid-token"
+	allowedToken = "allowed-token"
+)
+
+type apiServerError struct {
+	t *testing.T
+}
+
+func (a *apiServerError) Error(err error) {
+	a.t.Fatal(err)
+}
+
+// testGetProxy create a proxy backed by a fake PhoenixNAP API and a fake kubernetes client.
+// allowedToken authenticates and is authorized; validToken authenticates but is denied.
+func testGetProxy(t *testing.T) *Proxy {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	ts := httptest.NewServer(fake.CreateHandler())
+	t.Cleanup(ts.Close)
+	set, err := clients.New(clients.Options{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+
+	k8sclient := k8sfake.NewSimpleClientset()
+	k8sclient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		switch review.Spec.Token {
+		case validToken:
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:denied:reader"
+		case allowedToken:
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:allowed:reader"
+		}
+		return true, review, nil
+	})
+	k8sclient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		attrs := sar.Spec.ResourceAttributes
+		sar.Status.Allowed = attrs != nil && attrs.Namespace == "allowed" && attrs.Group == APIGroup
+		return true, sar, nil
+	})
+
+	return &Proxy{
+		BMCClient: set.BMC,
+		K8sClient: k8sclient,
+	}
+}
+
+func TestProxyAuthorization(t *testing.T) {
+	proxy := testGetProxy(t)
+	handler := proxy.CreateHandler()
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"invalid token", "abc", http.StatusUnauthorized},
+		{"denied", validToken, http.StatusForbidden},
+		{"allowed", allowedToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/servers", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Fatalf("mismatched code, actual %d expected %d", rec.Code, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var servers []bmcapi.Server
+			if err := json.NewDecoder(rec.Body).Decode(&servers); err != nil {
+				t.Fatalf("unable to decode response: %v", err)
+			}
+		})
+	}
+}
+
+func TestProxyPendingDeletions(t *testing.T) {
+	proxy := testGetProxy(t)
+	get := func(handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/pending-deletions", nil)
+		req.Header.Set("Authorization", "Bearer "+allowedToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get(proxy.CreateHandler()); rec.Code != http.StatusNotFound {
+		t.Errorf("mismatched code without pending deletions, actual %d expected %d", rec.Code, http.StatusNotFound)
+	}
+
+	expected := []PendingDeletion{{BlockID: "block1", CIDR: "203.0.113.8/29", Status: "unassigning", Service: "default/svc1", AgeSeconds: 90}}
+	proxy.PendingDeletions = func(ctx context.Context) ([]PendingDeletion, error) {
+		return expected, nil
+	}
+	rec := get(proxy.CreateHandler())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("mismatched code, actual %d expected %d", rec.Code, http.StatusOK)
+	}
+	var pending []PendingDeletion
+	if err := json.NewDecoder(rec.Body).Decode(&pending); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if len(pending) != 1 || pending[0] != expected[0] {
+		t.Errorf("mismatched pending deletions, actual %v expected %v", pending, expected)
+	}
+}
+
+func TestProxyIPBlocks(t *testing.T) {
+	proxy := testGetProxy(t)
+	get := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+allowedToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get(proxy.CreateHandler(), "/v1/ip-blocks"); rec.Code != http.StatusNotFound {
+		t.Errorf("mismatched code without IP blocks, actual %d expected %d", rec.Code, http.StatusNotFound)
+	}
+
+	// only the blocks of the cluster are served
+	proxy.IPBlocks = func(ctx context.Context) ([]ipapi.IpBlock, error) {
+		return []ipapi.IpBlock{{Id: "owned", Cidr: "203.0.113.8/29"}}, nil
+	}
+	handler := proxy.CreateHandler()
+	rec := get(handler, "/v1/ip-blocks")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("mismatched code, actual %d expected %d", rec.Code, http.StatusOK)
+	}
+	var blocks []ipapi.IpBlock
+	if err := json.NewDecoder(rec.Body).Decode(&blocks); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if len(blocks) != 1 || blocks[0].Id != "owned" {
+		t.Errorf("mismatched IP blocks, actual %v expected %v", blocks, []string{"owned"})
+	}
+	for id, code := range map[string]int{"owned": http.StatusOK, "other": http.StatusNotFound} {
+		if rec := get(handler, "/v1/ip-blocks/"+id); rec.Code != code {
+			t.Errorf("mismatched code for IP block %s, actual %d expected %d", id, rec.Code, code)
+		}
+	}
+}
+
+func TestNamespaceFromUsername(t *testing.T) {
+	tests := []struct {
+		username  string
+		namespace string
+	}{
+		{"", ""},
+		{"admin", ""},
+		{"system:serviceaccount:kube-system:default", "kube-system"},
+		{"system:serviceaccount:broken", ""},
+	}
+	for i, tt := range tests {
+		if ns := namespaceFromUsername(tt.username); ns != tt.namespace {
+			t.Errorf("%d: mismatched namespace, actual %s expected %s", i, ns, tt.namespace)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package phoenixnap
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const metricsSubsystem = "phoenixnap"
+
+var (
+	apiCircuitBreakerOpen = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "api_circuit_breaker_open",
+		Help:           "Number of PhoenixNAP API accounts whose circuit breaker currently is open.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	apiCircuitBreakerRejectedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "api_circuit_breaker_rejected_total",
+		Help:           "Number of PhoenixNAP API calls rejected because the circuit breaker was open.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	apiRateLimitWaitSeconds = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "api_rate_limit_wait_seconds",
+		Help:           "Time PhoenixNAP API calls were held back by the rate limit of their subsystem, by subsystem.",
+		Buckets:        metrics.DefBuckets,
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"subsystem"})
+	apiCredentialFailuresTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "api_credential_failures_total",
+		Help:           "Number of PhoenixNAP API calls that failed because of the credentials, by reason: rejected by the token endpoint, or unauthorized by the API.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"reason"})
+	apiTokenExpiry = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "api_token_expiry_timestamp_seconds",
+		Help:           "Unix time at which the current PhoenixNAP API token expires, by client ID.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"client_id"})
+	apiTokenRefreshesTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "api_token_refreshes_total",
+		Help:           "Number of attempts to fetch a PhoenixNAP API token, by client ID and result.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"client_id", "result"})
+	instanceTypeInfo = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "instance_type_info",
+		Help:           "Always 1; describes the server product of each instance type in use, by instance type, location, CPU, cores, RAM in GB and hourly price.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"instance_type", "location", "cpu", "cores", "ram_gb", "hourly_price"})
+	serverHostnameMismatches = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "server_hostname_mismatches",
+		Help:           "Number of nodes whose server hostname no longer matches the node name.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	uninitializedNodes = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "uninitialized_nodes",
+		Help:           "Number of nodes that still have the uninitialized taint of the cloud provider, if diagnosed.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	serverHostnameDuplicatesTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "server_hostname_duplicates_total",
+		Help:           "Number of lookups of nodes by name that found more than one server with the hostname.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	serverLookupsCoalescedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "server_lookups_coalesced_total",
+		Help:           "Number of server lookups of nodes that shared a list of servers rather than calling the PhoenixNAP API.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	instanceExistsAssumedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "instance_exists_assumed_total",
+		Help:           "Number of InstanceExists calls that reported the server of a node as existing, because the PhoenixNAP API failed with a transient error.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	apiUnknownEnumValuesTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "api_unknown_enum_values_total",
+		Help:           "Number of distinct unknown values of enumerations, e.g. server statuses, returned by the PhoenixNAP API, by enumeration.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"enum"})
+	startupSyncsDelayedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "startup_syncs_delayed_total",
+		Help:           "Number of initial syncs of Services delayed to spread them over the startup of the CCM.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	ipBlocksInUse = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_blocks",
+		Help:           "Number of IP blocks purchased by the CCM for this cluster, including those pending deletion, as of the last check against maxIPBlocks.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	ipBlocksMax = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_blocks_max",
+		Help:           "Maximum number of IP blocks the CCM may purchase for this cluster; not set if unlimited.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	ipBlockListRequestsTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_block_list_requests_total",
+		Help:           "Number of calls to the PhoenixNAP API to list the IP blocks of the cluster.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	ipBlockListDuration = metrics.NewHistogram(&metrics.HistogramOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_block_list_duration_seconds",
+		Help:           "Duration of calls to the PhoenixNAP API to list the IP blocks of the cluster.",
+		Buckets:        metrics.DefBuckets,
+		StabilityLevel: metrics.ALPHA,
+	})
+	ipBlockListSize = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_block_list_size",
+		Help:           "Number of IP blocks of the cluster as of the last time they were listed.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	ipBlockCacheHitsTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_block_cache_hits_total",
+		Help:           "Number of IP block lookups served from the cache, without calling the PhoenixNAP API.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	providerErrorsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "provider_errors_total",
+		Help:           "Number of errors from the PhoenixNAP provider, by reason.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"reason"})
+	serviceNodeChangesTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "service_node_changes_total",
+		Help:           "Number of nodes added to or removed from the nodes of Services by UpdateLoadBalancer, by change.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"change"})
+	serviceNodeUpdatesSkippedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "service_node_updates_skipped_total",
+		Help:           "Number of UpdateLoadBalancer calls that did not call the load balancer implementation, because the nodes were unchanged.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	nodeSelectorEmptyTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "node_selector_empty_total",
+		Help:           "Number of reconciles of Services for which the service node selector matched none of the nodes.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	implementorRequestsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "implementor_requests_total",
+		Help:           "Number of calls to the load balancer implementation, by implementation and operation.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"scheme", "operation"})
+	implementorRequestFailuresTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "implementor_request_failures_total",
+		Help:           "Number of failed calls to the load balancer implementation, by implementation and operation.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"scheme", "operation"})
+	implementorRequestsSkippedTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "implementor_requests_skipped_total",
+		Help:           "Number of calls to the load balancer implementation skipped because the IP and nodes were unchanged, by implementation and operation.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"scheme", "operation"})
+	implementorRequestDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "implementor_request_duration_seconds",
+		Help:           "Duration of calls to the load balancer implementation, by implementation and operation.",
+		Buckets:        metrics.DefBuckets,
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"scheme", "operation"})
+	implementorCapability = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "implementor_capability",
+		Help:           "Whether the load balancer implementation supports a protocol or feature, 1 if it does, by implementation and capability.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"scheme", "capability"})
+	implementorReady = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "implementor_ready",
+		Help:           "Whether the prerequisites of the load balancer implementation exist in the cluster, 1 if they do, by implementation.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"scheme"})
+	serviceFeaturesIgnoredTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "service_features_ignored_total",
+		Help:           "Number of reconciles of Services using a feature the load balancer implementation does not support, by implementation and capability.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"scheme", "capability"})
+	backendProbeFailuresTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "backend_probe_failures_total",
+		Help:           "Number of backends of Services that failed their probe, and were not added to the load balancer implementation.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	canaryRunsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "canary_runs_total",
+		Help:           "Number of cycles of the load balancer canary, by result: success or failure.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"result"})
+	canaryDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "canary_duration_seconds",
+		Help:           "Duration of the operations of the load balancer canary, by operation: ensure or delete.",
+		Buckets:        metrics.ExponentialBuckets(0.5, 2, 10),
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"operation"})
+	canaryLastSuccess = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "canary_last_success_timestamp_seconds",
+		Help:           "Unix time of the last successful cycle of the load balancer canary.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	orphanedAnnouncements = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "orphaned_announcements",
+		Help:           "Number of IPs the load balancer implementation announces that no IP block of their Service contains, as of the last orphan check.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	orphanedAnnouncementsRemovedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "orphaned_announcements_removed_total",
+		Help:           "Number of orphaned IPs removed from the load balancer implementation by the orphan check.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	ownedResourcesSweptTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "owned_resources_swept_total",
+		Help:           "Number of Kubernetes resources of deleted Services removed by the sweeper, by kind.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"kind"})
+	ipBlocksPendingDeletion = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_blocks_pending_deletion",
+		Help:           "Number of IP blocks of the cluster released and waiting to be deleted, by status, as of the last cycle of the reaper.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"status"})
+	ipBlockPendingDeletionOldestAge = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "ip_blocks_pending_deletion_oldest_age_seconds",
+		Help:           "Seconds since the longest pending IP block of the cluster was released, as of the last cycle of the reaper; 0 if none is.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	eventsSuppressedTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "events_suppressed_total",
+		Help:           "Number of Events of Services and other objects not recorded because the same object had too many with the same reason recently, by reason.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"reason"})
+	vipConflictsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "vip_conflicts_total",
+		Help:           "Number of Service IPs not announced because they are the address of a node or the IP of another Service, by what they conflict with.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"with"})
+	gatewaySyncErrorsTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "gateway_sync_errors_total",
+		Help:           "Number of times a Gateway of the phoenixnap.com/gateway-class controller did not get its IP block or address.",
+		StabilityLevel: metrics.ALPHA,
+	})
+)
+
+func init() {
+	legacyregistry.MustRegister(
+		apiCircuitBreakerOpen,
+		apiCircuitBreakerRejectedTotal,
+		apiRateLimitWaitSeconds,
+		serverHostnameMismatches,
+		instanceExistsAssumedTotal,
+		serverLookupsCoalescedTotal,
+		serverHostnameDuplicatesTotal,
+		uninitializedNodes,
+		startupSyncsDelayedTotal,
+		apiUnknownEnumValuesTotal,
+		instanceTypeInfo,
+		apiCredentialFailuresTotal,
+		apiTokenExpiry,
+		apiTokenRefreshesTotal,
+		ipBlocksInUse,
+		ipBlocksMax,
+		ipBlockListRequestsTotal,
+		ipBlockListDuration,
+		ipBlockListSize,
+		ipBlockCacheHitsTotal,
+		providerErrorsTotal,
+		serviceNodeChangesTotal,
+		serviceNodeUpdatesSkippedTotal,
+		nodeSelectorEmptyTotal,
+		implementorRequestsTotal,
+		implementorRequestFailuresTotal,
+		implementorRequestsSkippedTotal,
+		implementorRequestDuration,
+		implementorCapability,
+		implementorReady,
+		serviceFeaturesIgnoredTotal,
+		backendProbeFailuresTotal,
+		canaryRunsTotal,
+		canaryDuration,
+		canaryLastSuccess,
+		orphanedAnnouncements,
+		orphanedAnnouncementsRemovedTotal,
+		ownedResourcesSweptTotal,
+		ipBlocksPendingDeletion,
+		ipBlockPendingDeletionOldestAge,
+		vipConflictsTotal,
+		eventsSuppressedTotal,
+		gatewaySyncErrorsTotal,
+	)
+}
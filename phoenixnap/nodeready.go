@@ -0,0 +1,199 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// heldBackServices the services for which nodes were held back until they have been Ready for
+// the node ready delay, with the earliest time one of them becomes eligible
+type heldBackServices struct {
+	mutex sync.Mutex
+	due   map[string]time.Time
+}
+
+// set records that the service has nodes held back until due, or, if due is zero, none
+func (h *heldBackServices) set(svcName string, due time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if due.IsZero() {
+		delete(h.due, svcName)
+		return
+	}
+	if h.due == nil {
+		h.due = map[string]time.Time{}
+	}
+	h.due[svcName] = due
+}
+
+// hold records that the service has nodes held back until due, unless it already has some that are due earlier
+func (h *heldBackServices) hold(svcName string, due time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if existing, ok := h.due[svcName]; ok && existing.Before(due) {
+		return
+	}
+	if h.due == nil {
+		h.due = map[string]time.Time{}
+	}
+	h.due[svcName] = due
+}
+
+// ready returns the services with held back nodes that are eligible by now
+func (h *heldBackServices) ready(now time.Time) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var names []string
+	for name, due := range h.due {
+		if !now.Before(due) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// nodeReadySince returns when the node last became Ready, or false if it is not Ready
+func nodeReadySince(node *v1.Node) (time.Time, bool) {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			return cond.LastTransitionTime.Time, cond.Status == v1.ConditionTrue
+		}
+	}
+	return time.Time{}, false
+}
+
+// eligibleNodes returns the nodes that may announce the IP of the service: those matching the
+// node selector and, if the node ready delay is set, Ready for at least that long. If any nodes
+// are held back, the service is updated again once they are eligible.
+func (l *loadBalancers) eligibleNodes(service *v1.Service, nodes []*v1.Node) []*v1.Node {
+	nodes = l.selectNodes(service, nodes)
+	if l.nodeReadyDelay <= 0 {
+		// none held back for readiness; backends that fail their probe are held back again after this
+		l.heldBack.set(serviceRep(service), time.Time{})
+		return nodes
+	}
+	now := l.clock.Now()
+	var (
+		eligible []*v1.Node
+		due      time.Time
+	)
+	for _, node := range nodes {
+		since, ready := nodeReadySince(node)
+		switch {
+		case !ready:
+			// the service controller updates the service when it becomes Ready
+			klog.V(2).Infof("node %s is not Ready, so does not announce the IP of service %s", node.Name, serviceRep(service))
+		case now.Sub(since) < l.nodeReadyDelay:
+			klog.V(2).Infof("node %s Ready since %s, holding back from service %s for %s", node.Name, since.Format(time.RFC3339), serviceRep(service), l.nodeReadyDelay)
+			if eligibleAt := since.Add(l.nodeReadyDelay); due.IsZero() || eligibleAt.Before(due) {
+				due = eligibleAt
+			}
+		default:
+			eligible = append(eligible, node)
+		}
+	}
+	l.heldBack.set(serviceRep(service), due)
+	return eligible
+}
+
+// selectNodes returns the nodes matching the node selector. If it matches none of them, this is
+// recorded in an Event and a metric, and, with the fallback enabled, all Ready worker nodes are returned.
+func (l *loadBalancers) selectNodes(service *v1.Service, nodes []*v1.Node) []*v1.Node {
+	selected := filterNodes(nodes, l.nodeSelector)
+	if len(selected) > 0 || len(nodes) == 0 || l.nodeSelector.Empty() {
+		return selected
+	}
+	nodeSelectorEmptyTotal.Inc()
+	msg := fmt.Sprintf("node selector %q matches none of the %d nodes, so nothing announces the IP", l.nodeSelector, len(nodes))
+	if l.nodeSelectorFallback {
+		for _, node := range nodes {
+			if _, ready := nodeReadySince(node); ready && !isControlPlaneNode(node) {
+				selected = append(selected, node)
+			}
+		}
+		msg = fmt.Sprintf("node selector %q matches none of the %d nodes, announcing from all %d Ready worker nodes instead", l.nodeSelector, len(nodes), len(selected))
+	}
+	klog.Warningf("service %s: %s", serviceRep(service), msg)
+	if l.recorder != nil {
+		l.recorder.Event(service, v1.EventTypeWarning, eventReasonNodeSelectorEmpty, msg)
+	}
+	return selected
+}
+
+// startNodeReadyRecheck periodically updates the services whose held back nodes have become
+// eligible, as the service controller does not call again just because time passed
+func (l *loadBalancers) startNodeReadyRecheck() {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := l.clock.NewTicker(nodeReadyRecheckSeconds * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping node ready recheck")
+				return
+			case <-ticker.C():
+			}
+			l.recheckHeldBack(withSubsystem(l.ctx, subsystemLoadBalancer))
+		}
+	}()
+}
+
+// balancerNodes lists the nodes as the service controller passes them to the load balancer: all but those
+// labeled to be excluded from load balancers
+func (l *loadBalancers) balancerNodes(ctx context.Context) ([]*v1.Node, error) {
+	list, err := l.k8sclient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	var nodes []*v1.Node
+	for i := range list.Items {
+		if _, excluded := list.Items[i].Labels[v1.LabelNodeExcludeBalancers]; !excluded {
+			nodes = append(nodes, &list.Items[i])
+		}
+	}
+	return nodes, nil
+}
+
+// recheckHeldBack updates each service whose held back nodes have become eligible, with the current nodes
+func (l *loadBalancers) recheckHeldBack(ctx context.Context) {
+	names := l.heldBack.ready(l.clock.Now())
+	if len(names) == 0 {
+		return
+	}
+	nodes, err := l.balancerNodes(ctx)
+	if err != nil {
+		klog.Errorf("unable to recheck held back nodes: %v", err)
+		return
+	}
+	for _, name := range names {
+		namespace, svcName, _ := strings.Cut(name, "/")
+		svc, err := l.k8sclient.CoreV1().Services(namespace).Get(ctx, svcName, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err) || (err == nil && svc.Spec.Type != v1.ServiceTypeLoadBalancer):
+			l.heldBack.set(name, time.Time{})
+			continue
+		case err != nil:
+			klog.Errorf("unable to get service %s to recheck held back nodes: %v", name, err)
+			continue
+		}
+		if l.nodeSets.ip(name) == "" {
+			// not yet added to the implementation; the service controller retries EnsureLoadBalancer
+			continue
+		}
+		klog.V(2).Infof("held back nodes of service %s are eligible, updating", name)
+		if err := l.UpdateLoadBalancer(ctx, "", svc, nodes); err != nil {
+			klog.Errorf("unable to update service %s with held back nodes: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package phoenixnap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/component-base/metrics/testutil"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+// testReadyNode a node that became Ready at since; not Ready if since is zero
+func testReadyNode(name string, since time.Time) *v1.Node {
+	node := testNode("phoenixnap://"+name, name)
+	status := v1.ConditionTrue
+	if since.IsZero() {
+		status = v1.ConditionFalse
+	}
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: status, LastTransitionTime: metav1.NewTime(since)}}
+	return node
+}
+
+func TestEligibleNodesReadyDelay(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	now := time.Now()
+	nodes := []*v1.Node{
+		testReadyNode("node1", now.Add(-time.Hour)),
+		testReadyNode("node2", now.Add(-10*time.Second)),
+		testReadyNode("node3", time.Time{}),
+	}
+
+	// no delay, all are passed on, as the service controller already only passes Ready nodes
+	if eligible := l.eligibleNodes(svc, nodes); len(eligible) != 3 {
+		t.Errorf("mismatched eligible nodes without delay, actual %d expected %d", len(eligible), 3)
+	}
+
+	l.nodeReadyDelay = time.Minute
+	eligible := l.eligibleNodes(svc, nodes)
+	if len(eligible) != 1 || eligible[0].Name != "node1" {
+		t.Errorf("mismatched eligible nodes, actual %v expected %v", eligible, []string{"node1"})
+	}
+	if names := l.heldBack.ready(now); len(names) != 0 {
+		t.Errorf("service due before the held back node is eligible: %v", names)
+	}
+	if names := l.heldBack.ready(now.Add(time.Minute)); len(names) != 1 || names[0] != "default/svc1" {
+		t.Errorf("mismatched due services, actual %v expected %v", names, []string{"default/svc1"})
+	}
+
+	// once all are eligible, the service no longer is held back
+	l.eligibleNodes(svc, nodes[:1])
+	if names := l.heldBack.ready(now.Add(time.Minute)); len(names) != 0 {
+		t.Errorf("service still held back: %v", names)
+	}
+}
+
+func TestRecheckHeldBack(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+	l.nodeReadyDelay = time.Minute
+	now := time.Now()
+	clock := testingclock.NewFakeClock(now)
+	l.clock = clock
+	nodes := []*v1.Node{testReadyNode("node1", now.Add(-time.Hour)), testReadyNode("node2", now.Add(-10*time.Second))}
+	for _, node := range nodes {
+		if _, err := l.k8sclient.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unable to create node: %v", err)
+		}
+	}
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := lb.nodes["default/svc1"]; strings.Join(actual, ",") != "node1" {
+		t.Errorf("mismatched nodes, actual %v expected %v", actual, []string{"node1"})
+	}
+
+	// not yet due, nothing changes
+	l.recheckHeldBack(context.TODO())
+	if actual := lb.nodes["default/svc1"]; strings.Join(actual, ",") != "node1" {
+		t.Errorf("mismatched nodes before due, actual %v expected %v", actual, []string{"node1"})
+	}
+
+	// node2 has been Ready long enough
+	clock.Step(50 * time.Second)
+	l.recheckHeldBack(context.TODO())
+	if actual := lb.nodes["default/svc1"]; strings.Join(actual, ",") != "node1,node2" {
+		t.Errorf("mismatched nodes after due, actual %v expected %v", actual, []string{"node1", "node2"})
+	}
+	if names := l.heldBack.ready(clock.Now().Add(time.Hour)); len(names) != 0 {
+		t.Errorf("service still held back: %v", names)
+	}
+}
+
+func TestSelectNodesEmptySelector(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+	l.nodeSelector, _ = labels.Parse("role=gateway")
+	worker := testReadyNode("worker", time.Now().Add(-time.Hour))
+	notReady := testReadyNode("not-ready", time.Time{})
+	controlPlane := testReadyNode("control-plane", time.Now().Add(-time.Hour))
+	controlPlane.Labels = map[string]string{labelControlPlane: ""}
+	nodes := []*v1.Node{worker, notReady, controlPlane}
+
+	before, _ := testutil.GetCounterMetricValue(nodeSelectorEmptyTotal)
+	if selected := l.selectNodes(svc, nodes); len(selected) != 0 {
+		t.Errorf("mismatched nodes without fallback, actual %d expected %d", len(selected), 0)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonNodeSelectorEmpty) {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+	if after, _ := testutil.GetCounterMetricValue(nodeSelectorEmptyTotal); after != before+1 {
+		t.Errorf("mismatched metric, actual %v expected %v", after, before+1)
+	}
+
+	l.nodeSelectorFallback = true
+	selected := l.selectNodes(svc, nodes)
+	if len(selected) != 1 || selected[0].Name != "worker" {
+		t.Errorf("mismatched fallback nodes, actual %v expected %v", selected, []string{"worker"})
+	}
+
+	// the event of the fallback
+	<-recorder.Events
+
+	// a match is not reported
+	worker.Labels = map[string]string{"role": "gateway"}
+	if selected := l.selectNodes(svc, nodes); len(selected) != 1 {
+		t.Errorf("mismatched selected nodes, actual %d expected %d", len(selected), 1)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("unexpected event %s", event)
+	default:
+	}
+}
@@ -0,0 +1,137 @@
+package phoenixnap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+)
+
+// pushedService what was last passed to the implementation for a Service
+type pushedService struct {
+	ip    string
+	names map[string]bool
+	// ports the ports, see portKeys
+	ports []string
+	// hash of the IP, the ports and the nodes, see contentHash
+	hash string
+}
+
+// serviceNodeSets what was last passed to the implementation for each Service, so that updates can
+// report which nodes changed, and calls whose content is unchanged can be skipped
+type serviceNodeSets struct {
+	mutex sync.Mutex
+	sets  map[string]pushedService
+}
+
+// contentHash hashes everything about ip, ports and nodes the implementation may act on
+func contentHash(ip string, ports []loadbalancers.Port, nodes []loadbalancers.Node) string {
+	lines := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		var addresses []string
+		for _, address := range node.Node.Status.Addresses {
+			addresses = append(addresses, fmt.Sprintf("%s=%s", address.Type, address.Address))
+		}
+		sort.Strings(addresses)
+		// and what is known of its server
+		server := fmt.Sprintf("%s %s %s %s %s %s", node.ServerID, node.Location, strings.Join(node.PublicIPs, ","),
+			strings.Join(node.PrivateIPs, ","), strings.Join(node.BGP.SourceIPs, ","), node.BGP.PeerIP)
+		lines = append(lines, fmt.Sprintf("%s %s %s %s", node.Node.Name, node.Node.Spec.ProviderID, strings.Join(addresses, ","), server))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(ip + "\n" + strings.Join(portKeys(ports), ",") + "\n" + strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// set records ip, ports and nodes as passed to the implementation for the service
+func (s *serviceNodeSets) set(service, ip string, ports []loadbalancers.Port, nodes []loadbalancers.Node) {
+	names := map[string]bool{}
+	for _, node := range nodes {
+		names[node.Node.Name] = true
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.sets == nil {
+		s.sets = map[string]pushedService{}
+	}
+	s.sets[service] = pushedService{ip: ip, names: names, ports: portKeys(ports), hash: contentHash(ip, ports, nodes)}
+}
+
+// setNodes same as set, keeping the recorded IP of the service
+func (s *serviceNodeSets) setNodes(service string, ports []loadbalancers.Port, nodes []loadbalancers.Node) {
+	s.set(service, s.ip(service), ports, nodes)
+}
+
+// ip the recorded IP of the service, empty if unknown
+func (s *serviceNodeSets) ip(service string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sets[service].ip
+}
+
+// unchanged returns true if ip, ports and nodes are exactly what was last passed to the implementation for the service
+func (s *serviceNodeSets) unchanged(service, ip string, ports []loadbalancers.Port, nodes []loadbalancers.Node) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pushed, ok := s.sets[service]
+	return ok && pushed.hash == contentHash(ip, ports, nodes)
+}
+
+// portsDiff returns the ports that were added and removed, compared to the recorded ports of the service, see
+// portKeys. known is false if nothing is recorded for it.
+func (s *serviceNodeSets) portsDiff(service string, ports []loadbalancers.Port) (added, removed []string, known bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pushed, known := s.sets[service]
+	previous := map[string]bool{}
+	for _, key := range pushed.ports {
+		previous[key] = true
+	}
+	current := map[string]bool{}
+	for _, key := range portKeys(ports) {
+		current[key] = true
+		if !previous[key] {
+			added = append(added, key)
+		}
+	}
+	for _, key := range pushed.ports {
+		if !current[key] {
+			removed = append(removed, key)
+		}
+	}
+	return added, removed, known
+}
+
+// diff returns the names of the nodes that were added and removed, compared to the recorded nodes
+// of the service, sorted. known is false if no nodes are recorded for it, e.g. after a restart.
+func (s *serviceNodeSets) diff(service string, nodes []loadbalancers.Node) (added, removed []string, known bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pushed, known := s.sets[service]
+	current := map[string]bool{}
+	for _, node := range nodes {
+		current[node.Node.Name] = true
+		if !pushed.names[node.Node.Name] {
+			added = append(added, node.Node.Name)
+		}
+	}
+	for name := range pushed.names {
+		if !current[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed, known
+}
+
+// forget drops the record of the service
+func (s *serviceNodeSets) forget(service string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sets, service)
+}
@@ -0,0 +1,67 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestContentHash(t *testing.T) {
+	node1, node2 := testNode("phoenixnap://node1", "node1"), testNode("phoenixnap://node2", "node2")
+	nodes := []loadbalancers.Node{{Node: node1}, {Node: node2}}
+	hash := contentHash("192.0.2.10/32", nil, nodes)
+
+	if actual := contentHash("192.0.2.10/32", nil, []loadbalancers.Node{{Node: node2}, {Node: node1}}); actual != hash {
+		t.Errorf("hash depends on the order of the nodes")
+	}
+	if actual := contentHash("192.0.2.11/32", nil, nodes); actual == hash {
+		t.Errorf("hash does not depend on the IP")
+	}
+	moved := node2.DeepCopy()
+	moved.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.2"}}
+	if actual := contentHash("192.0.2.10/32", nil, []loadbalancers.Node{{Node: node1}, {Node: moved}}); actual == hash {
+		t.Errorf("hash does not depend on the node addresses")
+	}
+	withServer := []loadbalancers.Node{{Node: node1}, {Node: node2, ServerID: "server2", BGP: loadbalancers.BGPPeer{PeerIP: "198.51.100.1"}}}
+	if actual := contentHash("192.0.2.10/32", nil, withServer); actual == hash {
+		t.Errorf("hash does not depend on the server of the nodes")
+	}
+	ports := []loadbalancers.Port{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}}
+	if actual := contentHash("192.0.2.10/32", ports, nodes); actual == hash {
+		t.Errorf("hash does not depend on the ports")
+	}
+}
+
+func TestEnsureLoadBalancerSkipsUnchanged(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+	node := testNode("phoenixnap://node1", "node1")
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, []*v1.Node{node}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a resync with the same content does not call the implementation
+	lb.ips = map[string]string{}
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, []*v1.Node{node}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.ips["default/svc1"]; ok {
+		t.Errorf("implementation called for unchanged service")
+	}
+
+	// same node, new address
+	moved := node.DeepCopy()
+	moved.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.2"}}
+	lb.nodes = map[string][]string{}
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, []*v1.Node{moved}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.nodes["default/svc1"]; !ok {
+		t.Errorf("implementation not called for changed node addresses")
+	}
+}
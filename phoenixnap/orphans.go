@@ -0,0 +1,162 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// The state of an implementation that keeps it in the cluster, e.g. the kube-vip annotations of a Service, may
+// outlive the IP block it was for, e.g. if the block was deleted in the PhoenixNAP portal, or the CCM was
+// stopped while it removed a Service. The IP still is announced, though no longer routed to the cluster, or
+// even in use by another customer. The orphan check compares the state against the IP blocks, and flags the IPs
+// that no active block of their Service contains, and, with cleanup enabled, removes them from the implementation.
+
+// findOrphans returns the announcements of the implementation that no active IP block of their Service
+// contains. Those of the control plane IP and of Services with external IPs, which are not from IP blocks,
+// are skipped.
+func (l *loadBalancers) findOrphans(ctx context.Context, lister loadbalancers.Lister) ([]loadbalancers.Announcement, error) {
+	var announcements []loadbalancers.Announcement
+	if err := l.callImplementor(implementorOpListAnnouncements, func() (err error) {
+		announcements, err = lister.ListAnnouncements(ctx)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("unable to list announcements of implementation: %w", err)
+	}
+	var orphans []loadbalancers.Announcement
+	for _, announcement := range announcements {
+		orphaned, err := l.isOrphan(ctx, announcement)
+		if err != nil {
+			return nil, err
+		}
+		if orphaned {
+			orphans = append(orphans, announcement)
+		}
+	}
+	return orphans, nil
+}
+
+// isOrphan returns whether no active IP block of the Service of the announcement contains its IP
+func (l *loadBalancers) isOrphan(ctx context.Context, announcement loadbalancers.Announcement) (bool, error) {
+	if announcement.Namespace == controlPlaneServiceNamespace && announcement.Name == controlPlaneServiceName {
+		return false, nil
+	}
+	svc, err := l.k8sclient.CoreV1().Services(announcement.Namespace).Get(ctx, announcement.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return false, fmt.Errorf("unable to get service %s/%s: %w", announcement.Namespace, announcement.Name, err)
+	case externalIPsMode(svc):
+		return false, nil
+	}
+	ip, err := netip.ParseAddr(announcement.IP)
+	if err != nil {
+		// not an IP the CCM set, so not for it to judge
+		klog.V(2).Infof("service %s/%s has invalid announced IP %q: %v", announcement.Namespace, announcement.Name, announcement.IP, err)
+		return false, nil
+	}
+	blocks, err := l.getIPBlocks(ctx, announcement.Namespace, announcement.Name, true, false)
+	if err != nil {
+		return false, fmt.Errorf("unable to retrieve IP blocks of service %s/%s: %w", announcement.Namespace, announcement.Name, err)
+	}
+	secondary, err := l.secondaryBlocks(ctx, announcement.Namespace, announcement.Name)
+	if err != nil {
+		return false, fmt.Errorf("unable to retrieve secondary IP blocks of service %s/%s: %w", announcement.Namespace, announcement.Name, err)
+	}
+	blocks = append(blocks, secondary...)
+	for _, block := range blocks {
+		prefix, err := blockPrefix(block)
+		if err != nil || prefix.Contains(ip) {
+			// a block still being provisioned may be the one
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkOrphans flags the orphaned announcements of the implementation, if it can list them, in a metric, a log
+// and an Event on their Service, and, with cleanup enabled, removes each that still is orphaned under the lock of
+// its Service
+func (l *loadBalancers) checkOrphans(ctx context.Context) error {
+	lister, ok := l.implementor.(loadbalancers.Lister)
+	if !ok {
+		return nil
+	}
+	// the blocks must be current, not those from before a Service was last ensured
+	l.blockCache.invalidate()
+	orphans, err := l.findOrphans(ctx, lister)
+	if err != nil {
+		return err
+	}
+	orphanedAnnouncements.Set(float64(len(orphans)))
+	for _, orphan := range orphans {
+		svcName := orphan.Namespace + "/" + orphan.Name
+		msg := fmt.Sprintf("implementation %s announces IP %s, which no IP block of the service contains", l.implementorScheme, orphan.IP)
+		klog.Warningf("service %s: %s", svcName, msg)
+		svc, err := l.k8sclient.CoreV1().Services(orphan.Namespace).Get(ctx, orphan.Name, metav1.GetOptions{})
+		if err == nil && l.recorder != nil {
+			l.recorder.Event(svc, v1.EventTypeWarning, eventReasonOrphanedAnnouncement, msg)
+		}
+		if !l.orphanCleanup {
+			continue
+		}
+		if err := l.removeOrphan(ctx, orphan); err != nil {
+			klog.Errorf("unable to remove orphaned IP %s of service %s from implementation: %v", orphan.IP, svcName, err)
+		}
+	}
+	return nil
+}
+
+// removeOrphan removes the Service of the announcement from the implementation, if it still is orphaned once
+// its Service is locked, e.g. not since given an IP block
+func (l *loadBalancers) removeOrphan(ctx context.Context, orphan loadbalancers.Announcement) error {
+	svcName := orphan.Namespace + "/" + orphan.Name
+	unlock := l.serviceLocks.lock(svcName)
+	defer unlock()
+	l.blockCache.invalidate()
+	orphaned, err := l.isOrphan(ctx, orphan)
+	if err != nil || !orphaned {
+		return err
+	}
+	allocations := []loadbalancers.Allocation{{IP: fmt.Sprintf("%s/32", orphan.IP)}}
+	if err := l.callImplementor(implementorOpRemoveService, func() error {
+		return l.implementor.RemoveService(ctx, orphan.Namespace, orphan.Name, allocations)
+	}); err != nil {
+		return err
+	}
+	l.nodeSets.forget(svcName)
+	orphanedAnnouncementsRemovedTotal.Inc()
+	klog.Infof("removed orphaned IP %s of service %s from implementation %s", orphan.IP, svcName, l.implementorScheme)
+	return nil
+}
+
+// startOrphanCheck checks for orphaned announcements of the implementation every interval, until the
+// loadBalancers are stopped
+func (l *loadBalancers) startOrphanCheck(interval time.Duration) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping orphan check")
+				return
+			case <-ticker.C:
+			}
+			if err := l.checkOrphans(withSubsystem(l.ctx, subsystemLoadBalancer)); err != nil {
+				klog.Errorf("unable to check for orphaned announcements: %v", err)
+			}
+		}
+	}()
+}
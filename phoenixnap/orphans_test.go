@@ -0,0 +1,72 @@
+package phoenixnap
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+)
+
+// testListerLB a testRecordingLB that lists what it records as announcements
+type testListerLB struct {
+	testRecordingLB
+}
+
+func (t *testListerLB) ListAnnouncements(ctx context.Context) ([]loadbalancers.Announcement, error) {
+	var announcements []loadbalancers.Announcement
+	for svcName, ip := range t.ips {
+		namespace, name, _ := strings.Cut(svcName, "/")
+		announcements = append(announcements, loadbalancers.Announcement{Namespace: namespace, Name: name, IP: strings.SplitN(ip, "/", 2)[0]})
+	}
+	sort.Slice(announcements, func(i, j int) bool { return announcements[i].Name < announcements[j].Name })
+	return announcements, nil
+}
+
+func TestCheckOrphans(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+	l, _, recorder := testGetLoadBalancers(t, 0, svc1, svc2)
+	lb := &testListerLB{testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}}
+	l.implementor = lb
+	ctx := context.TODO()
+
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc1, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// left over in the implementation without a block, e.g. deleted in the portal
+	lb.ips["default/svc2"] = "198.51.100.7/32"
+	// the control plane IP is not from a block
+	lb.ips[controlPlaneServiceNamespace+"/"+controlPlaneServiceName] = "198.51.100.8/32"
+
+	orphans, err := l.findOrphans(ctx, lb)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []loadbalancers.Announcement{{Namespace: "default", Name: "svc2", IP: "198.51.100.7"}}
+	if len(orphans) != 1 || orphans[0] != expected[0] {
+		t.Fatalf("mismatched orphans, actual %v expected %v", orphans, expected)
+	}
+
+	// flagged only
+	if err := l.checkOrphans(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := testCountEvents(testDrainEvents(recorder), eventReasonOrphanedAnnouncement); count != 1 {
+		t.Errorf("mismatched %s events, actual %d expected %d", eventReasonOrphanedAnnouncement, count, 1)
+	}
+	if _, ok := lb.ips["default/svc2"]; !ok {
+		t.Errorf("orphan removed without cleanup")
+	}
+
+	l.orphanCleanup = true
+	if err := l.checkOrphans(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.ips["default/svc2"]; ok {
+		t.Errorf("orphan not removed with cleanup")
+	}
+	if _, ok := lb.ips["default/svc1"]; !ok {
+		t.Errorf("service with a block removed")
+	}
+}
@@ -0,0 +1,119 @@
+package phoenixnap
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// The Kubernetes resources the CCM keeps for a Service, e.g. its VIP firewall ConfigMap and its Lease, are in the
+// implementor namespace, which an owner reference cannot cross, so they are labeled with the cluster ID and the UID
+// of the Service instead. They are deleted with the load balancer of the Service; the sweeper deletes those whose
+// Service was deleted while the CCM was down. The implementation keeps no such resources: kube-vip annotates the
+// Service itself, and its BGP password Secret and Node annotations belong to the nodes, not to a Service.
+
+// clusterIDLabelValue returns the cluster ID as a label value: as is, or, if it is not a valid one, e.g. too long,
+// its hash
+func clusterIDLabelValue(clusterID string) string {
+	if len(validation.IsValidLabelValue(clusterID)) == 0 {
+		return clusterID
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(clusterID)))[:validation.LabelValueMaxLength]
+}
+
+// serviceOwnerLabels returns the labels of a Kubernetes resource the CCM keeps for the service, which link it to
+// the service by its UID, as an owner reference cannot cross namespaces
+func (l *loadBalancers) serviceOwnerLabels(service *v1.Service) map[string]string {
+	return map[string]string{
+		labelClusterID:  clusterIDLabelValue(l.clusterID()),
+		labelServiceUID: string(service.UID),
+	}
+}
+
+// startOwnerSweeper sweeps the resources of deleted Services every ownerSweepSeconds, until the loadBalancers are
+// stopped
+func (l *loadBalancers) startOwnerSweeper() {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(ownerSweepSeconds * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.ctx.Done():
+				klog.V(2).Info("loadBalancers: stopping owner sweeper")
+				return
+			case <-ticker.C:
+			}
+			if err := l.sweepOwnedResources(l.ctx); err != nil {
+				klog.Errorf("unable to sweep the resources of deleted services: %v", err)
+			}
+		}
+	}()
+}
+
+// sweepOwnedResources deletes the ConfigMaps and Leases in the implementor namespace labeled with the cluster ID
+// and the UID of a Service that no longer exists. Leases still held are kept. The resources are listed before the
+// Services, so that one created for a new Service meanwhile is never deleted.
+func (l *loadBalancers) sweepOwnedResources(ctx context.Context) error {
+	clusterID, err := l.cluster.get(ctx)
+	if err != nil {
+		return err
+	}
+	selector := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s,%s", labelClusterID, clusterIDLabelValue(clusterID), labelServiceUID)}
+	configMaps, err := l.k8sclient.CoreV1().ConfigMaps(l.namespace).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("unable to list configmaps: %w", err)
+	}
+	leases, err := l.k8sclient.CoordinationV1().Leases(l.namespace).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("unable to list leases: %w", err)
+	}
+	services, err := l.k8sclient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list services: %w", err)
+	}
+	exists := map[string]bool{}
+	for _, svc := range services.Items {
+		exists[string(svc.UID)] = true
+	}
+	deleted := func(labels map[string]string) bool {
+		uid := labels[labelServiceUID]
+		return uid != "" && !exists[uid]
+	}
+
+	var errs []error
+	for _, cm := range configMaps.Items {
+		if !deleted(cm.Labels) {
+			continue
+		}
+		if err := l.k8sclient.CoreV1().ConfigMaps(l.namespace).Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("unable to delete configmap %s/%s: %w", l.namespace, cm.Name, err))
+			continue
+		}
+		ownedResourcesSweptTotal.WithLabelValues("ConfigMap").Inc()
+		klog.Infof("deleted configmap %s/%s of deleted service %s", l.namespace, cm.Name, cm.Labels[labelServiceUID])
+	}
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if !deleted(lease.Labels) || held(lease, l.clock.Now()) {
+			continue
+		}
+		if err := l.k8sclient.CoordinationV1().Leases(l.namespace).Delete(ctx, lease.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("unable to delete lease %s/%s: %w", l.namespace, lease.Name, err))
+			continue
+		}
+		ownedResourcesSweptTotal.WithLabelValues("Lease").Inc()
+		klog.Infof("deleted lease %s/%s of deleted service %s", l.namespace, lease.Name, lease.Labels[labelServiceUID])
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,99 @@
+package phoenixnap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestClusterIDLabelValue(t *testing.T) {
+	if value := clusterIDLabelValue(testClusterID); value != testClusterID {
+		t.Errorf("mismatched value of a valid cluster ID, actual %s expected %s", value, testClusterID)
+	}
+	for _, id := range []string{strings.Repeat("a", 64), "cluster/one"} {
+		value := clusterIDLabelValue(id)
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			t.Errorf("invalid value %q of cluster ID %q: %v", value, id, errs)
+		}
+		if value != clusterIDLabelValue(id) {
+			t.Errorf("value of cluster ID %q is not stable", id)
+		}
+	}
+}
+
+func TestSweepOwnedResources(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.UID = types.UID("live")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	ctx := context.TODO()
+	owned := func(cluster, uid string) map[string]string {
+		return map[string]string{labelClusterID: cluster, labelServiceUID: uid}
+	}
+	configMaps := l.k8sclient.CoreV1().ConfigMaps(l.namespace)
+	leases := l.k8sclient.CoordinationV1().Leases(l.namespace)
+	for name, labels := range map[string]map[string]string{
+		"live":          owned(testClusterID, "live"),
+		"deleted":       owned(testClusterID, "gone"),
+		"other-cluster": owned("other", "gone"),
+	} {
+		if _, err := configMaps.Create(ctx, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unable to create configmap %s: %v", name, err)
+		}
+	}
+	holder := "other-ccm"
+	seconds := int32(60)
+	renewed := metav1.MicroTime{Time: l.clock.Now()}
+	for name, spec := range map[string]coordinationv1.LeaseSpec{
+		"released": {},
+		"held":     {HolderIdentity: &holder, LeaseDurationSeconds: &seconds, RenewTime: &renewed},
+	} {
+		lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: owned(testClusterID, "gone")}, Spec: spec}
+		if _, err := leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unable to create lease %s: %v", name, err)
+		}
+	}
+
+	if err := l.sweepOwnedResources(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, kept := range map[string]bool{"live": true, "deleted": false, "other-cluster": true} {
+		if _, err := configMaps.Get(ctx, name, metav1.GetOptions{}); (err == nil) != kept || (err != nil && !apierrors.IsNotFound(err)) {
+			t.Errorf("configmap %s: mismatched kept, expected %t, error %v", name, kept, err)
+		}
+	}
+	for name, kept := range map[string]bool{"released": false, "held": true} {
+		if _, err := leases.Get(ctx, name, metav1.GetOptions{}); (err == nil) != kept || (err != nil && !apierrors.IsNotFound(err)) {
+			t.Errorf("lease %s: mismatched kept, expected %t, error %v", name, kept, err)
+		}
+	}
+}
+
+func TestLeaseLockOwnerLabels(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.UID = types.UID("1234")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	lock := newLeaseLock(l.k8sclient, l.namespace)
+	lock.retry = 10 * time.Millisecond
+	lock.labels = l.serviceOwnerLabels
+
+	release, err := lock.acquire(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("unexpected error acquiring: %v", err)
+	}
+	release(false)
+	lease, err := l.k8sclient.CoordinationV1().Leases(l.namespace).Get(context.TODO(), leaseName(svc), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("lease not kept: %v", err)
+	}
+	if lease.Labels[labelClusterID] != testClusterID || lease.Labels[labelServiceUID] != "1234" {
+		t.Errorf("mismatched owner labels, actual %v", lease.Labels)
+	}
+}
@@ -0,0 +1,97 @@
+package phoenixnap
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/metadataproxy"
+)
+
+// pendingDeletions the IP blocks of the cluster that are released, and so wait for the reaper to unassign and
+// delete them, as of its last cycle, for metrics and the metadata proxy. A block may stay there, e.g. if the
+// PhoenixNAP API fails to unassign it, or it is not in the reaper scope, and is billed until it is deleted.
+type pendingDeletions struct {
+	mutex  sync.Mutex
+	blocks []metadataproxy.PendingDeletion
+	// firstSeen when the reaper first saw each released block without a release time, as released by
+	// earlier versions, by ID
+	firstSeen map[string]time.Time
+}
+
+// recordPendingDeletions replaces the pending deletions with the released blocks, as of now, and updates the metrics
+func (l *loadBalancers) recordPendingDeletions(blocks []ipapi.IpBlock, now time.Time) {
+	p := &l.pendingDeletions
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.firstSeen == nil {
+		p.firstSeen = map[string]time.Time{}
+	}
+	seen := map[string]time.Time{}
+	pending := make([]metadataproxy.PendingDeletion, 0, len(blocks))
+	byStatus := map[string]int{}
+	var oldest time.Duration
+	for _, block := range blocks {
+		if !l.ownsBlock(block) {
+			continue
+		}
+		releasedAt := blockReleasedAt(block)
+		if releasedAt.IsZero() {
+			if first, ok := p.firstSeen[block.Id]; ok {
+				releasedAt = first
+			} else {
+				releasedAt = now
+			}
+			seen[block.Id] = releasedAt
+		}
+		service, _ := blockTagValue(block, releasedServiceTag)
+		age := now.Sub(releasedAt)
+		if age > oldest {
+			oldest = age
+		}
+		status := blockStatus(block)
+		byStatus[status]++
+		pending = append(pending, metadataproxy.PendingDeletion{
+			BlockID:       block.Id,
+			CIDR:          block.Cidr,
+			Location:      block.Location,
+			Status:        status,
+			Service:       service,
+			ReleasedAt:    releasedAt,
+			AgeSeconds:    int64(age.Seconds()),
+			InReaperScope: l.reaperScope.includes(block),
+		})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ReleasedAt.Before(pending[j].ReleasedAt) })
+	p.blocks = pending
+	p.firstSeen = seen
+
+	ipBlocksPendingDeletion.Reset()
+	for status, count := range byStatus {
+		ipBlocksPendingDeletion.WithLabelValues(status).Set(float64(count))
+	}
+	ipBlockPendingDeletionOldestAge.Set(oldest.Seconds())
+}
+
+// list returns the pending deletions as of the last cycle of the reaper, oldest first
+func (p *pendingDeletions) list(ctx context.Context) ([]metadataproxy.PendingDeletion, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]metadataproxy.PendingDeletion(nil), p.blocks...), nil
+}
+
+// blockReleasedAt returns when the block was released, from the value of its delete tag, or zero if it has none
+func blockReleasedAt(block ipapi.IpBlock) time.Time {
+	value, ok := blockTagValue(block, deleteTag)
+	if !ok {
+		return time.Time{}
+	}
+	releasedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// "true", as set by earlier versions
+		return time.Time{}
+	}
+	return releasedAt
+}
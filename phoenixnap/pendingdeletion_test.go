@@ -0,0 +1,63 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+)
+
+func TestPendingDeletions(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	ctx := context.TODO()
+
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.EnsureLoadBalancerDeleted(ctx, "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks, err := l.getIPBlocks(ctx, "", "", false, true)
+	if err != nil || len(blocks) != 1 {
+		t.Fatalf("expected one released block, got %d: %v", len(blocks), err)
+	}
+	releasedAt := blockReleasedAt(blocks[0])
+	if releasedAt.IsZero() {
+		t.Fatalf("expected the release time in the %s tag", deleteTag)
+	}
+
+	l.recordPendingDeletions(blocks, releasedAt.Add(time.Hour))
+	pending, _ := l.pendingDeletions.list(ctx)
+	if len(pending) != 1 {
+		t.Fatalf("mismatched pending deletions, actual %d expected %d", len(pending), 1)
+	}
+	if pending[0].BlockID != blocks[0].Id || pending[0].Service != "default/svc1" || pending[0].AgeSeconds != 3600 || !pending[0].InReaperScope {
+		t.Errorf("mismatched pending deletion: %+v", pending[0])
+	}
+
+	l.recordPendingDeletions(nil, time.Now())
+	if pending, _ := l.pendingDeletions.list(ctx); len(pending) != 0 {
+		t.Errorf("mismatched pending deletions once deleted, actual %d expected %d", len(pending), 0)
+	}
+}
+
+func TestPendingDeletionsLegacyTag(t *testing.T) {
+	l, _, _ := testGetLoadBalancers(t, 0)
+	usage, cluster, valtrue := pnapValue, testClusterID, "true"
+	block := ipapi.IpBlock{Id: "block1", Cidr: "203.0.113.8/29", Tags: []ipapi.TagAssignment{
+		{Name: pnapTag, Value: &usage},
+		{Name: clusterTagName, Value: &cluster},
+		{Name: deleteTag, Value: &valtrue},
+	}}
+	first := time.Now()
+
+	// without a release time, the age counts from when the block was first seen
+	l.recordPendingDeletions([]ipapi.IpBlock{block}, first)
+	l.recordPendingDeletions([]ipapi.IpBlock{block}, first.Add(time.Minute))
+	pending, _ := l.pendingDeletions.list(context.TODO())
+	if len(pending) != 1 || pending[0].AgeSeconds != 60 || !pending[0].ReleasedAt.Equal(first) {
+		t.Errorf("mismatched pending deletions: %+v", pending)
+	}
+}
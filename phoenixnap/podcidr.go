@@ -0,0 +1,183 @@
+package phoenixnap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// podCIDRAllocator allocates the PodCIDR of each node from the CIDR of a PhoenixNAP private network,
+// for clusters that want cloud-managed allocation instead of the range allocator of kube-controller-manager
+type podCIDRAllocator struct {
+	k8sclient kubernetes.Interface
+	netClient *netapi.APIClient
+	// network ID of the private network whose CIDR is divided into PodCIDRs
+	network string
+	// maskSize prefix length of each PodCIDR
+	maskSize int
+}
+
+// start allocates PodCIDRs periodically until stop is closed
+func (a *podCIDRAllocator) start(wg *sync.WaitGroup, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// cancel in-flight calls too
+	go func() {
+		<-stop
+		cancel()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(podCIDRSyncSeconds * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := a.sync(ctx); err != nil {
+				klog.Errorf("unable to allocate PodCIDRs from private network %s: %v", a.network, err)
+			}
+			select {
+			case <-ctx.Done():
+				klog.V(2).Info("stopping PodCIDR allocator")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sync allocates a PodCIDR to every node that does not have one yet
+func (a *podCIDRAllocator) sync(ctx context.Context) error {
+	network, resp, err := a.netClient.PrivateNetworksApi.PrivateNetworksNetworkIdGet(ctx, a.network).Execute()
+	if err != nil {
+		return fmt.Errorf("unable to get private network: %w", providerError(resp, err))
+	}
+	supernet, err := netip.ParsePrefix(network.Cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %q of private network: %w", network.Cidr, err)
+	}
+	supernet = supernet.Masked()
+	if supernet.Bits() > a.maskSize || a.maskSize > supernet.Addr().BitLen() {
+		return fmt.Errorf("cannot divide CIDR %s of private network into /%d PodCIDRs", supernet, a.maskSize)
+	}
+
+	list, err := a.k8sclient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list nodes: %w", err)
+	}
+	nodes := list.Items
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	// the PodCIDRs already allocated, and the node addresses, which must not be inside a PodCIDR
+	var (
+		used      []netip.Prefix
+		addresses []netip.Addr
+		pending   []*v1.Node
+	)
+	for i := range nodes {
+		node := &nodes[i]
+		for _, cidr := range nodePodCIDRs(node) {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				used = append(used, prefix.Masked())
+			}
+		}
+		for _, address := range node.Status.Addresses {
+			if addr, err := netip.ParseAddr(address.Address); err == nil {
+				addresses = append(addresses, addr)
+			}
+		}
+		if len(nodePodCIDRs(node)) == 0 {
+			pending = append(pending, node)
+		}
+	}
+
+	for _, node := range pending {
+		cidr, ok := freeSubnet(supernet, a.maskSize, used, addresses)
+		if !ok {
+			return fmt.Errorf("no free /%d PodCIDR left in %s for node %s", a.maskSize, supernet, node.Name)
+		}
+		patch, _ := json.Marshal(map[string]any{
+			"spec": map[string]any{
+				"podCIDR":  cidr.String(),
+				"podCIDRs": []string{cidr.String()},
+			},
+		})
+		if _, err := a.k8sclient.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("unable to set PodCIDR %s on node %s: %w", cidr, node.Name, err)
+		}
+		klog.Infof("allocated PodCIDR %s to node %s", cidr, node.Name)
+		used = append(used, cidr)
+	}
+	return nil
+}
+
+// nodePodCIDRs the PodCIDRs of the node, from podCIDRs, or the legacy podCIDR
+func nodePodCIDRs(node *v1.Node) []string {
+	if len(node.Spec.PodCIDRs) > 0 {
+		return node.Spec.PodCIDRs
+	}
+	if node.Spec.PodCIDR != "" {
+		return []string{node.Spec.PodCIDR}
+	}
+	return nil
+}
+
+// freeSubnet returns the first subnet of supernet with prefix length bits, that neither overlaps
+// any of used nor contains any of addresses
+func freeSubnet(supernet netip.Prefix, bits int, used []netip.Prefix, addresses []netip.Addr) (netip.Prefix, bool) {
+	for subnet := netip.PrefixFrom(supernet.Addr(), bits); supernet.Contains(subnet.Addr()); {
+		free := true
+		for _, prefix := range used {
+			if prefix.Overlaps(subnet) {
+				free = false
+				break
+			}
+		}
+		for _, addr := range addresses {
+			if subnet.Contains(addr) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return subnet, true
+		}
+		next, ok := nextSubnet(subnet)
+		if !ok {
+			break
+		}
+		subnet = next
+	}
+	return netip.Prefix{}, false
+}
+
+// nextSubnet returns the subnet of the same size directly after subnet, and false if there is none
+func nextSubnet(subnet netip.Prefix) (netip.Prefix, bool) {
+	addr := subnet.Addr().AsSlice()
+	bit := subnet.Bits() - 1
+	if bit < 0 {
+		return netip.Prefix{}, false
+	}
+	// add 1 at the last bit of the prefix, carrying into the preceding bytes
+	carry := 1 << (7 - bit%8)
+	for i := bit / 8; i >= 0 && carry > 0; i-- {
+		sum := int(addr[i]) + carry
+		addr[i] = byte(sum)
+		carry = sum >> 8
+	}
+	if carry > 0 {
+		return netip.Prefix{}, false
+	}
+	next, _ := netip.AddrFromSlice(addr)
+	return netip.PrefixFrom(next, subnet.Bits()), true
+}
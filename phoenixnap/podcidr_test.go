@@ -0,0 +1,95 @@
+package phoenixnap
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFreeSubnet(t *testing.T) {
+	tests := []struct {
+		supernet  string
+		bits      int
+		used      []string
+		addresses []string
+		expected  string
+	}{
+		{"10.0.0.0/16", 24, nil, nil, "10.0.0.0/24"},
+		{"10.0.0.0/16", 24, []string{"10.0.0.0/24", "10.0.2.0/24"}, nil, "10.0.1.0/24"},
+		{"10.0.0.0/16", 24, []string{"10.0.0.0/23"}, []string{"10.0.2.5"}, "10.0.3.0/24"},
+		{"10.0.0.0/23", 24, []string{"10.0.0.0/24", "10.0.1.0/24"}, nil, ""},
+		{"10.0.255.0/24", 25, []string{"10.0.255.0/25"}, nil, "10.0.255.128/25"},
+		{"255.255.255.0/24", 25, []string{"255.255.255.0/25", "255.255.255.128/25"}, nil, ""},
+		{"fd00::/48", 64, []string{"fd00::/64"}, nil, "fd00:0:0:1::/64"},
+	}
+	for i, tt := range tests {
+		var (
+			used      []netip.Prefix
+			addresses []netip.Addr
+		)
+		for _, u := range tt.used {
+			used = append(used, netip.MustParsePrefix(u))
+		}
+		for _, a := range tt.addresses {
+			addresses = append(addresses, netip.MustParseAddr(a))
+		}
+		subnet, ok := freeSubnet(netip.MustParsePrefix(tt.supernet), tt.bits, used, addresses)
+		switch {
+		case tt.expected == "" && ok:
+			t.Errorf("%d: expected no free subnet, got %s", i, subnet)
+		case tt.expected != "" && (!ok || subnet.String() != tt.expected):
+			t.Errorf("%d: mismatched subnet, actual %s expected %s", i, subnet, tt.expected)
+		}
+	}
+}
+
+func TestPodCIDRAllocatorSync(t *testing.T) {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{
+		Store:        backend,
+		ErrorHandler: &apiServerError{t: t},
+	}
+	_, _ = backend.CreateLocation(validLocationName)
+	network, err := backend.CreatePrivateNetwork("pods", validLocationName, "10.100.0.0/22")
+	if err != nil {
+		t.Fatalf("unable to create private network: %v", err)
+	}
+	ts := httptest.NewServer(fake.CreateHandler())
+	t.Cleanup(ts.Close)
+	_, _, _, _, netClient, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+
+	k8sclient := k8sfake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: v1.NodeSpec{PodCIDR: "10.100.0.0/24", PodCIDRs: []string{"10.100.0.0/24"}}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Status: v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.100.1.10"}}}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node3"}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node4"}},
+	)
+	allocator := &podCIDRAllocator{k8sclient: k8sclient, netClient: netClient, network: network.Id, maskSize: 24}
+
+	// only two /24s are free; 10.100.1.0/24 holds a node address
+	if err := allocator.sync(context.TODO()); err == nil {
+		t.Errorf("expected error once the private network is exhausted")
+	}
+	for name, expected := range map[string]string{"node1": "10.100.0.0/24", "node2": "10.100.2.0/24", "node3": "10.100.3.0/24", "node4": ""} {
+		node, err := k8sclient.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+		switch {
+		case err != nil:
+			t.Fatalf("unable to get node %s: %v", name, err)
+		case node.Spec.PodCIDR != expected:
+			t.Errorf("%s: mismatched PodCIDR, actual %s expected %s", name, node.Spec.PodCIDR, expected)
+		case expected != "" && (len(node.Spec.PodCIDRs) != 1 || node.Spec.PodCIDRs[0] != expected):
+			t.Errorf("%s: mismatched PodCIDRs, actual %v expected %v", name, node.Spec.PodCIDRs, []string{expected})
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// servicePorts returns the ports of the service, as passed to the implementation
+func servicePorts(svc *v1.Service) []loadbalancers.Port {
+	ports := make([]loadbalancers.Port, 0, len(svc.Spec.Ports))
+	for _, port := range svc.Spec.Ports {
+		ports = append(ports, loadbalancers.Port{Name: port.Name, Protocol: port.Protocol, Port: port.Port, NodePort: port.NodePort})
+	}
+	return ports
+}
+
+// portKeys returns the ports as "<protocol>/<port>:<node port>", e.g. TCP/80:30080, sorted, to compare and log them
+func portKeys(ports []loadbalancers.Port) []string {
+	keys := make([]string, 0, len(ports))
+	for _, port := range ports {
+		keys = append(keys, fmt.Sprintf("%s/%d:%d", port.Protocol, port.Port, port.NodePort))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setPorts passes the ports of the service to the implementation, if it is a loadbalancers.PortSetter
+func (l *loadBalancers) setPorts(ctx context.Context, svc *v1.Service, ports []loadbalancers.Port) error {
+	setter, ok := l.implementor.(loadbalancers.PortSetter)
+	if !ok {
+		return nil
+	}
+	return l.callImplementor(implementorOpSetPorts, func() error {
+		return setter.SetPorts(ctx, svc.Namespace, svc.Name, ports)
+	})
+}
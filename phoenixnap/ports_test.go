@@ -0,0 +1,91 @@
+package phoenixnap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// testPortsLB a testRecordingLB that records the ports of each service
+type testPortsLB struct {
+	testRecordingLB
+	ports map[string][]string
+}
+
+func (t *testPortsLB) SetPorts(ctx context.Context, svcNamespace, svcName string, ports []loadbalancers.Port) error {
+	t.ports[svcNamespace+"/"+svcName] = portKeys(ports)
+	return nil
+}
+
+func TestPortKeys(t *testing.T) {
+	ports := []loadbalancers.Port{
+		{Name: "https", Protocol: v1.ProtocolTCP, Port: 443, NodePort: 30443},
+		{Name: "dns", Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30053},
+		{Name: "http", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080},
+	}
+	expected := []string{"TCP/443:30443", "TCP/80:30080", "UDP/53:30053"}
+	if actual := portKeys(ports); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("mismatched keys, actual %v expected %v", actual, expected)
+	}
+}
+
+func TestEnsureLoadBalancerPortChanges(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Spec.Ports = []v1.ServicePort{{Name: "http", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}}
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testPortsLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		ports:           map[string][]string{},
+	}
+	l.implementor = lb
+	nodes := []*v1.Node{testNode("phoenixnap://node1", "node1")}
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"TCP/80:30080"}; !reflect.DeepEqual(lb.ports["default/svc1"], expected) {
+		t.Errorf("mismatched ports, actual %v expected %v", lb.ports["default/svc1"], expected)
+	}
+
+	// a port added to the live service reaches the implementation, with the same IP and nodes
+	added := svc.DeepCopy()
+	added.Spec.Ports = append(added.Spec.Ports, v1.ServicePort{Name: "https", Protocol: v1.ProtocolTCP, Port: 443, NodePort: 30443})
+	lb.nodes = map[string][]string{}
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", added, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.nodes["default/svc1"]; !ok {
+		t.Errorf("implementation not called for an added port")
+	}
+	if expected := []string{"TCP/443:30443", "TCP/80:30080"}; !reflect.DeepEqual(lb.ports["default/svc1"], expected) {
+		t.Errorf("mismatched ports, actual %v expected %v", lb.ports["default/svc1"], expected)
+	}
+
+	// and so does a port removed
+	lb.nodes = map[string][]string{}
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.nodes["default/svc1"]; !ok {
+		t.Errorf("implementation not called for a removed port")
+	}
+	if expected := []string{"TCP/80:30080"}; !reflect.DeepEqual(lb.ports["default/svc1"], expected) {
+		t.Errorf("mismatched ports, actual %v expected %v", lb.ports["default/svc1"], expected)
+	}
+
+	// a resync with the same ports does not call the implementation
+	lb.ips, lb.nodes = map[string]string{}, map[string][]string{}
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lb.ips) != 0 || len(lb.nodes) != 0 {
+		t.Errorf("implementation called for unchanged ports")
+	}
+}
@@ -0,0 +1,122 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrorReason a machine-readable class of a ProviderError
+type ErrorReason string
+
+const (
+	// ErrorReasonNotFound the resource does not exist
+	ErrorReasonNotFound ErrorReason = "NotFound"
+	// ErrorReasonQuota a limit on the account, or the maxIPBlocks of the CCM, was reached
+	ErrorReasonQuota ErrorReason = "Quota"
+	// ErrorReasonAuth the credentials are invalid, or not allowed to perform the call
+	ErrorReasonAuth ErrorReason = "Auth"
+	// ErrorReasonRateLimited the API asked to slow down
+	ErrorReasonRateLimited ErrorReason = "RateLimited"
+	// ErrorReasonConflict the call conflicts with the current state of the resource
+	ErrorReasonConflict ErrorReason = "Conflict"
+	// ErrorReasonUnavailable the API is failing, or not called because of the circuit breaker
+	ErrorReasonUnavailable ErrorReason = "Unavailable"
+	// ErrorReasonUnknown any other error
+	ErrorReasonUnknown ErrorReason = "Unknown"
+)
+
+// ProviderError an error from the PhoenixNAP provider, with a reason, so that callers,
+// Events and metrics can treat each class of error differently
+type ProviderError struct {
+	Reason ErrorReason
+	Err    error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// ReasonForError returns the reason of the ProviderError in the chain of err,
+// or ErrorReasonUnknown if there is none
+func ReasonForError(err error) ErrorReason {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.Reason
+	}
+	return ErrorReasonUnknown
+}
+
+// transientError returns true if err is a failure of the API or of the connection to it, rather than an
+// answer, e.g. that a resource does not exist, so that the call may succeed if repeated later
+func transientError(err error) bool {
+	switch ReasonForError(err) {
+	case ErrorReasonUnavailable, ErrorReasonRateLimited:
+		return true
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// newProviderError returns a ProviderError with the given reason, and counts it
+func newProviderError(reason ErrorReason, err error) *ProviderError {
+	providerErrorsTotal.WithLabelValues(string(reason)).Inc()
+	return &ProviderError{Reason: reason, Err: err}
+}
+
+// providerErrorf same as newProviderError, with the error built from format and args
+func providerErrorf(reason ErrorReason, format string, args ...any) *ProviderError {
+	return newProviderError(reason, fmt.Errorf(format, args...))
+}
+
+// providerError classifies the error of a PhoenixNAP API call by its response, and adds the message
+// from the error body. It returns nil if err is nil, and err unchanged if it already is classified.
+func providerError(resp *http.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return err
+	}
+	err = withAPIErrorDetails(err)
+	return newProviderError(reasonForResponse(resp, err), err)
+}
+
+// reasonForResponse the reason for a failed PhoenixNAP API call
+func reasonForResponse(resp *http.Response, err error) ErrorReason {
+	if resp == nil {
+		// the SDKs flatten transport errors into a string, so errors.Is does not work
+		if errors.Is(err, ErrProviderAPIUnavailable) || strings.Contains(err.Error(), ErrProviderAPIUnavailable.Error()) {
+			return ErrorReasonUnavailable
+		}
+		if errors.Is(err, ErrCredentialsRejected) || strings.Contains(err.Error(), ErrCredentialsRejected.Error()) {
+			return ErrorReasonAuth
+		}
+		return ErrorReasonUnknown
+	}
+	message := strings.ToLower(apiErrorMessage(err))
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrorReasonNotFound
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return ErrorReasonAuth
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return ErrorReasonRateLimited
+	case resp.StatusCode == http.StatusPaymentRequired,
+		resp.StatusCode >= 400 && resp.StatusCode < 500 && (strings.Contains(message, "quota") || strings.Contains(message, "limit")):
+		return ErrorReasonQuota
+	case resp.StatusCode == http.StatusConflict:
+		return ErrorReasonConflict
+	case resp.StatusCode >= 500:
+		return ErrorReasonUnavailable
+	}
+	return ErrorReasonUnknown
+}
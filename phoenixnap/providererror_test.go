@@ -0,0 +1,85 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestReasonForResponse(t *testing.T) {
+	tests := []struct {
+		code   int
+		err    error
+		reason ErrorReason
+	}{
+		{0, errors.New("dial tcp: connection refused"), ErrorReasonUnknown},
+		{0, fmt.Errorf("Get \"https://api\": %w", ErrProviderAPIUnavailable), ErrorReasonUnavailable},
+		{0, errors.New("Get \"https://api\": " + ErrProviderAPIUnavailable.Error()), ErrorReasonUnavailable},
+		{http.StatusNotFound, errors.New("404 Not Found"), ErrorReasonNotFound},
+		{http.StatusUnauthorized, errors.New("401 Unauthorized"), ErrorReasonAuth},
+		{http.StatusForbidden, errors.New("403 Forbidden"), ErrorReasonAuth},
+		{http.StatusTooManyRequests, errors.New("429 Too Many Requests"), ErrorReasonRateLimited},
+		{http.StatusPaymentRequired, errors.New("402 Payment Required"), ErrorReasonQuota},
+		{http.StatusConflict, errors.New("409 Conflict"), ErrorReasonConflict},
+		{http.StatusBadRequest, errors.New("400 Bad Request"), ErrorReasonUnknown},
+		{http.StatusBadGateway, errors.New("502 Bad Gateway"), ErrorReasonUnavailable},
+	}
+	for i, tt := range tests {
+		var resp *http.Response
+		if tt.code != 0 {
+			resp = &http.Response{StatusCode: tt.code}
+		}
+		if reason := reasonForResponse(resp, tt.err); reason != tt.reason {
+			t.Errorf("%d: mismatched reason, actual %s expected %s", i, reason, tt.reason)
+		}
+	}
+}
+
+func TestReasonForError(t *testing.T) {
+	base := errors.New("409 Conflict")
+	err := fmt.Errorf("unable to assign block: %w", providerError(&http.Response{StatusCode: http.StatusConflict}, base))
+	if reason := ReasonForError(err); reason != ErrorReasonConflict {
+		t.Errorf("mismatched reason, actual %s expected %s", reason, ErrorReasonConflict)
+	}
+	if !errors.Is(err, base) {
+		t.Errorf("wrapped error does not unwrap to the original")
+	}
+	// already classified errors are not reclassified
+	if reason := ReasonForError(providerError(nil, err)); reason != ErrorReasonConflict {
+		t.Errorf("mismatched reason after reclassify, actual %s expected %s", reason, ErrorReasonConflict)
+	}
+	if reason := ReasonForError(base); reason != ErrorReasonUnknown {
+		t.Errorf("mismatched reason for plain error, actual %s expected %s", reason, ErrorReasonUnknown)
+	}
+	if providerError(nil, nil) != nil {
+		t.Errorf("expected nil for nil error")
+	}
+}
+
+func TestTransientError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"unavailable", newProviderError(ErrorReasonUnavailable, errors.New("503 Service Unavailable")), true},
+		{"rate limited", newProviderError(ErrorReasonRateLimited, errors.New("429 Too Many Requests")), true},
+		{"connection", &url.Error{Op: "Get", URL: "https://api", Err: errors.New("connection refused")}, true},
+		{"timeout", fmt.Errorf("listing servers: %w", context.DeadlineExceeded), true},
+		{"auth", newProviderError(ErrorReasonAuth, errors.New("403 Forbidden")), false},
+		{"not found", cloudprovider.InstanceNotFound, false},
+		{"other", errors.New("providerID cannot be empty"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if transient := transientError(tt.err); transient != tt.transient {
+				t.Errorf("mismatched transient, actual %v expected %v", transient, tt.transient)
+			}
+		})
+	}
+}
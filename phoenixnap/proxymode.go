@@ -0,0 +1,203 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// An implementation that proxies connections to the backends, e.g. HAProxy, rather than routing the IP of a
+// Service to its nodes, needs the traffic to the IP to reach it. kube-proxy, however, short-circuits traffic from
+// within the cluster to an IP in the status of a Service. The API of this Kubernetes version has no ipMode for
+// the ingress yet, so the convention of the clouds is used: the ingress of a Service with a hostname annotation
+// is the hostname, resolving to the IP, rather than the IP. Such an implementation may also have the backends
+// probed before they are added, so that it is not handed backends that fail.
+
+// proxyHostnameFromService returns the hostname of the ingress of the service in proxy mode, or "" if it has none
+func proxyHostnameFromService(svc *v1.Service) (string, error) {
+	hostname, ok := svc.Annotations[annotationLoadBalancerHostname]
+	if !ok {
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) > 0 {
+		return "", fmt.Errorf("annotation %s must be a DNS name, was %q: %s", annotationLoadBalancerHostname, hostname, strings.Join(errs, "; "))
+	}
+	return hostname, nil
+}
+
+// probeBackendsFromService returns whether the service asks for its backends to be probed before they are added
+func probeBackendsFromService(svc *v1.Service) (bool, error) {
+	value, ok := svc.Annotations[annotationProbeBackends]
+	if !ok {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("annotation %s must be true or false, was %q", annotationProbeBackends, value)
+	}
+	return enabled, nil
+}
+
+// withIPMode returns status with the ipMode of each ingress with an IP that of the implementation: Proxy if it
+// proxies, so that kube-proxy sends the traffic of pods to the IP to it rather than to the backends, else VIP.
+// Against Kubernetes API modules before v0.29, which have no ipMode, status is as is; see setIPMode.
+func (l *loadBalancers) withIPMode(status *v1.LoadBalancerStatus) *v1.LoadBalancerStatus {
+	if status == nil || l.implementor == nil {
+		return status
+	}
+	proxy := l.implementor.Capabilities().Proxy
+	for i := range status.Ingress {
+		if status.Ingress[i].IP != "" {
+			setIPMode(&status.Ingress[i], proxy)
+		}
+	}
+	return status
+}
+
+// proxyModeStatus returns status with each ingress marked as proxied, i.e. its hostname rather than its IP, if the
+// implementation proxies and the service has a hostname. Otherwise, or if the hostname is invalid, status is as is.
+func (l *loadBalancers) proxyModeStatus(svc *v1.Service, status *v1.LoadBalancerStatus) *v1.LoadBalancerStatus {
+	if l.implementor == nil || !l.implementor.Capabilities().Proxy {
+		return status
+	}
+	hostname, err := proxyHostnameFromService(svc)
+	if err != nil || hostname == "" {
+		return status
+	}
+	for i := range status.Ingress {
+		status.Ingress[i].Hostname = hostname
+		status.Ingress[i].IP = ""
+	}
+	return status
+}
+
+// probeBackends returns the nodes whose probe on the health check of the service succeeds, if the implementation
+// proxies and the service asks for it. Failing nodes are recorded in an Event, and probed again after
+// backendProbeRecheckSeconds. If all of them fail, all are returned, as a probe that is wrong must not take the
+// Service down.
+func (l *loadBalancers) probeBackends(ctx context.Context, svc *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	if l.implementor == nil || !l.implementor.Capabilities().Proxy || len(nodes) == 0 {
+		return nodes, nil
+	}
+	enabled, err := probeBackendsFromService(svc)
+	if err != nil {
+		if l.recorder != nil {
+			l.recorder.Event(svc, v1.EventTypeWarning, eventReasonInvalidBackendProbe, err.Error())
+		}
+		return nil, err
+	}
+	if !enabled {
+		return nodes, nil
+	}
+	check, err := healthCheckFromService(svc)
+	if err == nil && check == nil {
+		err = fmt.Errorf("annotation %s requires the health check annotation %s", annotationProbeBackends, annotationHealthCheckPort)
+	}
+	if err != nil {
+		if l.recorder != nil {
+			l.recorder.Event(svc, v1.EventTypeWarning, eventReasonInvalidBackendProbe, err.Error())
+		}
+		return nil, err
+	}
+
+	healthy := make([]bool, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *v1.Node) {
+			defer wg.Done()
+			address := nodeProbeAddress(node)
+			if address == "" {
+				klog.V(2).Infof("node %s has no address to probe for service %s", node.Name, serviceRep(svc))
+				return
+			}
+			probe := l.probe
+			if probe == nil {
+				probe = probeBackend
+			}
+			if err := probe(ctx, net.JoinHostPort(address, strconv.Itoa(int(check.Port))), check.Path); err != nil {
+				klog.V(2).Infof("probe of node %s for service %s failed: %v", node.Name, serviceRep(svc), err)
+				return
+			}
+			healthy[i] = true
+		}(i, node)
+	}
+	wg.Wait()
+
+	var passed []*v1.Node
+	var failed []string
+	for i, node := range nodes {
+		if healthy[i] {
+			passed = append(passed, node)
+		} else {
+			failed = append(failed, node.Name)
+		}
+	}
+	if len(failed) == 0 {
+		return nodes, nil
+	}
+	backendProbeFailuresTotal.Add(float64(len(failed)))
+	l.heldBack.hold(serviceRep(svc), l.clock.Now().Add(backendProbeRecheckSeconds*time.Second))
+	msg := fmt.Sprintf("backends failed their probe, not adding them: %s", strings.Join(failed, ", "))
+	if len(passed) == 0 {
+		msg = fmt.Sprintf("all backends failed their probe, adding them anyway: %s", strings.Join(failed, ", "))
+		passed = nodes
+	}
+	klog.Warningf("service %s: %s", serviceRep(svc), msg)
+	if l.recorder != nil {
+		l.recorder.Event(svc, v1.EventTypeWarning, eventReasonBackendProbeFailed, msg)
+	}
+	return passed, nil
+}
+
+// nodeProbeAddress returns the address at which a node is probed: its internal IP, else its external IP
+func nodeProbeAddress(node *v1.Node) string {
+	for _, addrType := range []v1.NodeAddressType{v1.NodeInternalIP, v1.NodeExternalIP} {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == addrType {
+				return addr.Address
+			}
+		}
+	}
+	return ""
+}
+
+// probeBackend probes address with an HTTP GET of path, which must respond with a 2xx or 3xx status, or, if path
+// is empty, a TCP connect
+func probeBackend(ctx context.Context, address, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, backendProbeTimeoutSeconds*time.Second)
+	defer cancel()
+	if path == "" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", address, path), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
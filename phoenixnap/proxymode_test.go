@@ -0,0 +1,181 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// testProxyLB an implementation that proxies connections
+type testProxyLB struct {
+	testRecordingLB
+}
+
+func (t *testProxyLB) Capabilities() loadbalancers.Capabilities {
+	caps := t.testRecordingLB.Capabilities()
+	caps.Proxy = true
+	return caps
+}
+
+func testProbedNode(name, address string) *v1.Node {
+	node := testNode("pnap://"+name, name)
+	node.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: address}}
+	return node
+}
+
+func TestProxyModeStatus(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationLoadBalancerHostname: "svc1.example.com"}
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+
+	// kube-vip routes the IP, so the ingress keeps it
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Ingress[0].IP == "" || status.Ingress[0].Hostname != "" {
+		t.Errorf("mismatched ingress for routing implementation, actual %+v", status.Ingress[0])
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonFeaturesIgnored) {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+
+	l.implementor = &testProxyLB{testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}}
+	status, err = l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Ingress[0].IP != "" || status.Ingress[0].Hostname != "svc1.example.com" {
+		t.Errorf("mismatched ingress for proxying implementation, actual %+v", status.Ingress[0])
+	}
+}
+
+func TestWithIPMode(t *testing.T) {
+	l, _, _ := testGetLoadBalancers(t, 0)
+	tests := []struct {
+		name     string
+		lb       loadbalancers.LB
+		expected string
+	}{
+		{"routing", &testRecordingLB{}, "VIP"},
+		{"proxying", &testProxyLB{}, "Proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.implementor = tt.lb
+			status := l.withIPMode(&v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "192.0.2.10"}, {Hostname: "svc1.example.com"}}})
+			// the ipMode is only set with Kubernetes API modules that have it, and only on an ingress with an IP
+			field := reflect.ValueOf(status.Ingress[0]).FieldByName("IPMode")
+			if !field.IsValid() {
+				return
+			}
+			if field.IsNil() || field.Elem().String() != tt.expected {
+				t.Errorf("mismatched ipMode, actual %v expected %s", field, tt.expected)
+			}
+			if !reflect.ValueOf(status.Ingress[1]).FieldByName("IPMode").IsNil() {
+				t.Errorf("ipMode set on an ingress without an IP")
+			}
+		})
+	}
+}
+
+func TestProbeBackends(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationProbeBackends: "true", annotationHealthCheckPort: "30080", annotationHealthCheckPath: "/healthz"}
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+	lb := &testProxyLB{testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}}
+	l.implementor = lb
+	failing := map[string]bool{"192.0.2.2:30080": true}
+	l.probe = func(ctx context.Context, address, path string) error {
+		if path != "/healthz" {
+			t.Errorf("mismatched probe path, actual %s expected %s", path, "/healthz")
+		}
+		if failing[address] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	nodes := []*v1.Node{testProbedNode("node1", "192.0.2.1"), testProbedNode("node2", "192.0.2.2")}
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := lb.nodes["default/svc1"]; len(got) != 1 || got[0] != "node1" {
+		t.Errorf("mismatched nodes, actual %v expected %v", got, []string{"node1"})
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonBackendProbeFailed) || !strings.Contains(event, "node2") {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+	// the failing node is probed again later
+	if names := l.heldBack.ready(time.Now().Add(backendProbeRecheckSeconds * time.Second)); len(names) != 1 {
+		t.Errorf("mismatched held back services, actual %v", names)
+	}
+
+	// once it recovers, it is added
+	delete(failing, "192.0.2.2:30080")
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := lb.nodes["default/svc1"]; len(got) != 2 {
+		t.Errorf("mismatched nodes, actual %v expected 2 nodes", got)
+	}
+
+	// if all fail, the probe is more likely wrong than all nodes, so all are kept
+	failing["192.0.2.1:30080"], failing["192.0.2.2:30080"] = true, true
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := lb.nodes["default/svc1"]; len(got) != 2 {
+		t.Errorf("mismatched nodes, actual %v expected 2 nodes", got)
+	}
+}
+
+func TestProbeBackendsRequiresHealthCheck(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationProbeBackends: "true"}
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	l.implementor = &testProxyLB{testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}}
+
+	if _, err := l.probeBackends(context.TODO(), svc, []*v1.Node{testProbedNode("node1", "192.0.2.1")}); err == nil {
+		t.Errorf("expected error without the health check port")
+	}
+}
+
+func TestProbeBackend(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	address := strings.TrimPrefix(ts.URL, "http://")
+
+	if err := probeBackend(context.TODO(), address, "/healthz"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := probeBackend(context.TODO(), address, "/other"); err == nil {
+		t.Errorf("expected error for failing status")
+	}
+	if err := probeBackend(context.TODO(), address, ""); err != nil {
+		t.Errorf("unexpected error for TCP probe: %v", err)
+	}
+}
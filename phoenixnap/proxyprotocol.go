@@ -0,0 +1,43 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// proxyProtocolFromService returns whether the service asks for the PROXY protocol
+func proxyProtocolFromService(svc *v1.Service) (bool, error) {
+	value, ok := svc.Annotations[annotationProxyProtocol]
+	if !ok {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("annotation %s must be true or false, was %q", annotationProxyProtocol, value)
+	}
+	return enabled, nil
+}
+
+// setProxyProtocol passes the PROXY protocol setting of the service to the implementation.
+// If the implementation does not support it, it is ignored; see warnIgnoredFeatures.
+func (l *loadBalancers) setProxyProtocol(ctx context.Context, svc *v1.Service) error {
+	enabled, err := proxyProtocolFromService(svc)
+	if err != nil {
+		if l.recorder != nil {
+			l.recorder.Event(svc, v1.EventTypeWarning, eventReasonInvalidProxyProtocol, err.Error())
+		}
+		return err
+	}
+	setter, ok := l.implementor.(loadbalancers.ProxyProtocolSetter)
+	if !ok {
+		return nil
+	}
+	return l.callImplementor(implementorOpSetProxyProtocol, func() error {
+		return setter.SetProxyProtocol(ctx, svc.Namespace, svc.Name, enabled)
+	})
+}
@@ -0,0 +1,93 @@
+package phoenixnap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+)
+
+// testProxyProtocolLB an implementation that records the PROXY protocol setting of each service
+type testProxyProtocolLB struct {
+	testRecordingLB
+	enabled map[string]bool
+}
+
+func (t *testProxyProtocolLB) SetProxyProtocol(ctx context.Context, svcNamespace, svcName string, enabled bool) error {
+	t.enabled[svcNamespace+"/"+svcName] = enabled
+	return nil
+}
+
+func (t *testProxyProtocolLB) Capabilities() loadbalancers.Capabilities {
+	caps := t.testRecordingLB.Capabilities()
+	caps.ProxyProtocol = true
+	return caps
+}
+
+func TestSetProxyProtocol(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationProxyProtocol: "true"}
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+
+	// kube-vip does not support it
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonFeaturesIgnored) {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+
+	lb := &testProxyProtocolLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		enabled:         map[string]bool{},
+	}
+	l.implementor = lb
+	if err := l.UpdateLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !lb.enabled["default/svc1"] {
+		t.Errorf("PROXY protocol not enabled")
+	}
+
+	invalid := svc.DeepCopy()
+	invalid.Annotations[annotationProxyProtocol] = "maybe"
+	if err := l.UpdateLoadBalancer(context.TODO(), "", invalid, nil); err == nil {
+		t.Errorf("expected error for invalid annotation")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonInvalidProxyProtocol) {
+			t.Errorf("unexpected event %s", event)
+		}
+	default:
+		t.Errorf("no event recorded")
+	}
+}
+
+func TestEnsureLoadBalancerTogglesProxyProtocol(t *testing.T) {
+	// changing the annotation of a service whose load balancer exists reaches the implementation
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationProxyProtocol: "true"}
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	lb := &testProxyProtocolLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		enabled:         map[string]bool{},
+	}
+	l.implementor = lb
+
+	for i, value := range []string{"true", "false", "true"} {
+		svc.Annotations[annotationProxyProtocol] = value
+		if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if expected := value == "true"; lb.enabled["default/svc1"] != expected {
+			t.Errorf("%d: mismatched PROXY protocol, actual %t expected %t", i, lb.enabled["default/svc1"], expected)
+		}
+	}
+}
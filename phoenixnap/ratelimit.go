@@ -0,0 +1,99 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// apiSubsystem a part of the CCM with its own budget of PhoenixNAP API calls
+type apiSubsystem string
+
+const (
+	subsystemInstances    apiSubsystem = "instances"
+	subsystemLoadBalancer apiSubsystem = "loadbalancer"
+	subsystemReaper       apiSubsystem = "reaper"
+)
+
+var apiSubsystems = []apiSubsystem{subsystemInstances, subsystemLoadBalancer, subsystemReaper}
+
+type apiSubsystemKey struct{}
+
+// withSubsystem returns a context whose PhoenixNAP API calls count against the budget of subsystem
+func withSubsystem(ctx context.Context, subsystem apiSubsystem) context.Context {
+	return context.WithValue(ctx, apiSubsystemKey{}, subsystem)
+}
+
+// subsystemFromContext the subsystem of the context, and false if none is set
+func subsystemFromContext(ctx context.Context) (apiSubsystem, bool) {
+	subsystem, ok := ctx.Value(apiSubsystemKey{}).(apiSubsystem)
+	return subsystem, ok
+}
+
+// APIRateLimit the rate at which a subsystem may call the PhoenixNAP API
+type APIRateLimit struct {
+	// QPS calls per second, on average
+	QPS float32 `json:"qps"`
+	// Burst calls that may be made at once, above QPS
+	Burst int `json:"burst,omitempty"`
+}
+
+// validateAPIRateLimits returns an error if a subsystem is unknown, or a limit is not positive
+func validateAPIRateLimits(limits map[string]APIRateLimit) error {
+	for name, limit := range limits {
+		known := false
+		for _, subsystem := range apiSubsystems {
+			known = known || name == string(subsystem)
+		}
+		if !known {
+			return fmt.Errorf("unknown subsystem %q, must be one of %v", name, apiSubsystems)
+		}
+		if limit.QPS <= 0 {
+			return fmt.Errorf("qps of subsystem %s must be positive, was %v", name, limit.QPS)
+		}
+		if limit.Burst < 0 {
+			return fmt.Errorf("burst of subsystem %s must not be negative, was %d", name, limit.Burst)
+		}
+	}
+	return nil
+}
+
+// rateLimiter is an http.RoundTripper that holds back PhoenixNAP API calls, so that each subsystem
+// stays within its own budget, and a busy one cannot starve the others. Calls of a subsystem without
+// a limit, or without a subsystem, are not held back.
+type rateLimiter struct {
+	next     http.RoundTripper
+	limiters map[apiSubsystem]flowcontrol.RateLimiter
+}
+
+func newRateLimiter(next http.RoundTripper, limits map[string]APIRateLimit) *rateLimiter {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	limiters := map[apiSubsystem]flowcontrol.RateLimiter{}
+	for name, limit := range limits {
+		burst := limit.Burst
+		if burst == 0 {
+			burst = 1
+		}
+		limiters[apiSubsystem(name)] = flowcontrol.NewTokenBucketRateLimiter(limit.QPS, burst)
+	}
+	return &rateLimiter{next: next, limiters: limiters}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *rateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if subsystem, ok := subsystemFromContext(req.Context()); ok {
+		if limiter, ok := r.limiters[subsystem]; ok {
+			start := time.Now()
+			if err := limiter.Wait(req.Context()); err != nil {
+				return nil, fmt.Errorf("rate limit of subsystem %s: %w", subsystem, err)
+			}
+			apiRateLimitWaitSeconds.WithLabelValues(string(subsystem)).Observe(time.Since(start).Seconds())
+		}
+	}
+	return r.next.RoundTrip(req)
+}
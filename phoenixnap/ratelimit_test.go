@@ -0,0 +1,63 @@
+package phoenixnap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	calls := 0
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return httptest.NewRecorder().Result(), nil
+	})
+	r := newRateLimiter(next, map[string]APIRateLimit{string(subsystemLoadBalancer): {QPS: 0.1, Burst: 1}})
+	call := func(subsystem apiSubsystem) error {
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		defer cancel()
+		if subsystem != "" {
+			ctx = withSubsystem(ctx, subsystem)
+		}
+		req := httptest.NewRequest("GET", "http://localhost/", nil).WithContext(ctx)
+		_, err := r.RoundTrip(req)
+		return err
+	}
+
+	// the burst is let through, the next call would wait far beyond the deadline
+	if err := call(subsystemLoadBalancer); err != nil {
+		t.Fatalf("unexpected error within burst: %v", err)
+	}
+	if err := call(subsystemLoadBalancer); err == nil {
+		t.Errorf("expected error once the budget is used up")
+	}
+	// other subsystems are not held back
+	for _, subsystem := range []apiSubsystem{subsystemInstances, subsystemReaper, ""} {
+		if err := call(subsystem); err != nil {
+			t.Errorf("%q: unexpected error: %v", subsystem, err)
+		}
+	}
+	if calls != 4 {
+		t.Errorf("mismatched calls, actual %d expected %d", calls, 4)
+	}
+}
+
+func TestValidateAPIRateLimits(t *testing.T) {
+	tests := []struct {
+		limits map[string]APIRateLimit
+		valid  bool
+	}{
+		{nil, true},
+		{map[string]APIRateLimit{"instances": {QPS: 5}, "loadbalancer": {QPS: 2, Burst: 5}, "reaper": {QPS: 0.5}}, true},
+		{map[string]APIRateLimit{"routes": {QPS: 5}}, false},
+		{map[string]APIRateLimit{"reaper": {QPS: 0}}, false},
+		{map[string]APIRateLimit{"reaper": {QPS: 1, Burst: -1}}, false},
+	}
+	for i, tt := range tests {
+		if err := validateAPIRateLimits(tt.limits); (err == nil) != tt.valid {
+			t.Errorf("%d: mismatched validity, actual error %v expected valid %t", i, err, tt.valid)
+		}
+	}
+}
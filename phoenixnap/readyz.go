@@ -0,0 +1,79 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/klog/v2"
+)
+
+// readyzHandler returns the handler of /readyz, which fails while the load balancer implementation, if any, is not
+// ready, and, if withPprof, of the pprof endpoints. The health of the controllers and the metrics are served by the
+// controller manager on its own port.
+func readyzHandler(lb *loadBalancers, withPprof bool) http.Handler {
+	mux := http.NewServeMux()
+	var checks []healthz.HealthChecker
+	if lb != nil && lb.implementor != nil {
+		checks = append(checks, healthz.NamedCheck("loadbalancer-implementation", func(r *http.Request) error {
+			return lb.implementorNotReady()
+		}))
+	}
+	healthz.InstallReadyzHandler(mux, checks...)
+	if withPprof {
+		installPprof(mux)
+	}
+	return mux
+}
+
+// installPprof installs the pprof endpoints under /debug/pprof/ in mux, for clients on localhost only. The readiness
+// address usually is reachable by the kubelet from outside the pod, while profiles and goroutine dumps are not for
+// anyone who can reach the pod; kubectl port-forward connects from localhost.
+func installPprof(mux *http.ServeMux) {
+	mux.Handle("/debug/pprof/", localhostOnly(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", localhostOnly(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", localhostOnly(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", localhostOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", localhostOnly(http.HandlerFunc(pprof.Trace)))
+}
+
+// localhostOnly returns a handler that rejects requests that do not come from a loopback address
+func localhostOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "only served to localhost", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startReadyz serves /readyz, and the pprof endpoints if withPprof, on addr until stop is closed
+func startReadyz(wg *sync.WaitGroup, stop <-chan struct{}, addr string, lb *loadBalancers, withPprof bool) {
+	srv := &http.Server{Addr: addr, Handler: readyzHandler(lb, withPprof)}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-stop
+		if err := srv.Shutdown(context.Background()); err != nil {
+			klog.Errorf("readiness server shutdown: %v", err)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if withPprof {
+			klog.Infof("serving /readyz, and /debug/pprof/ to localhost, on %s", addr)
+		} else {
+			klog.Infof("serving /readyz on %s", addr)
+		}
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("readiness server failed: %v", err)
+		}
+	}()
+}
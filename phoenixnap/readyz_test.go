@@ -0,0 +1,42 @@
+package phoenixnap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyzPprof(t *testing.T) {
+	tests := []struct {
+		name       string
+		withPprof  bool
+		remoteAddr string
+		status     int
+	}{
+		{"disabled", false, "127.0.0.1:40000", http.StatusNotFound},
+		{"localhost", true, "127.0.0.1:40000", http.StatusOK},
+		{"localhost IPv6", true, "[::1]:40000", http.StatusOK},
+		{"remote", true, "192.0.2.1:40000", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := readyzHandler(nil, tt.withPprof)
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("mismatched status, actual %d expected %d", rec.Code, tt.status)
+			}
+
+			// /readyz is served to anyone either way
+			req = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("mismatched /readyz status, actual %d expected %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+}
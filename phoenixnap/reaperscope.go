@@ -0,0 +1,50 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+)
+
+// reaperScope restricts the reaper to released IP blocks that carry an operator-supplied tag, for a cautious
+// rollout in which the CCM only ever deletes blocks explicitly marked for automation. The zero value is no scope:
+// all released blocks of the cluster are reaped.
+type reaperScope struct {
+	// tag the name of the tag; empty for no scope
+	tag string
+	// value the value the tag must have; empty for any value
+	value string
+}
+
+// parseReaperScope parses a scope of the form "<name>" or "<name>=<value>"; the empty string is no scope
+func parseReaperScope(scope string) (reaperScope, error) {
+	if scope == "" {
+		return reaperScope{}, nil
+	}
+	name, value, _ := strings.Cut(scope, "=")
+	if err := validateTagName(name); err != nil {
+		return reaperScope{}, fmt.Errorf("invalid reaper scope tag: %w", err)
+	}
+	return reaperScope{tag: name, value: value}, nil
+}
+
+// includes whether the reaper may delete block
+func (s reaperScope) includes(block ipapi.IpBlock) bool {
+	if s.tag == "" {
+		return true
+	}
+	value, ok := blockTagValue(block, s.tag)
+	return ok && (s.value == "" || value == s.value)
+}
+
+func (s reaperScope) String() string {
+	switch {
+	case s.tag == "":
+		return "all released blocks"
+	case s.value == "":
+		return fmt.Sprintf("released blocks with tag %s", s.tag)
+	default:
+		return fmt.Sprintf("released blocks with tag %s=%s", s.tag, s.value)
+	}
+}
@@ -0,0 +1,78 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseReaperScope(t *testing.T) {
+	tests := []struct {
+		scope    string
+		expected reaperScope
+		err      bool
+	}{
+		{"", reaperScope{}, false},
+		{"automation", reaperScope{tag: "automation"}, false},
+		{"automation=ccm", reaperScope{tag: "automation", value: "ccm"}, false},
+		{"=ccm", reaperScope{}, true},
+		{"auto.mation", reaperScope{}, true},
+	}
+	for i, tt := range tests {
+		scope, err := parseReaperScope(tt.scope)
+		switch {
+		case tt.err && err == nil:
+			t.Errorf("%d: expected error for %q", i, tt.scope)
+		case !tt.err && err != nil:
+			t.Errorf("%d: unexpected error for %q: %v", i, tt.scope, err)
+		case !tt.err && scope != tt.expected:
+			t.Errorf("%d: mismatched scope, actual %+v expected %+v", i, scope, tt.expected)
+		}
+	}
+}
+
+func TestReapScope(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+	l, backend, _ := testGetLoadBalancers(t, 0, svc1, svc2)
+	l.reaperScope = reaperScope{tag: "automation", value: "ccm"}
+
+	for _, svc := range []*v1.Service{svc1, svc2} {
+		if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// only the block of svc1 is marked for automation
+	ccm := "ccm"
+	blocks, _ := backend.ListIPBlocks()
+	for _, block := range blocks {
+		if name, _ := blockTagValue(*block, serviceNameTag); name != svc1.Name {
+			continue
+		}
+		updated := *block
+		updated.Tags = append(append([]ipapi.TagAssignment(nil), block.Tags...), ipapi.TagAssignment{Name: "automation", Value: &ccm})
+		if err := backend.UpdateIPBlock(&updated); err != nil {
+			t.Fatalf("unable to update IP block: %v", err)
+		}
+	}
+	l.blockCache.invalidate()
+	for _, svc := range []*v1.Service{svc1, svc2} {
+		if err := l.EnsureLoadBalancerDeleted(context.TODO(), "", svc); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// first unassigns, second deletes
+	_ = l.reap(context.TODO())
+	_ = l.reap(context.TODO())
+
+	blocks, _ = backend.ListIPBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("mismatched IP blocks, actual %d expected %d", len(blocks), 1)
+	}
+	if _, ok := blockTagValue(*blocks[0], "automation"); ok {
+		t.Errorf("block in the reaper scope was not deleted")
+	}
+}
@@ -0,0 +1,104 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// reapLog logs what the reaper finds for each block, or for the list of blocks, only when it changes from one cycle
+// to the next, so that a healthy cluster, or a block stuck in the same state, does not log the same line every
+// gcIterationSeconds. An error that repeats is counted, and logged again with its count every reapLogRepeatCycles
+// cycles; once it no longer occurs, that is logged with the count. Repeats of other messages are logged at V(4).
+// The zero value is ready to use.
+type reapLog struct {
+	mutex sync.Mutex
+	// last the last message for each key, e.g. a block ID
+	last map[string]reapLogEntry
+	// seen the keys with a message in the current cycle
+	seen map[string]bool
+	// output logs msg, as an error if err; to klog if nil, elsewhere in tests
+	output func(err bool, msg string)
+}
+
+// reapLogEntry a message of the reaper, and in how many cycles in a row it was logged
+type reapLogEntry struct {
+	msg   string
+	err   bool
+	count int
+}
+
+// begin starts a cycle of the reaper
+func (r *reapLog) begin() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.seen = map[string]bool{}
+}
+
+// errorf logs an error for key, if it is not the same as in the last cycle
+func (r *reapLog) errorf(key, format string, args ...any) {
+	r.log(key, true, fmt.Sprintf(format, args...))
+}
+
+// infof logs a message for key, if it is not the same as in the last cycle
+func (r *reapLog) infof(key, format string, args ...any) {
+	r.log(key, false, fmt.Sprintf(format, args...))
+}
+
+func (r *reapLog) log(key string, err bool, msg string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.last == nil {
+		r.last = map[string]reapLogEntry{}
+	}
+	if r.seen != nil {
+		r.seen[key] = true
+	}
+	last, ok := r.last[key]
+	if ok && last.msg == msg && last.err == err {
+		last.count++
+		r.last[key] = last
+		switch {
+		case err && last.count%reapLogRepeatCycles == 0:
+			r.print(true, fmt.Sprintf("%s (repeated in %d cycles)", msg, last.count))
+		case klog.V(4).Enabled():
+			klog.V(4).Infof("%s (repeated in %d cycles)", msg, last.count)
+		}
+		return
+	}
+	if ok && last.err {
+		r.print(false, fmt.Sprintf("%s: no longer occurs, after %d cycles", last.msg, last.count))
+	}
+	r.last[key] = reapLogEntry{msg: msg, err: err, count: 1}
+	r.print(err, msg)
+}
+
+// end ends a cycle of the reaper, forgetting the keys without a message in it, e.g. blocks that were deleted, and
+// logging that their errors no longer occur
+func (r *reapLog) end() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, last := range r.last {
+		if r.seen[key] {
+			continue
+		}
+		if last.err {
+			r.print(false, fmt.Sprintf("%s: no longer occurs, after %d cycles", last.msg, last.count))
+		}
+		delete(r.last, key)
+	}
+	r.seen = nil
+}
+
+// print logs msg, at the caller of the reaper function that logged it
+func (r *reapLog) print(err bool, msg string) {
+	switch {
+	case r.output != nil:
+		r.output(err, msg)
+	case err:
+		klog.ErrorDepth(3, msg)
+	default:
+		klog.InfoDepth(3, msg)
+	}
+}
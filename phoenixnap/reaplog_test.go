@@ -0,0 +1,53 @@
+package phoenixnap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReapLog(t *testing.T) {
+	var lines []string
+	r := reapLog{output: func(err bool, msg string) {
+		if err {
+			msg = "E " + msg
+		}
+		lines = append(lines, msg)
+	}}
+	cycle := func(log func()) []string {
+		lines = nil
+		r.begin()
+		log()
+		r.end()
+		return lines
+	}
+
+	tests := []struct {
+		name     string
+		cycles   int
+		log      func()
+		expected []string
+	}{
+		{"first error", 1, func() { r.errorf("a", "unable to delete") }, []string{"E unable to delete"}},
+		// repeats are counted, and only logged every reapLogRepeatCycles
+		{"repeated error", reapLogRepeatCycles - 2, func() { r.errorf("a", "unable to delete") }, nil},
+		{"repeated error logged", 1, func() { r.errorf("a", "unable to delete") }, []string{"E unable to delete (repeated in 20 cycles)"}},
+		{"changed", 1, func() { r.infof("a", "unassigning") }, []string{"unable to delete: no longer occurs, after 20 cycles", "unassigning"}},
+		{"repeated info", 5, func() { r.infof("a", "unassigning") }, nil},
+		{"other key", 1, func() {
+			r.infof("a", "unassigning")
+			r.errorf("b", "not ours")
+		}, []string{"E not ours"}},
+		// a key without a message in a cycle is forgotten
+		{"gone", 1, func() {}, []string{"not ours: no longer occurs, after 1 cycles"}},
+		{"again", 1, func() { r.infof("a", "unassigning") }, []string{"unassigning"}},
+	}
+	for _, tt := range tests {
+		var actual []string
+		for i := 0; i < tt.cycles; i++ {
+			actual = append(actual, cycle(tt.log)...)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: mismatched lines, actual %q expected %q", tt.name, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package phoenixnap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// recordReconcileResult sets the reconcile error annotation on the service to the time and err,
+// or removes it if err is nil, so that users can see why a Service is stuck without access to
+// the CCM logs. It does nothing unless enabled, and only logs if it fails.
+func (l *loadBalancers) recordReconcileResult(ctx context.Context, service *v1.Service, err error) {
+	if !l.reconcileErrorAnnotation {
+		return
+	}
+	_, exists := service.Annotations[annotationReconcileError]
+	if err == nil && !exists {
+		return
+	}
+	// a nil value removes the annotation in a merge patch
+	var value *string
+	if err != nil {
+		v := fmt.Sprintf("%s: %v", time.Now().UTC().Format(time.RFC3339), err)
+		value = &v
+	}
+	patch, _ := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]*string{annotationReconcileError: value},
+		},
+	})
+	if _, perr := l.k8sclient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{}); perr != nil {
+		klog.V(2).Infof("unable to set annotation %s on service %s: %v", annotationReconcileError, serviceRep(service), perr)
+	}
+}
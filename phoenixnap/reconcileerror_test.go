@@ -0,0 +1,42 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordReconcileResult(t *testing.T) {
+	svc1, svc2 := testService("default", "svc1"), testService("default", "svc2")
+	l, _, _ := testGetLoadBalancers(t, 1, svc1, svc2)
+	l.reconcileErrorAnnotation = true
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc1, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// at the maximum, so it fails
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc2, nil); err == nil {
+		t.Fatalf("expected error once at maximum IP blocks")
+	}
+	latest, err := l.k8sclient.CoreV1().Services(svc2.Namespace).Get(context.TODO(), svc2.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get service: %v", err)
+	}
+	if latest.Annotations[annotationReconcileError] == "" {
+		t.Fatalf("annotation %s not set after failure", annotationReconcileError)
+	}
+
+	// success clears it
+	l.maxIPBlocks = 0
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", latest, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	latest, err = l.k8sclient.CoreV1().Services(svc2.Namespace).Get(context.TODO(), svc2.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get service: %v", err)
+	}
+	if _, ok := latest.Annotations[annotationReconcileError]; ok {
+		t.Errorf("annotation %s still set after success", annotationReconcileError)
+	}
+}
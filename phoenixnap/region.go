@@ -0,0 +1,36 @@
+package phoenixnap
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// RegionFormatAsIs the region of nodes is the location of their server as the PhoenixNAP API returns it, e.g. ASH
+	RegionFormatAsIs = ""
+	// RegionFormatUpper the region of nodes is the location of their server in upper case, e.g. ASH
+	RegionFormatUpper = "upper"
+	// RegionFormatLower the region of nodes is the location of their server in lower case, e.g. ash
+	RegionFormatLower = "lower"
+)
+
+// validateRegionFormat returns an error if format is not one of the region formats
+func validateRegionFormat(format string) error {
+	switch format {
+	case RegionFormatAsIs, RegionFormatUpper, RegionFormatLower:
+		return nil
+	}
+	return fmt.Errorf("invalid region format %q, must be empty, %q or %q", format, RegionFormatUpper, RegionFormatLower)
+}
+
+// formatRegion returns the region of a node whose server is in location, so that it matches the
+// topology.kubernetes.io/region labels set by other means, e.g. by the kubelet
+func formatRegion(location, format string) string {
+	switch format {
+	case RegionFormatUpper:
+		return strings.ToUpper(location)
+	case RegionFormatLower:
+		return strings.ToLower(location)
+	}
+	return location
+}
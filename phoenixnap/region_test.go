@@ -0,0 +1,60 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestFormatRegion(t *testing.T) {
+	tests := []struct {
+		format string
+		region string
+	}{
+		{RegionFormatAsIs, "Ash"},
+		{RegionFormatUpper, "ASH"},
+		{RegionFormatLower, "ash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if err := validateRegionFormat(tt.format); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if region := formatRegion("Ash", tt.format); region != tt.region {
+				t.Errorf("mismatched region, actual %s expected %s", region, tt.region)
+			}
+		})
+	}
+	if err := validateRegionFormat("title"); err == nil {
+		t.Errorf("expected error for invalid region format")
+	}
+}
+
+func TestInstanceRegionFormat(t *testing.T) {
+	vc, backend := testGetValidCloud(t, "")
+	inst, _ := vc.InstancesV2()
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	inst.(*instances).regionFormat = RegionFormatLower
+
+	md, err := inst.InstanceMetadata(context.TODO(), testNode(fmt.Sprintf("phoenixnap://%s", server.Id), nodeName))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := formatRegion(server.Location, RegionFormatLower); md.Region != expected {
+		t.Errorf("mismatched region, actual %s expected %s", md.Region, expected)
+	}
+
+	// nodes labelled with the formatted region are in the location of the load balancer
+	node := testNode("", "node1")
+	node.Labels = map[string]string{v1.LabelTopologyRegion: md.Region}
+	if nodes := nodesInLocation([]*v1.Node{node}, server.Location); len(nodes) != 1 {
+		t.Errorf("node with region %s is not in location %s", md.Region, server.Location)
+	}
+}
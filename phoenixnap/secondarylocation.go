@@ -0,0 +1,229 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// A Service with the secondary location annotation gets a second IP block, in the secondary location, assigned to
+// the public network there, and both IPs in its status. The implementation announces the second IP from the nodes
+// in that location, so that the Service still is reachable if the load balancer location is not. Each block is
+// managed in the account of its location, so the locations may be in different accounts. The second block is tagged with secondaryServiceTag rather than the
+// service tags, so that all that handles the one block of a Service is unaffected by it.
+
+// secondaryLocation the location, and its public network, in which Services with the annotation get a second IP block
+type secondaryLocation struct {
+	location string
+	network  string
+}
+
+// secondaryLocationFromService returns whether the service asks for a second IP in the secondary location
+func secondaryLocationFromService(svc *v1.Service) (bool, error) {
+	value, ok := svc.Annotations[annotationSecondaryLocation]
+	if !ok {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("annotation %s must be true or false, was %q", annotationSecondaryLocation, value)
+	}
+	return enabled, nil
+}
+
+// networkForLocation returns the public network to which the blocks of the cluster in location are assigned
+func (l *loadBalancers) networkForLocation(location string) string {
+	if l.secondary != nil && location == l.secondary.location {
+		return l.secondary.network
+	}
+	return l.network
+}
+
+// secondaryBlocks returns the active IP blocks in the secondary location of the service
+func (l *loadBalancers) secondaryBlocks(ctx context.Context, namespace, name string) ([]ipapi.IpBlock, error) {
+	all, err := l.getIPBlocks(ctx, "", "", true, false)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []ipapi.IpBlock
+	for _, block := range all {
+		if value, ok := blockTagValue(block, secondaryServiceTag); ok && value == namespace+"/"+name {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+// secondaryIP returns the IP of the service in its secondary block, if it has one, or "" if not
+func (l *loadBalancers) secondaryIP(ctx context.Context, service *v1.Service) (string, error) {
+	blocks, err := l.secondaryBlocks(ctx, service.Namespace, service.Name)
+	if err != nil || len(blocks) != 1 {
+		return "", err
+	}
+	ip, _ := blockTagValue(blocks[0], assignedIPTag)
+	return ip, nil
+}
+
+// withSecondaryIngress returns status with the ingress of the secondary IP of the service added, if it has one
+func (l *loadBalancers) withSecondaryIngress(ctx context.Context, service *v1.Service, status *v1.LoadBalancerStatus) (*v1.LoadBalancerStatus, error) {
+	if status == nil || l.secondary == nil {
+		return status, nil
+	}
+	ip, err := l.secondaryIP(ctx, service)
+	if err != nil || ip == "" {
+		return status, err
+	}
+	for _, ingress := range status.Ingress {
+		if ingress.IP == ip || ingress.Hostname != "" {
+			// a hostname in proxy mode stands for all IPs
+			return status, nil
+		}
+	}
+	status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{IP: ip})
+	return status, nil
+}
+
+// withoutIngress returns status without the ingress of ip
+func withoutIngress(status *v1.LoadBalancerStatus, ip string) *v1.LoadBalancerStatus {
+	if status == nil || ip == "" {
+		return status
+	}
+	ingress := make([]v1.LoadBalancerIngress, 0, len(status.Ingress))
+	for _, i := range status.Ingress {
+		if i.IP != ip {
+			ingress = append(ingress, i)
+		}
+	}
+	status.Ingress = ingress
+	return status
+}
+
+// ensureSecondary gives the service its IP block in the secondary location, announces its IP from the nodes there
+// and adds it to status, if the service asks for it, or releases the block, if it no longer does
+func (l *loadBalancers) ensureSecondary(ctx context.Context, service *v1.Service, nodes []*v1.Node, status *v1.LoadBalancerStatus) (*v1.LoadBalancerStatus, error) {
+	if externalIPsMode(service) {
+		return status, nil
+	}
+	wanted, err := secondaryLocationFromService(service)
+	if err != nil {
+		if l.recorder != nil {
+			l.recorder.Event(service, v1.EventTypeWarning, eventReasonInvalidSecondaryLocation, err.Error())
+		}
+		return nil, err
+	}
+	announcer, supported := l.implementor.(loadbalancers.SecondaryAnnouncer)
+	supported = supported && l.implementor.Capabilities().SecondaryLocation
+	if !wanted || !supported {
+		// ignored features are warned about with the other service options
+		ip, err := l.secondaryIP(ctx, service)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.releaseSecondary(ctx, service); err != nil {
+			return nil, err
+		}
+		return withoutIngress(status, ip), nil
+	}
+	if l.secondary == nil {
+		msg := fmt.Sprintf("annotation %s is set, but no secondary location is configured", annotationSecondaryLocation)
+		if l.recorder != nil {
+			l.recorder.Event(service, v1.EventTypeWarning, eventReasonInvalidSecondaryLocation, msg)
+		}
+		return status, nil
+	}
+
+	blocks, err := l.secondaryBlocks(ctx, service.Namespace, service.Name)
+	if err != nil {
+		return nil, err
+	}
+	var block *ipapi.IpBlock
+	switch len(blocks) {
+	case 0:
+		ipBlockCreate := ipapi.NewIpBlockCreate(l.secondary.location, fmt.Sprintf("/%d", serviceBlockCidr))
+		usageValue, clusterID, svcName := l.ownership.usageValue, l.clusterID(), serviceRep(service)
+		ipBlockCreate.Tags = []ipapi.TagAssignmentRequest{
+			{Name: l.ownership.usage, Value: &usageValue},
+			{Name: l.ownership.cluster, Value: &clusterID},
+			{Name: secondaryServiceTag, Value: &svcName},
+		}
+		if err := l.tags.ensure(ctx, l.clientsFor(l.secondary.location).tagClient, secondaryServiceTag); err != nil {
+			return nil, fmt.Errorf("unable to ensure tags exist: %w", err)
+		}
+		if block, err = l.createBlock(ctx, service, ipBlockCreate); err != nil {
+			return nil, err
+		}
+	case 1:
+		block = &blocks[0]
+	default:
+		return nil, fmt.Errorf("more than one secondary block found for service %s", serviceRep(service))
+	}
+	if block, err = l.waitForBlock(ctx, block); err != nil {
+		return nil, err
+	}
+	if err := l.assignToNetwork(ctx, service, block, l.secondary.network); err != nil {
+		return nil, err
+	}
+	ip, err := l.recordBlockIP(ctx, *block)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.announceSecondary(ctx, announcer, service, nodes, ip); err != nil {
+		return nil, err
+	}
+	return l.withSecondaryIngress(ctx, service, status)
+}
+
+// announceSecondary passes the secondary IP of the service, with the eligible nodes in the secondary location, to
+// the implementation
+func (l *loadBalancers) announceSecondary(ctx context.Context, announcer loadbalancers.SecondaryAnnouncer, service *v1.Service, nodes []*v1.Node, ip string) error {
+	n := l.implementorNodes(ctx, nodesInLocation(l.eligibleNodes(service, nodes), l.secondary.location))
+	return l.callImplementor(implementorOpAddSecondaryIP, func() error {
+		return announcer.AddSecondaryIP(ctx, service.Namespace, service.Name, fmt.Sprintf("%s/32", ip), n)
+	})
+}
+
+// updateSecondary passes the nodes in the secondary location to the implementation, if the service has a secondary IP
+func (l *loadBalancers) updateSecondary(ctx context.Context, service *v1.Service, nodes []*v1.Node) error {
+	announcer, ok := l.implementor.(loadbalancers.SecondaryAnnouncer)
+	if !ok || l.secondary == nil || externalIPsMode(service) {
+		return nil
+	}
+	ip, err := l.secondaryIP(ctx, service)
+	if err != nil || ip == "" {
+		return err
+	}
+	return l.announceSecondary(ctx, announcer, service, nodes, ip)
+}
+
+// releaseSecondary removes the secondary IP of the service from the implementation and releases its block, if it
+// has one
+func (l *loadBalancers) releaseSecondary(ctx context.Context, service *v1.Service) error {
+	blocks, err := l.secondaryBlocks(ctx, service.Namespace, service.Name)
+	if err != nil || len(blocks) == 0 {
+		return err
+	}
+	for _, block := range blocks {
+		if ip, ok := blockTagValue(block, assignedIPTag); ok && ip != "" {
+			if announcer, ok := l.implementor.(loadbalancers.SecondaryAnnouncer); ok {
+				if err := l.callImplementor(implementorOpRemoveSecondaryIP, func() error {
+					return announcer.RemoveSecondaryIP(ctx, service.Namespace, service.Name, fmt.Sprintf("%s/32", ip))
+				}); err != nil {
+					return fmt.Errorf("failed to remove secondary IP %s of service %s from implementation: %w", ip, serviceRep(service), err)
+				}
+			}
+		}
+		if err := l.releaseBlock(ctx, block); err != nil {
+			return err
+		}
+		klog.V(2).Infof("released secondary block %s of service %s", block.Cidr, serviceRep(service))
+		l.auditBlock(service, block, eventReasonIPBlockReleased)
+	}
+	return nil
+}
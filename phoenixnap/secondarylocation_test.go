@@ -0,0 +1,226 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/loadbalancers"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testSecondaryLB a testRecordingLB that also records the secondary IP of each service
+type testSecondaryLB struct {
+	testRecordingLB
+	secondary map[string]string
+}
+
+func (t *testSecondaryLB) AddSecondaryIP(ctx context.Context, svcNamespace, svcName, ip string, nodes []loadbalancers.Node) error {
+	t.secondary[svcNamespace+"/"+svcName] = ip
+	return nil
+}
+
+func (t *testSecondaryLB) RemoveSecondaryIP(ctx context.Context, svcNamespace, svcName, ip string) error {
+	delete(t.secondary, svcNamespace+"/"+svcName)
+	return nil
+}
+
+func (t *testSecondaryLB) Capabilities() loadbalancers.Capabilities {
+	caps := t.testRecordingLB.Capabilities()
+	caps.SecondaryLocation = true
+	return caps
+}
+
+func TestEnsureLoadBalancerSecondaryLocation(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationSecondaryLocation: "true"}
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	_, _ = backend.CreateLocation("PHX")
+	network, err := backend.CreatePublicNetwork("lb-phx", "PHX")
+	if err != nil {
+		t.Fatalf("unable to create public network: %v", err)
+	}
+	l.secondary = &secondaryLocation{location: "PHX", network: network.Id}
+	lb := &testSecondaryLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		secondary:       map[string]string{},
+	}
+	l.implementor = lb
+	ctx := context.TODO()
+
+	status, err := l.EnsureLoadBalancer(ctx, "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Ingress) != 2 {
+		t.Fatalf("expected 2 ingress IPs, actual %v", status.Ingress)
+	}
+	secondaryIP := status.Ingress[1].IP
+	if actual := lb.secondary["default/svc1"]; actual != secondaryIP+"/32" {
+		t.Errorf("mismatched secondary IP, actual %s expected %s/32", actual, secondaryIP)
+	}
+	blocks, err := l.secondaryBlocks(ctx, "default", "svc1")
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case len(blocks) != 1:
+		t.Fatalf("expected 1 secondary block, actual %d", len(blocks))
+	case blocks[0].Location != "PHX":
+		t.Errorf("mismatched location of secondary block, actual %s expected PHX", blocks[0].Location)
+	case !blockAssignedToNetwork(blocks[0], network.Id):
+		t.Errorf("secondary block not assigned to network %s", network.Id)
+	}
+
+	// ensuring again is idempotent
+	if status, err = l.EnsureLoadBalancer(ctx, "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Ingress) != 2 || status.Ingress[1].IP != secondaryIP {
+		t.Errorf("mismatched ingress after second ensure, actual %v", status.Ingress)
+	}
+
+	// removing the annotation releases the secondary block
+	svc.Annotations = nil
+	if status, err = l.EnsureLoadBalancer(ctx, "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Ingress) != 1 {
+		t.Errorf("expected 1 ingress IP without the annotation, actual %v", status.Ingress)
+	}
+	if _, ok := lb.secondary["default/svc1"]; ok {
+		t.Errorf("secondary IP not removed from implementation")
+	}
+	if blocks, _ = l.secondaryBlocks(ctx, "default", "svc1"); len(blocks) != 0 {
+		t.Errorf("secondary block not released, actual %d", len(blocks))
+	}
+}
+
+func TestEnsureLoadBalancerSecondaryLocationAccount(t *testing.T) {
+	// the secondary location has credentials of its own, so its block is in that account
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationSecondaryLocation: "true"}
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	account, accountBackend := testGetAccount(t, "PHX", "net-phx")
+	// the accounts allocate CIDRs alike; take the first in this one, so that the IPs of the Service differ
+	if _, err := accountBackend.CreateIPBlock("PHX", serviceBlockCidr, nil); err != nil {
+		t.Fatalf("unable to create IP block: %v", err)
+	}
+	l.locationClients = map[string]*apiClients{"PHX": account}
+	l.secondary = &secondaryLocation{location: "PHX", network: "net-phx"}
+	lb := &testSecondaryLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		secondary:       map[string]string{},
+	}
+	l.implementor = lb
+	ctx := context.TODO()
+
+	status, err := l.EnsureLoadBalancer(ctx, "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Ingress) != 2 {
+		t.Fatalf("expected 2 ingress IPs, actual %v", status.Ingress)
+	}
+	primary, _ := backend.ListIPBlocks()
+	if len(primary) != 1 || primary[0].Location != validLocationName {
+		t.Errorf("expected 1 block in %s in the default account, actual %v", validLocationName, primary)
+	}
+	blocks, err := l.secondaryBlocks(ctx, "default", "svc1")
+	if err != nil || len(blocks) != 1 {
+		t.Fatalf("expected 1 secondary block, actual %v error %v", blocks, err)
+	}
+	secondary, err := accountBackend.GetIPBlock(blocks[0].Id)
+	switch {
+	case err != nil:
+		t.Errorf("expected the secondary block in the PHX account: %v", err)
+	case !blockAssignedToNetwork(*secondary, "net-phx"):
+		t.Errorf("secondary block not assigned to network net-phx")
+	}
+
+	// the secondary block is released in its account
+	svc.Annotations = nil
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocks, _ := l.secondaryBlocks(ctx, "default", "svc1"); len(blocks) != 0 {
+		t.Errorf("secondary block not released, actual %d", len(blocks))
+	}
+}
+
+func TestEnsureLoadBalancerDeletedSecondaryLocation(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationSecondaryLocation: "true"}
+	l, backend, _ := testGetLoadBalancers(t, 0, svc)
+	_, _ = backend.CreateLocation("PHX")
+	network, err := backend.CreatePublicNetwork("lb-phx", "PHX")
+	if err != nil {
+		t.Fatalf("unable to create public network: %v", err)
+	}
+	l.secondary = &secondaryLocation{location: "PHX", network: network.Id}
+	lb := &testSecondaryLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		secondary:       map[string]string{},
+	}
+	l.implementor = lb
+	ctx := context.TODO()
+
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.EnsureLoadBalancerDeleted(ctx, "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lb.secondary) != 0 {
+		t.Errorf("secondary IP not removed from implementation, actual %v", lb.secondary)
+	}
+	if blocks, _ := l.secondaryBlocks(ctx, "default", "svc1"); len(blocks) != 0 {
+		t.Errorf("secondary block not released, actual %d", len(blocks))
+	}
+}
+
+func TestEnsureLoadBalancerSecondaryLocationUnconfigured(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Annotations = map[string]string{annotationSecondaryLocation: "true"}
+	l, _, recorder := testGetLoadBalancers(t, 0, svc)
+	l.implementor = &testSecondaryLB{
+		testRecordingLB: testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}},
+		secondary:       map[string]string{},
+	}
+
+	status, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Ingress) != 1 {
+		t.Errorf("expected 1 ingress IP, actual %v", status.Ingress)
+	}
+	if count := testCountEvents(testDrainEvents(recorder), eventReasonInvalidSecondaryLocation); count != 1 {
+		t.Errorf("expected 1 %s event, actual %d", eventReasonInvalidSecondaryLocation, count)
+	}
+}
+
+func TestSecondaryLocationFromService(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		enabled     bool
+		valid       bool
+	}{
+		{nil, false, true},
+		{map[string]string{annotationSecondaryLocation: "true"}, true, true},
+		{map[string]string{annotationSecondaryLocation: "false"}, false, true},
+		{map[string]string{annotationSecondaryLocation: "yes please"}, false, false},
+	}
+	for _, tt := range tests {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+		enabled, err := secondaryLocationFromService(svc)
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("unexpected error for %v: %v", tt.annotations, err)
+		case !tt.valid && err == nil:
+			t.Errorf("expected error for %v", tt.annotations)
+		case enabled != tt.enabled:
+			t.Errorf("mismatched enabled for %v, actual %v expected %v", tt.annotations, enabled, tt.enabled)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenPath the path of the token endpoint, as of the PhoenixNAP auth server
+const TokenPath = "/auth/realms/BMC/protocol/openid-connect/token"
+
+// defaultTokenTTL how long tokens are valid unless configured otherwise
+const defaultTokenTTL = time.Hour
+
+// Auth validates the bearer tokens of API calls, as the PhoenixNAP API does, and issues them to a single
+// client with the client credentials grant. Each API requires a scope: tags for the tag manager, bmc for the
+// others; calls that only read accept the read scope instead, e.g. bmc.read.
+type Auth struct {
+	ClientID     string
+	ClientSecret string
+	// Scopes the scopes the client may request; a token has those requested, or all of them if none are
+	Scopes []string
+	// TokenTTL how long the issued tokens are valid; if 0, an hour
+	TokenTTL time.Duration
+
+	mutex  sync.Mutex
+	tokens map[string]issuedToken
+	issued int
+}
+
+// issuedToken a token issued by the token endpoint
+type issuedToken struct {
+	scopes []string
+	expiry time.Time
+}
+
+// Issued returns the number of tokens issued so far
+func (a *Auth) Issued() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.issued
+}
+
+// Revoke invalidates all tokens issued so far, as if the credentials were rotated
+func (a *Auth) Revoke() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.tokens = nil
+}
+
+// tokenHandler issues a token for the client credentials grant
+func (a *Auth) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if grant := r.PostForm.Get("grant_type"); grant != "client_credentials" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != a.ClientID || clientSecret != a.ClientSecret {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+	for _, scope := range scopes {
+		if !containsScope(a.Scopes, scope) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope")
+			return
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = a.Scopes
+	}
+	ttl := a.TokenTTL
+	if ttl == 0 {
+		ttl = defaultTokenTTL
+	}
+
+	token := uuid.New().String()
+	a.mutex.Lock()
+	if a.tokens == nil {
+		a.tokens = map[string]issuedToken{}
+	}
+	a.tokens[token] = issuedToken{scopes: scopes, expiry: time.Now().Add(ttl)}
+	a.issued++
+	a.mutex.Unlock()
+
+	_ = writeJSON(w, map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(ttl.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// middleware rejects calls without a valid bearer token with 401, and those whose token lacks the scope with 403
+func (a *Auth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		ok := strings.HasPrefix(header, "Bearer ")
+		bearer := strings.TrimPrefix(header, "Bearer ")
+		a.mutex.Lock()
+		token, known := a.tokens[bearer]
+		a.mutex.Unlock()
+		if !ok || !known || !time.Now().Before(token.expiry) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusUnauthorized, Message: "missing, invalid or expired token"})
+			return
+		}
+		scope := requiredScope(r)
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if !containsScope(token.scopes, scope) && !(readOnly && containsScope(token.scopes, scope+".read")) {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusForbidden, Message: "token does not have the scope " + scope})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredScope the scope that a call needs, or whose read scope suffices for a call that only reads
+func requiredScope(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/tag-manager/") {
+		return "tags"
+	}
+	return "bmc"
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOAuthError writes an error response of the token endpoint, as of RFC 6749
+func writeOAuthError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
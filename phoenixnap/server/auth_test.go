@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+)
+
+// testRequestToken requests a token from the handler with the client credentials in the form, and returns
+// the status and the token, if any
+func testRequestToken(t *testing.T, handler http.Handler, clientID, clientSecret, scope string) (int, string) {
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {clientID}, "client_secret": {clientSecret}, "scope": {scope}}
+	req := httptest.NewRequest(http.MethodPost, TokenPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp.AccessToken
+}
+
+// testAuthorizedCall returns the status of a call to the handler with the bearer token, if not empty
+func testAuthorizedCall(handler http.Handler, method, path, token string) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestAuthToken(t *testing.T) {
+	mem, _ := store.NewMemory()
+	auth := &Auth{ClientID: "client-1", ClientSecret: "secret-1", Scopes: []string{"bmc", "bmc.read", "tags.read"}}
+	handler := (&Server{Store: mem, Auth: auth}).CreateHandler()
+
+	tests := []struct {
+		clientID, clientSecret, scope string
+		status                        int
+	}{
+		{"client-1", "secret-1", "bmc.read tags.read", http.StatusOK},
+		{"client-1", "secret-1", "", http.StatusOK},
+		{"client-1", "wrong", "bmc.read", http.StatusUnauthorized},
+		{"client-2", "secret-1", "bmc.read", http.StatusUnauthorized},
+		{"client-1", "secret-1", "tags", http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		status, token := testRequestToken(t, handler, tt.clientID, tt.clientSecret, tt.scope)
+		if status != tt.status || (status == http.StatusOK) != (token != "") {
+			t.Errorf("%d: mismatched status %d and token %q, expected status %d", i, status, token, tt.status)
+		}
+	}
+	if auth.Issued() != 2 {
+		t.Errorf("mismatched tokens issued, actual %d expected %d", auth.Issued(), 2)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	mem, _ := store.NewMemory()
+	auth := &Auth{ClientID: "client-1", ClientSecret: "secret-1", Scopes: []string{"bmc", "bmc.read", "tags.read"}}
+	handler := (&Server{Store: mem, Auth: auth}).CreateHandler()
+	_, read := testRequestToken(t, handler, "client-1", "secret-1", "bmc.read tags.read")
+	_, write := testRequestToken(t, handler, "client-1", "secret-1", "bmc")
+
+	tests := []struct {
+		method, path, token string
+		status              int
+	}{
+		{http.MethodGet, "/bmc/v1/servers", "", http.StatusUnauthorized},
+		{http.MethodGet, "/bmc/v1/servers", "unknown", http.StatusUnauthorized},
+		{http.MethodGet, "/bmc/v1/servers", read, http.StatusOK},
+		{http.MethodGet, "/bmc/v1/servers", write, http.StatusOK},
+		{http.MethodPatch, "/bmc/v1/servers/unknown", read, http.StatusForbidden},
+		{http.MethodPatch, "/bmc/v1/servers/unknown", write, http.StatusNotFound},
+		{http.MethodGet, "/tag-manager/v1/tags", read, http.StatusOK},
+		{http.MethodGet, "/tag-manager/v1/tags", write, http.StatusForbidden},
+		{http.MethodPost, "/tag-manager/v1/tags", read, http.StatusForbidden},
+	}
+	for i, tt := range tests {
+		if status := testAuthorizedCall(handler, tt.method, tt.path, tt.token); status != tt.status {
+			t.Errorf("%d: %s %s: mismatched status, actual %d expected %d", i, tt.method, tt.path, status, tt.status)
+		}
+	}
+
+	// revoked and expired tokens are not accepted
+	auth.Revoke()
+	if status := testAuthorizedCall(handler, http.MethodGet, "/bmc/v1/servers", read); status != http.StatusUnauthorized {
+		t.Errorf("mismatched status with a revoked token, actual %d expected %d", status, http.StatusUnauthorized)
+	}
+	auth.TokenTTL = time.Nanosecond
+	_, expired := testRequestToken(t, handler, "client-1", "secret-1", "bmc.read")
+	time.Sleep(time.Millisecond)
+	if status := testAuthorizedCall(handler, http.MethodGet, "/bmc/v1/servers", expired); status != http.StatusUnauthorized {
+		t.Errorf("mismatched status with an expired token, actual %d expected %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestNoAuth(t *testing.T) {
+	// without auth, calls are not authenticated, and there is no token endpoint
+	mem, _ := store.NewMemory()
+	handler := (&Server{Store: mem}).CreateHandler()
+	if status := testAuthorizedCall(handler, http.MethodGet, "/bmc/v1/servers", ""); status != http.StatusOK {
+		t.Errorf("mismatched status without auth, actual %d expected %d", status, http.StatusOK)
+	}
+	if status, _ := testRequestToken(t, handler, "client-1", "secret-1", ""); status != http.StatusNotFound {
+		t.Errorf("mismatched status of the token endpoint without auth, actual %d expected %d", status, http.StatusNotFound)
+	}
+}
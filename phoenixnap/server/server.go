@@ -2,14 +2,23 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/phoenixnap/go-sdk-bmc/billingapi"
 	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
+	"github.com/phoenixnap/go-sdk-bmc/tagapi"
 	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
 )
 
+// publicNetworkResourceType the assignedResourceType of IP blocks assigned to a public network
+const publicNetworkResourceType = "PUBLIC_NETWORK"
+
 // ErrorHandler a handler for errors that can choose to exit or not
 // if it wants, it can exit entirely
 type ErrorHandler interface {
@@ -20,6 +29,8 @@ type ErrorHandler interface {
 type Server struct {
 	Store store.DataStore
 	ErrorHandler
+	// Auth if set, the API calls must have a bearer token that it issued, with the scope of the API
+	Auth *Auth
 }
 
 type ErrorResponse struct {
@@ -46,6 +57,42 @@ func (c *Server) CreateHandler() http.Handler {
 	billing.HandleFunc("/products", c.listProductsHandler).Methods("GET")
 	// list all locations
 	billing.HandleFunc("/locations", c.listLocationsHandler).Methods("GET")
+
+	ips := r.PathPrefix("/ips/v1").Subrouter()
+	// list all IP blocks, optionally filtered by tag
+	ips.HandleFunc("/ip-blocks", c.listIPBlocksHandler).Methods("GET")
+	// create an IP block
+	ips.HandleFunc("/ip-blocks", c.createIPBlockHandler).Methods("POST")
+	// get a single IP block
+	ips.HandleFunc("/ip-blocks/{ipBlockID}", c.getIPBlockHandler).Methods("GET")
+	// delete an IP block
+	ips.HandleFunc("/ip-blocks/{ipBlockID}", c.deleteIPBlockHandler).Methods("DELETE")
+	// replace the tags on an IP block
+	ips.HandleFunc("/ip-blocks/{ipBlockID}/tags", c.putIPBlockTagsHandler).Methods("PUT")
+
+	networks := r.PathPrefix("/networks/v1").Subrouter()
+	// assign an IP block to a public network
+	networks.HandleFunc("/public-networks/{networkID}/ip-blocks", c.assignIPBlockHandler).Methods("POST")
+	// unassign an IP block from a public network
+	networks.HandleFunc("/public-networks/{networkID}/ip-blocks/{ipBlockID}", c.unassignIPBlockHandler).Methods("DELETE")
+	// get a single public network
+	networks.HandleFunc("/public-networks/{networkID}", c.getPublicNetworkHandler).Methods("GET")
+	// get a single private network
+	networks.HandleFunc("/private-networks/{networkID}", c.getPrivateNetworkHandler).Methods("GET")
+
+	tags := r.PathPrefix("/tag-manager/v1").Subrouter()
+	// list all tags
+	tags.HandleFunc("/tags", c.listTagsHandler).Methods("GET")
+	// create a tag
+	tags.HandleFunc("/tags", c.createTagHandler).Methods("POST")
+
+	if c.Auth != nil {
+		// issue tokens for the client credentials grant
+		r.HandleFunc(TokenPath, c.Auth.tokenHandler).Methods("POST")
+		for _, api := range []*mux.Router{bmc, billing, ips, networks, tags} {
+			api.Use(c.Auth.middleware)
+		}
+	}
 	return r
 }
 
@@ -77,12 +124,23 @@ func (c *Server) listProductsHandler(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to list products"})
 		return
 	}
-	var resp = struct {
-		products []*billingapi.Product
-	}{
-		products: products,
+	// like the real API, server products carry their metadata
+	category := r.URL.Query().Get("productCategory")
+	resp := []any{}
+	for _, product := range products {
+		if category != "" && product.ProductCategory != category {
+			continue
+		}
+		metadata, _ := c.Store.GetProductMetadata(product.ProductCode)
+		if product.ProductCategory != "SERVER" || metadata == nil {
+			resp = append(resp, product)
+			continue
+		}
+		serverProduct := billingapi.NewServerProduct(product.ProductCode, product.ProductCategory, *metadata)
+		serverProduct.Plans = product.Plans
+		resp = append(resp, serverProduct)
 	}
-	if err := writeJSON(w, &resp); err != nil {
+	if err := writeJSON(w, resp); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
 		return
@@ -158,12 +216,13 @@ func (c *Server) createServerHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "not found"})
 }
 
-// update a server
+// update a server, with the merge semantics of PATCH: only the fields in the body are changed,
+// and a null description clears it
 func (c *Server) updateServerHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	serverID := vars["serverID"]
 	// read the body of the request
-	var req bmcapi.ServerPatch
+	var req map[string]json.RawMessage
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "unable to parse body of request"})
@@ -176,23 +235,319 @@ func (c *Server) updateServerHandler(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "unknown server ID"})
 		return
 	}
-	if server != nil {
-		server.Hostname = *req.Hostname
-		server.Description = req.Description
-		server.Id = serverID
-		if err := c.Store.UpdateServer(server); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to update server"})
-			return
+	if server == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "not found"})
+		return
+	}
+	// patch a copy, so the stored server is unchanged if the patch is invalid
+	updated := *server
+	if err := patchServer(&updated, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	if err := c.Store.UpdateServer(&updated); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to update server"})
+		return
+	}
+	if err := writeJSON(w, &updated); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// patchServer sets the fields of server that are in patch, the body of a server PATCH by field name
+func patchServer(server *bmcapi.Server, patch map[string]json.RawMessage) error {
+	for field, raw := range patch {
+		switch field {
+		case "hostname":
+			var hostname *string
+			if err := json.Unmarshal(raw, &hostname); err != nil {
+				return fmt.Errorf("invalid hostname: %w", err)
+			}
+			if hostname == nil || *hostname == "" {
+				return fmt.Errorf("hostname must not be empty")
+			}
+			server.Hostname = *hostname
+		case "description":
+			var description *string
+			if err := json.Unmarshal(raw, &description); err != nil {
+				return fmt.Errorf("invalid description: %w", err)
+			}
+			server.Description = description
+		default:
+			return fmt.Errorf("unknown field %s", field)
 		}
-		if err := writeJSON(w, &server); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+	return nil
+}
+
+// list all IP blocks; each "tag" query parameter, in the form name.value, must match
+func (c *Server) listIPBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	blocks, err := c.Store.ListIPBlocks()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "error retrieving IP blocks"})
+		return
+	}
+	filters := r.URL.Query()["tag"]
+	resp := []*ipapi.IpBlock{}
+	for _, block := range blocks {
+		if blockHasTags(block, filters) {
+			resp = append(resp, block)
 		}
+	}
+	if err := writeJSON(w, &resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// create an IP block
+func (c *Server) createIPBlockHandler(w http.ResponseWriter, r *http.Request) {
+	var req ipapi.IpBlockCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "cannot parse body of request"})
 		return
 	}
-	w.WriteHeader(http.StatusNotFound)
-	_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "not found"})
+	size, err := strconv.Atoi(strings.TrimPrefix(req.CidrBlockSize, "/"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "invalid cidrBlockSize"})
+		return
+	}
+	block, err := c.Store.CreateIPBlock(req.Location, size, tagRequestsIntoAssignments(req.Tags))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := writeJSON(w, block); err != nil {
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// get information about a specific IP block
+func (c *Server) getIPBlockHandler(w http.ResponseWriter, r *http.Request) {
+	block, err := c.Store.GetIPBlock(mux.Vars(r)["ipBlockID"])
+	if err != nil || block == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "IP block not found"})
+		return
+	}
+	if err := writeJSON(w, block); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// get a single private network
+func (c *Server) getPrivateNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	network, err := c.Store.GetPrivateNetwork(mux.Vars(r)["networkID"])
+	if err != nil || network == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "private network not found"})
+		return
+	}
+	if err := writeJSON(w, network); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// get a single public network
+func (c *Server) getPublicNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	network, err := c.Store.GetPublicNetwork(mux.Vars(r)["networkID"])
+	if err != nil || network == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "public network not found"})
+		return
+	}
+	if err := writeJSON(w, network); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// delete an IP block; like the real API, it must not be assigned
+func (c *Server) deleteIPBlockHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["ipBlockID"]
+	block, err := c.Store.GetIPBlock(id)
+	if err != nil || block == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "IP block not found"})
+		return
+	}
+	if block.AssignedResourceId != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "IP block is assigned"})
+		return
+	}
+	if _, err := c.Store.DeleteIPBlock(id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to delete IP block"})
+		return
+	}
+	if err := writeJSON(w, ipapi.DeleteIpBlockResult{Result: "IP Block deleted", IpBlockId: id}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// replace the tags on an IP block
+func (c *Server) putIPBlockTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var req []ipapi.TagAssignmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "cannot parse body of request"})
+		return
+	}
+	block, err := c.Store.GetIPBlock(mux.Vars(r)["ipBlockID"])
+	if err != nil || block == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "IP block not found"})
+		return
+	}
+	block.Tags = tagRequestsIntoAssignments(req)
+	if err := c.Store.UpdateIPBlock(block); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to update IP block"})
+		return
+	}
+	if err := writeJSON(w, block); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// assign an IP block to a public network
+func (c *Server) assignIPBlockHandler(w http.ResponseWriter, r *http.Request) {
+	networkID := mux.Vars(r)["networkID"]
+	var req netapi.PublicNetworkIpBlock
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "cannot parse body of request"})
+		return
+	}
+	block, err := c.Store.GetIPBlock(req.Id)
+	if err != nil || block == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "IP block not found"})
+		return
+	}
+	if block.AssignedResourceId != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "IP block already is assigned"})
+		return
+	}
+	resourceType := publicNetworkResourceType
+	block.AssignedResourceId = &networkID
+	block.AssignedResourceType = &resourceType
+	block.Status = "assigned"
+	if err := c.Store.UpdateIPBlock(block); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to update IP block"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := writeJSON(w, netapi.PublicNetworkIpBlock{Id: block.Id}); err != nil {
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// unassign an IP block from a public network; the fake completes this immediately
+func (c *Server) unassignIPBlockHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	block, err := c.Store.GetIPBlock(vars["ipBlockID"])
+	if err != nil || block == nil || block.AssignedResourceId == nil || *block.AssignedResourceId != vars["networkID"] {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusNotFound, Message: "IP block not assigned to network"})
+		return
+	}
+	block.AssignedResourceId = nil
+	block.AssignedResourceType = nil
+	block.Status = "unassigned"
+	if err := c.Store.UpdateIPBlock(block); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to update IP block"})
+		return
+	}
+	if err := writeJSON(w, "The IP Block is being unassigned from the public network."); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// list all tags
+func (c *Server) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := c.Store.ListTags()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "error retrieving tags"})
+		return
+	}
+	resp := []*tagapi.Tag{}
+	resp = append(resp, tags...)
+	if err := writeJSON(w, &resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// create a tag
+func (c *Server) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	var req tagapi.TagCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusBadRequest, Message: "cannot parse body of request"})
+		return
+	}
+	tag, err := c.Store.CreateTag(req.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "error creating tag"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := writeJSON(w, tag); err != nil {
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Code: http.StatusInternalServerError, Message: "unable to write json"})
+	}
+}
+
+// blockHasTags returns true if the block has every one of the filters, each in the form name.value
+func blockHasTags(block *ipapi.IpBlock, filters []string) bool {
+	for _, filter := range filters {
+		var found bool
+		for _, tag := range block.Tags {
+			value := ""
+			if tag.Value != nil {
+				value = *tag.Value
+			}
+			if filter == tag.Name+"."+value || filter == tag.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func tagRequestsIntoAssignments(requests []ipapi.TagAssignmentRequest) []ipapi.TagAssignment {
+	var tags []ipapi.TagAssignment
+	for _, req := range requests {
+		tags = append(tags, ipapi.TagAssignment{Name: req.Name, Value: req.Value})
+	}
+	return tags
 }
 
 func writeJSON(w http.ResponseWriter, v any) error {
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/billingapi"
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+)
+
+// testServerHandler returns the handler of a fake server, and the ID of a server in it with a hostname and description
+func testServerHandler(t *testing.T) (http.Handler, *store.Memory, string) {
+	mem, err := store.NewMemory()
+	if err != nil {
+		t.Fatalf("unable to create store: %v", err)
+	}
+	if _, err := mem.CreateProduct("s1.c1.small", "SERVER", []billingapi.PricingPlan{{Sku: "sku-1", Location: "ASH"}}); err != nil {
+		t.Fatalf("unable to create product: %v", err)
+	}
+	server, err := mem.CreateServer("server1", "s1.c1.small", "ASH")
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+	description := "original"
+	server.Description = &description
+	if err := mem.UpdateServer(server); err != nil {
+		t.Fatalf("unable to update server: %v", err)
+	}
+	s := &Server{Store: mem}
+	return s.CreateHandler(), mem, server.Id
+}
+
+func TestUpdateServerPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		status      int
+		hostname    string
+		description *string
+	}{
+		{"empty patch", `{}`, http.StatusOK, "server1", strPtr("original")},
+		{"hostname only", `{"hostname":"server2"}`, http.StatusOK, "server2", strPtr("original")},
+		{"description only", `{"description":"changed"}`, http.StatusOK, "server1", strPtr("changed")},
+		{"both", `{"hostname":"server2","description":"changed"}`, http.StatusOK, "server2", strPtr("changed")},
+		{"null description clears it", `{"description":null}`, http.StatusOK, "server1", nil},
+		{"null hostname", `{"hostname":null}`, http.StatusBadRequest, "server1", strPtr("original")},
+		{"empty hostname", `{"hostname":""}`, http.StatusBadRequest, "server1", strPtr("original")},
+		{"invalid hostname", `{"hostname":1}`, http.StatusBadRequest, "server1", strPtr("original")},
+		{"invalid with valid field", `{"description":"changed","hostname":""}`, http.StatusBadRequest, "server1", strPtr("original")},
+		{"unknown field", `{"location":"PHX"}`, http.StatusBadRequest, "server1", strPtr("original")},
+		{"invalid json", `{"hostname"`, http.StatusBadRequest, "server1", strPtr("original")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mem, id := testServerHandler(t)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/bmc/v1/servers/"+id, strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("mismatched status, actual %d expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			server, _ := mem.GetServer(id)
+			if server.Hostname != tt.hostname {
+				t.Errorf("mismatched hostname, actual %s expected %s", server.Hostname, tt.hostname)
+			}
+			if !strPtrEqual(server.Description, tt.description) {
+				t.Errorf("mismatched description, actual %v expected %v", server.Description, tt.description)
+			}
+			if server.Location != "ASH" || server.Type != "s1.c1.small" {
+				t.Errorf("unpatched fields changed: location %s type %s", server.Location, server.Type)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp bmcapi.Server
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("unable to parse response: %v", err)
+			}
+			if resp.Id != id || resp.Hostname != tt.hostname || !strPtrEqual(resp.Description, tt.description) {
+				t.Errorf("mismatched response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestUpdateServerNotFound(t *testing.T) {
+	handler, _, _ := testServerHandler(t)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/bmc/v1/servers/unknown", strings.NewReader(`{"hostname":"server2"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("mismatched status, actual %d expected %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func strPtrEqual(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -6,16 +6,21 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/google/uuid"
 	"github.com/pallinder/go-randomdata"
 	"github.com/phoenixnap/go-sdk-bmc/billingapi"
 	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
+	"github.com/phoenixnap/go-sdk-bmc/tagapi"
 )
 
 const (
 	privateIPRange = "10.0.10.0/24"
+	publicIPRange  = "100.64.0.0/16"
 )
 
 // Memory is an implementation of DataStore which stores everything in memory
@@ -24,8 +29,14 @@ type Memory struct {
 	servers           map[string]*bmcapi.Server
 	ProductCategories map[string]bool
 	products          map[string]*billingapi.Product
+	productMetadata   map[string]*billingapi.ServerProductMetadata
 	privateIPRange    string
 	lastIP            net.IP
+	ipBlocks          map[string]*ipapi.IpBlock
+	privateNetworks   map[string]*netapi.PrivateNetwork
+	publicNetworks    map[string]*netapi.PublicNetwork
+	lastPublicIP      net.IP
+	tags              map[string]*tagapi.Tag
 	mutex             sync.Mutex
 }
 
@@ -49,9 +60,19 @@ func NewMemory() (*Memory, error) {
 		servers:           map[string]*bmcapi.Server{},
 		ProductCategories: map[string]bool{},
 		products:          map[string]*billingapi.Product{},
+		productMetadata:   map[string]*billingapi.ServerProductMetadata{},
 		privateIPRange:    privateIPRange,
 		lastIP:            cidr.Inc(start),
+		ipBlocks:          map[string]*ipapi.IpBlock{},
+		privateNetworks:   map[string]*netapi.PrivateNetwork{},
+		publicNetworks:    map[string]*netapi.PublicNetwork{},
+		tags:              map[string]*tagapi.Tag{},
 	}
+	_, public, err := net.ParseCIDR(publicIPRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public IP range %s: %w", publicIPRange, err)
+	}
+	mem.lastPublicIP = cidr.Dec(public.IP)
 
 	// create default location
 	_, _ = mem.CreateLocation("ASH")
@@ -125,6 +146,20 @@ func (m *Memory) UpdateProduct(name string, plans []billingapi.PricingPlan) (*bi
 	return product, nil
 }
 
+// SetProductMetadata set the metadata of a server product, e.g. its CPU and RAM
+func (m *Memory) SetProductMetadata(name string, metadata billingapi.ServerProductMetadata) error {
+	if _, ok := m.products[name]; !ok {
+		return fmt.Errorf("product not found: %s", name)
+	}
+	m.productMetadata[name] = &metadata
+	return nil
+}
+
+// GetProductMetadata get the metadata of a server product, or nil if it has none
+func (m *Memory) GetProductMetadata(name string) (*billingapi.ServerProductMetadata, error) {
+	return m.productMetadata[name], nil
+}
+
 func (m *Memory) ListProductCategories() ([]string, error) {
 	var categories []string
 	for k := range m.ProductCategories {
@@ -238,3 +273,161 @@ func (m *Memory) DeleteServer(serverID string) (bool, error) {
 	}
 	return false, nil
 }
+
+// CreateIPBlock creates a new IP block of the given size, e.g. 29 for a /29
+func (m *Memory) CreateIPBlock(location string, size int, tags []ipapi.TagAssignment) (*ipapi.IpBlock, error) {
+	if _, ok := m.locations[location]; !ok {
+		return nil, fmt.Errorf("unknown location: %s", location)
+	}
+	if size < 22 || size > 31 {
+		return nil, fmt.Errorf("invalid block size: /%d", size)
+	}
+	mask := net.CIDRMask(size, 32)
+	m.mutex.Lock()
+	// the next network of this size after the last one handed out
+	ip := cidr.Inc(m.lastPublicIP)
+	network := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	if !network.IP.Equal(ip) {
+		_, last := cidr.AddressRange(network)
+		network.IP = cidr.Inc(last)
+	}
+	_, last := cidr.AddressRange(network)
+	m.lastPublicIP = last
+	block := ipapi.NewIpBlock(m.getID(), location, fmt.Sprintf("/%d", size), network.String(), "unassigned", false, time.Now())
+	block.Tags = tags
+	m.ipBlocks[block.Id] = block
+	m.mutex.Unlock()
+	return block, nil
+}
+
+// UpdateIPBlock updates an existing IP block
+func (m *Memory) UpdateIPBlock(block *ipapi.IpBlock) error {
+	if block == nil {
+		return fmt.Errorf("must include a valid IP block")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.ipBlocks[block.Id]; ok {
+		m.ipBlocks[block.Id] = block
+		return nil
+	}
+	return fmt.Errorf("IP block not found")
+}
+
+// ListIPBlocks list all known IP blocks
+func (m *Memory) ListIPBlocks() ([]*ipapi.IpBlock, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var blocks []*ipapi.IpBlock
+	for _, b := range m.ipBlocks {
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// GetIPBlock get information about a single IP block
+func (m *Memory) GetIPBlock(ipBlockID string) (*ipapi.IpBlock, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if block, ok := m.ipBlocks[ipBlockID]; ok {
+		return block, nil
+	}
+	return nil, nil
+}
+
+// DeleteIPBlock delete a single IP block
+func (m *Memory) DeleteIPBlock(ipBlockID string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.ipBlocks[ipBlockID]; ok {
+		delete(m.ipBlocks, ipBlockID)
+		return true, nil
+	}
+	return false, nil
+}
+
+// CreatePrivateNetwork create a private network with the given CIDR
+func (m *Memory) CreatePrivateNetwork(name, location, cidr string) (*netapi.PrivateNetwork, error) {
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		return nil, fmt.Errorf("invalid CIDR %s: %w", cidr, err)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.locations[location]; !ok {
+		return nil, fmt.Errorf("unknown location: %s", location)
+	}
+	network := netapi.NewPrivateNetwork(m.getID(), name, 0, "private", location, false, cidr, nil, nil, time.Now())
+	m.privateNetworks[network.Id] = network
+	return network, nil
+}
+
+// GetPrivateNetwork get a single private network
+func (m *Memory) GetPrivateNetwork(networkID string) (*netapi.PrivateNetwork, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if network, ok := m.privateNetworks[networkID]; ok {
+		return network, nil
+	}
+	return nil, nil
+}
+
+// CreatePublicNetwork create a public network in the given location
+func (m *Memory) CreatePublicNetwork(name, location string) (*netapi.PublicNetwork, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.locations[location]; !ok {
+		return nil, fmt.Errorf("unknown location: %s", location)
+	}
+	network := netapi.NewPublicNetwork(m.getID(), 0, nil, name, location, time.Now(), nil)
+	m.publicNetworks[network.Id] = network
+	return network, nil
+}
+
+// CreatePublicNetworkWithID create a public network with a given ID in the given location, for fixtures that refer to
+// a well-known network
+func (m *Memory) CreatePublicNetworkWithID(id, name, location string) (*netapi.PublicNetwork, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.locations[location]; !ok {
+		return nil, fmt.Errorf("unknown location: %s", location)
+	}
+	if _, ok := m.publicNetworks[id]; ok {
+		return nil, fmt.Errorf("public network %s already exists", id)
+	}
+	network := netapi.NewPublicNetwork(id, 0, nil, name, location, time.Now(), nil)
+	m.publicNetworks[network.Id] = network
+	return network, nil
+}
+
+// GetPublicNetwork get a single public network
+func (m *Memory) GetPublicNetwork(networkID string) (*netapi.PublicNetwork, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if network, ok := m.publicNetworks[networkID]; ok {
+		return network, nil
+	}
+	return nil, nil
+}
+
+// CreateTag creates a new tag, or returns the existing one with the same name
+func (m *Memory) CreateTag(name string) (*tagapi.Tag, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if tag, ok := m.tags[name]; ok {
+		return tag, nil
+	}
+	tag := tagapi.NewTag(m.getID(), name, false)
+	m.tags[name] = tag
+	return tag, nil
+}
+
+// ListTags list all known tags
+func (m *Memory) ListTags() ([]*tagapi.Tag, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var tags []*tagapi.Tag
+	for _, t := range m.tags {
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
@@ -3,6 +3,9 @@ package store
 import (
 	"github.com/phoenixnap/go-sdk-bmc/billingapi"
 	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+	netapi "github.com/phoenixnap/go-sdk-bmc/networkapi"
+	"github.com/phoenixnap/go-sdk-bmc/tagapi"
 )
 
 // DataStore is the item that retrieves backend information to serve out
@@ -19,9 +22,22 @@ type DataStore interface {
 	FindProduct(code, category string) (*billingapi.Product, error)
 	CreateProduct(name, category string, plans []billingapi.PricingPlan) (*billingapi.Product, error)
 	UpdateProduct(name string, plans []billingapi.PricingPlan) (*billingapi.Product, error)
+	SetProductMetadata(name string, metadata billingapi.ServerProductMetadata) error
+	GetProductMetadata(name string) (*billingapi.ServerProductMetadata, error)
 	CreateServer(name, serverType, location string) (*bmcapi.Server, error)
 	UpdateServer(server *bmcapi.Server) error
 	ListServers() ([]*bmcapi.Server, error)
 	GetServer(serverID string) (*bmcapi.Server, error)
 	DeleteServer(serverID string) (bool, error)
+	CreateIPBlock(location string, size int, tags []ipapi.TagAssignment) (*ipapi.IpBlock, error)
+	UpdateIPBlock(block *ipapi.IpBlock) error
+	ListIPBlocks() ([]*ipapi.IpBlock, error)
+	GetIPBlock(ipBlockID string) (*ipapi.IpBlock, error)
+	DeleteIPBlock(ipBlockID string) (bool, error)
+	CreatePrivateNetwork(name, location, cidr string) (*netapi.PrivateNetwork, error)
+	GetPrivateNetwork(networkID string) (*netapi.PrivateNetwork, error)
+	CreatePublicNetwork(name, location string) (*netapi.PublicNetwork, error)
+	GetPublicNetwork(networkID string) (*netapi.PublicNetwork, error)
+	CreateTag(name string) (*tagapi.Tag, error)
+	ListTags() ([]*tagapi.Tag, error)
 }
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Validate checks the invariants of the store that the real API keeps, and returns every violation, so that tests
+// can call it after a scenario to catch fixtures, or handlers, that leave the store in a state the API never would:
+//   - every IP block is in a known location, and its assignment points at an existing public network or server
+//   - every IP block has a valid CIDR, unless it is pending
+//   - no two IP blocks overlap, and no IP is that of more than one server or also in an IP block
+//   - every server is in a known location and of an existing product
+func (m *Memory) Validate() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var errs []error
+
+	var networks []*net.IPNet
+	var networkBlocks []string
+	blockIDs := make([]string, 0, len(m.ipBlocks))
+	for id := range m.ipBlocks {
+		blockIDs = append(blockIDs, id)
+	}
+	// in order, so that the errors are
+	sort.Strings(blockIDs)
+	for _, id := range blockIDs {
+		block := m.ipBlocks[id]
+		if !m.locations[block.Location] {
+			errs = append(errs, fmt.Errorf("IP block %s is in unknown location %s", id, block.Location))
+		}
+		if err := m.validateAssignment(id, block.AssignedResourceId, block.AssignedResourceType); err != nil {
+			errs = append(errs, err)
+		}
+		if block.Cidr == "" {
+			// pending, the API has not allocated its IPs yet
+			continue
+		}
+		_, network, err := net.ParseCIDR(block.Cidr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("IP block %s has invalid CIDR %s: %w", id, block.Cidr, err))
+			continue
+		}
+		for i, other := range networks {
+			if other.Contains(network.IP) || network.Contains(other.IP) {
+				errs = append(errs, fmt.Errorf("IP block %s %s overlaps IP block %s %s", id, network, networkBlocks[i], other))
+			}
+		}
+		networks = append(networks, network)
+		networkBlocks = append(networkBlocks, id)
+	}
+
+	owners := map[string]string{}
+	serverIDs := make([]string, 0, len(m.servers))
+	for id := range m.servers {
+		serverIDs = append(serverIDs, id)
+	}
+	sort.Strings(serverIDs)
+	for _, id := range serverIDs {
+		server := m.servers[id]
+		if !m.locations[server.Location] {
+			errs = append(errs, fmt.Errorf("server %s is in unknown location %s", id, server.Location))
+		}
+		if _, ok := m.products[server.Type]; !ok {
+			errs = append(errs, fmt.Errorf("server %s is of unknown product %s", id, server.Type))
+		}
+		for _, address := range append(append([]string{}, server.PublicIpAddresses...), server.PrivateIpAddresses...) {
+			if owner, ok := owners[address]; ok {
+				errs = append(errs, fmt.Errorf("IP %s is that of both server %s and server %s", address, owner, id))
+				continue
+			}
+			owners[address] = id
+			ip := net.ParseIP(address)
+			if ip == nil {
+				errs = append(errs, fmt.Errorf("server %s has invalid IP %s", id, address))
+				continue
+			}
+			for i, network := range networks {
+				if network.Contains(ip) {
+					errs = append(errs, fmt.Errorf("IP %s of server %s is in IP block %s %s", address, id, networkBlocks[i], network))
+				}
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateAssignment returns an error if the IP block with id is assigned to a resource that does not exist
+func (m *Memory) validateAssignment(id string, resourceID, resourceType *string) error {
+	switch {
+	case resourceID == nil && resourceType == nil:
+		return nil
+	case resourceID == nil || resourceType == nil:
+		return fmt.Errorf("IP block %s has only one of assigned resource ID and type", id)
+	}
+	switch strings.ToLower(*resourceType) {
+	case "public_network":
+		if _, ok := m.publicNetworks[*resourceID]; !ok {
+			return fmt.Errorf("IP block %s is assigned to unknown public network %s", id, *resourceID)
+		}
+	case "server":
+		if _, ok := m.servers[*resourceID]; !ok {
+			return fmt.Errorf("IP block %s is assigned to unknown server %s", id, *resourceID)
+		}
+	default:
+		return fmt.Errorf("IP block %s is assigned to %s of unknown type %s", id, *resourceID, *resourceType)
+	}
+	return nil
+}
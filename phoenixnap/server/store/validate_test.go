@@ -0,0 +1,80 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+)
+
+// testConsistentMemory returns a store with a public network, an IP block assigned to it and two servers
+func testConsistentMemory(t *testing.T) (*Memory, string) {
+	m, err := NewMemory()
+	if err != nil {
+		t.Fatalf("unable to create store: %v", err)
+	}
+	network, err := m.CreatePublicNetwork("lb", "ASH")
+	if err != nil {
+		t.Fatalf("unable to create public network: %v", err)
+	}
+	block, err := m.CreateIPBlock("ASH", 29, nil)
+	if err != nil {
+		t.Fatalf("unable to create IP block: %v", err)
+	}
+	resourceType := "PUBLIC_NETWORK"
+	block.AssignedResourceId, block.AssignedResourceType = &network.Id, &resourceType
+	for i, ip := range []string{"10.0.10.10", "10.0.10.11"} {
+		id := m.getID()
+		m.servers[id] = &bmcapi.Server{Id: id, Hostname: "server", Location: "ASH", Type: "d1.c1.small",
+			PublicIpAddresses: []string{[]string{"198.51.100.10", "198.51.100.11"}[i]}, PrivateIpAddresses: []string{ip}}
+	}
+	return m, block.Id
+}
+
+func TestValidate(t *testing.T) {
+	m, _ := testConsistentMemory(t)
+	if err := m.Validate(); err != nil {
+		t.Fatalf("unexpected error for a consistent store: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(m *Memory, blockID string)
+		expected string
+	}{
+		{"unknown network", func(m *Memory, blockID string) {
+			unknown := "public-network-1"
+			m.ipBlocks[blockID].AssignedResourceId = &unknown
+		}, "unknown public network public-network-1"},
+		{"overlapping blocks", func(m *Memory, blockID string) {
+			other, _ := m.CreateIPBlock("ASH", 30, nil)
+			other.Cidr = m.ipBlocks[blockID].Cidr
+		}, "overlaps"},
+		{"unknown product", func(m *Memory, blockID string) {
+			for _, server := range m.servers {
+				server.Type = "s9.c9.huge"
+			}
+		}, "unknown product s9.c9.huge"},
+		{"duplicate IP", func(m *Memory, blockID string) {
+			for _, server := range m.servers {
+				server.PrivateIpAddresses = []string{"10.0.10.100"}
+			}
+		}, "IP 10.0.10.100 is that of both"},
+		{"server IP in block", func(m *Memory, blockID string) {
+			for _, server := range m.servers {
+				server.PublicIpAddresses = []string{strings.Split(m.ipBlocks[blockID].Cidr, "/")[0]}
+				break
+			}
+		}, "is in IP block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, blockID := testConsistentMemory(t)
+			tt.mutate(m, blockID)
+			err := m.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, actual %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// isServerAssigned returns true if the block is assigned directly to a server, rather than to a network
+func isServerAssigned(block ipapi.IpBlock) bool {
+	return blockAssignedTo(block, assignedResourceServer)
+}
+
+// blockServer returns the server to which a server-assigned block is assigned
+func (l *loadBalancers) blockServer(ctx context.Context, block ipapi.IpBlock) (*bmcapi.Server, error) {
+	if block.AssignedResourceId == nil {
+		return nil, fmt.Errorf("block %s has an assigned resource type %s but not ID", block.Cidr, *block.AssignedResourceType)
+	}
+	for _, client := range l.bmcClients {
+		server, err := serverByID(ctx, client, *block.AssignedResourceId)
+		if errors.Is(err, cloudprovider.InstanceNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get server %s to which block %s is assigned: %w", *block.AssignedResourceId, block.Cidr, err)
+		}
+		return server, nil
+	}
+	return nil, fmt.Errorf("block %s is assigned to server %s, which cannot be found", block.Cidr, *block.AssignedResourceId)
+}
+
+// adoptServerBlock returns the node of the server to which the block is assigned, so that the
+// Service can be announced from that node alone. If the server is not one of nodes, it cannot
+// be adopted, and it returns an error explaining how to fix it, and records it as an Event.
+func (l *loadBalancers) adoptServerBlock(ctx context.Context, service *v1.Service, block ipapi.IpBlock, nodes []*v1.Node) (*v1.Node, error) {
+	server, err := l.blockServer(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if nodeHasServer(node, server) {
+			return node, nil
+		}
+	}
+	msg := fmt.Sprintf("block %s is assigned to server %s (%s), which is not a node for the service; "+
+		"unassign the block from the server, so that it can be assigned to public network %s, "+
+		"or add the server to the cluster", block.Cidr, server.Id, server.Hostname, l.network)
+	if l.recorder != nil {
+		l.recorder.Event(service, v1.EventTypeWarning, eventReasonIPBlockAssignedToServer, msg)
+	}
+	return nil, errors.New(msg)
+}
@@ -0,0 +1,123 @@
+package phoenixnap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/phoenixnap/go-sdk-bmc/bmcapi"
+
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// serverResolver coalesces the server lookups of instances. When many nodes join at once, e.g. at cluster
+// bootstrap, each is looked up separately; instead, the lookups of an account within window of each other
+// share a single list of its servers. A server that is not in the list is looked up by ID after all, as it
+// may have been created since, and if the list fails, each lookup falls back to its own call.
+type serverResolver struct {
+	window time.Duration
+	clock  clock.PassiveClock
+
+	mutex sync.Mutex
+	lists map[*bmcapi.APIClient]*serverList
+}
+
+// serverList a list of the servers of an account, in flight until done is closed
+type serverList struct {
+	done    chan struct{}
+	fetched time.Time
+	byID    map[string]bmcapi.Server
+	byName  map[string][]bmcapi.Server
+	err     error
+}
+
+func newServerResolver(window time.Duration) *serverResolver {
+	return &serverResolver{window: window, clock: clock.RealClock{}, lists: map[*bmcapi.APIClient]*serverList{}}
+}
+
+// list returns the servers of the account of client, listed by this call, by one in flight, or by one
+// completed within window
+func (r *serverResolver) list(ctx context.Context, client *bmcapi.APIClient) (*serverList, error) {
+	r.mutex.Lock()
+	list, ok := r.lists[client]
+	if ok {
+		select {
+		case <-list.done:
+			ok = r.clock.Since(list.fetched) < r.window
+		default:
+		}
+	}
+	if ok {
+		r.mutex.Unlock()
+		serverLookupsCoalescedTotal.Inc()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-list.done:
+			return list, list.err
+		}
+	}
+	list = &serverList{done: make(chan struct{})}
+	r.lists[client] = list
+	r.mutex.Unlock()
+
+	servers, resp, err := client.ServersApi.ServersGet(ctx).Execute()
+	if err != nil {
+		list.err = providerError(resp, err)
+		r.mutex.Lock()
+		if r.lists[client] == list {
+			delete(r.lists, client)
+		}
+		r.mutex.Unlock()
+	} else {
+		list.byID = make(map[string]bmcapi.Server, len(servers))
+		list.byName = make(map[string][]bmcapi.Server, len(servers))
+		for _, server := range servers {
+			list.byID[server.Id] = server
+			list.byName[server.Hostname] = append(list.byName[server.Hostname], server)
+		}
+	}
+	list.fetched = r.clock.Now()
+	close(list.done)
+	return list, list.err
+}
+
+// serverByID returns the server with id in the account of client
+func (r *serverResolver) serverByID(ctx context.Context, client *bmcapi.APIClient, id string) (*bmcapi.Server, error) {
+	if r == nil {
+		return serverByID(ctx, client, id)
+	}
+	list, err := r.list(ctx, client)
+	if err != nil {
+		klog.V(2).Infof("listing servers to find server %s failed, getting it instead: %v", id, err)
+		return serverByID(ctx, client, id)
+	}
+	if server, ok := list.byID[id]; ok {
+		return &server, nil
+	}
+	return serverByID(ctx, client, id)
+}
+
+// serverByName returns the server with hostname name in the account of client, or a *duplicateHostnameError if there
+// is more than one
+func (r *serverResolver) serverByName(ctx context.Context, client *bmcapi.APIClient, name string) (*bmcapi.Server, error) {
+	if r == nil || name == "" {
+		return serverByName(ctx, client, types.NodeName(name))
+	}
+	list, err := r.list(ctx, client)
+	if err != nil {
+		klog.V(2).Infof("listing servers to find server with hostname %s failed, listing again: %v", name, err)
+		return serverByName(ctx, client, types.NodeName(name))
+	}
+	switch servers := list.byName[name]; len(servers) {
+	case 0:
+		return nil, cloudprovider.InstanceNotFound
+	case 1:
+		return &servers[0], nil
+	default:
+		return nil, &duplicateHostnameError{hostname: name, servers: servers}
+	}
+}
@@ -0,0 +1,128 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pnapServer "github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server"
+	"github.com/phoenixnap/k8s-cloud-provider-bmc/phoenixnap/server/store"
+
+	cloudprovider "k8s.io/cloud-provider"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestServerResolverCoalesces(t *testing.T) {
+	backend, _ := store.NewMemory()
+	fake := pnapServer.Server{Store: backend, ErrorHandler: &apiServerError{t: t}}
+	var lists, gets int32
+	handler := fake.CreateHandler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if strings.HasSuffix(r.URL.Path, "/servers") {
+				atomic.AddInt32(&lists, 1)
+				// keep the list in flight, so that the lookups wait for it
+				time.Sleep(20 * time.Millisecond)
+			} else {
+				atomic.AddInt32(&gets, 1)
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	bmc, _, _, _, _, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	var ids, names []string
+	for i := 0; i < 5; i++ {
+		// distinct names, as random ones may collide, and a shared hostname is ambiguous
+		server, err := backend.CreateServer(fmt.Sprintf("server-coalesce-%d", i), product.ProductCode, location)
+		if err != nil {
+			t.Fatalf("unable to create server: %v", err)
+		}
+		ids = append(ids, server.Id)
+		names = append(names, server.Hostname)
+	}
+
+	// nodes joining at once share a single list
+	resolver := newServerResolver(time.Minute)
+	clock := testingclock.NewFakeClock(time.Now())
+	resolver.clock = clock
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(2)
+		go func(id, name string) {
+			defer wg.Done()
+			if server, err := resolver.serverByID(context.TODO(), bmc, id); err != nil || server.Id != id {
+				t.Errorf("mismatched server by ID %s, actual %v error %v", id, server, err)
+			}
+		}(ids[i], names[i])
+		go func(id, name string) {
+			defer wg.Done()
+			if server, err := resolver.serverByName(context.TODO(), bmc, name); err != nil || server.Id != id {
+				t.Errorf("mismatched server by name %s, actual %v error %v", name, server, err)
+			}
+		}(ids[i], names[i])
+	}
+	wg.Wait()
+	if lists != 1 || gets != 0 {
+		t.Errorf("mismatched calls, actual lists %d gets %d expected lists 1 gets 0", lists, gets)
+	}
+
+	// a server not in the list is got by ID, as it may be new
+	if _, err := resolver.serverByID(context.TODO(), bmc, randomID); !errors.Is(err, cloudprovider.InstanceNotFound) {
+		t.Errorf("expected server not found, got %v", err)
+	}
+	if _, err := resolver.serverByName(context.TODO(), bmc, "unknown"); !errors.Is(err, cloudprovider.InstanceNotFound) {
+		t.Errorf("expected server not found, got %v", err)
+	}
+	if lists != 1 || gets != 1 {
+		t.Errorf("mismatched calls, actual lists %d gets %d expected lists 1 gets 1", lists, gets)
+	}
+
+	// once the window is over, the servers are listed again
+	clock.Step(time.Minute)
+	if _, err := resolver.serverByID(context.TODO(), bmc, ids[0]); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if lists != 2 {
+		t.Errorf("mismatched lists, actual %d expected %d", lists, 2)
+	}
+}
+
+func TestServerResolverListFails(t *testing.T) {
+	var gets int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/servers") {
+			atomic.AddInt32(&gets, 1)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	bmc, _, _, _, _, err := constructClients(token, ts.URL)
+	if err != nil {
+		t.Fatalf("unable to construct testing phoenixnap API client: %v", err)
+	}
+
+	// each lookup falls back to its own call
+	resolver := newServerResolver(time.Minute)
+	if _, err := resolver.serverByID(context.TODO(), bmc, randomID); !errors.Is(err, cloudprovider.InstanceNotFound) {
+		t.Errorf("expected server not found, got %v", err)
+	}
+	if gets != 1 {
+		t.Errorf("mismatched gets, actual %d expected %d", gets, 1)
+	}
+	if len(resolver.lists) != 0 {
+		t.Errorf("failed list kept, %v", resolver.lists)
+	}
+}
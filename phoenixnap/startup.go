@@ -0,0 +1,85 @@
+package phoenixnap
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// startupSync protects the PhoenixNAP API on a cold start in a cluster with many Services of type=LoadBalancer,
+// for which the controller manager calls the load balancer right away. The first call for each Service since the
+// start is delayed until a random point within spread of the start, and at most concurrency of them run at once.
+// Later calls for a Service are not delayed, nor are first calls for Services created after the spread is over.
+// A nil startupSync delays nothing.
+type startupSync struct {
+	start  time.Time
+	spread time.Duration
+	// slots limits the first calls running at once; nil for unlimited
+	slots chan struct{}
+	mu    sync.Mutex
+	// synced the services whose first call has started
+	synced map[string]bool
+	// jitter returns a random duration in [0, spread), replaced in tests
+	jitter func(spread time.Duration) time.Duration
+}
+
+// newStartupSync returns a startupSync from start, or nil if neither spread nor concurrency is set
+func newStartupSync(start time.Time, spread time.Duration, concurrency int) *startupSync {
+	if spread <= 0 && concurrency <= 0 {
+		return nil
+	}
+	s := &startupSync{
+		start:  start,
+		spread: spread,
+		synced: map[string]bool{},
+		jitter: func(spread time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(spread)))
+		},
+	}
+	if concurrency > 0 {
+		s.slots = make(chan struct{}, concurrency)
+	}
+	return s
+}
+
+// wait waits, if this is the first call for svcName, until its point within the spread and for a free slot.
+// It returns a function to release the slot once the call is done, or the error of ctx if it is done first.
+func (s *startupSync) wait(ctx context.Context, svcName string) (func(), error) {
+	release := func() {}
+	if s == nil {
+		return release, nil
+	}
+	s.mu.Lock()
+	first := !s.synced[svcName]
+	s.synced[svcName] = true
+	s.mu.Unlock()
+	if !first {
+		return release, nil
+	}
+
+	if s.spread > 0 {
+		if delay := time.Until(s.start.Add(s.jitter(s.spread))); delay > 0 {
+			klog.V(2).Infof("delaying the initial sync of service %s by %v", svcName, delay)
+			startupSyncsDelayedTotal.Inc()
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return release, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	if s.slots == nil {
+		return release, nil
+	}
+	select {
+	case <-ctx.Done():
+		return release, ctx.Err()
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, nil
+	}
+}
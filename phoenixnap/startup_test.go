@@ -0,0 +1,101 @@
+package phoenixnap
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartupSyncDisabled(t *testing.T) {
+	if s := newStartupSync(time.Now(), 0, 0); s != nil {
+		t.Fatalf("expected no startup sync, got %+v", s)
+	}
+	var s *startupSync
+	release, err := s.wait(context.TODO(), "default/svc1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+}
+
+func TestStartupSyncSpread(t *testing.T) {
+	start := time.Now()
+	s := newStartupSync(start, time.Hour, 0)
+	s.jitter = func(time.Duration) time.Duration { return 50 * time.Millisecond }
+
+	release, err := s.wait(context.TODO(), "default/svc1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("first call not delayed, waited %v", waited)
+	}
+
+	// later calls for the service are not delayed
+	s.jitter = func(time.Duration) time.Duration { return time.Hour }
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := s.wait(ctx, "default/svc1"); err != nil {
+		t.Errorf("unexpected error on later call: %v", err)
+	}
+	// first calls end with their context
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.wait(ctx, "default/svc2"); err == nil {
+		t.Errorf("expected error for cancelled first call")
+	}
+
+	// first calls after the spread are not delayed
+	s = newStartupSync(start.Add(-time.Hour), time.Minute, 0)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := s.wait(ctx, "default/svc3"); err != nil {
+		t.Errorf("unexpected error after the spread: %v", err)
+	}
+}
+
+func TestStartupSyncConcurrency(t *testing.T) {
+	s := newStartupSync(time.Now(), 0, 2)
+	var (
+		mu            sync.Mutex
+		running, most int
+		wg            sync.WaitGroup
+	)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			release, err := s.wait(context.TODO(), name)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			defer release()
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	if most > 2 {
+		t.Errorf("mismatched concurrency, actual %d expected at most %d", most, 2)
+	}
+
+	// later calls do not take a slot
+	s.slots <- struct{}{}
+	s.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := s.wait(ctx, "a"); err != nil {
+		t.Errorf("unexpected error on later call: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// statusResource the cluster-scoped PNAPCloudProviderStatus resource, of which the CCM keeps a single object,
+// named statusObjectName, with the sync status of its subsystems
+var statusResource = schema.GroupVersionResource{Group: statusGroup, Version: statusVersion, Resource: "pnapcloudproviderstatuses"}
+
+// subsystemStatus the sync results of a subsystem, as published in the status resource
+type subsystemStatus struct {
+	// LastSyncTime when the subsystem last synced, successfully or not
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastSuccessTime when the subsystem last synced successfully
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+	// Syncs the number of syncs since the CCM started
+	Syncs int64 `json:"syncs"`
+	// Errors the number of failed syncs since the CCM started
+	Errors int64 `json:"errors"`
+	// ErrorReasons the number of failed syncs by the class of their error
+	ErrorReasons map[string]int64 `json:"errorReasons,omitempty"`
+	// LastError the error of the last failed sync
+	LastError string `json:"lastError,omitempty"`
+	// LastErrorTime when the last sync failed
+	LastErrorTime *metav1.Time `json:"lastErrorTime,omitempty"`
+}
+
+// cloudProviderStatus the status of the status resource
+type cloudProviderStatus struct {
+	// Subsystems the sync results by subsystem
+	Subsystems map[string]subsystemStatus `json:"subsystems"`
+}
+
+// syncStatus collects the sync results of the subsystems, and publishes them to the status resource,
+// so that the CCMs of many clusters can be monitored through their API servers. A nil syncStatus
+// records nothing.
+type syncStatus struct {
+	mu         sync.Mutex
+	subsystems map[apiSubsystem]*subsystemStatus
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+func newSyncStatus() *syncStatus {
+	s := &syncStatus{subsystems: map[apiSubsystem]*subsystemStatus{}, now: time.Now}
+	for _, subsystem := range apiSubsystems {
+		s.subsystems[subsystem] = &subsystemStatus{}
+	}
+	return s
+}
+
+// record records the result of a sync of subsystem, failed if err is not nil
+func (s *syncStatus) record(subsystem apiSubsystem, err error) {
+	if s == nil {
+		return
+	}
+	now := metav1.NewTime(s.now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, ok := s.subsystems[subsystem]
+	if !ok {
+		status = &subsystemStatus{}
+		s.subsystems[subsystem] = status
+	}
+	status.Syncs++
+	status.LastSyncTime = &now
+	if err == nil {
+		status.LastSuccessTime = &now
+		return
+	}
+	status.Errors++
+	status.LastError = err.Error()
+	status.LastErrorTime = &now
+	if status.ErrorReasons == nil {
+		status.ErrorReasons = map[string]int64{}
+	}
+	status.ErrorReasons[string(ReasonForError(err))]++
+}
+
+// recordInstances records the result of an instances call; finding no server is a successful sync
+func (s *syncStatus) recordInstances(err error) {
+	if errors.Is(err, cloudprovider.InstanceNotFound) {
+		err = nil
+	}
+	s.record(subsystemInstances, err)
+}
+
+// snapshot returns a copy of the current status
+func (s *syncStatus) snapshot() cloudProviderStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := cloudProviderStatus{Subsystems: map[string]subsystemStatus{}}
+	for subsystem, status := range s.subsystems {
+		copied := *status
+		if status.ErrorReasons != nil {
+			copied.ErrorReasons = map[string]int64{}
+			for reason, count := range status.ErrorReasons {
+				copied.ErrorReasons[reason] = count
+			}
+		}
+		ret.Subsystems[string(subsystem)] = copied
+	}
+	return ret
+}
+
+// publish writes the current status to the status object, creating it if it does not exist
+func (s *syncStatus) publish(ctx context.Context, client dynamic.Interface) error {
+	snapshot := s.snapshot()
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&snapshot)
+	if err != nil {
+		return fmt.Errorf("unable to convert status: %w", err)
+	}
+	resource := client.Resource(statusResource)
+	obj, err := resource.Get(ctx, statusObjectName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion(statusResource.GroupVersion().String())
+		obj.SetKind(statusKind)
+		obj.SetName(statusObjectName)
+		obj, err = resource.Create(ctx, obj, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get or create %s %s, is its CustomResourceDefinition installed? %w", statusKind, statusObjectName, err)
+	}
+	obj.Object["status"] = status
+	if _, err := resource.UpdateStatus(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update status of %s %s: %w", statusKind, statusObjectName, err)
+	}
+	return nil
+}
+
+// startStatusPublisher publishes the status every statusPublishSeconds, until stop is closed
+func startStatusPublisher(wg *sync.WaitGroup, stop <-chan struct{}, client dynamic.Interface, status *syncStatus) {
+	klog.Infof("publishing the sync status every %ds to %s %s", statusPublishSeconds, statusKind, statusObjectName)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(statusPublishSeconds * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), statusPublishSeconds*time.Second)
+			if err := status.publish(ctx, client); err != nil {
+				klog.Warningf("unable to publish the sync status: %v", err)
+			}
+			cancel()
+		}
+	}()
+}
@@ -0,0 +1,97 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestSyncStatusRecord(t *testing.T) {
+	status := newSyncStatus()
+	start := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	status.now = func() time.Time { return start }
+
+	status.record(subsystemLoadBalancer, nil)
+	status.now = func() time.Time { return start.Add(time.Minute) }
+	status.record(subsystemLoadBalancer, newProviderError(ErrorReasonQuota, errors.New("too many blocks")))
+	status.recordInstances(cloudprovider.InstanceNotFound)
+	status.recordInstances(errors.New("failed"))
+
+	snapshot := status.snapshot()
+	if len(snapshot.Subsystems) != len(apiSubsystems) {
+		t.Errorf("mismatched subsystems, actual %v expected %v", snapshot.Subsystems, apiSubsystems)
+	}
+	lb := snapshot.Subsystems[string(subsystemLoadBalancer)]
+	switch {
+	case lb.Syncs != 2 || lb.Errors != 1:
+		t.Errorf("mismatched load balancer counts, actual syncs %d errors %d", lb.Syncs, lb.Errors)
+	case !lb.LastSuccessTime.Time.Equal(start) || !lb.LastSyncTime.Time.Equal(start.Add(time.Minute)):
+		t.Errorf("mismatched load balancer times, actual success %v sync %v", lb.LastSuccessTime, lb.LastSyncTime)
+	case lb.LastError != "too many blocks" || lb.ErrorReasons[string(ErrorReasonQuota)] != 1:
+		t.Errorf("mismatched load balancer error, actual %s reasons %v", lb.LastError, lb.ErrorReasons)
+	}
+	instances := snapshot.Subsystems[string(subsystemInstances)]
+	if instances.Syncs != 2 || instances.Errors != 1 || instances.ErrorReasons[string(ErrorReasonUnknown)] != 1 {
+		t.Errorf("mismatched instances status, actual %+v", instances)
+	}
+	if reaper := snapshot.Subsystems[string(subsystemReaper)]; reaper.Syncs != 0 || reaper.LastSyncTime != nil {
+		t.Errorf("mismatched reaper status, actual %+v", reaper)
+	}
+
+	// the snapshot is a copy
+	status.record(subsystemLoadBalancer, newProviderError(ErrorReasonQuota, errors.New("too many blocks")))
+	if lb.ErrorReasons[string(ErrorReasonQuota)] != 1 {
+		t.Errorf("snapshot changed by a later record")
+	}
+
+	// a nil status records nothing
+	var disabled *syncStatus
+	disabled.record(subsystemReaper, nil)
+	disabled.recordInstances(nil)
+}
+
+func TestSyncStatusPublish(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		statusResource: statusKind + "List",
+	})
+	status := newSyncStatus()
+	status.record(subsystemReaper, nil)
+
+	// the first publish creates the object
+	if err := status.publish(context.TODO(), client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	obj := testGetStatusObject(t, client)
+	if syncs, _, _ := unstructured.NestedInt64(obj.Object, "status", "subsystems", string(subsystemReaper), "syncs"); syncs != 1 {
+		t.Errorf("mismatched reaper syncs, actual %d expected %d", syncs, 1)
+	}
+
+	// later ones update it
+	status.record(subsystemReaper, errors.New("failed"))
+	if err := status.publish(context.TODO(), client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	obj = testGetStatusObject(t, client)
+	if lastError, _, _ := unstructured.NestedString(obj.Object, "status", "subsystems", string(subsystemReaper), "lastError"); lastError != "failed" {
+		t.Errorf("mismatched reaper error, actual %s expected %s", lastError, "failed")
+	}
+	if obj.GetKind() != statusKind || obj.GetAPIVersion() != "phoenixnap.com/v1alpha1" {
+		t.Errorf("mismatched type, actual %s %s", obj.GetAPIVersion(), obj.GetKind())
+	}
+}
+
+func testGetStatusObject(t *testing.T, client *dynamicfake.FakeDynamicClient) *unstructured.Unstructured {
+	obj, err := client.Resource(statusResource).Get(context.TODO(), statusObjectName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get status object: %v", err)
+	}
+	return obj
+}
@@ -3,18 +3,106 @@ package phoenixnap
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/phoenixnap/go-sdk-bmc/tagapi"
+
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// ownershipTags the tags that mark an IP block as created by the CCM for a specific cluster
+type ownershipTags struct {
+	// usage name of the tag that marks blocks created by the CCM
+	usage string
+	// usageValue value of the usage tag
+	usageValue string
+	// cluster name of the tag whose value is the cluster ID
+	cluster string
+	// clusterID value of the cluster tag; if empty, the UID of the kube-system namespace
+	clusterID string
+}
+
+// defaultOwnershipTags the ownership tags used unless configured otherwise
+var defaultOwnershipTags = ownershipTags{usage: pnapTag, usageValue: pnapValue, cluster: clusterTagName}
+
+// reservedTags tags with a fixed meaning to the CCM, which may not be used as ownership tags
+var reservedTags = []string{serviceNamespaceTag, serviceNameTag, deleteTag, legacyDeleteTag, assignedIPTag, releasedServiceTag, secondaryServiceTag, gatewayTag}
+
+// validateTagName returns an error if name cannot be used as the name of an ownership tag
+func validateTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("tag name must not be empty")
+	}
+	// tag filters on list calls are '<name>.<value>', so the name cannot contain a '.'
+	if strings.ContainsAny(name, ".=:,") {
+		return fmt.Errorf("tag name %q must not contain any of '.', '=', ':' or ','", name)
+	}
+	for _, reserved := range reservedTags {
+		if name == reserved {
+			return fmt.Errorf("tag name %q is reserved", name)
+		}
+	}
+	return nil
+}
+
+// tagCache remembers which tags are known to exist in each account, by its client, so that they are not listed on
+// every call, and so that parallel calls do not try to create the same tag.
+type tagCache struct {
+	mutex sync.Mutex
+	known map[*tagapi.APIClient]map[string]bool
+	// backoff retries failed calls to create the tags
+	backoff wait.Backoff
+}
+
+// ensure ensures that the given tags exist, calling the API only for those not known to exist
+func (c *tagCache) ensure(ctx context.Context, client *tagapi.APIClient, tags ...string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var missing []string
+	for _, tag := range tags {
+		if !c.known[client][tag] {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := ensureTags(ctx, client, c.backoff, missing...); err != nil {
+		return err
+	}
+	if c.known == nil {
+		c.known = map[*tagapi.APIClient]map[string]bool{}
+	}
+	if c.known[client] == nil {
+		c.known[client] = map[string]bool{}
+	}
+	for _, tag := range missing {
+		c.known[client][tag] = true
+	}
+	return nil
+}
+
+// invalidate forgets all known tags, e.g. if one may have been deleted
+func (c *tagCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.known = nil
+}
+
 // ensureTags ensure that the given tags exist.
 // In PhoenixNAP cloud, tag names must exist separately as a resource
 // before they can be assigned to a resource like a server or IP block.
-func ensureTags(client *tagapi.APIClient, tags ...string) error {
+func ensureTags(ctx context.Context, client *tagapi.APIClient, backoff wait.Backoff, tags ...string) error {
 	// rather than trying to create all of them and erroring,
 	// we will get all of the tags that exist already, and find the ones we need
-	retTags, _, err := client.TagsApi.TagsGet(context.Background()).Execute()
-	if err != nil {
+	var retTags []tagapi.Tag
+	if err := retry(ctx, backoff, "getting tags", func() (err error) {
+		var resp *http.Response
+		retTags, resp, err = client.TagsApi.TagsGet(ctx).Execute()
+		return providerError(resp, err)
+	}); err != nil {
 		return fmt.Errorf("unable to get all tags: %w", err)
 	}
 	foundTags := make(map[string]bool)
@@ -30,7 +118,10 @@ func ensureTags(client *tagapi.APIClient, tags ...string) error {
 	// no tags to create, they all already exist
 	for _, tag := range toCreate {
 		tagCreate := tagapi.NewTagCreate(tag, false)
-		if _, _, err := client.TagsApi.TagsPost(context.Background()).TagCreate(*tagCreate).Execute(); err != nil {
+		if err := retry(ctx, backoff, "creating tag "+tag, func() error {
+			_, resp, err := client.TagsApi.TagsPost(ctx).TagCreate(*tagCreate).Execute()
+			return providerError(resp, err)
+		}); err != nil {
 			return fmt.Errorf("unable to create tag %s: %w", tag, err)
 		}
 	}
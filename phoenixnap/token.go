@@ -0,0 +1,95 @@
+package phoenixnap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"k8s.io/klog/v2"
+)
+
+// tokenMonitor is the oauth2.TokenSource of the API clients of an account. It caches the token,
+// refreshes it ahead of its expiry, so that a failed refresh can be retried while the token
+// still is valid, and reports the token lifecycle in metrics.
+type tokenMonitor struct {
+	// fetch fetches a new token from the token endpoint
+	fetch func(ctx context.Context) (*oauth2.Token, error)
+	// clientID identifies the account in metrics and logs
+	clientID string
+	// refreshAhead how long before its expiry the token is refreshed
+	refreshAhead time.Duration
+
+	mutex    sync.Mutex
+	token    *oauth2.Token
+	failures int
+}
+
+func newTokenMonitor(clientID string, fetch func(ctx context.Context) (*oauth2.Token, error)) *tokenMonitor {
+	return &tokenMonitor{fetch: fetch, clientID: clientID, refreshAhead: tokenRefreshAheadSeconds * time.Second}
+}
+
+// Token implements oauth2.TokenSource
+func (m *tokenMonitor) Token() (*oauth2.Token, error) {
+	return m.tokenContext(context.Background())
+}
+
+// tokenContext returns the cached token, refreshing it first if it expires within refreshAhead.
+// If the refresh fails, the cached token is returned as long as it is valid.
+func (m *tokenMonitor) tokenContext(ctx context.Context) (*oauth2.Token, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.token != nil && (m.token.Expiry.IsZero() || time.Until(m.token.Expiry) > m.refreshAhead) {
+		return m.token, nil
+	}
+	token, err := m.fetch(ctx)
+	if err != nil {
+		m.failures++
+		apiTokenRefreshesTotal.WithLabelValues(m.clientID, tokenRefreshFailure).Inc()
+		if m.failures >= tokenRefreshWarnThreshold {
+			klog.Warningf("refreshing the PhoenixNAP API token for client ID %s failed %d times in a row: %v", m.clientID, m.failures, err)
+		}
+		if m.token.Valid() {
+			return m.token, nil
+		}
+		return nil, err
+	}
+	if m.failures >= tokenRefreshWarnThreshold {
+		klog.Infof("refreshed the PhoenixNAP API token for client ID %s after %d failures", m.clientID, m.failures)
+	}
+	m.failures = 0
+	m.token = token
+	apiTokenRefreshesTotal.WithLabelValues(m.clientID, tokenRefreshSuccess).Inc()
+	if !token.Expiry.IsZero() {
+		apiTokenExpiry.WithLabelValues(m.clientID).Set(float64(token.Expiry.Unix()))
+	}
+	return token, nil
+}
+
+// startTokenPrefetch keeps the tokens of all accounts fresh until stop is closed, so that they are
+// refreshed ahead of API calls, and failing refreshes are reported even while no calls are made
+func startTokenPrefetch(wg *sync.WaitGroup, stop <-chan struct{}, monitors []*tokenMonitor) {
+	if len(monitors) == 0 {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(tokenPrefetchSeconds * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			for _, monitor := range monitors {
+				ctx, cancel := context.WithTimeout(context.Background(), tokenPrefetchSeconds*time.Second)
+				// failures are counted and logged by the monitor
+				_, _ = monitor.tokenContext(ctx)
+				cancel()
+			}
+		}
+	}()
+}
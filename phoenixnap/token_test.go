@@ -0,0 +1,96 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestTokenMonitor(t *testing.T) {
+	var (
+		fetches int
+		err     error
+		expiry  time.Time
+	)
+	m := newTokenMonitor("client-token", func(context.Context) (*oauth2.Token, error) {
+		fetches++
+		if err != nil {
+			return nil, err
+		}
+		return &oauth2.Token{AccessToken: "token", Expiry: expiry}, nil
+	})
+	m.refreshAhead = time.Minute
+
+	// the first token is fetched, and cached while it does not expire soon
+	expiry = time.Now().Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := m.Token(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("mismatched fetches, actual %d expected 1", fetches)
+	}
+	if value, _ := testutil.GetGaugeMetricValue(apiTokenExpiry.WithLabelValues("client-token")); value != float64(expiry.Unix()) {
+		t.Errorf("mismatched expiry, actual %v expected %v", value, expiry.Unix())
+	}
+
+	// refreshed ahead of its expiry; a failed refresh still returns the valid token
+	m.token.Expiry = time.Now().Add(30 * time.Second)
+	err = errors.New("token endpoint unavailable")
+	for i := 0; i < tokenRefreshWarnThreshold; i++ {
+		token, err := m.Token()
+		if err != nil || token.AccessToken != "token" {
+			t.Fatalf("%d: expected cached token, got %v, error %v", i, token, err)
+		}
+	}
+	if failures, _ := testutil.GetCounterMetricValue(apiTokenRefreshesTotal.WithLabelValues("client-token", tokenRefreshFailure)); failures != tokenRefreshWarnThreshold {
+		t.Errorf("mismatched refresh failures, actual %v expected %d", failures, tokenRefreshWarnThreshold)
+	}
+
+	// once expired, the error is returned
+	m.token.Expiry = time.Now().Add(-time.Second)
+	if _, err := m.Token(); err == nil {
+		t.Errorf("expected error once the token expired")
+	}
+
+	// a successful refresh resets the failures
+	err = nil
+	if _, err := m.Token(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.failures != 0 {
+		t.Errorf("mismatched failures after refresh, actual %d expected 0", m.failures)
+	}
+	if successes, _ := testutil.GetCounterMetricValue(apiTokenRefreshesTotal.WithLabelValues("client-token", tokenRefreshSuccess)); successes != 2 {
+		t.Errorf("mismatched refreshes, actual %v expected 2", successes)
+	}
+}
+
+func TestStartTokenPrefetch(t *testing.T) {
+	fetched := make(chan struct{}, 1)
+	m := newTokenMonitor("client-prefetch", func(context.Context) (*oauth2.Token, error) {
+		select {
+		case fetched <- struct{}{}:
+		default:
+		}
+		return &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	startTokenPrefetch(&wg, stop, []*tokenMonitor{m})
+	close(stop)
+	// stops without fetching, as the first check is after tokenPrefetchSeconds
+	wg.Wait()
+	select {
+	case <-fetched:
+		t.Errorf("unexpected fetch before the first tick")
+	default:
+	}
+}
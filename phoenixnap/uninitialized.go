@@ -0,0 +1,98 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+)
+
+// uninitializedNode whether node still has the taint that the cloud node controller removes once it
+// initialized the node from InstanceMetadata
+func uninitializedNode(node *v1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == cloudproviderapi.TaintExternalCloudProvider {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnoseUninitialized resolves the server of node as InstanceMetadata does, and explains why the
+// cloud node controller cannot initialize it
+func (i *instances) diagnoseUninitialized(ctx context.Context, node *v1.Node) string {
+	server, err := i.serverByNode(withSubsystem(ctx, subsystemInstances), node)
+	switch {
+	case errors.Is(err, cloudprovider.InstanceNotFound) && node.Spec.ProviderID != "":
+		return fmt.Sprintf("no server with the ID of provider ID %s was found in any account", node.Spec.ProviderID)
+	case errors.Is(err, cloudprovider.InstanceNotFound):
+		return fmt.Sprintf("the node has no provider ID, and no server in any account has the hostname %s; "+
+			"the node name must be the hostname of its server, or the node must have a provider ID", node.Name)
+	case err != nil && node.Spec.ProviderID != "":
+		return fmt.Sprintf("looking up the server of provider ID %s failed with a PhoenixNAP API error of class %s: %v", node.Spec.ProviderID, ReasonForError(err), err)
+	case err != nil:
+		return fmt.Sprintf("looking up the server with hostname %s failed with a PhoenixNAP API error of class %s: %v", node.Name, ReasonForError(err), err)
+	}
+	if _, err := nodeAddresses(*server); err != nil {
+		return fmt.Sprintf("server %s (%s) was found, but its addresses are incomplete: %v", server.Id, server.Hostname, err)
+	}
+	return fmt.Sprintf("server %s (%s) was found with complete addresses; the node should be initialized on the next sync of the cloud node controller", server.Id, server.Hostname)
+}
+
+// diagnoseUninitializedNodes records an Event on each node that has been uninitialized for longer than
+// uninitializedNodeGraceSeconds, with the reason why, and returns the number of uninitialized nodes
+func (i *instances) diagnoseUninitializedNodes(ctx context.Context, now time.Time) (int, error) {
+	nodes, err := i.k8sclient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	var count int
+	for idx := range nodes.Items {
+		node := &nodes.Items[idx]
+		if !uninitializedNode(node) || !i.manages(node) {
+			continue
+		}
+		count++
+		if now.Sub(node.CreationTimestamp.Time) < uninitializedNodeGraceSeconds*time.Second {
+			continue
+		}
+		diagnosis := i.diagnoseUninitialized(ctx, node)
+		klog.Warningf("node %s still has the taint %s: %s", node.Name, cloudproviderapi.TaintExternalCloudProvider, diagnosis)
+		if i.recorder != nil {
+			i.recorder.Eventf(node, v1.EventTypeWarning, eventReasonNodeUninitialized, "node is not initialized by the cloud provider: %s", diagnosis)
+		}
+	}
+	return count, nil
+}
+
+// startUninitializedNodeDiagnostics diagnoses uninitialized nodes every uninitializedNodeCheckSeconds, until stop is closed
+func startUninitializedNodeDiagnostics(wg *sync.WaitGroup, stop <-chan struct{}, i *instances) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := i.clock.NewTicker(uninitializedNodeCheckSeconds * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C():
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), uninitializedNodeCheckSeconds*time.Second)
+			count, err := i.diagnoseUninitializedNodes(ctx, i.clock.Now())
+			cancel()
+			if err != nil {
+				klog.Errorf("unable to diagnose uninitialized nodes: %v", err)
+				continue
+			}
+			uninitializedNodes.Set(float64(count))
+		}
+	}()
+}
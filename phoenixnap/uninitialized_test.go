@@ -0,0 +1,81 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+)
+
+func TestDiagnoseUninitializedNodes(t *testing.T) {
+	vc, backend := testGetValidCloud(t, "")
+	location, _ := testGetOrCreateValidLocation(validLocationName, backend)
+	product, _ := testGetOrCreateValidServerProduct(validProductName, location, backend)
+	server, err := backend.CreateServer(testGetNewServerName(), product.ProductCode, location)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+
+	now := time.Now()
+	uninitialized := func(name, providerID string, age time.Duration) *v1.Node {
+		node := testNode(providerID, name)
+		node.CreationTimestamp = metav1.NewTime(now.Add(-age))
+		node.Spec.Taints = []v1.Taint{{Key: cloudproviderapi.TaintExternalCloudProvider, Value: "true", Effect: v1.TaintEffectNoSchedule}}
+		return node
+	}
+	initialized := testNode(fmt.Sprintf("phoenixnap://%s", server.Id), "initialized")
+	vc.instances.k8sclient = k8sfake.NewSimpleClientset(
+		uninitialized("unknown-name", "", time.Hour),
+		uninitialized("unknown-id", fmt.Sprintf("phoenixnap://%s", randomID), time.Hour),
+		uninitialized("new", "", time.Second),
+		initialized,
+	)
+	recorder := record.NewFakeRecorder(10)
+	vc.instances.recorder = recorder
+
+	count, err := vc.instances.diagnoseUninitializedNodes(context.TODO(), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("mismatched uninitialized nodes, actual %d expected %d", count, 3)
+	}
+	// the new node is within its grace period
+	expected := []string{
+		"no server in any account has the hostname unknown-name",
+		fmt.Sprintf("no server with the ID of provider ID phoenixnap://%s was found", randomID),
+	}
+	if len(recorder.Events) != len(expected) {
+		t.Fatalf("mismatched events, actual %d expected %d", len(recorder.Events), len(expected))
+	}
+	var events []string
+	for range expected {
+		event := <-recorder.Events
+		if !strings.HasPrefix(event, "Warning "+eventReasonNodeUninitialized) {
+			t.Errorf("mismatched event reason, actual %q", event)
+		}
+		events = append(events, event)
+	}
+	for _, message := range expected {
+		var found bool
+		for _, event := range events {
+			found = found || strings.Contains(event, message)
+		}
+		if !found {
+			t.Errorf("no event with %q, actual %v", message, events)
+		}
+	}
+
+	// a node whose server resolves
+	node := uninitialized("resolves", fmt.Sprintf("phoenixnap:///%s/%s", validLocationName, server.Id), time.Hour)
+	if diagnosis := vc.instances.diagnoseUninitialized(context.TODO(), node); !strings.Contains(diagnosis, "server "+server.Id) {
+		t.Errorf("mismatched diagnosis, actual %q", diagnosis)
+	}
+}
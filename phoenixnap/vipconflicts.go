@@ -0,0 +1,81 @@
+package phoenixnap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// The IP of a Service is picked from its IP block by the CCM, but a user may set it with spec.loadBalancerIP, e.g.
+// to keep it across a recreate of the Service, and so may set it to an address of a node, or to the IP of another
+// Service. Announced, such an IP would take traffic from the node or the other Service. The conflict check rejects
+// the IP before it is recorded on the block or passed to the implementation.
+
+const (
+	// vipConflictNode metrics label for a Service IP that is an address of a node
+	vipConflictNode = "node"
+	// vipConflictService metrics label for a Service IP that is the IP of another Service
+	vipConflictService = "service"
+)
+
+// checkVIPConflict returns an error if ip is an address of a node, or the IP of another Service, and reports it in a
+// metric, a log and an Event on the Service
+func (l *loadBalancers) checkVIPConflict(ctx context.Context, svc *v1.Service, ip netip.Addr) error {
+	with, owner, err := l.vipConflict(ctx, svc, ip)
+	if err != nil || with == "" {
+		return err
+	}
+	vipConflictsTotal.WithLabelValues(with).Inc()
+	msg := fmt.Sprintf("IP %s is also the IP of %s %s, not announcing it; set another spec.loadBalancerIP, or none", ip, with, owner)
+	klog.Warningf("service %s: %s", serviceRep(svc), msg)
+	if l.recorder != nil {
+		l.recorder.Event(svc, v1.EventTypeWarning, eventReasonVIPConflict, msg)
+	}
+	return errors.New(msg)
+}
+
+// vipConflict returns what ip conflicts with, vipConflictNode or vipConflictService, and the name of the node or
+// Service, or empty strings if it conflicts with neither
+func (l *loadBalancers) vipConflict(ctx context.Context, svc *v1.Service, ip netip.Addr) (string, string, error) {
+	nodes, err := l.k8sclient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		for _, address := range node.Status.Addresses {
+			if sameIP(address.Address, ip) {
+				return vipConflictNode, node.Name, nil
+			}
+		}
+	}
+	services, err := l.k8sclient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to list services: %w", err)
+	}
+	for i := range services.Items {
+		other := &services.Items[i]
+		if other.Spec.Type != v1.ServiceTypeLoadBalancer || (other.Namespace == svc.Namespace && other.Name == svc.Name) {
+			continue
+		}
+		if sameIP(other.Spec.LoadBalancerIP, ip) {
+			return vipConflictService, serviceRep(other), nil
+		}
+		for _, ingress := range other.Status.LoadBalancer.Ingress {
+			if sameIP(ingress.IP, ip) {
+				return vipConflictService, serviceRep(other), nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// sameIP returns true if address is ip, in any notation
+func sameIP(address string, ip netip.Addr) bool {
+	parsed, err := netip.ParseAddr(address)
+	return err == nil && parsed.Unmap() == ip.Unmap()
+}
@@ -0,0 +1,97 @@
+package phoenixnap
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/phoenixnap/go-sdk-bmc/ipapi"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVIPConflict(t *testing.T) {
+	ip := netip.MustParseAddr("192.0.2.10")
+	node := testNode("phoenixnap://node1", "node1")
+	node.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeExternalIP, Address: "192.0.2.10"}}
+	withSpec := testService("default", "svc2")
+	withSpec.Spec.LoadBalancerIP = "192.0.2.10"
+	withStatus := testService("other", "svc2")
+	withStatus.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "192.0.2.10"}}
+	clusterIP := testService("default", "svc3")
+	clusterIP.Spec.Type = v1.ServiceTypeClusterIP
+	clusterIP.Spec.LoadBalancerIP = "192.0.2.10"
+	self := testService("default", "svc1")
+	self.Spec.LoadBalancerIP = "192.0.2.10"
+
+	tests := []struct {
+		name     string
+		node     *v1.Node
+		services []*v1.Service
+		with     string
+		owner    string
+	}{
+		{"none", nil, nil, "", ""},
+		{"node address", node, nil, vipConflictNode, "node1"},
+		{"other service spec", nil, []*v1.Service{withSpec}, vipConflictService, "default/svc2"},
+		{"other service status", nil, []*v1.Service{withStatus}, vipConflictService, "other/svc2"},
+		{"not a load balancer", nil, []*v1.Service{clusterIP}, "", ""},
+		{"itself", nil, []*v1.Service{self}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _, _ := testGetLoadBalancers(t, 0, tt.services...)
+			if tt.node != nil {
+				if _, err := l.k8sclient.CoreV1().Nodes().Create(context.TODO(), tt.node, metav1.CreateOptions{}); err != nil {
+					t.Fatalf("unable to create node: %v", err)
+				}
+			}
+			with, owner, err := l.vipConflict(context.TODO(), self, ip)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if with != tt.with || owner != tt.owner {
+				t.Errorf("mismatched conflict, actual %q %q expected %q %q", with, owner, tt.with, tt.owner)
+			}
+		})
+	}
+}
+
+func TestEnsureLoadBalancerVIPConflict(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, backend, recorder := testGetLoadBalancers(t, 0, svc)
+	lb := &testRecordingLB{ips: map[string]string{}, nodes: map[string][]string{}}
+	l.implementor = lb
+
+	// a block of the service, whose IP a node already has
+	usageValue, clusterID := l.ownership.usageValue, testClusterID
+	namespace, name := svc.Namespace, svc.Name
+	block, err := backend.CreateIPBlock(validLocationName, 29, []ipapi.TagAssignment{
+		{Name: l.ownership.usage, Value: &usageValue},
+		{Name: l.ownership.cluster, Value: &clusterID},
+		{Name: serviceNamespaceTag, Value: &namespace},
+		{Name: serviceNameTag, Value: &name},
+	})
+	if err != nil {
+		t.Fatalf("unable to create IP block: %v", err)
+	}
+	ip := blockServiceIP(netip.MustParsePrefix(block.Cidr))
+	node := testNode("phoenixnap://node1", "node1")
+	node.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeExternalIP, Address: ip.String()}}
+	if _, err := l.k8sclient.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unable to create node: %v", err)
+	}
+
+	_, err = l.EnsureLoadBalancer(context.TODO(), "", svc, []*v1.Node{node})
+	if err == nil || !strings.Contains(err.Error(), "node node1") {
+		t.Fatalf("expected conflict with node node1, actual %v", err)
+	}
+	if _, ok := lb.ips["default/svc1"]; ok {
+		t.Errorf("conflicting IP passed to the implementation")
+	}
+	if count := testCountEvents(testDrainEvents(recorder), eventReasonVIPConflict); count != 1 {
+		t.Errorf("mismatched %s events, actual %d expected %d", eventReasonVIPConflict, count, 1)
+	}
+}
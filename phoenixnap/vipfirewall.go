@@ -0,0 +1,140 @@
+package phoenixnap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// A VIP answers on every port of the nodes that announce it, not only those of its Service, e.g. sshd or the
+// kubelet, if they listen on all addresses. The PhoenixNAP API has no firewall rules to restrict it, so the CCM
+// publishes the desired rules of each VIP in a ConfigMap instead, for a node-local agent, e.g. a DaemonSet that
+// programs nftables, to allow only the ports of the Service on the VIP, and drop the rest.
+
+// vipFirewallConfigMapName returns the name of the ConfigMap with the firewall rules of the VIP of the service
+func (l *loadBalancers) vipFirewallConfigMapName(service *v1.Service) string {
+	return vipFirewallConfigMapPrefix + loadBalancerName(l.clusterID(), service)
+}
+
+// vipFirewallRules returns the rules allowing the ports of the service, "<protocol> <port>" per line, sorted
+func vipFirewallRules(service *v1.Service) string {
+	var rules []string
+	seen := map[string]bool{}
+	for _, port := range service.Spec.Ports {
+		rule := fmt.Sprintf("%s %d", strings.ToLower(string(port.Protocol)), port.Port)
+		if !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, "\n")
+}
+
+// vipFirewallIP returns the VIP of the service: the IP of its ingress, else its spec, else the one it was added
+// to the implementation with
+func (l *loadBalancers) vipFirewallIP(service *v1.Service, status *v1.LoadBalancerStatus) string {
+	if status != nil {
+		for _, ingress := range status.Ingress {
+			if ingress.IP != "" {
+				return ingress.IP
+			}
+		}
+	}
+	if service.Spec.LoadBalancerIP != "" {
+		return service.Spec.LoadBalancerIP
+	}
+	ip, _, _ := strings.Cut(l.nodeSets.ip(serviceRep(service)), "/")
+	return ip
+}
+
+// ensureVIPFirewall creates or updates the ConfigMap with the firewall rules of the VIP of the service, if enabled
+func (l *loadBalancers) ensureVIPFirewall(ctx context.Context, service *v1.Service, status *v1.LoadBalancerStatus) error {
+	if !l.vipFirewall || externalIPsMode(service) {
+		return nil
+	}
+	ip := l.vipFirewallIP(service, status)
+	if ip == "" {
+		return nil
+	}
+	labels := l.serviceOwnerLabels(service)
+	labels[vipFirewallLabel] = "true"
+	desired := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        l.vipFirewallConfigMapName(service),
+			Namespace:   l.namespace,
+			Labels:      labels,
+			Annotations: map[string]string{auditAnnotationService: serviceRep(service)},
+		},
+		Data: map[string]string{
+			vipFirewallKeyIP:    ip,
+			vipFirewallKeyRules: vipFirewallRules(service),
+		},
+	}
+	if len(service.Spec.LoadBalancerSourceRanges) > 0 {
+		desired.Data[vipFirewallKeySourceRanges] = strings.Join(service.Spec.LoadBalancerSourceRanges, "\n")
+	}
+	configMaps := l.k8sclient.CoreV1().ConfigMaps(l.namespace)
+	existing, err := configMaps.Get(ctx, desired.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := configMaps.Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("unable to create VIP firewall configmap %s: %w", desired.Name, err)
+		}
+		klog.V(2).Infof("created VIP firewall configmap %s for service %s", desired.Name, serviceRep(service))
+		return nil
+	case err != nil:
+		return fmt.Errorf("unable to get VIP firewall configmap %s: %w", desired.Name, err)
+	}
+	labeled := true
+	for k, v := range labels {
+		labeled = labeled && existing.Labels[k] == v
+	}
+	if mapsEqual(existing.Data, desired.Data) && labeled {
+		return nil
+	}
+	existing.Data = desired.Data
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		existing.Labels[k] = v
+	}
+	if _, err := configMaps.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update VIP firewall configmap %s: %w", desired.Name, err)
+	}
+	klog.V(2).Infof("updated VIP firewall configmap %s for service %s", desired.Name, serviceRep(service))
+	return nil
+}
+
+// deleteVIPFirewall deletes the ConfigMap with the firewall rules of the VIP of the service, if enabled
+func (l *loadBalancers) deleteVIPFirewall(ctx context.Context, service *v1.Service) error {
+	if !l.vipFirewall {
+		return nil
+	}
+	name := l.vipFirewallConfigMapName(service)
+	err := l.k8sclient.CoreV1().ConfigMaps(l.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete VIP firewall configmap %s: %w", name, err)
+	}
+	return nil
+}
+
+// mapsEqual returns whether a and b have the same keys and values
+func mapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
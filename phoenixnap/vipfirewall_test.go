@@ -0,0 +1,97 @@
+package phoenixnap
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestVIPFirewallRules(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.Spec.Ports = []v1.ServicePort{
+		{Protocol: v1.ProtocolTCP, Port: 443},
+		{Protocol: v1.ProtocolUDP, Port: 53},
+		{Protocol: v1.ProtocolTCP, Port: 53},
+		{Protocol: v1.ProtocolTCP, Port: 443},
+	}
+	expected := "tcp 443\ntcp 53\nudp 53"
+	if actual := vipFirewallRules(svc); actual != expected {
+		t.Errorf("mismatched rules, actual %q expected %q", actual, expected)
+	}
+}
+
+func TestVIPFirewall(t *testing.T) {
+	svc := testService("default", "svc1")
+	svc.UID = types.UID("1234")
+	svc.Spec.Ports = []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80}}
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+	l.vipFirewall = true
+	l.namespace = "lb-system"
+	ctx := context.TODO()
+	name := l.vipFirewallConfigMapName(svc)
+
+	status, err := l.EnsureLoadBalancer(ctx, "", svc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cm, err := l.k8sclient.CoreV1().ConfigMaps(l.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected VIP firewall configmap: %v", err)
+	}
+	if ip := cm.Data[vipFirewallKeyIP]; ip == "" || ip != status.Ingress[0].IP {
+		t.Errorf("mismatched ip, actual %q expected %q", ip, status.Ingress[0].IP)
+	}
+	if rules := cm.Data[vipFirewallKeyRules]; rules != "tcp 80" {
+		t.Errorf("mismatched rules, actual %q expected %q", rules, "tcp 80")
+	}
+	if _, ok := cm.Data[vipFirewallKeySourceRanges]; ok {
+		t.Errorf("unexpected source ranges without loadBalancerSourceRanges")
+	}
+	if cm.Labels[labelClusterID] != testClusterID || cm.Labels[labelServiceUID] != "1234" {
+		t.Errorf("mismatched owner labels, actual %v", cm.Labels)
+	}
+
+	// the ports change, which the service controller ensures again
+	svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Protocol: v1.ProtocolTCP, Port: 443})
+	svc.Spec.LoadBalancerSourceRanges = []string{"198.51.100.0/24"}
+	if _, err := l.EnsureLoadBalancer(ctx, "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cm, err = l.k8sclient.CoreV1().ConfigMaps(l.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected VIP firewall configmap: %v", err)
+	}
+	if rules := cm.Data[vipFirewallKeyRules]; rules != "tcp 443\ntcp 80" {
+		t.Errorf("mismatched rules, actual %q expected %q", rules, "tcp 443\ntcp 80")
+	}
+	if ranges := cm.Data[vipFirewallKeySourceRanges]; ranges != "198.51.100.0/24" {
+		t.Errorf("mismatched source ranges, actual %q expected %q", ranges, "198.51.100.0/24")
+	}
+
+	if err := l.EnsureLoadBalancerDeleted(ctx, "", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := l.k8sclient.CoreV1().ConfigMaps(l.namespace).Get(ctx, name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected VIP firewall configmap to be deleted, got %v", err)
+	}
+}
+
+func TestVIPFirewallDisabled(t *testing.T) {
+	svc := testService("default", "svc1")
+	l, _, _ := testGetLoadBalancers(t, 0, svc)
+
+	if _, err := l.EnsureLoadBalancer(context.TODO(), "", svc, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	list, err := l.k8sclient.CoreV1().ConfigMaps(l.namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: vipFirewallLabel})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("mismatched VIP firewall configmaps, actual %d expected %d", len(list.Items), 0)
+	}
+}